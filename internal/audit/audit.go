@@ -1,12 +1,22 @@
 package audit
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"dashgate/internal/server"
 )
 
+// AuditEntry is a single audit log row. Hash is an HMAC of the entry and
+// PrevHash, the hash of the entry before it, so editing or deleting a row
+// breaks the chain (see Verify).
 type AuditEntry struct {
 	ID        int    `json:"id"`
 	Timestamp string `json:"timestamp"`
@@ -14,8 +24,15 @@ type AuditEntry struct {
 	Action    string `json:"action"`
 	Detail    string `json:"detail"`
 	IP        string `json:"ip"`
+	PrevHash  string `json:"prevHash"`
+	Hash      string `json:"hash"`
 }
 
+const entryColumns = "id, COALESCE(timestamp, ''), COALESCE(username, ''), COALESCE(action, ''), COALESCE(detail, ''), COALESCE(ip, ''), prev_hash, hash"
+
+// writeMu serialises writes so every entry links to the one before it.
+var writeMu sync.Mutex
+
 func InitAuditTable(app *server.App) error {
 	_, err := app.DB.Exec(`
 		CREATE TABLE IF NOT EXISTS audit_log (
@@ -24,53 +41,156 @@ func InitAuditTable(app *server.App) error {
 			username TEXT,
 			action TEXT,
 			detail TEXT,
-			ip TEXT
+			ip TEXT,
+			prev_hash TEXT NOT NULL DEFAULT '',
+			hash TEXT NOT NULL DEFAULT ''
 		);
 		CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);
 		CREATE INDEX IF NOT EXISTS idx_audit_log_username ON audit_log(username);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	for _, col := range []string{
+		"prev_hash TEXT NOT NULL DEFAULT ''",
+		"hash TEXT NOT NULL DEFAULT ''",
+	} {
+		if _, err := app.DB.Exec("ALTER TABLE audit_log ADD COLUMN " + col); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (audit_log %s): %v", strings.Fields(col)[0], err)
+			}
+		}
+	}
+	return chainExistingEntries(app, loadKey(app))
+}
+
+// chainExistingEntries hashes the entries written before the hash chain
+// existed, or rehashes those chained without a key when the key has just
+// been created. The first only runs while no entry has a hash and the second
+// only while the unkeyed chain is intact, so clearing hashes or deleting the
+// key cannot be used to re-chain an edited log.
+func chainExistingEntries(app *server.App, newKey bool) error {
+	var chained int
+	if err := app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE hash != ''").Scan(&chained); err != nil || (chained > 0 && !newKey) {
+		return err
+	}
+
+	rows, err := app.DB.Query("SELECT " + entryColumns + " FROM audit_log ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanEntry(rows.Scan, &e); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(entries) == 0 {
+		return err
+	}
+	if chained > 0 && !unkeyedChainIntact(entries) {
+		log.Printf("WARNING: the audit log hash chain was already broken; existing entries were not rehashed with the new key")
+		return nil
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	prev := ""
+	for _, e := range entries {
+		e.PrevHash = prev
+		e.Hash = entryHash(app.AuditKey, e)
+		if _, err := tx.Exec("UPDATE audit_log SET prev_hash = ?, hash = ? WHERE id = ?", e.PrevHash, e.Hash, e.ID); err != nil {
+			return err
+		}
+		prev = e.Hash
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if chained > 0 {
+		log.Printf("Rehashed %d audit log entries with the new audit log key", len(entries))
+	} else {
+		log.Printf("Added %d existing audit log entries to the hash chain", len(entries))
+	}
+	return nil
 }
 
 func LogAudit(app *server.App, username, action, detail, ip string) {
 	if app.DB == nil {
 		return
 	}
-	_, err := app.DB.Exec(
-		"INSERT INTO audit_log (timestamp, username, action, detail, ip) VALUES (?, ?, ?, ?, ?)",
-		time.Now().UTC().Format(time.RFC3339), username, action, detail, ip,
-	)
-	if err != nil {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	if err := appendEntry(app, AuditEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Username:  username,
+		Action:    action,
+		Detail:    detail,
+		IP:        ip,
+	}); err != nil {
 		log.Printf("Failed to write audit log: %v", err)
 	}
 }
 
-func GetAuditLogs(app *server.App, limit int) ([]AuditEntry, error) {
-	if limit <= 0 {
-		limit = 100
+func appendEntry(app *server.App, e AuditEntry) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := app.DB.Query(
-		"SELECT id, timestamp, COALESCE(username, ''), COALESCE(action, ''), COALESCE(detail, ''), COALESCE(ip, '') FROM audit_log ORDER BY id DESC LIMIT ?",
-		limit,
-	)
-	if err != nil {
-		return nil, err
+	err = tx.QueryRow("SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	e.Hash = entryHash(app.AuditKey, e)
+	if _, err := tx.Exec(
+		"INSERT INTO audit_log (timestamp, username, action, detail, ip, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		e.Timestamp, e.Username, e.Action, e.Detail, e.IP, e.PrevHash, e.Hash,
+	); err != nil {
+		return err
 	}
-	defer rows.Close()
+	return tx.Commit()
+}
 
-	var entries []AuditEntry
-	for rows.Next() {
-		var e AuditEntry
-		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Username, &e.Action, &e.Detail, &e.IP); err != nil {
-			log.Printf("Error scanning audit log row: %v", err)
-			continue
+// entryHash is the HMAC-SHA256 of the previous hash and the entry's fields,
+// JSON-encoded so that no field can run into the next. The key is kept
+// outside audit_log, so rewriting the log needs more than write access to it.
+func entryHash(key []byte, e AuditEntry) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(entryData(e))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func entryData(e AuditEntry) []byte {
+	data, _ := json.Marshal([]string{e.PrevHash, e.Timestamp, e.Username, e.Action, e.Detail, e.IP})
+	return data
+}
+
+// unkeyedChainIntact reports whether entries form the chain of plain SHA-256
+// hashes written before the chain had a key.
+func unkeyedChainIntact(entries []AuditEntry) bool {
+	prev := ""
+	for _, e := range entries {
+		sum := sha256.Sum256(entryData(e))
+		if e.PrevHash != prev || e.Hash != hex.EncodeToString(sum[:]) {
+			return false
 		}
-		entries = append(entries, e)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		prev = e.Hash
 	}
+	return true
+}
 
-	return entries, nil
+func scanEntry(scan func(...interface{}) error, e *AuditEntry) error {
+	return scan(&e.ID, &e.Timestamp, &e.Username, &e.Action, &e.Detail, &e.IP, &e.PrevHash, &e.Hash)
 }
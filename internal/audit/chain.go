@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// VerifyResult reports whether the audit log's hash chain is intact. Anchor
+// is the PrevHash of the oldest entry: empty unless older entries were
+// removed by the retention policy. HeadHash can be recorded elsewhere to
+// later detect removal of the newest entries, which the chain alone cannot.
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	FirstID  int    `json:"firstId,omitempty"`
+	LastID   int    `json:"lastId,omitempty"`
+	Anchor   string `json:"anchor,omitempty"`
+	HeadHash string `json:"headHash,omitempty"`
+	BrokenAt int    `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify walks the whole log, oldest first, and stops at the first entry
+// that was modified or does not follow the entry before it.
+//
+// Hashes are keyed with app.AuditKey, which is stored encrypted with the
+// system encryption key. When that key comes from ENCRYPTION_KEY, a valid
+// result means nobody without it edited, inserted, reordered or deleted
+// entries, apart from the newest ones (see VerifyResult). A key generated
+// into the database only helps against someone who can write audit_log but
+// not read the rest of the database.
+func Verify(app *server.App) (*VerifyResult, error) {
+	rows, err := app.DB.Query("SELECT " + entryColumns + " FROM audit_log ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &VerifyResult{Valid: true}
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanEntry(rows.Scan, &e); err != nil {
+			return nil, err
+		}
+		if result.Entries == 0 {
+			result.FirstID = e.ID
+			result.Anchor = e.PrevHash
+		} else if e.PrevHash != result.HeadHash {
+			result.Valid, result.BrokenAt = false, e.ID
+			result.Reason = "entry does not follow the one before it; entries were deleted, inserted or reordered"
+			break
+		}
+		if entryHash(app.AuditKey, e) != e.Hash {
+			result.Valid, result.BrokenAt = false, e.ID
+			result.Reason = "entry was modified after it was written"
+			break
+		}
+		result.Entries++
+		result.LastID = e.ID
+		result.HeadHash = e.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Prune deletes entries older than the given number of days and records the
+// removal in the log. Zero or fewer days keeps everything.
+func Prune(app *server.App, days int) (int64, error) {
+	if app.DB == nil || days <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -days)
+	result, err := app.DB.Exec("DELETE FROM audit_log WHERE timestamp < ?", cutoff.Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		LogAudit(app, "", "audit_log_pruned", fmt.Sprintf("Removed %d entries older than %d days (before %s)", n, days, cutoff.Format(time.RFC3339)), "")
+	}
+	return n, nil
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+
+	"dashgate/internal/encryption"
+	"dashgate/internal/server"
+)
+
+// KeyDBKey names the encryption_keys row holding the key of the hash chain,
+// encrypted with the system encryption key so that rotations re-encrypt it.
+const KeyDBKey = "audit_log_key"
+
+// loadKey sets app.AuditKey from the database, creating the key on the
+// first start, and reports whether it was created. The encryption key must
+// already be loaded.
+func loadKey(app *server.App) bool {
+	var stored string
+	err := app.DB.QueryRow("SELECT key_value FROM encryption_keys WHERE key_name = ?", KeyDBKey).Scan(&stored)
+	if err == nil {
+		app.EncryptionMu.RLock()
+		value, err := encryption.DecryptValue(app.EncryptionKey, stored, app.OldEncryptionKeys...)
+		app.EncryptionMu.RUnlock()
+		var key []byte
+		if err == nil {
+			key, err = hex.DecodeString(value)
+		}
+		if err != nil || len(key) != 32 {
+			log.Printf("WARNING: failed to read the audit log key: %v — new entries will not verify until the encryption key is fixed", err)
+			return false
+		}
+		app.AuditKey = key
+		return false
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("WARNING: failed to read the audit log key: %v — new entries will not verify", err)
+		return false
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		log.Printf("WARNING: failed to generate the audit log key: %v — new entries will not verify", err)
+		return false
+	}
+	app.EncryptionMu.RLock()
+	encrypted, err := encryption.EncryptValue(app.EncryptionKey, hex.EncodeToString(key))
+	app.EncryptionMu.RUnlock()
+	if err == nil {
+		_, err = app.DB.Exec("INSERT INTO encryption_keys (key_name, key_value) VALUES (?, ?)", KeyDBKey, encrypted)
+	}
+	if err != nil {
+		log.Printf("WARNING: failed to store the audit log key: %v — new entries will not verify", err)
+		return false
+	}
+	app.AuditKey = key
+	return true
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"strings"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// Filter selects audit log entries. Zero fields match everything.
+type Filter struct {
+	Username string
+	Action   string
+	IP       string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+	BeforeID int       // cursor: only entries older than this ID
+	AfterID  int       // only entries newer than this ID
+}
+
+func (f Filter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.Username != "" {
+		conds = append(conds, "username = ?")
+		args = append(args, f.Username)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, f.IP)
+	}
+	// Timestamps are stored as UTC RFC 3339, which sorts as text
+	if !f.Since.IsZero() {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, f.Until.UTC().Format(time.RFC3339))
+	}
+	if f.BeforeID > 0 {
+		conds = append(conds, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+	if f.AfterID > 0 {
+		conds = append(conds, "id > ?")
+		args = append(args, f.AfterID)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Query returns up to limit entries matching f, newest first, and the
+// cursor for the next page: the BeforeID to ask for, or 0 on the last page.
+func Query(app *server.App, f Filter, limit int) ([]AuditEntry, int, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	where, args := f.where()
+	rows, err := app.DB.Query("SELECT "+entryColumns+" FROM audit_log"+where+" ORDER BY id DESC LIMIT ?", append(args, limit+1)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanEntry(rows.Scan, &e); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	next := 0
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].ID
+	}
+	return entries, next, nil
+}
+
+// eachPageSize is how many entries Each reads at a time.
+const eachPageSize = 500
+
+// Each calls fn for every entry matching f, oldest first, for exports.
+// Entries are read a page at a time and the query is closed before fn
+// runs, so a slow client does not hold the single database connection.
+func Each(app *server.App, f Filter, fn func(AuditEntry) error) error {
+	for {
+		page, err := pageAfter(app, f, eachPageSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range page {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		f.AfterID = page[len(page)-1].ID
+	}
+}
+
+// pageAfter returns up to limit entries matching f, oldest first.
+func pageAfter(app *server.App, f Filter, limit int) ([]AuditEntry, error) {
+	where, args := f.where()
+	rows, err := app.DB.Query("SELECT "+entryColumns+" FROM audit_log"+where+" ORDER BY id LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanEntry(rows.Scan, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
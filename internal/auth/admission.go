@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// AdmissionDeniedMessage is shown to users turned away by the admission rules.
+// It deliberately does not say which rule matched.
+const AdmissionDeniedMessage = "Your account is not allowed to sign in to DashGate. Contact your administrator if you need access."
+
+// AdmissionCandidate describes an externally authenticated user (OIDC or
+// LDAP) before a DashGate account is created or updated for them.
+type AdmissionCandidate struct {
+	Source   string // "ldap", "oidc" or "oidc:{id}"
+	Username string
+	Email    string
+	Groups   []string
+	// Invited is set when the sign-in accepts an invite, which counts as
+	// provisioning the account.
+	Invited bool
+}
+
+// CheckAdmission applies the admission rules to an external sign-in. It
+// returns nil if the user may sign in, or an error naming the rule that
+// rejected them. Deactivated accounts and the deny list always win;
+// allow-listed users skip the other rules, and when the allow list is the
+// only rule, nobody else is admitted.
+func CheckAdmission(app *server.App, c AdmissionCandidate) error {
+	if app.DB != nil && database.IsUserDisabled(app, c.Username) {
+		return fmt.Errorf("account is deactivated")
+	}
+
+	app.SysConfigMu.RLock()
+	domains := splitConfigList(app.SystemConfig.AdmissionEmailDomains)
+	requiredGroups := splitConfigList(app.SystemConfig.AdmissionRequiredGroups)
+	allowList := splitConfigList(app.SystemConfig.AdmissionAllowList)
+	denyList := splitConfigList(app.SystemConfig.AdmissionDenyList)
+	preprovisionedOnly := app.SystemConfig.AdmissionPreprovisionedOnly
+	app.SysConfigMu.RUnlock()
+
+	if matchesAdmissionList(denyList, c.Username, c.Email) {
+		return fmt.Errorf("on the deny list")
+	}
+	if matchesAdmissionList(allowList, c.Username, c.Email) {
+		return nil
+	}
+	if len(allowList) > 0 && len(domains) == 0 && len(requiredGroups) == 0 && !preprovisionedOnly {
+		return fmt.Errorf("not on the allow list")
+	}
+
+	if len(domains) > 0 {
+		_, domain, _ := strings.Cut(strings.ToLower(c.Email), "@")
+		allowed := false
+		for _, d := range domains {
+			if domain != "" && domain == strings.TrimPrefix(d, "@") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("email domain of %q is not allowed", c.Email)
+		}
+	}
+
+	if len(requiredGroups) > 0 {
+		member := false
+		for _, g := range c.Groups {
+			if containsFold(requiredGroups, g) {
+				member = true
+				break
+			}
+		}
+		if !member {
+			return fmt.Errorf("not in any required group")
+		}
+	}
+
+	if preprovisionedOnly && !c.Invited && app.DB != nil {
+		_, err := database.GetUserIDByUsername(app, c.Username)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no pre-provisioned account")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogAdmissionDenied records a rejected sign-in in the audit log.
+func LogAdmissionDenied(app *server.App, r *http.Request, c AdmissionCandidate, reason error) {
+	log.Printf("Sign-in denied for %q via %s: %v", c.Username, c.Source, reason)
+	audit.LogAudit(app, c.Username, "login_denied", fmt.Sprintf("Sign-in via %s denied: %v", c.Source, reason), ClientIP(r))
+}
+
+// splitConfigList splits a comma- or newline-separated list into
+// lowercased entries.
+func splitConfigList(value string) []string {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func matchesAdmissionList(list []string, username, email string) bool {
+	return containsFold(list, username) || (email != "" && containsFold(list, email))
+}
+
+// containsFold reports whether the lowercased list contains value, ignoring case.
+func containsFold(list []string, value string) bool {
+	value = strings.ToLower(value)
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
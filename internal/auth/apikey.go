@@ -2,13 +2,17 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"dashgate/internal/audit"
 	"dashgate/internal/database"
 	"dashgate/internal/models"
+	"dashgate/internal/netpolicy"
 	"dashgate/internal/server"
 
 	"golang.org/x/crypto/bcrypt"
@@ -16,7 +20,8 @@ import (
 
 // GetAPIKeyUser authenticates a request via the Authorization header using
 // an API key (Bearer or ApiKey scheme). It looks up matching keys by prefix,
-// verifies via bcrypt, and returns the associated user.
+// verifies via bcrypt, and returns the associated user. Keys restricted to
+// certain networks do not authenticate from anywhere else.
 func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	app.SysConfigMu.RLock()
 	apiKeyEnabled := app.SystemConfig.APIKeyEnabled
@@ -26,22 +31,76 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		return nil
 	}
 
-	// Check X-API-Key header first, then Authorization header
-	apiKey := r.Header.Get("X-API-Key")
-	if apiKey == "" {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+	matched := lookupAPIKey(app, apiKeyFromRequest(r))
+	if matched == nil {
+		return nil
+	}
+	if matched.allowedNetworks != "" {
+		nets, err := netpolicy.Parse(matched.allowedNetworks)
+		if err != nil || !netpolicy.Contains(nets, net.ParseIP(ClientIP(r))) {
+			log.Printf("API key %q used from %s outside its allowed networks", matched.name, ClientIP(r))
 			return nil
 		}
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			apiKey = strings.TrimPrefix(authHeader, "Bearer ")
-		} else if strings.HasPrefix(authHeader, "ApiKey ") {
-			apiKey = strings.TrimPrefix(authHeader, "ApiKey ")
-		} else {
+	}
+
+	var groups []string
+	if err := json.Unmarshal([]byte(matched.groupsJSON), &groups); err != nil {
+		log.Printf("Error parsing groups JSON: %v", err)
+		groups = []string{}
+	}
+
+	// A personal key is revoked as soon as its owner no longer holds every
+	// group it carries
+	if matched.personal {
+		if reason := database.PersonalAPIKeyOutgrown(app, matched.ownerID, groups); reason != "" {
+			database.DeleteAPIKey(app, matched.id)
+			audit.LogAudit(app, matched.username, "api_key_revoked", fmt.Sprintf("Revoked personal API key %q (id=%d): %s", matched.name, matched.id, reason), ClientIP(r))
 			return nil
 		}
 	}
 
+	// Update last used outside of row iteration to avoid deadlock with SetMaxOpenConns(1)
+	database.UpdateAPIKeyLastUsed(app, matched.id)
+
+	user := &models.AuthenticatedUser{
+		Username:    matched.username,
+		DisplayName: matched.username,
+		Groups:      groups,
+		Source:      "apikey",
+	}
+	user.IsAdmin = CheckIsAdmin(app, user.Groups)
+	return user
+}
+
+// apiKeyFromRequest returns the API key from the X-API-Key header, or from
+// a Bearer or ApiKey Authorization header.
+func apiKeyFromRequest(r *http.Request) string {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		return apiKey
+	}
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return strings.TrimPrefix(authHeader, "ApiKey ")
+	}
+	return ""
+}
+
+// apiKeyMatch is an unexpired API key whose hash matched.
+type apiKeyMatch struct {
+	id              int
+	name            string
+	username        string
+	groupsJSON      string
+	allowedNetworks string
+	personal        bool
+	ownerID         int
+}
+
+// lookupAPIKey finds the unexpired key matching apiKey, or returns nil.
+func lookupAPIKey(app *server.App, apiKey string) *apiKeyMatch {
 	if len(apiKey) < 8 {
 		return nil
 	}
@@ -55,20 +114,17 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	}
 	defer rows.Close()
 
-	type matchedKey struct {
-		id         int
-		username   string
-		groupsJSON string
-	}
-	var matched *matchedKey
+	var matched *apiKeyMatch
 
 	candidatesChecked := 0
 	for rows.Next() {
 		var id int
-		var keyHash, username, groupsJSON, permsJSON string
+		var keyHash, username, groupsJSON, permsJSON, name, allowedNetworks string
 		var expiresAt *time.Time
+		var personal bool
+		var ownerID int
 
-		if err := rows.Scan(&id, &keyHash, &username, &groupsJSON, &permsJSON, &expiresAt); err != nil {
+		if err := rows.Scan(&id, &keyHash, &username, &groupsJSON, &permsJSON, &expiresAt, &name, &allowedNetworks, &personal, &ownerID); err != nil {
 			continue
 		}
 
@@ -89,7 +145,7 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 			continue
 		}
 
-		matched = &matchedKey{id: id, username: username, groupsJSON: groupsJSON}
+		matched = &apiKeyMatch{id: id, name: name, username: username, groupsJSON: groupsJSON, allowedNetworks: allowedNetworks, personal: personal, ownerID: ownerID}
 		break
 	}
 	rows.Close()
@@ -98,26 +154,5 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		log.Printf("Error iterating API key rows: %v", err)
 		return nil
 	}
-
-	if matched == nil {
-		return nil
-	}
-
-	// Update last used outside of row iteration to avoid deadlock with SetMaxOpenConns(1)
-	database.UpdateAPIKeyLastUsed(app, matched.id)
-
-	var groups []string
-	if err := json.Unmarshal([]byte(matched.groupsJSON), &groups); err != nil {
-		log.Printf("Error parsing groups JSON: %v", err)
-		groups = []string{}
-	}
-
-	user := &models.AuthenticatedUser{
-		Username:    matched.username,
-		DisplayName: matched.username,
-		Groups:      groups,
-		Source:      "apikey",
-	}
-	user.IsAdmin = CheckIsAdmin(app, user.Groups)
-	return user
+	return matched
 }
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+	"dashgate/internal/server"
+)
+
+// apiKeyReminderWindow is how long before expiry owners of personal keys are
+// emailed a reminder.
+const apiKeyReminderWindow = 7 * 24 * time.Hour
+
+// StartAPIKeyMaintenanceLoop starts a background goroutine that revokes
+// outgrown personal API keys and sends expiry reminders, once at startup
+// and then hourly. The goroutine stops when the context is cancelled.
+func StartAPIKeyMaintenanceLoop(app *server.App, ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		defer ticker.Stop()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("API key maintenance recovered from panic: %v", r)
+			}
+		}()
+		MaintainPersonalAPIKeys(app)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				MaintainPersonalAPIKeys(app)
+			}
+		}
+	}()
+}
+
+// MaintainPersonalAPIKeys revokes personal keys whose owners were deleted,
+// deactivated or lost one of the key's groups, and emails owners whose keys
+// expire within a week.
+func MaintainPersonalAPIKeys(app *server.App) {
+	if app.DB == nil {
+		return
+	}
+
+	revoked, err := database.RevokeOutgrownAPIKeys(app)
+	if err != nil {
+		log.Printf("Error revoking outgrown API keys: %v", err)
+	}
+	for _, k := range revoked {
+		audit.LogAudit(app, k.Username, "api_key_revoked", fmt.Sprintf("Revoked personal API key %q (id=%d): %s", k.Name, k.ID, k.Reason), "")
+	}
+
+	if !mailer.Configured(app) {
+		return
+	}
+	due, err := database.APIKeysDueForReminder(app, time.Now().Add(apiKeyReminderWindow))
+	if err != nil {
+		log.Printf("Error listing API keys due for reminder: %v", err)
+		return
+	}
+
+	app.SysConfigMu.RLock()
+	settingsURL := strings.TrimRight(app.SystemConfig.PublicURL, "/")
+	app.SysConfigMu.RUnlock()
+	if settingsURL == "" {
+		settingsURL = "DashGate"
+	}
+
+	for _, k := range due {
+		name := k.DisplayName
+		if name == "" {
+			name = k.Username
+		}
+		msg := mailer.Message{
+			To:      k.Email,
+			Subject: fmt.Sprintf("Your DashGate API key %q expires soon", k.Name),
+			Body: fmt.Sprintf("Hello %s,\n\n"+
+				"Your personal API key %q expires on %s.\n"+
+				"To keep using it, rotate it under Settings > Profile in %s and update the apps that use it.\n\n"+
+				"If you no longer need the key, you can ignore this email.\n",
+				name, k.Name, k.ExpiresAt.Format("January 2, 2006"), settingsURL),
+		}
+		if err := mailer.Send(app, msg); err != nil {
+			log.Printf("Error sending API key reminder to %q: %v", k.Username, err)
+			continue
+		}
+		if err := database.MarkAPIKeyReminderSent(app, k.ID); err != nil {
+			log.Printf("Error recording API key reminder: %v", err)
+		}
+	}
+}
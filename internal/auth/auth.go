@@ -16,7 +16,8 @@ const userContextKey contextKey = "user"
 
 // GetAuthenticatedUser resolves the current user from the request using all
 // configured authentication methods, tried in order: API key, proxy headers,
-// then session cookie.
+// then session cookie. Temporary group grants are merged into the groups of
+// proxy and session users.
 func GetAuthenticatedUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	app.SysConfigMu.RLock()
 	proxyAuthEnabled := app.SystemConfig.ProxyAuthEnabled
@@ -31,10 +32,10 @@ func GetAuthenticatedUser(app *server.App, r *http.Request) *models.Authenticate
 		return user
 	}
 
-	// Check proxy headers (Authelia, etc.)
+	// Check proxy headers (Authelia, Authentik, oauth2-proxy, etc.)
 	if proxyAuthEnabled || authMode == models.AuthModeAuthelia || authMode == models.AuthModeHybrid {
-		if user := GetAutheliaUser(app, r); user != nil {
-			return user
+		if user := GetProxyUser(app, r); user != nil {
+			return withGroupGrants(app, user)
 		}
 	}
 
@@ -42,7 +43,7 @@ func GetAuthenticatedUser(app *server.App, r *http.Request) *models.Authenticate
 	if localAuthEnabled || ldapAuthEnabled || oidcAuthEnabled ||
 		authMode == models.AuthModeLocal || authMode == models.AuthModeHybrid {
 		if user := GetLocalUser(app, r); user != nil {
-			return user
+			return withGroupGrants(app, user)
 		}
 	}
 
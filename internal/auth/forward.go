@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"dashgate/internal/discovery"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ProtectedApp is an app DashGate can authorize requests for, resolved from
+// either the YAML catalog or a configured discovered app.
+type ProtectedApp struct {
+	Name   string
+	URL    string
+	Groups []string
+	// Discovered apps without groups are shown to every signed-in user on the
+	// dashboard, whereas catalog apps without groups are admin-only.
+	OpenToAll bool
+}
+
+// FindProtectedApp returns the app whose URL best matches target: same host
+// and port, with the longest matching path prefix.
+func FindProtectedApp(app *server.App, target *url.URL) (*ProtectedApp, bool) {
+	var best *ProtectedApp
+	bestLen := -1
+
+	consider := func(candidate ProtectedApp) {
+		u, err := url.Parse(candidate.URL)
+		if err != nil || u.Host == "" {
+			return
+		}
+		if !sameHost(u, target) {
+			return
+		}
+		prefix := strings.TrimSuffix(u.Path, "/")
+		if prefix != "" && target.Path != prefix && !strings.HasPrefix(target.Path, prefix+"/") {
+			return
+		}
+		if len(prefix) > bestLen {
+			c := candidate
+			best = &c
+			bestLen = len(prefix)
+		}
+	}
+
+	app.ConfigMu.RLock()
+	for _, cat := range app.Config.Categories {
+		for _, a := range cat.Apps {
+			consider(ProtectedApp{Name: a.Name, URL: a.URL, Groups: CatalogAppGroups(app, cat.Name, a)})
+		}
+	}
+	app.ConfigMu.RUnlock()
+
+	for _, d := range discovery.GetAllRawDiscoveredApps(app) {
+		if d.Override == nil || d.Override.Hidden {
+			continue
+		}
+		appURL := d.URL
+		if d.Override.URLOverride != "" {
+			appURL = d.Override.URLOverride
+		}
+		name := d.Name
+		if d.Override.NameOverride != "" {
+			name = d.Override.NameOverride
+		}
+		consider(ProtectedApp{Name: name, URL: appURL, Groups: d.Override.Groups, OpenToAll: len(d.Override.Groups) == 0})
+	}
+
+	return best, best != nil
+}
+
+// CanAccessApp applies the dashboard's visibility rules to an access decision:
+// admins may access everything, otherwise the user needs one of the app's
+// groups. Guests only get apps shared with the anonymous group.
+func CanAccessApp(app *server.App, user *models.AuthenticatedUser, a *ProtectedApp) bool {
+	if user.IsAdmin {
+		return true
+	}
+	if len(a.Groups) == 0 {
+		return a.OpenToAll && !IsGuest(user)
+	}
+	viewerGroups := ViewerGroups(app, user)
+	userGroups := make(map[string]bool, len(viewerGroups))
+	for _, g := range viewerGroups {
+		userGroups[strings.TrimSpace(g)] = true
+	}
+	for _, g := range a.Groups {
+		if userGroups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSafeRedirect reports whether target is an acceptable post-login redirect:
+// either a safe relative path, or an absolute http(s) URL pointing at an app
+// DashGate protects (used when forward auth sends users back to an app).
+func IsSafeRedirect(app *server.App, target string) bool {
+	if isValidRedirect(target) {
+		return true
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	if strings.Contains(target, "\\") {
+		return false
+	}
+	_, ok := FindProtectedApp(app, u)
+	return ok
+}
+
+// sameHost compares hostnames case-insensitively and ports after applying
+// the scheme's default port.
+func sameHost(a, b *url.URL) bool {
+	if !strings.EqualFold(a.Hostname(), b.Hostname()) {
+		return false
+	}
+	return effectivePort(a) == effectivePort(b)
+}
+
+func effectivePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if u.Scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
+
+// ForwardedURL reconstructs the URL the user originally requested from the
+// headers sent by a forward-auth proxy: X-Original-URL (nginx auth_request)
+// or X-Forwarded-Proto/Host/Uri (Traefik ForwardAuth, Caddy forward_auth).
+func ForwardedURL(h func(string) string) (*url.URL, bool) {
+	if original := h("X-Original-URL"); original != "" {
+		u, err := url.Parse(original)
+		if err == nil && u.Host != "" {
+			return u, true
+		}
+	}
+
+	host := h("X-Forwarded-Host")
+	if host == "" {
+		return nil, false
+	}
+	// Only the first value matters if a proxy chain appended several
+	host = strings.TrimSpace(strings.Split(host, ",")[0])
+	if _, _, err := net.SplitHostPort(host); err != nil && strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return nil, false
+	}
+
+	scheme := strings.ToLower(strings.TrimSpace(strings.Split(h("X-Forwarded-Proto"), ",")[0]))
+	if scheme != "http" {
+		scheme = "https"
+	}
+
+	uri := h("X-Forwarded-Uri")
+	if uri == "" {
+		uri = "/"
+	}
+
+	u, err := url.Parse(scheme + "://" + host + uri)
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// withGroupGrants adds the groups a user holds through unexpired temporary
+// grants to user.Groups. API keys keep the groups they were issued with.
+func withGroupGrants(app *server.App, user *models.AuthenticatedUser) *models.AuthenticatedUser {
+	if app.DB == nil {
+		return user
+	}
+	granted, err := database.ActiveGrantedGroups(app, user.Username)
+	if err != nil {
+		log.Printf("Error loading group grants for %q: %v", user.Username, err)
+		return user
+	}
+	for _, g := range granted {
+		held := false
+		for _, existing := range user.Groups {
+			if strings.EqualFold(strings.TrimSpace(existing), g) {
+				held = true
+				break
+			}
+		}
+		if !held {
+			user.Groups = append(user.Groups, g)
+		}
+	}
+	if len(granted) > 0 && !user.IsAdmin {
+		user.IsAdmin = CheckIsAdmin(app, granted)
+	}
+	return user
+}
+
+// StartGroupGrantExpiryLoop starts a background goroutine that removes
+// expired group grants every minute and records each in the audit log.
+// Expired grants stop applying right away; the loop only tidies up. The
+// goroutine stops when the context is cancelled.
+func StartGroupGrantExpiryLoop(app *server.App, ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	go func() {
+		defer ticker.Stop()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Group grant expiry recovered from panic: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ExpireGroupGrants(app)
+			}
+		}
+	}()
+}
+
+// ExpireGroupGrants deletes grants that have run out and audits each one.
+func ExpireGroupGrants(app *server.App) {
+	if app.DB == nil {
+		return
+	}
+	expired, err := database.DeleteExpiredGroupGrants(app)
+	if err != nil {
+		log.Printf("Error expiring group grants: %v", err)
+	}
+	for _, g := range expired {
+		audit.LogAudit(app, g.Username, "group_grant_expired", fmt.Sprintf("Temporary membership of %s expired (granted by %s)", g.Group, g.GrantedBy), "")
+	}
+}
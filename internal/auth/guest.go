@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+
+	"dashgate/internal/config"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// AnonymousGroup is the synthetic group every visitor belongs to while guest
+// mode is on, signed in or not. Apps shared with it are public.
+const AnonymousGroup = "anonymous"
+
+// GuestUser returns the identity of a visitor who is not signed in, or nil
+// when guest mode is off.
+func GuestUser(app *server.App) *models.AuthenticatedUser {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.GuestModeEnabled
+	app.SysConfigMu.RUnlock()
+	if !enabled {
+		return nil
+	}
+	return &models.AuthenticatedUser{
+		DisplayName: "Guest",
+		Groups:      []string{AnonymousGroup},
+		Source:      "guest",
+	}
+}
+
+// IsGuest reports whether user is the synthetic guest from GuestUser.
+func IsGuest(user *models.AuthenticatedUser) bool {
+	return user != nil && user.Source == "guest"
+}
+
+// ViewerGroups returns the groups used to decide which apps user may see:
+// their own groups, plus AnonymousGroup while guest mode is on, so signing
+// in never hides a public app.
+func ViewerGroups(app *server.App, user *models.AuthenticatedUser) []string {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.GuestModeEnabled
+	app.SysConfigMu.RUnlock()
+	if !enabled || IsGuest(user) {
+		return user.Groups
+	}
+	groups := make([]string, 0, len(user.Groups)+1)
+	groups = append(groups, user.Groups...)
+	return append(groups, AnonymousGroup)
+}
+
+// CatalogAppGroups returns the groups allowed to see a catalog app in the
+// given category. Apps in a public guest category are shared with
+// AnonymousGroup on top of their own groups.
+func CatalogAppGroups(app *server.App, category string, a models.App) []string {
+	groups := config.GetAppGroups(app, a)
+	app.SysConfigMu.RLock()
+	public := containsFold(splitConfigList(app.SystemConfig.GuestCategories), strings.TrimSpace(category))
+	app.SysConfigMu.RUnlock()
+	if !public {
+		return groups
+	}
+	return append(append([]string{}, groups...), AnonymousGroup)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// ErrIdentityConflict is returned when an external sign-in carries the
+// username of an existing account it is not linked to.
+var ErrIdentityConflict = errors.New("an account with this username exists and is not linked to this sign-in")
+
+// IdentityConflictMessage is shown to users whose sign-in was refused with
+// ErrIdentityConflict.
+const IdentityConflictMessage = "An account with this username already exists. Sign in to it another way and link this sign-in from your profile."
+
+// ExternalIdentity is a user as asserted by an external provider.
+type ExternalIdentity struct {
+	Provider    string // "ldap", "oidc" or "oidc:{id}"
+	Subject     string // the OIDC "sub" claim or the lowercased LDAP username
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+// externalPasswordHash is the password_hash sentinel of accounts created by
+// sign-ins through the provider.
+func (e ExternalIdentity) externalPasswordHash() string {
+	if e.Provider == "ldap" {
+		return "LDAP_USER"
+	}
+	return "OIDC_USER"
+}
+
+// LinkedUsername returns the username of the account an identity is linked
+// to, or "" if it is not linked yet.
+func LinkedUsername(app *server.App, provider, subject string) string {
+	_, username, err := database.GetIdentityUser(app, provider, subject)
+	if err != nil {
+		return ""
+	}
+	return username
+}
+
+// LDAPSubject is the identity subject of an LDAP account.
+func LDAPSubject(username string) string {
+	return strings.ToLower(username)
+}
+
+// ResolveExternalUser returns the ID of the DashGate user an external
+// sign-in belongs to and, for accounts the provider owns, refreshes the
+// profile from the provider.
+//
+// A linked identity always signs in to its own account. An unlinked one
+// gets a new account, or adopts an existing account with the same username
+// only if that account was created by the same provider (or by
+// provisioning) and has no identity yet. Unlinked OIDC accounts from before
+// identities were recorded can only be adopted by the primary OIDC provider.
+// Any other username match returns ErrIdentityConflict: the account must be
+// linked explicitly.
+func ResolveExternalUser(app *server.App, ext ExternalIdentity) (int, error) {
+	groupsJSON, _ := json.Marshal(ext.Groups)
+
+	userID, _, err := database.GetIdentityUser(app, ext.Provider, ext.Subject)
+	if err == nil {
+		owned, err := ownsProfile(app, userID, ext)
+		if err != nil {
+			return 0, err
+		}
+		if owned {
+			if err := database.SyncExternalUser(app, userID, ext.Email, ext.DisplayName, string(groupsJSON)); err != nil {
+				return 0, err
+			}
+		}
+		database.TouchIdentity(app, ext.Provider, ext.Subject, ext.Email)
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	existing, err := database.GetUserByUsername(app, ext.Username)
+	if err == sql.ErrNoRows {
+		return database.CreateExternalUser(app, ext.Username, ext.Email, ext.DisplayName, string(groupsJSON), ext.externalPasswordHash(), ext.Provider, ext.Subject)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Provisioned accounts are waiting for whichever provider signs in first.
+	// An unlinked OIDC account does not record which provider created it, so
+	// only the primary one may adopt it
+	adoptable := existing.PasswordHash == database.ProvisionedPasswordHash ||
+		(existing.PasswordHash == ext.externalPasswordHash() && (ext.Provider == "ldap" || ext.Provider == "oidc"))
+	if !adoptable {
+		return 0, ErrIdentityConflict
+	}
+	if n, err := database.CountUserIdentities(app, existing.ID); err != nil {
+		return 0, err
+	} else if n > 0 {
+		return 0, ErrIdentityConflict
+	}
+
+	if err := database.LinkIdentity(app, existing.ID, ext.Provider, ext.Subject, ext.Email); err != nil {
+		return 0, err
+	}
+	if err := database.SyncExternalUser(app, existing.ID, ext.Email, ext.DisplayName, string(groupsJSON)); err != nil {
+		return 0, err
+	}
+	database.TouchIdentity(app, ext.Provider, ext.Subject, ext.Email)
+	return existing.ID, nil
+}
+
+// ownsProfile reports whether a sign-in through ext keeps the profile of
+// the account it is linked to in step with the provider. Only the identity
+// that created or adopted an external or provisioned account does; the
+// groups, email and display name of accounts it was linked to explicitly are
+// left alone.
+func ownsProfile(app *server.App, userID int, ext ExternalIdentity) (bool, error) {
+	user, err := database.GetUserByID(app, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.PasswordHash != ext.externalPasswordHash() && user.PasswordHash != database.ProvisionedPasswordHash {
+		return false, nil
+	}
+	provider, subject, err := database.GetPrimaryIdentity(app, userID)
+	if err != nil {
+		return false, err
+	}
+	return provider == ext.Provider && subject == ext.Subject, nil
+}
+
+// LogIdentityConflict records a sign-in refused by the conflict policy.
+func LogIdentityConflict(app *server.App, r *http.Request, ext ExternalIdentity) {
+	log.Printf("Sign-in via %s refused: username %q belongs to an unlinked account", ext.Provider, ext.Username)
+	audit.LogAudit(app, ext.Username, "identity_conflict", fmt.Sprintf("Sign-in via %s (subject %s) refused: account is not linked", ext.Provider, ext.Subject), ClientIP(r))
+}
@@ -4,12 +4,24 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 
 	"dashgate/internal/database"
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
+// GetSessionUser authenticates the user only from DashGate's own session
+// cookie, with temporary group grants added. Unlike GetAuthenticatedUser it
+// never trusts proxy headers or API keys, for endpoints such as forward auth
+// that answer for requests whose headers the client controls.
+func GetSessionUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
+	if user := GetLocalUser(app, r); user != nil {
+		return withGroupGrants(app, user)
+	}
+	return nil
+}
+
 // GetLocalUser authenticates the user via a session cookie stored in the
 // local SQLite database. Returns nil if no valid session is found.
 func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
@@ -26,6 +38,7 @@ func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	if err != nil {
 		return nil
 	}
+	database.TouchSession(app, cookie.Value)
 	username := su.Username
 	email := su.Email
 	displayName := su.DisplayName
@@ -55,6 +68,10 @@ func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		source = "ldap"
 	case "OIDC_USER":
 		source = "oidc"
+		// Record which OIDC provider this session signed in with
+		if strings.HasPrefix(su.AuthSource, "oidc:") {
+			source = su.AuthSource
+		}
 	}
 
 	user := &models.AuthenticatedUser{
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// IsAccountLocked reports whether username is temporarily locked out after
+// too many failed logins.
+func IsAccountLocked(app *server.App, username string) bool {
+	lockedUntil, err := database.GetLockedUntil(app, username)
+	if err != nil {
+		log.Printf("Error checking account lockout: %v", err)
+		return false
+	}
+	return lockedUntil != nil
+}
+
+// RecordLoginFailure counts a failed login for username and locks the account
+// once the configured threshold is reached.
+func RecordLoginFailure(app *server.App, r *http.Request, username string) {
+	app.SysConfigMu.RLock()
+	threshold := app.SystemConfig.LockoutThreshold
+	minutes := app.SystemConfig.LockoutMinutes
+	app.SysConfigMu.RUnlock()
+
+	if threshold <= 0 {
+		return
+	}
+	if minutes <= 0 {
+		minutes = 15
+	}
+
+	lockedUntil, err := database.RecordFailedLogin(app, username, threshold, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		log.Printf("Error recording failed login: %v", err)
+		return
+	}
+	if lockedUntil != nil {
+		log.Printf("Account %q locked until %s after %d failed logins", username, lockedUntil.Format(time.RFC3339), threshold)
+		audit.LogAudit(app, username, "account_locked", fmt.Sprintf("Locked for %d minutes after %d failed logins", minutes, threshold), ClientIP(r))
+	}
+}
+
+// RecordLoginSuccess clears the failed login count for username.
+func RecordLoginSuccess(app *server.App, username string) {
+	database.ClearLoginAttempts(app, username)
+}
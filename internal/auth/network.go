@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/database"
+	"dashgate/internal/netpolicy"
+	"dashgate/internal/server"
+)
+
+const clientIPContextKey contextKey = "client_ip"
+
+// NetworkDenial names the policy that refused a request.
+type NetworkDenial struct {
+	Kind   string // "route", "group" or "apikey"
+	Target string
+}
+
+// ResolveClientIP returns the address of the client behind any trusted
+// proxies. X-Forwarded-For is walked from the right, skipping addresses of
+// trusted proxies, and the first untrusted address is the client. Requests
+// that do not come from a trusted proxy use the connection address, so the
+// header cannot be spoofed by connecting directly.
+func ResolveClientIP(app *server.App, r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !isTrustedProxyIP(app, net.ParseIP(ip)) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop.String()
+		if !isTrustedProxyIP(app, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// WithClientIP returns a copy of r that carries the resolved client IP for
+// ClientIP.
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPContextKey, ip))
+}
+
+func isTrustedProxyIP(app *server.App, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	if netpolicy.Contains(app.TrustedProxyNets, ip) {
+		return true
+	}
+	for _, trusted := range app.TrustedProxyIPs {
+		if trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteNetworkDenial returns the route policy that refuses path from ip, or
+// nil. A policy matches its target path and everything below it.
+func RouteNetworkDenial(app *server.App, path string, ip net.IP) *NetworkDenial {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	for _, p := range app.NetworkPolicies {
+		if p.Kind == "route" && RouteMatches(p.Target, path) && !netpolicy.Contains(p.Networks, ip) {
+			return &NetworkDenial{Kind: p.Kind, Target: p.Target}
+		}
+	}
+	return nil
+}
+
+// GroupNetworkDenial returns the policy of one of the groups that refuses
+// its members from ip, or nil. Every policy of every group the user is in
+// must allow the address.
+func GroupNetworkDenial(app *server.App, groups []string, ip net.IP) *NetworkDenial {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	for _, p := range app.NetworkPolicies {
+		if p.Kind != "group" || netpolicy.Contains(p.Networks, ip) {
+			continue
+		}
+		for _, g := range groups {
+			if strings.EqualFold(g, p.Target) {
+				return &NetworkDenial{Kind: p.Kind, Target: p.Target}
+			}
+		}
+	}
+	return nil
+}
+
+// HasGroupNetworkPolicies reports whether any group policy is configured, so
+// requests only need to be authenticated early when one is.
+func HasGroupNetworkPolicies(app *server.App) bool {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	for _, p := range app.NetworkPolicies {
+		if p.Kind == "group" {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyNetworkDenial returns a denial if the request carries an API key
+// that is restricted to networks ip is not in. Keys without restrictions are
+// not looked up, so unrestricted keys cost nothing extra here.
+func APIKeyNetworkDenial(app *server.App, r *http.Request, ip net.IP) *NetworkDenial {
+	apiKey := apiKeyFromRequest(r)
+	if len(apiKey) < 8 || app.DB == nil || !database.HasNetworkRestrictedAPIKeys(app, apiKey[:8]) {
+		return nil
+	}
+	key := lookupAPIKey(app, apiKey)
+	if key == nil || key.allowedNetworks == "" {
+		return nil
+	}
+	if nets, err := netpolicy.Parse(key.allowedNetworks); err == nil && netpolicy.Contains(nets, ip) {
+		return nil
+	}
+	return &NetworkDenial{Kind: "apikey", Target: key.name}
+}
+
+// RouteMatches reports whether a route policy target covers path. A target
+// ending in "/" matches by prefix; otherwise the path itself and everything
+// below it match.
+func RouteMatches(target, path string) bool {
+	if strings.HasSuffix(target, "/") {
+		return strings.HasPrefix(path, target)
+	}
+	return path == target || strings.HasPrefix(path, target+"/")
+}
@@ -3,17 +3,20 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
-	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
-	"time"
 
+	"dashgate/internal/audit"
 	"dashgate/internal/database"
 	"dashgate/internal/server"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
 )
 
 // isValidRedirect checks that a redirect URL is a safe relative path.
@@ -35,210 +38,453 @@ func isValidRedirect(url string) bool {
 	return true
 }
 
-// OIDCAuthHandler initiates the OIDC authorization code flow by generating a
-// state parameter and redirecting the user to the OIDC provider.
-func OIDCAuthHandler(app *server.App) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		app.SysConfigMu.RLock()
-		oidcEnabled := app.SystemConfig.OIDCAuthEnabled
-		oauth2Config := app.OAuth2Config
-		app.SysConfigMu.RUnlock()
-
-		if !oidcEnabled || oauth2Config == nil {
-			http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
-			return
-		}
+// GetOIDCClient returns the OIDC provider with the given ID, or nil if it is
+// not configured. The primary provider from the system settings has the ID "".
+func GetOIDCClient(app *server.App, id string) *server.OIDCClient {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
 
-		// Generate state
-		stateBytes := make([]byte, 16)
-		if _, err := rand.Read(stateBytes); err != nil {
-			log.Printf("Failed to generate OIDC state: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+	if !app.SystemConfig.OIDCAuthEnabled {
+		return nil
+	}
+	if id == "" {
+		if app.OIDCProvider == nil || app.OAuth2Config == nil {
+			return nil
 		}
-		state := base64.URLEncoding.EncodeToString(stateBytes)
-
-		// Store state with redirect URL
-		redirectURL := r.URL.Query().Get("redirect")
-		if !isValidRedirect(redirectURL) {
-			redirectURL = "/"
+		return &server.OIDCClient{
+			DisplayName:  app.SystemConfig.OIDCDisplayName,
+			Provider:     app.OIDCProvider,
+			OAuth2:       app.OAuth2Config,
+			GroupsClaim:  app.SystemConfig.OIDCGroupsClaim,
+			GroupMapping: app.SystemConfig.OIDCGroupMapping,
 		}
-
-		if app.DB != nil {
-			if err := database.CreateOIDCState(app, state, redirectURL); err != nil {
-				log.Printf("Failed to store OIDC state: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			// Clean up old states (best-effort)
-			database.CleanOldOIDCStates(app)
+	}
+	for _, c := range app.OIDCProviders {
+		if c.ID == id {
+			return c
 		}
+	}
+	return nil
+}
 
-		// Redirect to OIDC provider
-		authURL := oauth2Config.AuthCodeURL(state)
-		http.Redirect(w, r, authURL, http.StatusFound)
+// OIDCAuthSource returns the session auth source for logins through client:
+// "oidc" for the primary provider and "oidc:{id}" for additional ones.
+func OIDCAuthSource(client *server.OIDCClient) string {
+	if client.ID == "" {
+		return "oidc"
 	}
+	return "oidc:" + client.ID
 }
 
-// OIDCCallbackHandler handles the OIDC provider callback, exchanging the
-// authorization code for tokens, verifying the ID token, extracting user
-// claims, and creating a local session.
-func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
+// OIDCAuthHandler initiates the OIDC authorization code flow with the primary
+// provider.
+func OIDCAuthHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		app.SysConfigMu.RLock()
-		oidcEnabled := app.SystemConfig.OIDCAuthEnabled
-		oauth2Config := app.OAuth2Config
-		oidcProvider := app.OIDCProvider
-		app.SysConfigMu.RUnlock()
-
-		if !oidcEnabled || oauth2Config == nil || oidcProvider == nil {
-			http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
-			return
-		}
+		startOIDCLogin(app, w, r, GetOIDCClient(app, ""))
+	}
+}
 
-		// Verify state
-		state := r.URL.Query().Get("state")
-		var redirectURL string
-		if app.DB == nil {
-			http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
+// OIDCProviderHandler serves the login (/auth/oidc/{id}) and callback
+// (/auth/oidc/{id}/callback) routes of the additional OIDC providers.
+func OIDCProviderHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/auth/oidc/")
+		id, action, _ := strings.Cut(rest, "/")
+		if id == "" || (action != "" && action != "callback") {
+			http.NotFound(w, r)
 			return
 		}
-		redirectURL, err := database.GetOIDCState(app, state)
-		if err != nil {
-			http.Error(w, "Invalid state", http.StatusBadRequest)
+		client := GetOIDCClient(app, id)
+		if client == nil {
+			http.Error(w, "OIDC provider not configured", http.StatusNotFound)
 			return
 		}
-		database.DeleteOIDCState(app, state)
-		if !isValidRedirect(redirectURL) {
-			redirectURL = "/"
+		if action == "callback" {
+			finishOIDCLogin(app, w, r, client)
+		} else {
+			startOIDCLogin(app, w, r, client)
 		}
+	}
+}
 
-		// Check for error from provider
-		if errMsg := r.URL.Query().Get("error"); errMsg != "" {
-			errDesc := r.URL.Query().Get("error_description")
-			log.Printf("OIDC error: %s - %s", errMsg, errDesc)
-			http.Error(w, "Authentication failed", http.StatusUnauthorized)
-			return
-		}
+// startOIDCLogin generates a state parameter, a PKCE verifier and a nonce, and
+// redirects the user to the provider.
+func startOIDCLogin(app *server.App, w http.ResponseWriter, r *http.Request, client *server.OIDCClient) {
+	if client == nil {
+		http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if app.DB == nil {
+		http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
-		// Exchange code for token
-		code := r.URL.Query().Get("code")
-		ctx := context.Background()
-		token, err := oauth2Config.Exchange(ctx, code)
-		if err != nil {
-			log.Printf("OIDC token exchange failed: %v", err)
-			http.Error(w, "Token exchange failed", http.StatusInternalServerError)
-			return
-		}
+	// Generate state and nonce
+	state, err := randomURLToken()
+	if err != nil {
+		log.Printf("Failed to generate OIDC state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		log.Printf("Failed to generate OIDC nonce: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	login := database.OIDCLogin{
+		RedirectURL:  r.URL.Query().Get("redirect"),
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		ProviderID:   client.ID,
+	}
+	if !IsSafeRedirect(app, login.RedirectURL) {
+		login.RedirectURL = "/"
+	}
 
-		// Verify ID token
-		verifier := oidcProvider.Verifier(&oidc.Config{ClientID: oauth2Config.ClientID})
-		rawIDToken, ok := token.Extra("id_token").(string)
-		if !ok {
-			http.Error(w, "No ID token in response", http.StatusInternalServerError)
+	// A signed-in user can link this provider to their account
+	if r.URL.Query().Get("link") == "1" {
+		su := sessionUser(app, r)
+		if su == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
 			return
 		}
+		login.LinkUserID = su.ID
+		login.RedirectURL = "/"
+	}
 
-		idToken, err := verifier.Verify(ctx, rawIDToken)
+	// An invite link can be accepted by signing in with OIDC
+	if inviteToken := r.URL.Query().Get("invite"); inviteToken != "" {
+		invite, err := database.GetInviteByToken(app, inviteToken)
 		if err != nil {
-			log.Printf("OIDC token verification failed: %v", err)
-			http.Error(w, "Token verification failed", http.StatusUnauthorized)
+			http.Error(w, "This invite link is invalid or has expired", http.StatusBadRequest)
 			return
 		}
+		login.InviteID = invite.ID
+	}
 
-		// Extract claims
-		var claims struct {
-			Subject           string   `json:"sub"`
-			Email             string   `json:"email"`
-			Name              string   `json:"name"`
-			PreferredUsername string   `json:"preferred_username"`
-			Groups            []string `json:"groups"`
-		}
-		if err := idToken.Claims(&claims); err != nil {
-			log.Printf("Failed to parse OIDC claims: %v", err)
-			http.Error(w, "Failed to parse claims", http.StatusInternalServerError)
-			return
-		}
+	if err := database.CreateOIDCState(app, state, login); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Clean up old states (best-effort)
+	database.CleanOldOIDCStates(app)
 
-		// Also try to get groups from custom claim
-		var rawClaims map[string]interface{}
-		if err := idToken.Claims(&rawClaims); err != nil {
-			log.Printf("Failed to parse raw OIDC claims: %v", err)
-		}
-		app.SysConfigMu.RLock()
-		groupsClaimName := app.SystemConfig.OIDCGroupsClaim
-		app.SysConfigMu.RUnlock()
-		if groupsClaim, ok := rawClaims[groupsClaimName]; ok {
-			switch g := groupsClaim.(type) {
-			case []interface{}:
-				for _, v := range g {
-					if s, ok := v.(string); ok {
-						claims.Groups = append(claims.Groups, s)
-					}
-				}
-			case []string:
-				claims.Groups = g
+	// Redirect to OIDC provider
+	authURL := client.OAuth2.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(login.CodeVerifier),
+		oidc.Nonce(login.Nonce),
+	)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler handles the primary provider's callback.
+func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		finishOIDCLogin(app, w, r, GetOIDCClient(app, ""))
+	}
+}
+
+// finishOIDCLogin exchanges the authorization code for tokens, verifies the
+// ID token and its nonce, extracts user claims (falling back to the userinfo
+// endpoint), maps the provider's groups, and creates a local session.
+func finishOIDCLogin(app *server.App, w http.ResponseWriter, r *http.Request, client *server.OIDCClient) {
+	if client == nil {
+		http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
+		return
+	}
+	oauth2Config := client.OAuth2
+	oidcProvider := client.Provider
+	groupsClaimName := client.GroupsClaim
+
+	// Verify state
+	state := r.URL.Query().Get("state")
+	if app.DB == nil {
+		http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	login, err := database.GetOIDCState(app, state)
+	if err != nil {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	database.DeleteOIDCState(app, state)
+	if login.ProviderID != client.ID {
+		log.Printf("OIDC state for provider %q used at the callback of %q", login.ProviderID, client.ID)
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	redirectURL := login.RedirectURL
+	if !IsSafeRedirect(app, redirectURL) {
+		redirectURL = "/"
+	}
+	inviteID := login.InviteID
+
+	// Check for error from provider
+	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+		errDesc := r.URL.Query().Get("error_description")
+		log.Printf("OIDC error: %s - %s", errMsg, errDesc)
+		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	// Exchange code for token, proving we started this login
+	code := r.URL.Query().Get("code")
+	ctx := context.Background()
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		log.Printf("OIDC token exchange failed: %v", err)
+		http.Error(w, "Token exchange failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Verify ID token
+	verifier := oidcProvider.Verifier(&oidc.Config{ClientID: oauth2Config.ClientID})
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "No ID token in response", http.StatusInternalServerError)
+		return
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("OIDC token verification failed: %v", err)
+		http.Error(w, "Token verification failed", http.StatusUnauthorized)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(login.Nonce)) != 1 {
+		log.Printf("OIDC nonce mismatch for subject %q", idToken.Subject)
+		http.Error(w, "Token verification failed", http.StatusUnauthorized)
+		return
+	}
+
+	// Extract claims
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		log.Printf("Failed to parse OIDC claims: %v", err)
+		http.Error(w, "Failed to parse claims", http.StatusInternalServerError)
+		return
+	}
+
+	// Some providers only put groups (or profile details) in userinfo
+	if NeedsUserInfo(rawClaims, groupsClaimName) && oidcProvider.UserInfoEndpoint() != "" {
+		if info, err := oidcProvider.UserInfo(ctx, oauth2.StaticTokenSource(token)); err != nil {
+			log.Printf("OIDC userinfo request failed: %v", err)
+		} else if info.Subject != idToken.Subject {
+			log.Printf("OIDC userinfo subject %q does not match ID token subject %q", info.Subject, idToken.Subject)
+		} else {
+			var infoClaims map[string]interface{}
+			if err := info.Claims(&infoClaims); err != nil {
+				log.Printf("Failed to parse OIDC userinfo claims: %v", err)
+			} else {
+				MergeMissingClaims(rawClaims, infoClaims)
 			}
 		}
+	}
 
-		// Determine username
-		username := claims.PreferredUsername
-		if username == "" {
-			username = claims.Email
-		}
-		if username == "" {
-			username = claims.Subject
-		}
+	claims := ParseOIDCClaims(rawClaims, groupsClaimName)
+	claims.Groups = ApplyGroupMapping(claims.Groups, client.GroupMapping)
+	provider := OIDCAuthSource(client)
 
-		displayName := claims.Name
-		if displayName == "" {
-			displayName = username
-		}
+	if login.LinkUserID != 0 {
+		finishOIDCLink(app, w, r, login.LinkUserID, provider, claims)
+		return
+	}
+
+	// Determine username
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+	// A linked identity signs in to its account whatever username the
+	// provider sends now
+	if linked := LinkedUsername(app, provider, claims.Subject); linked != "" {
+		username = linked
+	}
 
-		// Create or update user in database using upsert to avoid race conditions
-		var userID int
-		groupsJSON, _ := json.Marshal(claims.Groups)
-		if err := database.UpsertOIDCUser(app, username, claims.Email, displayName, string(groupsJSON)); err != nil {
-			log.Printf("Failed to upsert OIDC user: %v", err)
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	displayName := claims.Name
+	if displayName == "" {
+		displayName = username
+	}
+
+	// An invite bound to an email address can only be accepted by that address
+	if inviteID != 0 {
+		invite, err := database.GetInviteByID(app, inviteID)
+		if err != nil || invite.Status != "pending" {
+			http.Error(w, "This invite link is invalid or has expired", http.StatusBadRequest)
 			return
 		}
-		userID, err = database.GetUserIDByUsername(app, username)
-		if err != nil {
-			log.Printf("Failed to retrieve OIDC user ID: %v", err)
-			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		if invite.Email != "" && !strings.EqualFold(invite.Email, claims.Email) {
+			http.Error(w, "This invite is for a different email address", http.StatusForbidden)
 			return
 		}
+	}
 
-		// Invalidate any existing sessions for this user to prevent session fixation
-		database.InvalidateUserSessions(app, userID)
+	// Keep groups DashGate has granted (e.g. via an invite) on top of the
+	// provider's groups
+	if granted, err := database.GetGrantedGroups(app, username); err != nil {
+		log.Printf("Failed to load granted groups: %v", err)
+	} else {
+		claims.Groups = database.MergeGroups(claims.Groups, granted)
+	}
 
-		// Create session
-		sessionToken, err := GenerateSessionToken()
-		if err != nil {
-			log.Printf("Error generating session token: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	candidate := AdmissionCandidate{
+		Source:   provider,
+		Username: username,
+		Email:    claims.Email,
+		Groups:   claims.Groups,
+		Invited:  inviteID != 0,
+	}
+	if err := CheckAdmission(app, candidate); err != nil {
+		LogAdmissionDenied(app, r, candidate, err)
+		http.Redirect(w, r, "/login?error=access_denied", http.StatusFound)
+		return
+	}
+
+	ext := ExternalIdentity{
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Username:    username,
+		Email:       claims.Email,
+		DisplayName: displayName,
+		Groups:      claims.Groups,
+	}
+	userID, err := ResolveExternalUser(app, ext)
+	if err == ErrIdentityConflict {
+		LogIdentityConflict(app, r, ext)
+		http.Redirect(w, r, "/login?error=account_link_required", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to resolve OIDC user: %v", err)
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	if inviteID != 0 {
+		inviteGroups, err := database.AcceptInviteForUser(app, inviteID, username)
+		if err == database.ErrInviteInvalid {
+			http.Error(w, "This invite link is invalid or has expired", http.StatusBadRequest)
 			return
 		}
-
-		expiresAt := time.Now().Add(time.Duration(app.AuthConfig.SessionDuration) * 24 * time.Hour)
-		if err := database.CreateSession(app, userID, sessionToken, expiresAt); err != nil {
-			log.Printf("Error creating session: %v", err)
+		if err != nil {
+			log.Printf("Failed to accept invite: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		for _, g := range inviteGroups {
+			if err := database.SetUserGroupMembership(app, userID, g, true); err != nil {
+				log.Printf("Failed to add invite group: %v", err)
+				http.Error(w, "Failed to create user", http.StatusInternalServerError)
+				return
+			}
+		}
+		audit.LogAudit(app, username, "invite_accepted", fmt.Sprintf("Accepted invite id=%d with OIDC", inviteID), ClientIP(r))
+	}
+
+	if err := StartOIDCSession(app, w, r, userID, provider, rawIDToken); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// finishOIDCLink links the identity a signed-in user just proved to their
+// account instead of starting a new session. The user is sent back to the
+// dashboard with ?identity=linked, or ?identity=conflict if the identity
+// already belongs to someone else.
+func finishOIDCLink(app *server.App, w http.ResponseWriter, r *http.Request, userID int, provider string, claims OIDCClaims) {
+	su := sessionUser(app, r)
+	if su == nil || su.ID != userID {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	err := database.LinkIdentity(app, userID, provider, claims.Subject, claims.Email)
+	if err == database.ErrIdentityLinked {
+		audit.LogAudit(app, su.Username, "identity_conflict", fmt.Sprintf("Linking %s (subject %s) refused: linked to another account", provider, claims.Subject), ClientIP(r))
+		http.Redirect(w, r, "/?identity=conflict", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to link identity: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	audit.LogAudit(app, su.Username, "identity_linked", fmt.Sprintf("Linked %s (subject %s)", provider, claims.Subject), ClientIP(r))
+	http.Redirect(w, r, "/?identity=linked", http.StatusFound)
+}
+
+// sessionUser returns the user of the request's DashGate session, or nil.
+func sessionUser(app *server.App, r *http.Request) *database.SessionUser {
+	cookie, err := r.Cookie(app.AuthConfig.CookieName)
+	if err != nil {
+		return nil
+	}
+	su, err := database.GetUserBySession(app, cookie.Value)
+	if err != nil {
+		return nil
+	}
+	return su
+}
+
+// OIDCLogoutURL returns the provider's end-session URL for a session with the
+// given OIDC auth source when RP-initiated logout is enabled, or "" if the
+// user should simply be sent back to the login page.
+func OIDCLogoutURL(app *server.App, authSource, idToken string) string {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.OIDCLogoutEnabled
+	publicURL := app.SystemConfig.PublicURL
+	app.SysConfigMu.RUnlock()
+
+	if !enabled {
+		return ""
+	}
+	var client *server.OIDCClient
+	switch {
+	case authSource == "oidc":
+		client = GetOIDCClient(app, "")
+	case strings.HasPrefix(authSource, "oidc:"):
+		client = GetOIDCClient(app, strings.TrimPrefix(authSource, "oidc:"))
+	}
+	if client == nil {
+		return ""
+	}
+	provider := client.Provider
+	oauth2Config := client.OAuth2
 
-		// Set cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     app.AuthConfig.CookieName,
-			Value:    sessionToken,
-			Path:     "/",
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Secure:   app.AuthConfig.CookieSecure,
-			SameSite: http.SameSiteLaxMode,
-		})
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&metadata); err != nil || metadata.EndSessionEndpoint == "" {
+		return ""
+	}
+	endSession, err := url.Parse(metadata.EndSessionEndpoint)
+	if err != nil || (endSession.Scheme != "https" && endSession.Scheme != "http") {
+		return ""
+	}
+
+	q := endSession.Query()
+	q.Set("client_id", oauth2Config.ClientID)
+	if idToken != "" {
+		q.Set("id_token_hint", idToken)
+	}
+	if publicURL != "" {
+		q.Set("post_logout_redirect_uri", strings.TrimRight(publicURL, "/")+"/login")
+	}
+	endSession.RawQuery = q.Encode()
+	return endSession.String()
+}
 
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+func randomURLToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OIDCClaims holds the user details DashGate reads from an ID token and
+// userinfo response.
+type OIDCClaims struct {
+	Subject           string
+	Email             string
+	Name              string
+	PreferredUsername string
+	Groups            []string
+}
+
+// ParseOIDCClaims extracts user details from raw OIDC claims. groupsClaim may
+// be a dotted path into nested claims such as "realm_access.roles" or
+// "resource_access.dashgate.roles"; the standard "groups" claim is always
+// included as well.
+//
+// An email the provider marks as unverified (email_verified false) is left
+// out: users can often set any address at the provider, so it must not pass
+// the admission rules or an invite bound to an address. Providers that do not
+// send email_verified are trusted.
+func ParseOIDCClaims(raw map[string]interface{}, groupsClaim string) OIDCClaims {
+	claims := OIDCClaims{
+		Subject:           claimString(raw, "sub"),
+		Email:             claimString(raw, "email"),
+		Name:              claimString(raw, "name"),
+		PreferredUsername: claimString(raw, "preferred_username"),
+	}
+	if emailUnverified(raw) {
+		claims.Email = ""
+	}
+
+	groups, _ := ClaimStrings(raw, "groups")
+	if groupsClaim != "" && groupsClaim != "groups" {
+		custom, _ := ClaimStrings(raw, groupsClaim)
+		groups = append(groups, custom...)
+	}
+	claims.Groups = dedupeStrings(groups)
+	return claims
+}
+
+// ClaimStrings returns the string values at path in raw claims. A claim whose
+// name literally matches path wins; otherwise path is split on "." and
+// followed through nested objects. A single string value is returned as a
+// one-element list. The bool reports whether the claim was present.
+func ClaimStrings(raw map[string]interface{}, path string) ([]string, bool) {
+	value, ok := lookupClaim(raw, path)
+	if !ok {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values, true
+	case []string:
+		return v, true
+	case string:
+		if v == "" {
+			return nil, true
+		}
+		return []string{v}, true
+	}
+	return nil, true
+}
+
+func lookupClaim(raw map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := raw[path]; ok {
+		return value, true
+	}
+	if !strings.Contains(path, ".") {
+		return nil, false
+	}
+
+	var current interface{} = raw
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func claimString(raw map[string]interface{}, name string) string {
+	s, _ := raw[name].(string)
+	return s
+}
+
+// emailUnverified reports whether email_verified is false. Some providers
+// send it as a string.
+func emailUnverified(raw map[string]interface{}) bool {
+	switch v := raw["email_verified"].(type) {
+	case bool:
+		return !v
+	case string:
+		return strings.EqualFold(v, "false")
+	}
+	return false
+}
+
+// NeedsUserInfo reports whether the ID token claims lack the groups or the
+// email address, so the userinfo endpoint should be asked for them.
+func NeedsUserInfo(raw map[string]interface{}, groupsClaim string) bool {
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	if _, ok := lookupClaim(raw, groupsClaim); !ok {
+		return true
+	}
+	return claimString(raw, "email") == ""
+}
+
+// MergeMissingClaims copies claims from extra into raw where raw does not
+// already have them. The ID token's own claims always win.
+func MergeMissingClaims(raw, extra map[string]interface{}) {
+	for key, value := range extra {
+		if _, ok := raw[key]; !ok {
+			raw[key] = value
+		}
+	}
+}
+
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ParseGroupMapping parses OIDC group mapping rules. Each non-empty line has
+// the form "provider-group = dashgate-group, other-group"; lines starting
+// with "#" are comments.
+func ParseGroupMapping(text string) (map[string][]string, error) {
+	mapping := make(map[string][]string)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		from = strings.TrimSpace(from)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("line %d: expected \"provider-group = dashgate-group\"", i+1)
+		}
+		var targets []string
+		for _, g := range strings.Split(to, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				targets = append(targets, g)
+			}
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("line %d: no DashGate group given for %q", i+1, from)
+		}
+		mapping[from] = append(mapping[from], targets...)
+	}
+	return mapping, nil
+}
+
+// ApplyGroupMapping translates provider groups into DashGate groups using
+// the rules in mapping. Groups without a rule are kept as they are. Invalid
+// rules are ignored, as they are rejected when saved.
+func ApplyGroupMapping(groups []string, mapping string) []string {
+	if strings.TrimSpace(mapping) == "" {
+		return groups
+	}
+	rules, err := ParseGroupMapping(mapping)
+	if err != nil {
+		return groups
+	}
+	mapped := make([]string, 0, len(groups))
+	for _, g := range groups {
+		if targets, ok := rules[g]; ok {
+			mapped = append(mapped, targets...)
+		} else {
+			mapped = append(mapped, g)
+		}
+	}
+	return dedupeStrings(mapped)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// ErrPasswordReused is returned when a new password matches the current one
+// or one of the user's remembered previous passwords.
+var ErrPasswordReused = errors.New("Password was used recently. Choose a different password")
+
+// commonPasswords is a small built-in breached-password list, checked
+// case-insensitively whenever the breached-password check is enabled.
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password12": true, "password123": true, "password1234": true,
+	"passw0rd": true, "p@ssw0rd": true, "p@ssword": true, "12345678": true, "123456789": true,
+	"1234567890": true, "0123456789": true, "87654321": true, "987654321": true, "123123123": true,
+	"11111111": true, "00000000": true, "88888888": true, "12341234": true, "11223344": true,
+	"qwertyui": true, "qwerty12": true, "qwerty123": true, "qwertyuiop": true, "1q2w3e4r": true,
+	"1q2w3e4r5t": true, "q1w2e3r4": true, "1qaz2wsx": true, "zaq12wsx": true, "asdfghjk": true,
+	"asdfasdf": true, "zxcvbnm1": true, "abc12345": true, "abcd1234": true, "aa123456": true,
+	"iloveyou": true, "iloveyou1": true, "sunshine": true, "princess": true, "football": true,
+	"baseball": true, "superman": true, "starwars": true, "whatever": true, "trustno1": true,
+	"welcome1": true, "welcome123": true, "letmein1": true, "letmein123": true, "changeme": true,
+	"changeme1": true, "admin123": true, "admin1234": true, "administrator": true, "root1234": true,
+	"master12": true, "dragon12": true, "computer": true, "internet": true, "michelle": true,
+	"jennifer": true, "corvette": true, "mustang1": true, "shadow12": true, "monkey12": true,
+	"charlie1": true, "liverpool": true, "chelsea1": true, "pokemon1": true, "samsung1": true,
+	"default1": true, "security": true, "homelab1": true, "dashgate": true, "dashgate1": true,
+}
+
+// breachedListCache holds the parsed contents of the configured breached
+// password file, reloaded when the path or modification time changes.
+var breachedListCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	plain   map[string]bool
+	sha1    map[string]bool
+}
+
+// CheckPasswordPolicy validates a new password against the configured minimum
+// length and breached-password lists. The returned error is safe to show to
+// the user.
+func CheckPasswordPolicy(app *server.App, password string) error {
+	app.SysConfigMu.RLock()
+	minLength := app.SystemConfig.PasswordMinLength
+	checkBreached := app.SystemConfig.PasswordCheckBreached
+	listPath := app.SystemConfig.PasswordBreachedList
+	app.SysConfigMu.RUnlock()
+
+	if minLength <= 0 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("Password must be at least %d characters", minLength)
+	}
+
+	if checkBreached && isBreachedPassword(password, listPath) {
+		return errors.New("This password appears in a list of breached passwords. Choose a different password")
+	}
+	return nil
+}
+
+// CheckPasswordHistory returns ErrPasswordReused if password matches the
+// user's current password hash or one of the remembered previous hashes.
+func CheckPasswordHistory(app *server.App, userID int, password, currentHash string) error {
+	app.SysConfigMu.RLock()
+	keep := app.SystemConfig.PasswordHistory
+	app.SysConfigMu.RUnlock()
+
+	if keep <= 0 {
+		return nil
+	}
+	if currentHash != "" && CheckPassword(password, currentHash) {
+		return ErrPasswordReused
+	}
+
+	hashes, err := database.GetPasswordHistory(app, userID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to load password history: %w", err)
+	}
+	for _, h := range hashes {
+		if CheckPassword(password, h) {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// RecordPasswordChange remembers the hash a user is replacing so it cannot be
+// reused while password history is enabled.
+func RecordPasswordChange(app *server.App, userID int, oldHash string) {
+	app.SysConfigMu.RLock()
+	keep := app.SystemConfig.PasswordHistory
+	app.SysConfigMu.RUnlock()
+
+	if oldHash == "" || oldHash == "LDAP_USER" || oldHash == "OIDC_USER" {
+		return
+	}
+	if err := database.AddPasswordHistory(app, userID, oldHash, keep); err != nil {
+		log.Printf("Error recording password history: %v", err)
+	}
+}
+
+func isBreachedPassword(password, listPath string) bool {
+	if commonPasswords[strings.ToLower(password)] {
+		return true
+	}
+	if listPath == "" {
+		return false
+	}
+
+	plain, hashes := loadBreachedList(listPath)
+	if plain[password] {
+		return true
+	}
+	sum := sha1.Sum([]byte(password))
+	return hashes[strings.ToUpper(hex.EncodeToString(sum[:]))]
+}
+
+// loadBreachedList parses a breached password file with one entry per line:
+// either a plaintext password or an uppercase/lowercase SHA-1 hex digest,
+// optionally followed by ":count" as in the Have I Been Pwned downloads.
+func loadBreachedList(path string) (map[string]bool, map[string]bool) {
+	breachedListCache.Lock()
+	defer breachedListCache.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Breached password list unavailable: %v", err)
+		return nil, nil
+	}
+	if breachedListCache.path == path && breachedListCache.modTime.Equal(info.ModTime()) {
+		return breachedListCache.plain, breachedListCache.sha1
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Breached password list unavailable: %v", err)
+		return nil, nil
+	}
+	defer f.Close()
+
+	plain := make(map[string]bool)
+	hashes := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			hashes[strings.ToUpper(digest)] = true
+			continue
+		}
+		plain[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading breached password list: %v", err)
+	}
+
+	breachedListCache.path = path
+	breachedListCache.modTime = info.ModTime()
+	breachedListCache.plain = plain
+	breachedListCache.sha1 = hashes
+	log.Printf("Loaded breached password list %s (%d passwords, %d hashes)", path, len(plain), len(hashes))
+	return plain, hashes
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// PreviewCookieName holds an admin's "view as" preview. It only has an effect
+// for admins and can only narrow what they see, so it is not signed.
+const PreviewCookieName = "dashgate_preview"
+
+// previewMaxAge ends a forgotten preview after an hour.
+const previewMaxAge = 3600
+
+// Preview is an admin's read-only view of the dashboard as a specific user or
+// as an arbitrary set of groups.
+type Preview struct {
+	Username string   `json:"username,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Label describes the preview for the banner and the audit log.
+func (p *Preview) Label() string {
+	if p.Username != "" {
+		return "user " + p.Username
+	}
+	if len(p.Groups) == 0 {
+		return "a user with no groups"
+	}
+	return "groups " + strings.Join(p.Groups, ", ")
+}
+
+// SetPreviewCookie starts a preview in the admin's browser.
+func SetPreviewCookie(app *server.App, w http.ResponseWriter, p Preview) {
+	value, _ := json.Marshal(p)
+	app.SysConfigMu.RLock()
+	secure := app.AuthConfig.CookieSecure
+	app.SysConfigMu.RUnlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     PreviewCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/",
+		MaxAge:   previewMaxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearPreviewCookie ends a preview.
+func ClearPreviewCookie(app *server.App, w http.ResponseWriter) {
+	app.SysConfigMu.RLock()
+	secure := app.AuthConfig.CookieSecure
+	app.SysConfigMu.RUnlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     PreviewCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetPreview returns the active preview for an admin, or nil if the request
+// carries none or the user is not an admin.
+func GetPreview(app *server.App, r *http.Request, user *models.AuthenticatedUser) *Preview {
+	if user == nil || !user.IsAdmin {
+		return nil
+	}
+	cookie, err := r.Cookie(PreviewCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	var p Preview
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil
+	}
+	return &p
+}
+
+// GetViewingUser returns who the dashboard should be rendered for: the
+// authenticated user, or the previewed identity while an admin previews. The
+// preview is nil outside preview mode.
+func GetViewingUser(app *server.App, r *http.Request) (*models.AuthenticatedUser, *Preview) {
+	user := GetAuthenticatedUser(app, r)
+	preview := GetPreview(app, r, user)
+	if preview == nil {
+		return user, nil
+	}
+
+	viewer := &models.AuthenticatedUser{
+		Username:    preview.Username,
+		DisplayName: preview.Label(),
+		Groups:      preview.Groups,
+		Source:      "preview",
+	}
+	if preview.Username != "" {
+		// Use the user's current groups so the preview tracks later changes
+		viewer.Groups = nil
+		if app.DB != nil {
+			if row, err := database.GetUserByUsername(app, preview.Username); err == nil {
+				json.Unmarshal([]byte(row.GroupsJSON), &viewer.Groups)
+				if row.DisplayName != "" {
+					viewer.DisplayName = row.DisplayName
+				}
+			}
+			// Groups granted by DashGate (invites, memberships) apply on
+			// top of the provider's, as they do when the user signs in
+			if granted, err := database.GetGrantedGroups(app, preview.Username); err == nil {
+				viewer.Groups = database.MergeGroups(viewer.Groups, granted)
+			}
+		}
+	}
+	viewer.IsAdmin = CheckIsAdmin(app, viewer.Groups)
+	if preview.Username != "" {
+		viewer = withGroupGrants(app, viewer)
+	}
+	return viewer, preview
+}
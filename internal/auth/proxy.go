@@ -8,14 +8,14 @@ import (
 
 	"dashgate/internal/models"
 	"dashgate/internal/server"
+
+	"github.com/coreos/go-oidc/v3/oidc"
 )
 
 // IsRequestFromTrustedProxy checks whether the request originates from a
 // configured trusted proxy IP or CIDR range.
 func IsRequestFromTrustedProxy(app *server.App, r *http.Request) bool {
 	app.SysConfigMu.RLock()
-	nets := app.TrustedProxyNets
-	ips := app.TrustedProxyIPs
 	hasTrusted := app.SystemConfig.TrustedProxies != ""
 	app.SysConfigMu.RUnlock()
 
@@ -34,27 +34,142 @@ func IsRequestFromTrustedProxy(app *server.App, r *http.Request) bool {
 		return false
 	}
 
-	for _, cidr := range nets {
-		if cidr.Contains(parsedRemoteIP) {
-			return true
-		}
+	if isTrustedProxyIP(app, parsedRemoteIP) {
+		return true
 	}
 
-	for _, ip := range ips {
-		if ip.Equal(parsedRemoteIP) {
-			return true
+	log.Printf("Proxy auth headers rejected from untrusted IP: %s", remoteIP)
+	return false
+}
+
+// proxyProfile describes the headers a particular authenticating proxy uses
+// to forward the user's identity.
+type proxyProfile struct {
+	UserHeader      string
+	GroupsHeader    string
+	NameHeader      string
+	EmailHeader     string
+	GroupsSeparator string
+	// JWTHeader, when set, carries a signed assertion that must be verified
+	// against the configured JWKS. Identity is then taken from its claims.
+	JWTHeader string
+}
+
+// proxyProfiles are the built-in header profiles selectable in system config.
+var proxyProfiles = map[string]proxyProfile{
+	"authelia": {
+		UserHeader:      "Remote-User",
+		GroupsHeader:    "Remote-Groups",
+		NameHeader:      "Remote-Name",
+		EmailHeader:     "Remote-Email",
+		GroupsSeparator: ",",
+	},
+	"authentik": {
+		UserHeader:      "X-authentik-username",
+		GroupsHeader:    "X-authentik-groups",
+		NameHeader:      "X-authentik-name",
+		EmailHeader:     "X-authentik-email",
+		GroupsSeparator: "|",
+	},
+	"oauth2-proxy": {
+		UserHeader:      "X-Forwarded-User",
+		GroupsHeader:    "X-Forwarded-Groups",
+		NameHeader:      "X-Forwarded-Preferred-Username",
+		EmailHeader:     "X-Forwarded-Email",
+		GroupsSeparator: ",",
+	},
+	"cloudflare": {
+		UserHeader:      "Cf-Access-Authenticated-User-Email",
+		EmailHeader:     "Cf-Access-Authenticated-User-Email",
+		GroupsSeparator: ",",
+		JWTHeader:       "Cf-Access-Jwt-Assertion",
+	},
+	"tailscale": {
+		UserHeader:      "Tailscale-User-Login",
+		NameHeader:      "Tailscale-User-Name",
+		EmailHeader:     "Tailscale-User-Login",
+		GroupsSeparator: ",",
+	},
+}
+
+// IsValidProxyProfile reports whether name is a selectable proxy auth profile.
+// An empty name selects the default (Authelia) profile.
+func IsValidProxyProfile(name string) bool {
+	if name == "" || name == "custom" {
+		return true
+	}
+	_, ok := proxyProfiles[name]
+	return ok
+}
+
+// ProxyProfileUsesJWT reports whether the named profile authenticates via a
+// signed assertion and therefore needs a JWKS configured.
+func ProxyProfileUsesJWT(name string) bool {
+	return proxyProfiles[name].JWTHeader != ""
+}
+
+// resolveProxyProfile returns the configured profile name and header set.
+// Unknown or empty profiles fall back to Authelia-style headers, and any
+// non-empty custom header setting overrides the profile default.
+func resolveProxyProfile(sc *models.SystemConfig) (string, proxyProfile) {
+	name := sc.ProxyAuthProfile
+	p, ok := proxyProfiles[name]
+	if !ok {
+		if name != "custom" {
+			name = "authelia"
 		}
+		p = proxyProfiles["authelia"]
 	}
 
-	log.Printf("Proxy auth headers rejected from untrusted IP: %s", remoteIP)
-	return false
+	if sc.ProxyUserHeader != "" {
+		p.UserHeader = sc.ProxyUserHeader
+	}
+	if sc.ProxyGroupsHeader != "" {
+		p.GroupsHeader = sc.ProxyGroupsHeader
+	}
+	if sc.ProxyNameHeader != "" {
+		p.NameHeader = sc.ProxyNameHeader
+	}
+	if sc.ProxyEmailHeader != "" {
+		p.EmailHeader = sc.ProxyEmailHeader
+	}
+	if sc.ProxyGroupsSeparator != "" {
+		p.GroupsSeparator = sc.ProxyGroupsSeparator
+	}
+	return name, p
+}
+
+// splitGroups splits a groups header value on sep, trimming whitespace and
+// dropping empty entries.
+func splitGroups(value, sep string) []string {
+	if value == "" {
+		return nil
+	}
+	var groups []string
+	for _, g := range strings.Split(value, sep) {
+		g = strings.TrimSpace(g)
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
 }
 
-// GetAutheliaUser extracts user information from proxy authentication headers
-// (Remote-User, Remote-Groups, Remote-Name, Remote-Email) after verifying the
-// request comes from a trusted proxy.
-func GetAutheliaUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
-	username := r.Header.Get("Remote-User")
+// GetProxyUser extracts user information from the authentication headers of
+// the configured proxy profile. Header-based profiles require the request to
+// come from a trusted proxy; assertion-based profiles (Cloudflare Access)
+// require a JWT that verifies against the configured JWKS instead.
+func GetProxyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
+	app.SysConfigMu.RLock()
+	source, profile := resolveProxyProfile(&app.SystemConfig)
+	verifier := app.ProxyJWTVerifier
+	app.SysConfigMu.RUnlock()
+
+	if profile.JWTHeader != "" {
+		return getProxyJWTUser(app, r, source, profile, verifier)
+	}
+
+	username := r.Header.Get(profile.UserHeader)
 	if username == "" {
 		return nil
 	}
@@ -64,28 +179,97 @@ func GetAutheliaUser(app *server.App, r *http.Request) *models.AuthenticatedUser
 		return nil
 	}
 
-	groupsHeader := r.Header.Get("Remote-Groups")
 	var groups []string
-	if groupsHeader != "" {
-		groups = strings.Split(groupsHeader, ",")
-		for i := range groups {
-			groups[i] = strings.TrimSpace(groups[i])
-		}
+	if profile.GroupsHeader != "" {
+		groups = splitGroups(r.Header.Get(profile.GroupsHeader), profile.GroupsSeparator)
 	}
 
-	displayName := r.Header.Get("Remote-Name")
+	displayName := ""
+	if profile.NameHeader != "" {
+		displayName = r.Header.Get(profile.NameHeader)
+	}
 	if displayName == "" {
 		displayName = username
 	}
 
-	email := r.Header.Get("Remote-Email")
+	email := ""
+	if profile.EmailHeader != "" {
+		email = r.Header.Get(profile.EmailHeader)
+	}
 
 	user := &models.AuthenticatedUser{
 		Username:    username,
 		DisplayName: displayName,
 		Email:       email,
 		Groups:      groups,
-		Source:      "authelia",
+		Source:      source,
+	}
+	user.IsAdmin = CheckIsAdmin(app, user.Groups)
+	return user
+}
+
+// getProxyJWTUser verifies the signed assertion in profile.JWTHeader and
+// builds the user from its claims. Plain identity headers are ignored for
+// these profiles because they can be forged by anyone reaching DashGate.
+func getProxyJWTUser(app *server.App, r *http.Request, source string, profile proxyProfile, verifier *oidc.IDTokenVerifier) *models.AuthenticatedUser {
+	rawJWT := r.Header.Get(profile.JWTHeader)
+	if rawJWT == "" {
+		return nil
+	}
+
+	if verifier == nil {
+		log.Printf("Proxy auth assertion rejected: no JWKS configured for %s profile", source)
+		return nil
+	}
+
+	token, err := verifier.Verify(r.Context(), rawJWT)
+	if err != nil {
+		log.Printf("Proxy auth assertion rejected: %v", err)
+		return nil
+	}
+
+	var claims struct {
+		Subject string      `json:"sub"`
+		Email   string      `json:"email"`
+		Name    string      `json:"name"`
+		Groups  interface{} `json:"groups"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		log.Printf("Failed to parse proxy assertion claims: %v", err)
+		return nil
+	}
+
+	username := claims.Email
+	if username == "" {
+		username = claims.Subject
+	}
+	if username == "" {
+		return nil
+	}
+
+	var groups []string
+	switch g := claims.Groups.(type) {
+	case []interface{}:
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = splitGroups(g, profile.GroupsSeparator)
+	}
+
+	displayName := claims.Name
+	if displayName == "" {
+		displayName = username
+	}
+
+	user := &models.AuthenticatedUser{
+		Username:    username,
+		DisplayName: displayName,
+		Email:       claims.Email,
+		Groups:      groups,
+		Source:      source,
 	}
 	user.IsAdmin = CheckIsAdmin(app, user.Groups)
 	return user
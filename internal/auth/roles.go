@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Role is a set of admin permissions that can be granted to groups without
+// making their members full admins.
+type Role string
+
+const (
+	// RoleAppEditor manages the app catalog, categories, icons and imports.
+	RoleAppEditor Role = "app_editor"
+	// RoleDiscoveryManager configures discovery sources and discovered apps.
+	RoleDiscoveryManager Role = "discovery_manager"
+	// RoleUserManager manages local users, invites and groups. Only full
+	// admins can manage privileged accounts or grant privileged groups.
+	RoleUserManager Role = "user_manager"
+	// RoleSystemAdmin changes system and authentication settings, API keys,
+	// OIDC providers and backups.
+	RoleSystemAdmin Role = "system_admin"
+	// RoleAuditor reads the audit log.
+	RoleAuditor Role = "auditor"
+)
+
+// AllRoles lists every role in display order.
+var AllRoles = []Role{RoleAppEditor, RoleDiscoveryManager, RoleUserManager, RoleSystemAdmin, RoleAuditor}
+
+// roleGroups returns the lowercased groups mapped to each role.
+func roleGroups(app *server.App) map[Role][]string {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	return map[Role][]string{
+		RoleAppEditor:        splitConfigList(app.SystemConfig.RoleAppEditorGroups),
+		RoleDiscoveryManager: splitConfigList(app.SystemConfig.RoleDiscoveryManagerGroups),
+		RoleUserManager:      splitConfigList(app.SystemConfig.RoleUserManagerGroups),
+		RoleSystemAdmin:      splitConfigList(app.SystemConfig.RoleSystemAdminGroups),
+		RoleAuditor:          splitConfigList(app.SystemConfig.RoleAuditorGroups),
+	}
+}
+
+// UserRoles returns the roles held by a user. Admins hold every role.
+func UserRoles(app *server.App, user *models.AuthenticatedUser) []Role {
+	if user == nil {
+		return nil
+	}
+	if user.IsAdmin {
+		return AllRoles
+	}
+	mapping := roleGroups(app)
+	var roles []Role
+	for _, role := range AllRoles {
+		for _, g := range user.Groups {
+			if containsFold(mapping[role], strings.TrimSpace(g)) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// HasRole reports whether the user holds the role.
+func HasRole(app *server.App, user *models.AuthenticatedUser, role Role) bool {
+	for _, r := range UserRoles(app, user) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivilegedGroup reports whether membership of the group makes a user an
+// admin or grants any role.
+func IsPrivilegedGroup(app *server.App, group string) bool {
+	if CheckIsAdmin(app, []string{group}) {
+		return true
+	}
+	group = strings.TrimSpace(group)
+	for _, groups := range roleGroups(app) {
+		if containsFold(groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanGrantGroups reports whether the user may give these groups to someone.
+// Only full admins can hand out groups that carry admin rights or roles, so
+// a user manager cannot promote themselves or anyone else.
+func CanGrantGroups(app *server.App, user *models.AuthenticatedUser, groups []string) bool {
+	if user != nil && user.IsAdmin {
+		return true
+	}
+	for _, g := range groups {
+		if IsPrivilegedGroup(app, g) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireRole is middleware that ensures the request has an authenticated
+// user holding the role.
+func RequireRole(app *server.App, role Role, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(app, func(w http.ResponseWriter, r *http.Request) {
+		user := GetUserFromContext(r)
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !HasRole(app, user, role) {
+			http.Error(w, "Forbidden: Missing permission", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireAnyRole is middleware that ensures the request has an authenticated
+// user holding at least one admin role.
+func RequireAnyRole(app *server.App, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(app, func(w http.ResponseWriter, r *http.Request) {
+		user := GetUserFromContext(r)
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(UserRoles(app, user)) == 0 {
+			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
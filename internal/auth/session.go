@@ -3,8 +3,20 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
 )
 
+// maxUserAgentLength bounds the stored User-Agent so clients cannot bloat the
+// sessions table with oversized headers.
+const maxUserAgentLength = 512
+
 // GenerateSessionToken creates a cryptographically random 32-byte session
 // token and returns it as a hex-encoded string.
 func GenerateSessionToken() (string, error) {
@@ -14,3 +26,114 @@ func GenerateSessionToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// HasSession reports whether user signed in with a DashGate session cookie
+// (local, LDAP or OIDC) rather than through a proxy or an API key.
+func HasSession(user *models.AuthenticatedUser) bool {
+	if user == nil {
+		return false
+	}
+	switch user.Source {
+	case "local", "ldap", "oidc":
+		return true
+	}
+	return strings.HasPrefix(user.Source, "oidc:")
+}
+
+// StartSession creates a new session for userID, recording the client IP, user
+// agent and the method used to sign in, and sets the session cookie. Any
+// session already carried by the request is replaced, and the user's oldest
+// sessions are signed out once the configured concurrent session cap is hit.
+func StartSession(app *server.App, w http.ResponseWriter, r *http.Request, userID int, authSource string) error {
+	return startSession(app, w, r, userID, database.SessionInfo{AuthSource: authSource})
+}
+
+// StartOIDCSession is StartSession for an OIDC login, remembering the ID token
+// so the user can later be signed out of the provider as well.
+func StartOIDCSession(app *server.App, w http.ResponseWriter, r *http.Request, userID int, authSource, idToken string) error {
+	return startSession(app, w, r, userID, database.SessionInfo{AuthSource: authSource, IDToken: idToken})
+}
+
+func startSession(app *server.App, w http.ResponseWriter, r *http.Request, userID int, info database.SessionInfo) error {
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+
+	app.SysConfigMu.RLock()
+	cookieName := app.AuthConfig.CookieName
+	sessionDuration := app.AuthConfig.SessionDuration
+	maxSessions := app.SystemConfig.MaxSessions
+	app.SysConfigMu.RUnlock()
+
+	// Drop the session this browser was using before, so a planted or stale
+	// token cannot survive the new login
+	if old, err := r.Cookie(cookieName); err == nil && old.Value != "" {
+		database.DeleteSession(app, old.Value)
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	expiresAt := time.Now().Add(time.Duration(sessionDuration) * 24 * time.Hour)
+	info.IP = ClientIP(r)
+	info.UserAgent = userAgent
+	if err := database.CreateSession(app, userID, token, expiresAt, info); err != nil {
+		return err
+	}
+	database.PruneUserSessions(app, userID, maxSessions)
+
+	SetSessionCookie(app, w, token, expiresAt)
+	return nil
+}
+
+// ClientIP returns the IP address of the client that sent the request, as
+// resolved through trusted proxies by the ClientIP middleware. Without it,
+// the connection address is used.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
+// SetSessionCookie writes the session cookie using the configured cookie
+// name, domain and secure flag.
+func SetSessionCookie(app *server.App, w http.ResponseWriter, token string, expiresAt time.Time) {
+	app.SysConfigMu.RLock()
+	cookie := &http.Cookie{
+		Name:     app.AuthConfig.CookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   app.AuthConfig.CookieDomain,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   app.AuthConfig.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	app.SysConfigMu.RUnlock()
+	http.SetCookie(w, cookie)
+}
+
+// ClearSessionCookie expires the session cookie in the browser.
+func ClearSessionCookie(app *server.App, w http.ResponseWriter) {
+	app.SysConfigMu.RLock()
+	cookie := &http.Cookie{
+		Name:     app.AuthConfig.CookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   app.AuthConfig.CookieDomain,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.AuthConfig.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	app.SysConfigMu.RUnlock()
+	http.SetCookie(w, cookie)
+}
@@ -0,0 +1,537 @@
+// Package bootstrap completes first-run setup without the /setup wizard,
+// from SETUP_* environment variables or a seed YAML file.
+package bootstrap
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Seed is the unattended setup configuration. Settings left out of the seed
+// keep their stored values.
+type Seed struct {
+	Admin          SeedAdmin     `yaml:"admin"`
+	AdminGroup     string        `yaml:"admin_group"`
+	Auth           SeedAuth      `yaml:"auth"`
+	TrustedProxies []string      `yaml:"trusted_proxies"`
+	LDAP           *SeedLDAP     `yaml:"ldap"`
+	OIDC           *SeedOIDC     `yaml:"oidc"`
+	Discovery      SeedDiscovery `yaml:"discovery"`
+	Groups         []SeedGroup   `yaml:"groups"`
+}
+
+// SeedAdmin is the initial admin user. The password is given as a bcrypt
+// hash so no plaintext password needs to be stored in the deployment.
+type SeedAdmin struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`
+	Email        string `yaml:"email"`
+	DisplayName  string `yaml:"display_name"`
+}
+
+// SeedAuth selects the authentication providers and session settings.
+type SeedAuth struct {
+	Providers    []string `yaml:"providers"`
+	SessionDays  int      `yaml:"session_days"`
+	CookieSecure *bool    `yaml:"cookie_secure"`
+}
+
+type SeedLDAP struct {
+	Server       string `yaml:"server"`
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	UserFilter   string `yaml:"user_filter"`
+	UserAttr     string `yaml:"user_attr"`
+	EmailAttr    string `yaml:"email_attr"`
+	DisplayAttr  string `yaml:"display_attr"`
+	StartTLS     bool   `yaml:"start_tls"`
+	SkipVerify   bool   `yaml:"skip_verify"`
+}
+
+type SeedOIDC struct {
+	DisplayName  string `yaml:"display_name"`
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	Scopes       string `yaml:"scopes"`
+	GroupsClaim  string `yaml:"groups_claim"`
+}
+
+// SeedDiscovery holds one entry per discovery source. A source that is
+// left out keeps its stored settings.
+type SeedDiscovery struct {
+	Docker  *SeedDocker  `yaml:"docker"`
+	Traefik *SeedTraefik `yaml:"traefik"`
+	Nginx   *SeedNginx   `yaml:"nginx"`
+	NPM     *SeedNPM     `yaml:"npm"`
+	Caddy   *SeedCaddy   `yaml:"caddy"`
+	Unraid  *SeedUnraid  `yaml:"unraid"`
+}
+
+type SeedDocker struct {
+	Enabled    bool   `yaml:"enabled"`
+	SocketPath string `yaml:"socket_path"`
+}
+
+type SeedTraefik struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type SeedNginx struct {
+	Enabled    bool   `yaml:"enabled"`
+	ConfigPath string `yaml:"config_path"`
+}
+
+type SeedNPM struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
+type SeedCaddy struct {
+	Enabled  bool   `yaml:"enabled"`
+	AdminURL string `yaml:"admin_url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type SeedUnraid struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	APIKey  string `yaml:"api_key"`
+}
+
+// SeedGroup is a managed group to create if it does not exist.
+type SeedGroup struct {
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name"`
+}
+
+var validProviders = []string{"proxy", "local", "ldap", "oidc"}
+
+var discoverySources = []string{"docker", "traefik", "nginx", "npm", "caddy", "unraid"}
+
+// Run loads the seed from the environment and applies it. It does nothing
+// when neither SETUP_FILE nor any SETUP_* variable is set.
+func Run(app *server.App) error {
+	seed, err := Load()
+	if err != nil {
+		return err
+	}
+	if seed == nil {
+		return nil
+	}
+	return Apply(app, seed)
+}
+
+// Load reads the seed file named by SETUP_FILE, if any, and applies the
+// SETUP_* environment variables on top of it. It returns nil when no
+// unattended setup is configured.
+func Load() (*Seed, error) {
+	seed := &Seed{}
+	configured := false
+
+	if path := os.Getenv("SETUP_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading SETUP_FILE: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(seed); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		configured = true
+	}
+
+	env := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = strings.TrimSpace(v)
+			configured = true
+		}
+	}
+	env("SETUP_ADMIN_USERNAME", &seed.Admin.Username)
+	env("SETUP_ADMIN_PASSWORD_HASH", &seed.Admin.PasswordHash)
+	env("SETUP_ADMIN_EMAIL", &seed.Admin.Email)
+	env("SETUP_ADMIN_DISPLAY_NAME", &seed.Admin.DisplayName)
+	env("SETUP_ADMIN_GROUP", &seed.AdminGroup)
+
+	if v, ok := os.LookupEnv("SETUP_AUTH_PROVIDERS"); ok {
+		seed.Auth.Providers = splitList(v)
+		configured = true
+	}
+	if v, ok := os.LookupEnv("SETUP_TRUSTED_PROXIES"); ok {
+		seed.TrustedProxies = splitList(v)
+		configured = true
+	}
+	if v, ok := os.LookupEnv("SETUP_DISCOVERY"); ok {
+		if err := seed.enableDiscovery(splitList(v)); err != nil {
+			return nil, err
+		}
+		configured = true
+	}
+	if v, ok := os.LookupEnv("SETUP_GROUPS"); ok {
+		// Each entry is "name" or "name:Display Name"
+		for _, entry := range strings.Split(v, ",") {
+			name, display, _ := strings.Cut(strings.TrimSpace(entry), ":")
+			if name = strings.TrimSpace(name); name != "" {
+				seed.Groups = append(seed.Groups, SeedGroup{Name: name, DisplayName: strings.TrimSpace(display)})
+			}
+		}
+		configured = true
+	}
+
+	if !configured {
+		return nil, nil
+	}
+	return seed, nil
+}
+
+// enableDiscovery turns on the listed discovery sources, keeping any
+// connection settings from the seed file.
+func (s *Seed) enableDiscovery(sources []string) error {
+	for _, src := range sources {
+		switch strings.ToLower(src) {
+		case "docker":
+			if s.Discovery.Docker == nil {
+				s.Discovery.Docker = &SeedDocker{}
+			}
+			s.Discovery.Docker.Enabled = true
+		case "traefik":
+			if s.Discovery.Traefik == nil {
+				s.Discovery.Traefik = &SeedTraefik{}
+			}
+			s.Discovery.Traefik.Enabled = true
+		case "nginx":
+			if s.Discovery.Nginx == nil {
+				s.Discovery.Nginx = &SeedNginx{}
+			}
+			s.Discovery.Nginx.Enabled = true
+		case "npm":
+			if s.Discovery.NPM == nil {
+				s.Discovery.NPM = &SeedNPM{}
+			}
+			s.Discovery.NPM.Enabled = true
+		case "caddy":
+			if s.Discovery.Caddy == nil {
+				s.Discovery.Caddy = &SeedCaddy{}
+			}
+			s.Discovery.Caddy.Enabled = true
+		case "unraid":
+			if s.Discovery.Unraid == nil {
+				s.Discovery.Unraid = &SeedUnraid{}
+			}
+			s.Discovery.Unraid.Enabled = true
+		default:
+			return fmt.Errorf("SETUP_DISCOVERY: unknown discovery source %q (expected one of %s)", src, strings.Join(discoverySources, ", "))
+		}
+	}
+	return nil
+}
+
+// Validate checks the seed against the current state without changing
+// anything. All problems are reported together.
+func (s *Seed) Validate(app *server.App) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	providers := map[string]bool{}
+	for _, p := range s.Auth.Providers {
+		p = strings.ToLower(p)
+		valid := false
+		for _, v := range validProviders {
+			if p == v {
+				valid = true
+			}
+		}
+		if !valid {
+			add("auth.providers: unknown provider %q (expected one of %s)", p, strings.Join(validProviders, ", "))
+		}
+		providers[p] = true
+	}
+
+	app.SysConfigMu.RLock()
+	sc := app.SystemConfig
+	app.SysConfigMu.RUnlock()
+	if len(s.Auth.Providers) == 0 {
+		providers["proxy"] = sc.ProxyAuthEnabled
+		providers["local"] = sc.LocalAuthEnabled
+		providers["ldap"] = sc.LDAPAuthEnabled
+		providers["oidc"] = sc.OIDCAuthEnabled
+	}
+	if !providers["proxy"] && !providers["local"] && !providers["ldap"] && !providers["oidc"] {
+		add("auth.providers: at least one authentication provider must be enabled")
+	}
+	if s.Auth.SessionDays < 0 {
+		add("auth.session_days must not be negative")
+	}
+
+	adminExists := false
+	if s.Admin.Username != "" {
+		_, err := database.GetUserByUsername(app, s.Admin.Username)
+		switch {
+		case err == nil:
+			adminExists = true
+		case err != sql.ErrNoRows:
+			add("admin.username: looking up %q: %v", s.Admin.Username, err)
+		}
+	}
+	if s.Admin.Username == "" && s.Admin.PasswordHash != "" {
+		add("admin.username is required when admin.password_hash is set")
+	}
+	if s.Admin.Username != "" && !adminExists {
+		if s.Admin.PasswordHash == "" {
+			add("admin.password_hash is required to create admin user %q", s.Admin.Username)
+		} else if _, err := bcrypt.Cost([]byte(s.Admin.PasswordHash)); err != nil {
+			add("admin.password_hash is not a valid bcrypt hash: %v", err)
+		}
+	}
+	if providers["local"] && s.Admin.Username == "" && database.NeedsSetup(app) {
+		add("admin.username and admin.password_hash are required when local auth is enabled and no users exist")
+	}
+
+	for _, entry := range s.TrustedProxies {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				add("trusted_proxies: invalid CIDR %q", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			add("trusted_proxies: invalid IP address %q", entry)
+		}
+	}
+
+	if providers["ldap"] {
+		ldap := s.LDAP
+		if ldap == nil {
+			ldap = &SeedLDAP{Server: sc.LDAPServer, BaseDN: sc.LDAPBaseDN}
+		}
+		if ldap.Server == "" || ldap.BaseDN == "" {
+			add("ldap.server and ldap.base_dn are required when LDAP auth is enabled")
+		}
+	}
+	if providers["oidc"] {
+		oidc := s.OIDC
+		if oidc == nil {
+			oidc = &SeedOIDC{Issuer: sc.OIDCIssuer, ClientID: sc.OIDCClientID, RedirectURL: sc.OIDCRedirectURL}
+		}
+		if oidc.Issuer == "" || oidc.ClientID == "" || oidc.RedirectURL == "" {
+			add("oidc.issuer, oidc.client_id and oidc.redirect_url are required when OIDC auth is enabled")
+		}
+	}
+
+	if d := s.Discovery.Traefik; d != nil && d.Enabled && d.URL == "" && sc.TraefikURL == "" {
+		add("discovery.traefik.url is required when Traefik discovery is enabled")
+	}
+	if d := s.Discovery.NPM; d != nil && d.Enabled && d.URL == "" && sc.NPMUrl == "" {
+		add("discovery.npm.url is required when Nginx Proxy Manager discovery is enabled")
+	}
+	if d := s.Discovery.Caddy; d != nil && d.Enabled && d.AdminURL == "" && sc.CaddyAdminURL == "" {
+		add("discovery.caddy.admin_url is required when Caddy discovery is enabled")
+	}
+	if d := s.Discovery.Unraid; d != nil && d.Enabled && d.URL == "" && sc.UnraidURL == "" {
+		add("discovery.unraid.url is required when Unraid discovery is enabled")
+	}
+
+	seen := map[string]bool{}
+	for i, g := range s.Groups {
+		if strings.TrimSpace(g.Name) == "" {
+			add("groups[%d].name is required", i)
+		} else if seen[g.Name] {
+			add("groups: %q is listed more than once", g.Name)
+		}
+		seen[g.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Apply validates the seed and writes it to the database. It is idempotent:
+// settings in the seed are written on every run, while the admin user and
+// managed groups are only created when missing, so changes made to them in
+// DashGate afterwards are kept.
+func Apply(app *server.App, s *Seed) error {
+	if app.DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if err := s.Validate(app); err != nil {
+		return err
+	}
+	firstRun := database.NeedsSetup(app)
+
+	// Set the admin group early so CreateAdminUserWithHash can use it
+	app.SysConfigMu.Lock()
+	if s.AdminGroup != "" {
+		app.SystemConfig.AdminGroup = s.AdminGroup
+	} else if app.SystemConfig.AdminGroup == "" {
+		app.SystemConfig.AdminGroup = "admin"
+	}
+	app.SysConfigMu.Unlock()
+
+	// Create the admin user and groups first so a failure leaves setup pending
+	if s.Admin.Username != "" {
+		if _, err := database.GetUserByUsername(app, s.Admin.Username); err == sql.ErrNoRows {
+			if err := database.CreateAdminUserWithHash(app, s.Admin.Username, s.Admin.PasswordHash, s.Admin.Email, s.Admin.DisplayName); err != nil {
+				return fmt.Errorf("creating admin user %q: %w", s.Admin.Username, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("looking up admin user %q: %w", s.Admin.Username, err)
+		}
+	}
+
+	for _, g := range s.Groups {
+		if _, err := database.GetManagedGroup(app, g.Name); err == sql.ErrNoRows {
+			if err := database.CreateManagedGroup(app, g.Name, g.DisplayName); err != nil {
+				return fmt.Errorf("creating group %q: %w", g.Name, err)
+			}
+			log.Printf("Created managed group: %s", g.Name)
+		} else if err != nil {
+			return fmt.Errorf("looking up group %q: %w", g.Name, err)
+		}
+	}
+
+	app.SysConfigMu.Lock()
+	sc := &app.SystemConfig
+	if len(s.Auth.Providers) > 0 {
+		providers := map[string]bool{}
+		for _, p := range s.Auth.Providers {
+			providers[strings.ToLower(p)] = true
+		}
+		sc.ProxyAuthEnabled = providers["proxy"]
+		sc.LocalAuthEnabled = providers["local"]
+		sc.LDAPAuthEnabled = providers["ldap"]
+		sc.OIDCAuthEnabled = providers["oidc"]
+	}
+	if s.Auth.SessionDays > 0 {
+		sc.SessionDays = s.Auth.SessionDays
+	} else if sc.SessionDays == 0 {
+		sc.SessionDays = 7
+	}
+	if sc.MaxSessions == 0 {
+		sc.MaxSessions = 10
+	}
+	if s.Auth.CookieSecure != nil {
+		sc.CookieSecure = *s.Auth.CookieSecure
+	} else if firstRun {
+		// There is no request to detect HTTPS from, so default to secure
+		// cookies; COOKIE_SECURE=false still overrides this at runtime.
+		sc.CookieSecure = true
+	}
+	if s.TrustedProxies != nil {
+		sc.TrustedProxies = strings.Join(s.TrustedProxies, ", ")
+	}
+	if l := s.LDAP; l != nil {
+		sc.LDAPServer = l.Server
+		sc.LDAPBindDN = l.BindDN
+		sc.LDAPBindPassword = l.BindPassword
+		sc.LDAPBaseDN = l.BaseDN
+		sc.LDAPUserFilter = l.UserFilter
+		sc.LDAPUserAttr = l.UserAttr
+		sc.LDAPEmailAttr = l.EmailAttr
+		sc.LDAPDisplayAttr = l.DisplayAttr
+		sc.LDAPStartTLS = l.StartTLS
+		sc.LDAPSkipVerify = l.SkipVerify
+		database.SetLDAPDefaults(sc)
+	}
+	if o := s.OIDC; o != nil {
+		sc.OIDCDisplayName = o.DisplayName
+		sc.OIDCIssuer = o.Issuer
+		sc.OIDCClientID = o.ClientID
+		sc.OIDCClientSecret = o.ClientSecret
+		sc.OIDCRedirectURL = o.RedirectURL
+		sc.OIDCScopes = o.Scopes
+		sc.OIDCGroupsClaim = o.GroupsClaim
+		database.SetOIDCDefaults(sc)
+	}
+	s.Discovery.apply(sc)
+	sc.SetupCompleted = true
+	app.SysConfigMu.Unlock()
+
+	if err := database.SaveSystemConfig(app); err != nil {
+		return fmt.Errorf("saving configuration: %w", err)
+	}
+
+	if firstRun {
+		log.Println("Unattended setup completed")
+	} else {
+		log.Println("Unattended setup applied (already set up)")
+	}
+	return nil
+}
+
+func (d SeedDiscovery) apply(sc *models.SystemConfig) {
+	if c := d.Docker; c != nil {
+		sc.DockerDiscoveryEnabled = c.Enabled
+		if c.SocketPath != "" {
+			sc.DockerSocketPath = c.SocketPath
+		}
+	}
+	if c := d.Traefik; c != nil {
+		sc.TraefikDiscoveryEnabled = c.Enabled
+		if c.URL != "" {
+			sc.TraefikURL = c.URL
+			sc.TraefikUsername = c.Username
+			sc.TraefikPassword = c.Password
+		}
+	}
+	if c := d.Nginx; c != nil {
+		sc.NginxDiscoveryEnabled = c.Enabled
+		if c.ConfigPath != "" {
+			sc.NginxConfigPath = c.ConfigPath
+		}
+	}
+	if c := d.NPM; c != nil {
+		sc.NPMDiscoveryEnabled = c.Enabled
+		if c.URL != "" {
+			sc.NPMUrl = c.URL
+			sc.NPMEmail = c.Email
+			sc.NPMPassword = c.Password
+		}
+	}
+	if c := d.Caddy; c != nil {
+		sc.CaddyDiscoveryEnabled = c.Enabled
+		if c.AdminURL != "" {
+			sc.CaddyAdminURL = c.AdminURL
+			sc.CaddyUsername = c.Username
+			sc.CaddyPassword = c.Password
+		}
+	}
+	if c := d.Unraid; c != nil {
+		sc.UnraidDiscoveryEnabled = c.Enabled
+		if c.URL != "" {
+			sc.UnraidURL = c.URL
+			sc.UnraidAPIKey = c.APIKey
+		}
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
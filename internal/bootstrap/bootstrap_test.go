@@ -0,0 +1,177 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dashgate/internal/crypto"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+func newTestApp(t *testing.T) *server.App {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "dashgate.db"))
+	app := server.New()
+	database.InitAuthConfigDefaults(app)
+	if err := database.InitDatabase(app); err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+	return app
+}
+
+func writeSeed(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seed.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SETUP_FILE", path)
+}
+
+func TestRun_SeedFileIsIdempotent(t *testing.T) {
+	app := newTestApp(t)
+	hash, _ := crypto.HashPassword("correct horse battery")
+	writeSeed(t, `
+admin:
+  username: root
+  password_hash: "`+hash+`"
+admin_group: admins
+auth:
+  providers: [local, proxy]
+  session_days: 14
+trusted_proxies: [10.0.0.0/8, 192.168.1.1]
+discovery:
+  docker:
+    enabled: true
+    socket_path: /var/run/docker.sock
+groups:
+  - name: media
+    display_name: Media
+  - name: family
+`)
+
+	if err := Run(app); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if database.NeedsSetup(app) {
+		t.Fatal("expected setup to be completed")
+	}
+	sc := app.SystemConfig
+	if !sc.LocalAuthEnabled || !sc.ProxyAuthEnabled || sc.LDAPAuthEnabled || sc.SessionDays != 14 || !sc.DockerDiscoveryEnabled {
+		t.Errorf("seed settings not applied: %+v", sc)
+	}
+	if sc.TrustedProxies != "10.0.0.0/8, 192.168.1.1" || len(app.TrustedProxyNets) != 1 || len(app.TrustedProxyIPs) != 1 {
+		t.Errorf("unexpected trusted proxies %q", sc.TrustedProxies)
+	}
+	user, err := database.GetUserByUsername(app, "root")
+	if err != nil || !crypto.CheckPassword("correct horse battery", user.PasswordHash) || user.GroupsJSON != `["admins"]` {
+		t.Fatalf("expected admin user root in admins, got %+v (%v)", user, err)
+	}
+
+	// A password changed after setup survives the next start
+	newHash, _ := crypto.HashPassword("changed later")
+	app.DB.Exec("UPDATE users SET password_hash = ? WHERE username = 'root'", newHash)
+	if err := Run(app); err != nil {
+		t.Fatalf("second Run failed: %v", err)
+	}
+	user, _ = database.GetUserByUsername(app, "root")
+	if !crypto.CheckPassword("changed later", user.PasswordHash) {
+		t.Error("expected the second run to keep the changed password")
+	}
+	var users, groups int
+	app.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	app.DB.QueryRow("SELECT COUNT(*) FROM managed_groups WHERE name IN ('media', 'family')").Scan(&groups)
+	if users != 1 || groups != 2 {
+		t.Errorf("expected 1 user and 2 groups after two runs, got %d and %d", users, groups)
+	}
+}
+
+func TestRun_EnvironmentOverridesFile(t *testing.T) {
+	app := newTestApp(t)
+	writeSeed(t, "auth:\n  providers: [local]\n")
+	t.Setenv("SETUP_AUTH_PROVIDERS", "proxy")
+	t.Setenv("SETUP_TRUSTED_PROXIES", "172.16.0.0/12")
+	t.Setenv("SETUP_GROUPS", "media:Media, kids")
+
+	if err := Run(app); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if app.SystemConfig.LocalAuthEnabled || !app.SystemConfig.ProxyAuthEnabled {
+		t.Error("expected SETUP_AUTH_PROVIDERS to replace the file's providers")
+	}
+	g, err := database.GetManagedGroup(app, "media")
+	if err != nil || g.DisplayName != "Media" {
+		t.Errorf("expected group media with display name Media, got %+v (%v)", g, err)
+	}
+	if _, err := database.GetManagedGroup(app, "kids"); err != nil {
+		t.Errorf("expected group kids, got %v", err)
+	}
+}
+
+func TestRun_LDAPDefaultsMatchRuntime(t *testing.T) {
+	app := newTestApp(t)
+	writeSeed(t, `
+auth:
+  providers: [ldap]
+ldap:
+  server: ldap://ldap.example.com:389
+  base_dn: dc=example,dc=com
+`)
+	if err := Run(app); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	sc := app.SystemConfig
+	if sc.LDAPUserFilter != "(uid=%s)" || sc.LDAPDisplayAttr != "cn" || sc.LDAPGroupAttr != "memberOf" {
+		t.Errorf("expected LDAP defaults to be saved, got %+v", sc)
+	}
+	if app.LDAPAuth == nil || app.LDAPAuth.DisplayAttr != sc.LDAPDisplayAttr || app.LDAPAuth.GroupAttr != sc.LDAPGroupAttr {
+		t.Errorf("expected the running LDAP config to use the saved defaults, got %+v", app.LDAPAuth)
+	}
+}
+
+func TestRun_ValidationErrorsChangeNothing(t *testing.T) {
+	app := newTestApp(t)
+	writeSeed(t, `
+admin:
+  username: root
+  password_hash: plaintext
+auth:
+  providers: [local, kerberos]
+trusted_proxies: [not-an-ip]
+discovery:
+  traefik:
+    enabled: true
+`)
+
+	err := Run(app)
+	if err == nil {
+		t.Fatal("expected validation to fail")
+	}
+	for _, want := range []string{"admin.password_hash", "kerberos", "not-an-ip", "discovery.traefik.url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got: %v", want, err)
+		}
+	}
+	if !database.NeedsSetup(app) {
+		t.Error("expected setup to still be pending")
+	}
+
+	writeSeed(t, "admin:\n  username: root\n  pasword_hash: typo\n")
+	if err := Run(app); err == nil || !strings.Contains(err.Error(), "pasword_hash") {
+		t.Errorf("expected unknown keys to be rejected, got %v", err)
+	}
+}
+
+func TestRun_NothingConfigured(t *testing.T) {
+	app := newTestApp(t)
+	if err := Run(app); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !database.NeedsSetup(app) {
+		t.Error("expected the setup wizard to stay available when nothing is configured")
+	}
+}
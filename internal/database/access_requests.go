@@ -0,0 +1,277 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrAccessRequestNotFound is returned when no pending request has the
+// given ID.
+var ErrAccessRequestNotFound = errors.New("access request not found")
+
+// ErrGroupGrantNotFound is returned when no grant has the given ID.
+var ErrGroupGrantNotFound = errors.New("group grant not found")
+
+const accessRequestColumns = "id, username, app_name, groups, reason, status, decided_by, decided_at, created_at"
+
+func scanAccessRequest(scan func(...interface{}) error) (*models.AccessRequest, error) {
+	var req models.AccessRequest
+	var groupsJSON string
+	var decidedAt sql.NullTime
+	if err := scan(&req.ID, &req.Username, &req.App, &groupsJSON, &req.Reason, &req.Status, &req.DecidedBy, &decidedAt, &req.CreatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(groupsJSON), &req.Groups)
+	if req.Groups == nil {
+		req.Groups = []string{}
+	}
+	if decidedAt.Valid {
+		req.DecidedAt = &decidedAt.Time
+	}
+	return &req, nil
+}
+
+func queryAccessRequests(app *server.App, query string, args ...interface{}) ([]models.AccessRequest, error) {
+	rows, err := app.DB.Query("SELECT "+accessRequestColumns+" FROM access_requests "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.AccessRequest{}
+	for rows.Next() {
+		req, err := scanAccessRequest(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// ListPendingAccessRequests returns the requests waiting for a decision,
+// oldest first.
+func ListPendingAccessRequests(app *server.App) ([]models.AccessRequest, error) {
+	return queryAccessRequests(app, "WHERE status = 'pending' ORDER BY created_at, id")
+}
+
+// ListUserAccessRequests returns a user's requests, newest first.
+func ListUserAccessRequests(app *server.App, username string) ([]models.AccessRequest, error) {
+	return queryAccessRequests(app, "WHERE username = ? ORDER BY created_at DESC, id DESC LIMIT 50", username)
+}
+
+// CountPendingAccessRequests returns how many of a user's requests are
+// waiting for a decision, and whether one of them is for appName.
+func CountPendingAccessRequests(app *server.App, username, appName string) (count int, forApp bool, err error) {
+	err = app.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(app_name = ?), 0) > 0 FROM access_requests WHERE username = ? AND status = 'pending'",
+		appName, username,
+	).Scan(&count, &forApp)
+	return count, forApp, err
+}
+
+// CreateAccessRequest stores a pending request and returns its ID.
+func CreateAccessRequest(app *server.App, username, appName string, groups []string, reason string) (int64, error) {
+	result, err := app.DB.Exec(
+		"INSERT INTO access_requests (username, app_name, groups, reason, status, created_at) VALUES (?, ?, ?, ?, 'pending', ?)",
+		username, appName, MarshalListJSON(groups), reason, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetPendingAccessRequest returns a request waiting for a decision, or
+// ErrAccessRequestNotFound.
+func GetPendingAccessRequest(app *server.App, id int) (*models.AccessRequest, error) {
+	req, err := scanAccessRequest(app.DB.QueryRow("SELECT "+accessRequestColumns+" FROM access_requests WHERE id = ? AND status = 'pending'", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessRequestNotFound
+	}
+	return req, err
+}
+
+// DecideAccessRequest marks a pending request approved or denied. It returns
+// ErrAccessRequestNotFound if the request was decided in the meantime.
+func DecideAccessRequest(app *server.App, id int, status, decidedBy string) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := decideAccessRequest(tx, id, status, decidedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ApproveAccessRequest approves a pending request and grants the user group
+// until expiresAt in one transaction, so a request is never left approved
+// without its grant. It returns the grant's ID, or ErrAccessRequestNotFound
+// if the request was decided in the meantime.
+func ApproveAccessRequest(app *server.App, id int, decidedBy, username, group string, expiresAt time.Time) (int64, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := decideAccessRequest(tx, id, "approved", decidedBy); err != nil {
+		return 0, err
+	}
+	grantID, err := grantGroup(tx, username, group, decidedBy, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return grantID, tx.Commit()
+}
+
+func decideAccessRequest(tx *sql.Tx, id int, status, decidedBy string) error {
+	result, err := tx.Exec(
+		"UPDATE access_requests SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = 'pending'",
+		status, decidedBy, time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAccessRequestNotFound
+	}
+	return nil
+}
+
+// ListGroupGrants returns the unexpired grants, soonest to expire first.
+// With a username, only that user's grants are returned.
+func ListGroupGrants(app *server.App, username string) ([]models.GroupGrant, error) {
+	query := "SELECT id, username, group_name, granted_by, created_at, expires_at FROM group_grants WHERE expires_at > ?"
+	args := []interface{}{time.Now()}
+	if username != "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	rows, err := app.DB.Query(query+" ORDER BY expires_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []models.GroupGrant{}
+	for rows.Next() {
+		var g models.GroupGrant
+		if err := rows.Scan(&g.ID, &g.Username, &g.Group, &g.GrantedBy, &g.CreatedAt, &g.ExpiresAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// ActiveGrantedGroups returns the groups a user holds through unexpired
+// grants.
+func ActiveGrantedGroups(app *server.App, username string) ([]string, error) {
+	rows, err := app.DB.Query("SELECT DISTINCT group_name FROM group_grants WHERE username = ? AND expires_at > ?", username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var g string
+		if err := rows.Scan(&g); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GrantGroup gives a user a group until expiresAt. An unexpired grant of the
+// same group is extended or shortened instead of duplicated. It returns the
+// grant's ID.
+func GrantGroup(app *server.App, username, group, grantedBy string, expiresAt time.Time) (int64, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := grantGroup(tx, username, group, grantedBy, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func grantGroup(tx *sql.Tx, username, group, grantedBy string, expiresAt time.Time) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM group_grants WHERE username = ? AND group_name = ? AND expires_at > ?", username, group, time.Now()).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(
+			"INSERT INTO group_grants (username, group_name, granted_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+			username, group, grantedBy, time.Now(), expiresAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	case err != nil:
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE group_grants SET granted_by = ?, expires_at = ? WHERE id = ?", grantedBy, expiresAt, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// RevokeGroupGrant deletes a grant and returns it.
+func RevokeGroupGrant(app *server.App, id int) (*models.GroupGrant, error) {
+	var g models.GroupGrant
+	err := app.DB.QueryRow("SELECT id, username, group_name, granted_by, created_at, expires_at FROM group_grants WHERE id = ?", id).
+		Scan(&g.ID, &g.Username, &g.Group, &g.GrantedBy, &g.CreatedAt, &g.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupGrantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := app.DB.Exec("DELETE FROM group_grants WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// DeleteExpiredGroupGrants removes grants that have run out and returns them.
+func DeleteExpiredGroupGrants(app *server.App) ([]models.GroupGrant, error) {
+	now := time.Now()
+	rows, err := app.DB.Query("SELECT id, username, group_name, granted_by, created_at, expires_at FROM group_grants WHERE expires_at <= ?", now)
+	if err != nil {
+		return nil, err
+	}
+	var expired []models.GroupGrant
+	for rows.Next() {
+		var g models.GroupGrant
+		if err := rows.Scan(&g.ID, &g.Username, &g.Group, &g.GrantedBy, &g.CreatedAt, &g.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired = append(expired, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Deleted after iterating to avoid a deadlock with SetMaxOpenConns(1)
+	for _, g := range expired {
+		if _, err := app.DB.Exec("DELETE FROM group_grants WHERE id = ?", g.ID); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// GetLockedUntil returns when the lockout on username ends, or nil if the
+// account is not currently locked.
+func GetLockedUntil(app *server.App, username string) (*time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := app.DB.QueryRow(
+		"SELECT locked_until FROM login_attempts WHERE username = ?",
+		strings.ToLower(username),
+	).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !lockedUntil.Valid || !lockedUntil.Time.After(time.Now()) {
+		return nil, nil
+	}
+	return &lockedUntil.Time, nil
+}
+
+// RecordFailedLogin counts a failed login for username. Failures older than
+// window are forgotten. Once threshold failures accumulate the account is
+// locked for window and the lock expiry is returned; otherwise nil.
+// Attempts are tracked by username whether or not the account exists, so
+// lockout responses do not reveal which usernames are valid.
+func RecordFailedLogin(app *server.App, username string, threshold int, window time.Duration) (*time.Time, error) {
+	username = strings.ToLower(username)
+	now := time.Now()
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	var lastFailed sql.NullTime
+	err = tx.QueryRow("SELECT failed_count, last_failed_at FROM login_attempts WHERE username = ?", username).Scan(&count, &lastFailed)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if !lastFailed.Valid || now.Sub(lastFailed.Time) > window {
+		count = 0
+	}
+	count++
+
+	var lockedUntil *time.Time
+	if threshold > 0 && count >= threshold {
+		until := now.Add(window)
+		lockedUntil = &until
+		count = 0
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO login_attempts (username, failed_count, last_failed_at, locked_until) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(username) DO UPDATE SET
+		   failed_count = excluded.failed_count,
+		   last_failed_at = excluded.last_failed_at,
+		   locked_until = COALESCE(excluded.locked_until, login_attempts.locked_until)`,
+		username, count, now, lockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return lockedUntil, tx.Commit()
+}
+
+// ClearLoginAttempts resets the failure count and any lockout for username.
+func ClearLoginAttempts(app *server.App, username string) error {
+	_, err := app.DB.Exec("DELETE FROM login_attempts WHERE username = ?", strings.ToLower(username))
+	if err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
+	return err
+}
+
+// GetPasswordHistory returns up to limit of the user's previous password
+// hashes, newest first.
+func GetPasswordHistory(app *server.App, userID, limit int) ([]string, error) {
+	rows, err := app.DB.Query(
+		"SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// AddPasswordHistory remembers a password hash the user is moving away from
+// and trims the history to the newest keep entries.
+func AddPasswordHistory(app *server.App, userID int, passwordHash string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	if _, err := app.DB.Exec(
+		"INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?)",
+		userID, passwordHash, time.Now(),
+	); err != nil {
+		return err
+	}
+	_, err := app.DB.Exec(
+		`DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`,
+		userID, userID, keep,
+	)
+	return err
+}
+
+// GetPasswordHashByID returns the stored password hash for a user.
+func GetPasswordHashByID(app *server.App, id int) (string, error) {
+	var hash string
+	err := app.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", id).Scan(&hash)
+	return hash, err
+}
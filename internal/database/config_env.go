@@ -0,0 +1,167 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// legacyConfigEnv maps system_config keys to the variables that set them
+// before DASHGATE_* existed. They still work, but DASHGATE_* wins.
+var legacyConfigEnv = map[string]string{
+	"docker_discovery_enabled":  "DOCKER_DISCOVERY",
+	"docker_socket_path":        "DOCKER_SOCKET",
+	"traefik_discovery_enabled": "TRAEFIK_DISCOVERY",
+	"traefik_url":               "TRAEFIK_URL",
+	"traefik_username":          "TRAEFIK_USERNAME",
+	"traefik_password":          "TRAEFIK_PASSWORD",
+	"nginx_discovery_enabled":   "NGINX_DISCOVERY",
+	"nginx_config_path":         "NGINX_CONFIG_PATH",
+	"npm_discovery_enabled":     "NPM_DISCOVERY",
+	"npm_url":                   "NPM_URL",
+	"npm_email":                 "NPM_EMAIL",
+	"npm_password":              "NPM_PASSWORD",
+	"caddy_discovery_enabled":   "CADDY_DISCOVERY",
+	"caddy_admin_url":           "CADDY_ADMIN_URL",
+	"caddy_username":            "CADDY_USERNAME",
+	"caddy_password":            "CADDY_PASSWORD",
+	"unraid_discovery_enabled":  "UNRAID_DISCOVERY",
+	"unraid_url":                "UNRAID_URL",
+	"unraid_api_key":            "UNRAID_API_KEY",
+	"lldap_url":                 "LLDAP_URL",
+	"lldap_admin_username":      "LLDAP_ADMIN_USERNAME",
+	"lldap_admin_password":      "LLDAP_ADMIN_PASSWORD",
+	"oidc_display_name":         "OIDC_DISPLAY_NAME",
+}
+
+// ConfigEnvName returns the DASHGATE_* variable for a system_config key,
+// e.g. DASHGATE_SESSION_DAYS for session_days.
+func ConfigEnvName(key string) string {
+	return "DASHGATE_" + strings.ToUpper(key)
+}
+
+// LoadConfigEnv reads DASHGATE_<KEY>, or DASHGATE_<KEY>_FILE for values
+// mounted as files such as Docker secrets, for every system config key and
+// applies them over the stored configuration. Keys set this way are locked:
+// SaveSystemConfig never persists them and always restores the environment
+// value, so they cannot be changed from the admin UI. All invalid values are
+// reported together.
+func LoadConfigEnv(app *server.App) error {
+	// The zero config tells each key's type: booleans format as "false"
+	// and numbers as "0"
+	kinds := systemConfigValues(&models.SystemConfig{})
+	keys := make([]string, 0, len(kinds))
+	for key := range kinds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := map[string]server.ConfigEnvValue{}
+	var errs []error
+	for _, key := range keys {
+		name := ConfigEnvName(key)
+		value, set, err := lookupConfigEnv(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !set {
+			if legacy, ok := legacyConfigEnv[key]; ok && os.Getenv(legacy) != "" {
+				name, value, set = legacy, os.Getenv(legacy), true
+				// As before DASHGATE_*, a legacy switch only turns a
+				// feature on, and only when set to exactly "true"
+				if kinds[key] == "false" && value != "true" {
+					log.Printf("WARNING: ignoring %s=%q; only \"true\" has an effect (use %s to turn it off)", legacy, value, ConfigEnvName(key))
+					set = false
+				}
+			}
+		}
+		if !set {
+			continue
+		}
+
+		switch kinds[key] {
+		case "false":
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not true or false", name, value))
+				continue
+			}
+			value = strconv.FormatBool(b)
+		case "0":
+			value = strings.TrimSpace(value)
+			if _, err := strconv.Atoi(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a whole number", name, value))
+				continue
+			}
+		}
+		env[key] = server.ConfigEnvValue{Var: name, Value: value}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// The legacy LLDAP variables enable LLDAP when all three are set
+	if _, ok := env["lldap_enabled"]; !ok && env["lldap_url"].Var == "LLDAP_URL" &&
+		env["lldap_admin_username"].Var == "LLDAP_ADMIN_USERNAME" && env["lldap_admin_password"].Var == "LLDAP_ADMIN_PASSWORD" {
+		env["lldap_enabled"] = server.ConfigEnvValue{Var: "LLDAP_URL", Value: "true"}
+	}
+
+	app.SysConfigMu.Lock()
+	app.ConfigEnv = env
+	applyConfigEnv(app)
+	app.SysConfigMu.Unlock()
+
+	if len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for _, v := range env {
+			names = append(names, v.Var)
+		}
+		sort.Strings(names)
+		log.Printf("System config set from the environment: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// lookupConfigEnv returns the value of name, or the contents of the file
+// named by name_FILE without its trailing newline.
+func lookupConfigEnv(name string) (string, bool, error) {
+	value, set := os.LookupEnv(name)
+	path, fileSet := os.LookupEnv(name + "_FILE")
+	if set && fileSet {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	}
+	if fileSet {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return value, set, nil
+}
+
+// applyConfigEnv overwrites the locked keys with their environment values.
+// The caller must hold SysConfigMu.
+func applyConfigEnv(app *server.App) {
+	for key, v := range app.ConfigEnv {
+		setSystemConfigValue(&app.SystemConfig, key, v.Value)
+	}
+}
+
+// ConfigEnvLocks returns the locked system_config keys and the variables
+// that set them.
+func ConfigEnvLocks(app *server.App) map[string]string {
+	locks := make(map[string]string, len(app.ConfigEnv))
+	for key, v := range app.ConfigEnv {
+		locks[key] = v.Var
+	}
+	return locks
+}
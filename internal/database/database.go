@@ -103,6 +103,9 @@ func InitDatabase(app *server.App) error {
 		password_hash TEXT NOT NULL,
 		display_name TEXT,
 		groups TEXT DEFAULT '[]',
+		granted_groups TEXT NOT NULL DEFAULT '[]',
+		disabled INTEGER NOT NULL DEFAULT 0,
+		external_id TEXT NOT NULL DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -113,6 +116,11 @@ func InitDatabase(app *server.App) error {
 		token TEXT UNIQUE NOT NULL,
 		expires_at DATETIME NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		auth_source TEXT NOT NULL DEFAULT '',
+		last_seen_at DATETIME,
+		id_token TEXT NOT NULL DEFAULT '',
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);
 
@@ -133,6 +141,9 @@ func InitDatabase(app *server.App) error {
 		permissions TEXT DEFAULT '["read"]',
 		expires_at DATETIME,
 		last_used_at DATETIME,
+		allowed_networks TEXT NOT NULL DEFAULT '',
+		personal INTEGER NOT NULL DEFAULT 0,
+		reminder_sent_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
 	);
@@ -140,6 +151,26 @@ func InitDatabase(app *server.App) error {
 	CREATE TABLE IF NOT EXISTS oidc_states (
 		state TEXT PRIMARY KEY,
 		redirect_url TEXT,
+		invite_id INTEGER NOT NULL DEFAULT 0,
+		code_verifier TEXT NOT NULL DEFAULT '',
+		nonce TEXT NOT NULL DEFAULT '',
+		provider_id TEXT NOT NULL DEFAULT '',
+		link_user_id INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS oidc_providers (
+		id TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL,
+		issuer TEXT NOT NULL,
+		client_id TEXT NOT NULL,
+		client_secret TEXT NOT NULL DEFAULT '',
+		redirect_url TEXT NOT NULL DEFAULT '',
+		scopes TEXT NOT NULL DEFAULT '',
+		groups_claim TEXT NOT NULL DEFAULT '',
+		group_mapping TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		sort_order INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -166,11 +197,135 @@ func InitDatabase(app *server.App) error {
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		username TEXT PRIMARY KEY,
+		failed_count INTEGER NOT NULL DEFAULT 0,
+		last_failed_at DATETIME,
+		locked_until DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS password_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT UNIQUE NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		groups TEXT NOT NULL DEFAULT '[]',
+		note TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		used_by TEXT NOT NULL DEFAULT '',
+		revoked_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME,
+		UNIQUE (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS network_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		target TEXT NOT NULL,
+		networks TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS idp_clients (
+		client_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		secret_hash TEXT NOT NULL,
+		redirect_uris TEXT NOT NULL DEFAULT '[]',
+		allowed_groups TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS idp_auth_codes (
+		code TEXT PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		redirect_uri TEXT NOT NULL,
+		scope TEXT NOT NULL,
+		nonce TEXT NOT NULL DEFAULT '',
+		code_challenge TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (client_id) REFERENCES idp_clients(client_id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS idp_signing_keys (
+		kid TEXT PRIMARY KEY,
+		private_key TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS access_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		app_name TEXT NOT NULL,
+		groups TEXT NOT NULL DEFAULT '[]',
+		reason TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		decided_by TEXT NOT NULL DEFAULT '',
+		decided_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS group_grants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		group_name TEXT NOT NULL,
+		granted_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS display_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		token_prefix TEXT NOT NULL,
+		groups TEXT NOT NULL DEFAULT '[]',
+		allowed_networks TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 	CREATE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys(key_prefix);
+	CREATE INDEX IF NOT EXISTS idx_group_grants_username ON group_grants(username);
 	CREATE INDEX IF NOT EXISTS idx_oidc_states_created ON oidc_states(created_at);
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+	CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id);
+	CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_user_preferences_username ON user_preferences(username) WHERE username != '';
 	`
 
@@ -191,6 +346,68 @@ func InitDatabase(app *server.App) error {
 		}
 	}
 	app.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_preferences_username ON user_preferences(username) WHERE username != ''")
+	for _, col := range []string{
+		"ip TEXT NOT NULL DEFAULT ''",
+		"user_agent TEXT NOT NULL DEFAULT ''",
+		"auth_source TEXT NOT NULL DEFAULT ''",
+		"last_seen_at DATETIME",
+		"id_token TEXT NOT NULL DEFAULT ''",
+	} {
+		if _, err := app.DB.Exec("ALTER TABLE sessions ADD COLUMN " + col); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (sessions %s): %v", strings.Fields(col)[0], err)
+			}
+		}
+	}
+
+	for _, col := range []string{
+		"granted_groups TEXT NOT NULL DEFAULT '[]'",
+		"disabled INTEGER NOT NULL DEFAULT 0",
+		"external_id TEXT NOT NULL DEFAULT ''",
+	} {
+		if _, err := app.DB.Exec("ALTER TABLE users ADD COLUMN " + col); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (users %s): %v", strings.Fields(col)[0], err)
+			}
+		}
+	}
+	for _, col := range []string{
+		"allowed_networks TEXT NOT NULL DEFAULT ''",
+		"personal INTEGER NOT NULL DEFAULT 0",
+		"reminder_sent_at DATETIME",
+	} {
+		if _, err := app.DB.Exec("ALTER TABLE api_keys ADD COLUMN " + col); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (api_keys %s): %v", strings.Fields(col)[0], err)
+			}
+		}
+	}
+	for _, col := range []string{
+		"invite_id INTEGER NOT NULL DEFAULT 0",
+		"code_verifier TEXT NOT NULL DEFAULT ''",
+		"nonce TEXT NOT NULL DEFAULT ''",
+		"provider_id TEXT NOT NULL DEFAULT ''",
+		"link_user_id INTEGER NOT NULL DEFAULT 0",
+	} {
+		if _, err := app.DB.Exec("ALTER TABLE oidc_states ADD COLUMN " + col); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (oidc_states %s): %v", strings.Fields(col)[0], err)
+			}
+		}
+	}
+
+	// One-off data migrations
+	if _, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			name TEXT PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	if err := runMigrationOnce(app, "hash_session_tokens", hashStoredTokens); err != nil {
+		return fmt.Errorf("failed to hash stored session tokens: %w", err)
+	}
 
 	// Create managed_groups table
 	if _, err := app.DB.Exec(`
@@ -203,22 +420,27 @@ func InitDatabase(app *server.App) error {
 		return fmt.Errorf("failed to create managed_groups table: %w", err)
 	}
 
-	// Create audit log table
-	if err := audit.InitAuditTable(app); err != nil {
-		return fmt.Errorf("failed to create audit_log table: %w", err)
-	}
-
 	log.Printf("Database initialized at %s", dbPath)
 
 	// Initialize encryption key before loading config so sensitive values
 	// can be decrypted on read and encrypted on write.
 	InitEncryptionKey(app)
 
+	// Create audit log table. Its hash chain key is stored encrypted.
+	if err := audit.InitAuditTable(app); err != nil {
+		return fmt.Errorf("failed to create audit_log table: %w", err)
+	}
+
 	// Load system config from database (overrides env defaults)
 	if err := LoadSystemConfig(app); err != nil {
 		log.Printf("No system config found, using defaults: %v", err)
 	}
 
+	// DASHGATE_* environment variables override and lock stored settings
+	if err := LoadConfigEnv(app); err != nil {
+		return fmt.Errorf("invalid configuration in environment:\n%w", err)
+	}
+
 	// Apply system config to auth config
 	ApplySystemConfig(app)
 
@@ -250,6 +472,74 @@ func InitDatabase(app *server.App) error {
 		log.Printf("Warning: failed to load discovered overrides: %v", err)
 	}
 
+	if err := ReloadNetworkPolicies(app); err != nil {
+		log.Printf("Warning: failed to load network policies: %v", err)
+	}
+
+	return nil
+}
+
+// runMigrationOnce runs fn inside a transaction unless a migration with the
+// given name has already been recorded in schema_migrations.
+func runMigrationOnce(app *server.App, name string, fn func(tx *sql.Tx) error) error {
+	var applied int
+	if err := app.DB.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE name = ?", name).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (name) VALUES (?)", name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// hashStoredTokens replaces raw session tokens with their SHA-256 so existing
+// sessions stay valid, and drops pending OIDC states, which only live for a
+// few minutes anyway.
+func hashStoredTokens(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, token FROM sessions")
+	if err != nil {
+		return err
+	}
+	hashed := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		hashed[id] = HashToken(token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, hash := range hashed {
+		if _, err := tx.Exec("UPDATE sessions SET token = ? WHERE id = ?", hash, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM oidc_states"); err != nil {
+		return err
+	}
+
+	if len(hashed) > 0 {
+		log.Printf("MIGRATION: hashed %d stored session tokens", len(hashed))
+	}
 	return nil
 }
 
@@ -271,6 +561,9 @@ func StartSessionCleanupLoop(app *server.App, ctx context.Context) {
 				return
 			case <-ticker.C:
 				CleanupExpiredSessions(app)
+				CleanupPasswordResetTokens(app)
+				CleanupIDPAuthCodes(app)
+				CleanupAuditLog(app)
 			}
 		}
 	}()
@@ -291,6 +584,22 @@ func CleanupExpiredSessions(app *server.App) {
 	}
 }
 
+// CleanupAuditLog applies the audit log retention policy.
+func CleanupAuditLog(app *server.App) {
+	app.SysConfigMu.RLock()
+	days := app.SystemConfig.AuditRetentionDays
+	app.SysConfigMu.RUnlock()
+
+	n, err := audit.Prune(app, days)
+	if err != nil {
+		log.Printf("Error pruning audit log: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Removed %d audit log entries older than %d days", n, days)
+	}
+}
+
 // NeedsSetup returns true if the application requires initial setup
 // (no setup completed flag and no local users exist).
 func NeedsSetup(app *server.App) bool {
@@ -327,6 +636,15 @@ func CreateAdminUser(app *server.App, username, password, email, displayName str
 	if err != nil {
 		return err
 	}
+	return CreateAdminUserWithHash(app, username, hashedPassword, email, displayName)
+}
+
+// CreateAdminUserWithHash creates a new admin user from an existing bcrypt
+// password hash, as used by unattended setup.
+func CreateAdminUserWithHash(app *server.App, username, hashedPassword, email, displayName string) error {
+	if app.DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
 
 	// Admin user gets the configured admin groups
 	app.SysConfigMu.RLock()
@@ -353,7 +671,7 @@ func CreateAdminUser(app *server.App, username, password, email, displayName str
 		displayName = "Administrator"
 	}
 
-	_, err = app.DB.Exec(
+	_, err := app.DB.Exec(
 		"INSERT INTO users (username, email, password_hash, display_name, groups) VALUES (?, ?, ?, ?, ?)",
 		username, email, hashedPassword, displayName, groups,
 	)
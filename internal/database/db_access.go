@@ -1,11 +1,14 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"time"
 
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
@@ -17,6 +20,7 @@ type UserRow struct {
 	GroupsJSON   string
 	PasswordHash string
 	CreatedAt    string
+	Disabled     bool
 }
 
 type SessionUser struct {
@@ -26,14 +30,28 @@ type SessionUser struct {
 	DisplayName  string
 	GroupsJSON   string
 	PasswordHash string
+	AuthSource   string
 }
 
 func GetUserByUsername(app *server.App, username string) (*UserRow, error) {
 	var u UserRow
 	err := app.DB.QueryRow(
-		"SELECT id, username, COALESCE(email,''), COALESCE(display_name,''), groups, password_hash, COALESCE(created_at,'') FROM users WHERE username = ?",
+		"SELECT id, username, COALESCE(email,''), COALESCE(display_name,''), groups, password_hash, COALESCE(created_at,''), disabled FROM users WHERE username = ?",
 		username,
-	).Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.GroupsJSON, &u.PasswordHash, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.GroupsJSON, &u.PasswordHash, &u.CreatedAt, &u.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByID returns a user by ID.
+func GetUserByID(app *server.App, id int) (*UserRow, error) {
+	var u UserRow
+	err := app.DB.QueryRow(
+		"SELECT id, username, COALESCE(email,''), COALESCE(display_name,''), groups, password_hash, COALESCE(created_at,''), disabled FROM users WHERE id = ?",
+		id,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.GroupsJSON, &u.PasswordHash, &u.CreatedAt, &u.Disabled)
 	if err != nil {
 		return nil, err
 	}
@@ -52,12 +70,32 @@ func GetUsernameByID(app *server.App, id int) (string, error) {
 	return username, err
 }
 
+// GetUserGroupsByID returns the groups of a user.
+func GetUserGroupsByID(app *server.App, id int) ([]string, error) {
+	var groupsJSON string
+	if err := app.DB.QueryRow("SELECT groups FROM users WHERE id = ?", id).Scan(&groupsJSON); err != nil {
+		return nil, err
+	}
+	var groups []string
+	json.Unmarshal([]byte(groupsJSON), &groups)
+	return groups, nil
+}
+
+// HashToken returns the hex-encoded SHA-256 of a session token or OIDC state.
+// Only the hash is stored, so a copy of the database cannot be used to
+// hijack sessions. Tokens are high-entropy random values, so an unsalted
+// hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetUserBySession(app *server.App, token string) (*SessionUser, error) {
 	var su SessionUser
 	err := app.DB.QueryRow(
-		"SELECT u.id, u.username, COALESCE(u.email,''), COALESCE(u.display_name,''), u.groups, u.password_hash FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.token = ? AND s.expires_at > datetime('now')",
-		token,
-	).Scan(&su.ID, &su.Username, &su.Email, &su.DisplayName, &su.GroupsJSON, &su.PasswordHash)
+		"SELECT u.id, u.username, COALESCE(u.email,''), COALESCE(u.display_name,''), u.groups, u.password_hash, s.auth_source FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.token = ? AND s.expires_at > datetime('now') AND u.disabled = 0",
+		HashToken(token),
+	).Scan(&su.ID, &su.Username, &su.Email, &su.DisplayName, &su.GroupsJSON, &su.PasswordHash, &su.AuthSource)
 	if err != nil {
 		return nil, err
 	}
@@ -86,23 +124,6 @@ func CreateLDAPUser(app *server.App, username, email, displayName, groupsJSON st
 	return result.LastInsertId()
 }
 
-func UpsertLDAPUser(app *server.App, username, email, displayName, groupsJSON string) error {
-	_, err := app.DB.Exec(
-		`INSERT INTO users (username, email, password_hash, display_name, groups)
-		 VALUES (?, ?, 'LDAP_USER', ?, ?)
-		 ON CONFLICT(username) DO UPDATE SET
-		   email = excluded.email,
-		   display_name = excluded.display_name,
-		   groups = excluded.groups,
-		   updated_at = ?`,
-		username, email, displayName, groupsJSON, time.Now(),
-	)
-	if err != nil {
-		log.Printf("Failed to upsert LDAP user: %v", err)
-	}
-	return err
-}
-
 func UpdateUser(app *server.App, id int, username, email, displayName, groups string) (int64, error) {
 	result, err := app.DB.Exec(
 		"UPDATE users SET username = ?, email = ?, display_name = ?, groups = ?, updated_at = ? WHERE id = ?",
@@ -125,7 +146,18 @@ func UpdateUserFields(app *server.App, id int, email, displayName, groups string
 	return result.RowsAffected()
 }
 
+// DeleteUser removes a user along with their personal API keys.
 func DeleteUser(app *server.App, id int) (int64, error) {
+	if _, err := app.DB.Exec("DELETE FROM api_keys WHERE user_id = ? AND personal = 1", id); err != nil {
+		return 0, err
+	}
+	// Grants and requests are keyed by username, so a later account with
+	// the same name must not inherit them
+	for _, table := range []string{"group_grants", "access_requests"} {
+		if _, err := app.DB.Exec("DELETE FROM "+table+" WHERE username = (SELECT username FROM users WHERE id = ?)", id); err != nil {
+			return 0, err
+		}
+	}
 	result, err := app.DB.Exec("DELETE FROM users WHERE id = ?", id)
 	if err != nil {
 		return 0, err
@@ -152,7 +184,8 @@ func ListUsers(app *server.App) (*sql.Rows, error) {
 
 func ListUsersAdmin(app *server.App) (*sql.Rows, error) {
 	return app.DB.Query(
-		"SELECT id, username, COALESCE(email,''), COALESCE(display_name,username), COALESCE(groups,'[]'), created_at, updated_at FROM users ORDER BY username",
+		`SELECT u.id, u.username, COALESCE(u.email,''), COALESCE(u.display_name,u.username), COALESCE(u.groups,'[]'), u.created_at, u.updated_at, la.locked_until, u.disabled
+		 FROM users u LEFT JOIN login_attempts la ON la.username = lower(u.username) ORDER BY u.username`,
 	)
 }
 
@@ -162,36 +195,113 @@ func UserCount(app *server.App) (int, error) {
 	return count, err
 }
 
-func UpsertOIDCUser(app *server.App, username, email, displayName, groupsJSON string) error {
+// SessionInfo is the client metadata recorded when a session is created.
+type SessionInfo struct {
+	IP         string
+	UserAgent  string
+	AuthSource string
+	// IDToken is the raw OIDC ID token, kept for RP-initiated logout.
+	IDToken string
+}
+
+func CreateSession(app *server.App, userID int, token string, expiresAt time.Time, info SessionInfo) error {
 	_, err := app.DB.Exec(
-		`INSERT INTO users (username, email, password_hash, display_name, groups)
-		 VALUES (?, ?, 'OIDC_USER', ?, ?)
-		 ON CONFLICT(username) DO UPDATE SET
-		   email = excluded.email,
-		   display_name = excluded.display_name,
-		   groups = excluded.groups,
-		   updated_at = ?`,
-		username, email, displayName, groupsJSON, time.Now(),
+		"INSERT INTO sessions (user_id, token, expires_at, ip, user_agent, auth_source, id_token, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, HashToken(token), expiresAt, info.IP, info.UserAgent, info.AuthSource, info.IDToken, time.Now(),
 	)
 	if err != nil {
-		log.Printf("Failed to upsert OIDC user: %v", err)
+		log.Printf("Error creating session: %v", err)
 	}
 	return err
 }
 
-func CreateSession(app *server.App, userID int, token string, expiresAt time.Time) error {
+// PruneUserSessions keeps only the max most recently used sessions for a user,
+// signing out the oldest devices first. A max of zero or less is unlimited.
+func PruneUserSessions(app *server.App, userID, max int) error {
+	if max <= 0 {
+		return nil
+	}
 	_, err := app.DB.Exec(
-		"INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, ?)",
-		userID, token, expiresAt,
+		`DELETE FROM sessions WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM sessions WHERE user_id = ?
+			ORDER BY COALESCE(last_seen_at, created_at) DESC, id DESC LIMIT ?
+		)`,
+		userID, userID, max,
 	)
 	if err != nil {
-		log.Printf("Error creating session: %v", err)
+		log.Printf("Error pruning sessions for user %d: %v", userID, err)
 	}
 	return err
 }
 
+// TouchSession records activity on a session. Updates are throttled to one
+// per minute so that every authenticated request does not cause a write.
+func TouchSession(app *server.App, token string) {
+	now := time.Now()
+	if _, err := app.DB.Exec(
+		"UPDATE sessions SET last_seen_at = ? WHERE token = ? AND (last_seen_at IS NULL OR last_seen_at < ?)",
+		now, HashToken(token), now.Add(-time.Minute),
+	); err != nil {
+		log.Printf("Error updating session last_seen_at: %v", err)
+	}
+}
+
+// ListUserSessions returns the unexpired sessions of a user, most recently
+// used first. The session matching currentToken is flagged as current.
+func ListUserSessions(app *server.App, userID int, currentToken string) ([]models.UserSession, error) {
+	rows, err := app.DB.Query(
+		`SELECT id, token, ip, user_agent, auth_source, created_at, last_seen_at, expires_at
+		 FROM sessions WHERE user_id = ? AND expires_at > datetime('now')
+		 ORDER BY COALESCE(last_seen_at, created_at) DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := ""
+	if currentToken != "" {
+		currentHash = HashToken(currentToken)
+	}
+
+	sessions := []models.UserSession{}
+	for rows.Next() {
+		var s models.UserSession
+		var tokenHash string
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&s.ID, &tokenHash, &s.IP, &s.UserAgent, &s.AuthSource, &s.CreatedAt, &lastSeen, &s.ExpiresAt); err != nil {
+			log.Printf("Error scanning session: %v", err)
+			continue
+		}
+		if lastSeen.Valid {
+			s.LastSeenAt = &lastSeen.Time
+		}
+		s.Current = currentHash != "" && tokenHash == currentHash
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession deletes a single session, scoped to its owner so users
+// cannot revoke each other's sessions by guessing IDs.
+func DeleteUserSession(app *server.App, userID, sessionID int) (int64, error) {
+	result, err := app.DB.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetSessionLogin returns how a session signed in and, for OIDC sessions, the
+// ID token it received.
+func GetSessionLogin(app *server.App, token string) (authSource, idToken string, err error) {
+	err = app.DB.QueryRow("SELECT auth_source, id_token FROM sessions WHERE token = ?", HashToken(token)).Scan(&authSource, &idToken)
+	return authSource, idToken, err
+}
+
 func DeleteSession(app *server.App, token string) {
-	if _, err := app.DB.Exec("DELETE FROM sessions WHERE token = ?", token); err != nil {
+	if _, err := app.DB.Exec("DELETE FROM sessions WHERE token = ?", HashToken(token)); err != nil {
 		log.Printf("Error deleting session: %v", err)
 	}
 }
@@ -217,14 +327,14 @@ func ListAPIKeys(app *server.App) (*sql.Rows, error) {
 
 func ListAPIKeysOrdered(app *server.App) (*sql.Rows, error) {
 	return app.DB.Query(
-		"SELECT id, name, key_prefix, username, groups, permissions, expires_at, last_used_at, created_at FROM api_keys ORDER BY created_at DESC",
+		"SELECT id, name, key_prefix, username, groups, permissions, expires_at, last_used_at, created_at, allowed_networks, personal FROM api_keys ORDER BY created_at DESC",
 	)
 }
 
-func CreateAPIKey(app *server.App, name, keyHash, keyPrefix, username, groups, permissions string, expiresAt *time.Time) (int64, error) {
+func CreateAPIKey(app *server.App, name, keyHash, keyPrefix, username, groups, permissions string, expiresAt *time.Time, allowedNetworks string) (int64, error) {
 	result, err := app.DB.Exec(
-		"INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		name, keyHash, keyPrefix, username, groups, permissions, expiresAt,
+		"INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions, expires_at, allowed_networks) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		name, keyHash, keyPrefix, username, groups, permissions, expiresAt, allowedNetworks,
 	)
 	if err != nil {
 		return 0, err
@@ -242,21 +352,44 @@ func DeleteAPIKey(app *server.App, id int) (int64, error) {
 
 func GetAPIKeysByPrefix(app *server.App, prefix string) (*sql.Rows, error) {
 	return app.DB.Query(
-		"SELECT id, key_hash, username, groups, permissions, expires_at FROM api_keys WHERE key_prefix = ?",
+		"SELECT id, key_hash, username, groups, permissions, expires_at, name, allowed_networks, personal, COALESCE(user_id, 0) FROM api_keys WHERE key_prefix = ?",
 		prefix,
 	)
 }
 
+// HasNetworkRestrictedAPIKeys reports whether any key with this prefix is
+// limited to certain networks, so unrestricted keys skip the policy check.
+func HasNetworkRestrictedAPIKeys(app *server.App, prefix string) bool {
+	var n int
+	app.DB.QueryRow("SELECT COUNT(*) FROM api_keys WHERE key_prefix = ? AND allowed_networks != ''", prefix).Scan(&n)
+	return n > 0
+}
+
 func UpdateAPIKeyLastUsed(app *server.App, id int) {
 	if _, err := app.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), id); err != nil {
 		log.Printf("Error updating API key last_used_at: %v", err)
 	}
 }
 
-func CreateOIDCState(app *server.App, state, redirectURL string) error {
+// OIDCLogin is what DashGate remembers about a login between redirecting to
+// the provider and handling its callback.
+type OIDCLogin struct {
+	RedirectURL  string
+	CodeVerifier string
+	Nonce        string
+	InviteID     int
+	// ProviderID is the OIDC provider the login started with ("" for the
+	// primary provider)
+	ProviderID string
+	// LinkUserID is set when a signed-in user is linking this provider to
+	// their account rather than signing in
+	LinkUserID int
+}
+
+func CreateOIDCState(app *server.App, state string, login OIDCLogin) error {
 	_, err := app.DB.Exec(
-		"INSERT INTO oidc_states (state, redirect_url, created_at) VALUES (?, ?, ?)",
-		state, redirectURL, time.Now(),
+		"INSERT INTO oidc_states (state, redirect_url, code_verifier, nonce, invite_id, provider_id, link_user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		HashToken(state), login.RedirectURL, login.CodeVerifier, login.Nonce, login.InviteID, login.ProviderID, login.LinkUserID, time.Now(),
 	)
 	if err != nil {
 		log.Printf("Failed to store OIDC state: %v", err)
@@ -264,14 +397,20 @@ func CreateOIDCState(app *server.App, state, redirectURL string) error {
 	return err
 }
 
-func GetOIDCState(app *server.App, state string) (string, error) {
-	var redirectURL string
-	err := app.DB.QueryRow("SELECT redirect_url FROM oidc_states WHERE state = ?", state).Scan(&redirectURL)
-	return redirectURL, err
+func GetOIDCState(app *server.App, state string) (*OIDCLogin, error) {
+	var login OIDCLogin
+	err := app.DB.QueryRow(
+		"SELECT COALESCE(redirect_url, ''), code_verifier, nonce, invite_id, provider_id, link_user_id FROM oidc_states WHERE state = ?",
+		HashToken(state),
+	).Scan(&login.RedirectURL, &login.CodeVerifier, &login.Nonce, &login.InviteID, &login.ProviderID, &login.LinkUserID)
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
 }
 
 func DeleteOIDCState(app *server.App, state string) {
-	if _, err := app.DB.Exec("DELETE FROM oidc_states WHERE state = ?", state); err != nil {
+	if _, err := app.DB.Exec("DELETE FROM oidc_states WHERE state = ?", HashToken(state)); err != nil {
 		log.Printf("Failed to delete OIDC state: %v", err)
 	}
 }
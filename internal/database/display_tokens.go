@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrDisplayTokenNotFound is returned when no display token matches.
+var ErrDisplayTokenNotFound = errors.New("display token not found")
+
+const displayTokenColumns = "id, name, token_prefix, groups, allowed_networks, created_by, created_at, last_used_at"
+
+func scanDisplayToken(scan func(...interface{}) error) (*models.DisplayToken, error) {
+	var t models.DisplayToken
+	var groupsJSON string
+	var lastUsedAt sql.NullTime
+	if err := scan(&t.ID, &t.Name, &t.TokenPrefix, &groupsJSON, &t.AllowedNetworks, &t.CreatedBy, &t.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(groupsJSON), &t.Groups)
+	if t.Groups == nil {
+		t.Groups = []string{}
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return &t, nil
+}
+
+// ListDisplayTokens returns every display token, newest first.
+func ListDisplayTokens(app *server.App) ([]models.DisplayToken, error) {
+	rows, err := app.DB.Query("SELECT " + displayTokenColumns + " FROM display_tokens ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.DisplayToken{}
+	for rows.Next() {
+		t, err := scanDisplayToken(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// CreateDisplayToken stores the hash of a new display token and returns its ID.
+func CreateDisplayToken(app *server.App, name, token string, groups []string, allowedNetworks, createdBy string) (int64, error) {
+	result, err := app.DB.Exec(
+		`INSERT INTO display_tokens (name, token_hash, token_prefix, groups, allowed_networks, created_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		name, HashToken(token), token[:8], MarshalListJSON(groups), allowedNetworks, createdBy, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetDisplayTokenByToken returns the display token matching token and records
+// that it was used, or returns ErrDisplayTokenNotFound.
+func GetDisplayTokenByToken(app *server.App, token string) (*models.DisplayToken, error) {
+	t, err := scanDisplayToken(app.DB.QueryRow("SELECT "+displayTokenColumns+" FROM display_tokens WHERE token_hash = ?", HashToken(token)).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrDisplayTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	app.DB.Exec("UPDATE display_tokens SET last_used_at = ? WHERE id = ?", time.Now(), t.ID)
+	return t, nil
+}
+
+// DeleteDisplayToken revokes a display token and returns it.
+func DeleteDisplayToken(app *server.App, id int) (*models.DisplayToken, error) {
+	t, err := scanDisplayToken(app.DB.QueryRow("SELECT "+displayTokenColumns+" FROM display_tokens WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrDisplayTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := app.DB.Exec("DELETE FROM display_tokens WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -1,24 +1,38 @@
 package database
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 
+	"dashgate/internal/encryption"
 	"dashgate/internal/server"
 )
 
-const encryptionKeyDBKey = "system_encryption_key"
+const (
+	encryptionKeyDBKey = "system_encryption_key"
+	// Keys replaced by a rotation are kept as retired_encryption_key:<key ID>
+	// until every value has been re-encrypted
+	retiredKeyDBPrefix = "retired_encryption_key:"
+)
 
 // InitEncryptionKey sets up the AES-256 encryption key on the App struct.
 //
 // Key resolution order:
-//  1. ENCRYPTION_KEY environment variable (hex-encoded, 32 bytes / 64 hex chars)
+//  1. ENCRYPTION_KEY environment variable, or the file named by
+//     ENCRYPTION_KEY_FILE (hex-encoded, 32 bytes / 64 hex chars)
 //  2. Previously stored key in the encryption_keys database table
 //  3. Freshly generated random 32-byte key, persisted to the database
 //
+// Keys retired by an unfinished rotation, a stored key replaced by
+// ENCRYPTION_KEY and the keys in ENCRYPTION_OLD_KEYS are kept for decryption.
+// A completed rotation removes the first two (see RotateEncryptionKey).
+//
 // If key initialisation fails entirely the application continues without
 // encryption and a warning is logged. Sensitive values will be stored in
 // plaintext until the issue is resolved.
@@ -35,39 +49,40 @@ func InitEncryptionKey(app *server.App) {
 		return
 	}
 
-	if envKey := os.Getenv("ENCRYPTION_KEY"); envKey != "" {
-		decoded, err := hex.DecodeString(envKey)
-		if err != nil || len(decoded) != 32 {
-			log.Printf("WARNING: ENCRYPTION_KEY env var is invalid (must be 64 hex chars / 32 bytes) — ignoring")
-		} else {
-			app.EncryptionKey = decoded
-			log.Println("Encryption key loaded from ENCRYPTION_KEY environment variable")
-			return
+	oldKeys := loadRetiredEncryptionKeys(app)
+	oldKeys = append(oldKeys, oldEncryptionKeysFromEnv()...)
+	stored := loadStoredEncryptionKey(app)
+
+	if key, source := encryptionKeyFromEnv(); key != nil {
+		// The generated key used before ENCRYPTION_KEY was set still
+		// decrypts the values written with it
+		if stored != nil && !bytes.Equal(stored, key) {
+			oldKeys = append(oldKeys, stored)
+		}
+		setEncryptionKeys(app, key, oldKeys, source)
+		name := "ENCRYPTION_KEY"
+		if source == "file" {
+			name = "ENCRYPTION_KEY_FILE"
 		}
+		log.Printf("Encryption key %s loaded from %s", encryption.KeyID(key), name)
+		return
 	}
 
-	var storedHex string
-	err = app.DB.QueryRow("SELECT key_value FROM encryption_keys WHERE key_name = ?", encryptionKeyDBKey).Scan(&storedHex)
-	if err == nil {
-		decoded, err := hex.DecodeString(storedHex)
-		if err == nil && len(decoded) == 32 {
-			app.EncryptionKey = decoded
-			log.Println("Encryption key loaded from database")
-			return
-		}
-		log.Printf("WARNING: stored encryption key is invalid, generating a new one")
+	if stored != nil {
+		setEncryptionKeys(app, stored, oldKeys, "database")
+		log.Printf("Encryption key %s loaded from database", encryption.KeyID(stored))
+		return
 	}
 
-	newKey := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
+	newKey, err := generateEncryptionKey()
+	if err != nil {
 		log.Printf("WARNING: failed to generate encryption key: %v — sensitive values will be stored in plaintext", err)
 		return
 	}
 
-	hexKey := hex.EncodeToString(newKey)
 	_, err = app.DB.Exec(
 		"INSERT OR REPLACE INTO encryption_keys (key_name, key_value) VALUES (?, ?)",
-		encryptionKeyDBKey, hexKey,
+		encryptionKeyDBKey, hex.EncodeToString(newKey),
 	)
 	if err != nil {
 		log.Printf("WARNING: failed to persist encryption key to database: %v — key will be lost on restart", err)
@@ -75,5 +90,129 @@ func InitEncryptionKey(app *server.App) {
 		log.Println("Generated and stored new encryption key in database")
 	}
 
-	app.EncryptionKey = newKey
+	setEncryptionKeys(app, newKey, oldKeys, "database")
+}
+
+func setEncryptionKeys(app *server.App, key []byte, oldKeys [][]byte, source string) {
+	app.EncryptionMu.Lock()
+	defer app.EncryptionMu.Unlock()
+	app.EncryptionKey = key
+	app.OldEncryptionKeys = nil
+	for _, old := range oldKeys {
+		if !bytes.Equal(old, key) {
+			app.OldEncryptionKeys = append(app.OldEncryptionKeys, old)
+		}
+	}
+	app.EncryptionKeySource = source
+}
+
+func generateEncryptionKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseEncryptionKey(s string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(decoded) != 32 {
+		return nil, fmt.Errorf("must be 64 hex chars / 32 bytes")
+	}
+	return decoded, nil
+}
+
+// encryptionKeyFromEnv returns the key from ENCRYPTION_KEY or
+// ENCRYPTION_KEY_FILE and which of the two set it.
+func encryptionKeyFromEnv() ([]byte, string) {
+	value, set, err := lookupConfigEnv("ENCRYPTION_KEY")
+	if err != nil {
+		log.Printf("WARNING: %v — ignoring", err)
+		return nil, ""
+	}
+	if !set || value == "" {
+		return nil, ""
+	}
+	source := "env"
+	if os.Getenv("ENCRYPTION_KEY_FILE") != "" {
+		source = "file"
+	}
+	key, err := parseEncryptionKey(value)
+	if err != nil {
+		log.Printf("WARNING: ENCRYPTION_KEY is invalid (%v) — ignoring", err)
+		return nil, ""
+	}
+	return key, source
+}
+
+// oldEncryptionKeysFromEnv returns the previous keys listed in
+// ENCRYPTION_OLD_KEYS or ENCRYPTION_OLD_KEYS_FILE, separated by commas or
+// whitespace. They are needed when ENCRYPTION_KEY is changed, until a
+// rotation has re-encrypted every value with the new key.
+func oldEncryptionKeysFromEnv() [][]byte {
+	value, _, err := lookupConfigEnv("ENCRYPTION_OLD_KEYS")
+	if err != nil {
+		log.Printf("WARNING: %v — ignoring", err)
+		return nil
+	}
+	var keys [][]byte
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		key, err := parseEncryptionKey(field)
+		if err != nil {
+			log.Printf("WARNING: ENCRYPTION_OLD_KEYS entry is invalid (%v) — ignoring", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func loadStoredEncryptionKey(app *server.App) []byte {
+	var storedHex string
+	if err := app.DB.QueryRow("SELECT key_value FROM encryption_keys WHERE key_name = ?", encryptionKeyDBKey).Scan(&storedHex); err != nil {
+		return nil
+	}
+	key, err := parseEncryptionKey(storedHex)
+	if err != nil {
+		log.Printf("WARNING: stored encryption key is invalid, ignoring it")
+		return nil
+	}
+	return key
+}
+
+func loadRetiredEncryptionKeys(app *server.App) [][]byte {
+	rows, err := app.DB.Query("SELECT key_value FROM encryption_keys WHERE key_name LIKE ? ORDER BY created_at DESC", retiredKeyDBPrefix+"%")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var keys [][]byte
+	for rows.Next() {
+		var storedHex string
+		if rows.Scan(&storedHex) != nil {
+			continue
+		}
+		if key, err := parseEncryptionKey(storedHex); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// encryptValue encrypts a sensitive value with the current key.
+func encryptValue(app *server.App, plaintext string) (string, error) {
+	app.EncryptionMu.RLock()
+	defer app.EncryptionMu.RUnlock()
+	return encryption.EncryptValue(app.EncryptionKey, plaintext)
+}
+
+// decryptValue decrypts a sensitive value with the key it was encrypted
+// with, which may be a key kept from before a rotation.
+func decryptValue(app *server.App, value string) (string, error) {
+	app.EncryptionMu.RLock()
+	defer app.EncryptionMu.RUnlock()
+	return encryption.DecryptValue(app.EncryptionKey, value, app.OldEncryptionKeys...)
 }
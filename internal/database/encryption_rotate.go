@@ -0,0 +1,210 @@
+package database
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/encryption"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// encryptedColumns lists every column holding values encrypted with the
+// system key, with the column that identifies their rows. Only the
+// sensitive keys of system_config and the audit log key in encryption_keys
+// are encrypted.
+var encryptedColumns = []struct{ table, idColumn, column string }{
+	{"system_config", "key", "value"},
+	{"oidc_providers", "id", "client_secret"},
+	{"idp_signing_keys", "kid", "private_key"},
+	{"encryption_keys", "key_name", "key_value"},
+}
+
+type encryptedValue struct {
+	table, idColumn, column string
+	id, value               string
+}
+
+// rotateMu keeps rotations from running concurrently.
+var rotateMu sync.Mutex
+
+// ErrEncryptionDisabled is returned when no encryption key is configured.
+var ErrEncryptionDisabled = errors.New("encryption is not configured")
+
+func listEncryptedValues(app *server.App) ([]encryptedValue, error) {
+	var values []encryptedValue
+	for _, c := range encryptedColumns {
+		rows, err := app.DB.Query(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s != ''", c.idColumn, c.column, c.table, c.column))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", c.table, err)
+		}
+		for rows.Next() {
+			v := encryptedValue{table: c.table, idColumn: c.idColumn, column: c.column}
+			if err := rows.Scan(&v.id, &v.value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if c.table == "system_config" && !encryption.IsSensitiveKey(v.id) {
+				continue
+			}
+			if c.table == "encryption_keys" && v.id != audit.KeyDBKey {
+				continue
+			}
+			values = append(values, v)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// GetEncryptionStatus reports the current key, the keys kept from earlier
+// rotations and how many stored values are not yet encrypted with the
+// current key.
+func GetEncryptionStatus(app *server.App) (*models.EncryptionStatus, error) {
+	app.EncryptionMu.RLock()
+	status := &models.EncryptionStatus{Source: app.EncryptionKeySource, OldKeyIDs: []string{}}
+	if len(app.EncryptionKey) > 0 {
+		status.KeyID = encryption.KeyID(app.EncryptionKey)
+	}
+	for _, key := range app.OldEncryptionKeys {
+		status.OldKeyIDs = append(status.OldKeyIDs, encryption.KeyID(key))
+	}
+	app.EncryptionMu.RUnlock()
+
+	values, err := listEncryptedValues(app)
+	if err != nil {
+		return nil, err
+	}
+	status.Values = len(values)
+	for _, v := range values {
+		if id, ok := encryption.ValueKeyID(v.value); !ok || id != status.KeyID {
+			status.Pending++
+		}
+	}
+	return status, nil
+}
+
+// RotateEncryptionKey re-encrypts every sensitive value with a new key.
+//
+// A key kept in the database is replaced by a freshly generated one. A key
+// from ENCRYPTION_KEY or ENCRYPTION_KEY_FILE cannot be replaced from here,
+// so values are re-encrypted with it instead; this finishes a rotation
+// started by changing ENCRYPTION_KEY and listing the previous key in
+// ENCRYPTION_OLD_KEYS.
+//
+// The previous key keeps decrypting while values are rewritten, so the
+// rotation needs no downtime. It is discarded once every value has been
+// re-encrypted, along with a stored key replaced by ENCRYPTION_KEY, and
+// kept while any value could not be decrypted or was saved with it during
+// the rotation.
+func RotateEncryptionKey(app *server.App) (*models.EncryptionStatus, error) {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+
+	app.EncryptionMu.RLock()
+	current, source := app.EncryptionKey, app.EncryptionKeySource
+	app.EncryptionMu.RUnlock()
+	if len(current) == 0 {
+		return nil, ErrEncryptionDisabled
+	}
+
+	if source == "database" {
+		newKey, err := generateEncryptionKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+		}
+		if err := storeRotatedKey(app, current, newKey); err != nil {
+			return nil, err
+		}
+		app.EncryptionMu.Lock()
+		app.OldEncryptionKeys = append([][]byte{current}, app.OldEncryptionKeys...)
+		app.EncryptionKey = newKey
+		app.EncryptionMu.Unlock()
+		log.Printf("Encryption key rotated from %s to %s", encryption.KeyID(current), encryption.KeyID(newKey))
+		current = newKey
+	}
+
+	values, err := listEncryptedValues(app)
+	if err != nil {
+		return nil, err
+	}
+	currentID := encryption.KeyID(current)
+	failed := 0
+	for _, v := range values {
+		if id, ok := encryption.ValueKeyID(v.value); ok && id == currentID {
+			continue
+		}
+		plaintext, err := decryptValue(app, v.value)
+		if err != nil {
+			log.Printf("WARNING: failed to decrypt %s %q during key rotation: %v", v.table, v.id, err)
+			failed++
+			continue
+		}
+		encrypted, err := encryptValue(app, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		// Only replace the value that was read; one saved meanwhile is
+		// already encrypted with the new key
+		query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?", v.table, v.column, v.idColumn, v.column)
+		if _, err := app.DB.Exec(query, encrypted, v.id, v.value); err != nil {
+			return nil, fmt.Errorf("failed to update %s %q: %w", v.table, v.id, err)
+		}
+	}
+
+	status, err := GetEncryptionStatus(app)
+	if err != nil {
+		return nil, err
+	}
+	status.Failed = failed
+	// A value saved with the old key while this ran shows up as pending;
+	// the old key stays until a later rotation rewrites it
+	if failed > 0 || status.Pending > 0 {
+		return status, nil
+	}
+
+	if _, err := app.DB.Exec("DELETE FROM encryption_keys WHERE key_name LIKE ?", retiredKeyDBPrefix+"%"); err != nil {
+		return nil, fmt.Errorf("failed to remove retired keys: %w", err)
+	}
+	// The generated key stored before ENCRYPTION_KEY was set would
+	// otherwise be loaded as an old key again on every start
+	if source != "database" {
+		if _, err := app.DB.Exec("DELETE FROM encryption_keys WHERE key_name = ?", encryptionKeyDBKey); err != nil {
+			return nil, fmt.Errorf("failed to remove stored key: %w", err)
+		}
+	}
+	app.EncryptionMu.Lock()
+	app.OldEncryptionKeys = nil
+	app.EncryptionMu.Unlock()
+	status.OldKeyIDs = []string{}
+	log.Printf("All %d encrypted values now use key %s", status.Values, currentID)
+	return status, nil
+}
+
+// storeRotatedKey makes newKey the stored key and keeps the old one until
+// the rotation completes, so a restart midway can still decrypt everything.
+func storeRotatedKey(app *server.App, oldKey, newKey []byte) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT OR REPLACE INTO encryption_keys (key_name, key_value) VALUES (?, ?)",
+		retiredKeyDBPrefix+encryption.KeyID(oldKey), hex.EncodeToString(oldKey)); err != nil {
+		return fmt.Errorf("failed to retire encryption key: %w", err)
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO encryption_keys (key_name, key_value, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+		encryptionKeyDBKey, hex.EncodeToString(newKey)); err != nil {
+		return fmt.Errorf("failed to store encryption key: %w", err)
+	}
+	return tx.Commit()
+}
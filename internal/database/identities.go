@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrIdentityLinked is returned when an external identity is already linked
+// to a different user.
+var ErrIdentityLinked = errors.New("this sign-in is already linked to another account")
+
+// GetIdentityUser returns the ID and username of the user an external
+// identity is linked to, or sql.ErrNoRows.
+func GetIdentityUser(app *server.App, provider, subject string) (int, string, error) {
+	var id int
+	var username string
+	err := app.DB.QueryRow(
+		"SELECT u.id, u.username FROM identities i JOIN users u ON u.id = i.user_id WHERE i.provider = ? AND i.subject = ?",
+		provider, subject,
+	).Scan(&id, &username)
+	return id, username, err
+}
+
+// LinkIdentity links an external identity to a user. Linking an identity
+// to the user it already belongs to is a no-op; linking it to anyone else
+// returns ErrIdentityLinked.
+func LinkIdentity(app *server.App, userID int, provider, subject, email string) error {
+	result, err := app.DB.Exec(
+		`INSERT INTO identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(provider, subject) DO NOTHING`,
+		userID, provider, subject, email, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	owner, _, err := GetIdentityUser(app, provider, subject)
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+// TouchIdentity records a sign-in with an identity and the email address
+// the provider reported for it.
+func TouchIdentity(app *server.App, provider, subject, email string) error {
+	_, err := app.DB.Exec(
+		"UPDATE identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?",
+		email, time.Now(), provider, subject,
+	)
+	return err
+}
+
+// ListUserIdentities returns the identities linked to a user, oldest first.
+func ListUserIdentities(app *server.App, userID int) ([]models.Identity, error) {
+	rows, err := app.DB.Query(
+		"SELECT id, provider, subject, email, created_at, last_login_at FROM identities WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		var created, lastLogin sql.NullTime
+		if err := rows.Scan(&i.ID, &i.Provider, &i.Subject, &i.Email, &created, &lastLogin); err != nil {
+			return nil, err
+		}
+		i.CreatedAt = created.Time
+		if lastLogin.Valid {
+			i.LastLoginAt = &lastLogin.Time
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// GetPrimaryIdentity returns the provider and subject of the first identity
+// linked to a user: the one that created or adopted the account.
+func GetPrimaryIdentity(app *server.App, userID int) (string, string, error) {
+	var provider, subject string
+	err := app.DB.QueryRow(
+		"SELECT provider, subject FROM identities WHERE user_id = ? ORDER BY id LIMIT 1", userID,
+	).Scan(&provider, &subject)
+	return provider, subject, err
+}
+
+// CountUserIdentities returns how many identities are linked to a user.
+func CountUserIdentities(app *server.App, userID int) (int, error) {
+	var count int
+	err := app.DB.QueryRow("SELECT COUNT(*) FROM identities WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteUserIdentity unlinks one of a user's identities.
+func DeleteUserIdentity(app *server.App, userID, id int) (int64, error) {
+	result, err := app.DB.Exec("DELETE FROM identities WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateExternalUser creates a user for an external identity and links the
+// identity to it in one transaction.
+func CreateExternalUser(app *server.App, username, email, displayName, groupsJSON, passwordHash, provider, subject string) (int, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, email, password_hash, display_name, groups) VALUES (?, ?, ?, ?, ?)",
+		username, nullIfEmpty(email), passwordHash, displayName, groupsJSON,
+	)
+	if err != nil {
+		return 0, err
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO identities (user_id, provider, subject, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, provider, subject, email, time.Now(), time.Now(),
+	); err != nil {
+		return 0, err
+	}
+	return int(userID), tx.Commit()
+}
+
+// SyncExternalUser refreshes a user's profile from their identity provider.
+// The username is left alone, so a renamed provider account keeps signing
+// in to the same DashGate user.
+func SyncExternalUser(app *server.App, userID int, email, displayName, groupsJSON string) error {
+	_, err := app.DB.Exec(
+		"UPDATE users SET email = ?, display_name = ?, groups = ?, updated_at = ? WHERE id = ?",
+		nullIfEmpty(email), displayName, groupsJSON, time.Now(), userID,
+	)
+	return err
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrIDPClientNotFound is returned when no client has the given ID.
+var ErrIDPClientNotFound = errors.New("OIDC client not found")
+
+// IDPAuthCode is an authorization code issued to a client, waiting to be
+// exchanged for tokens.
+type IDPAuthCode struct {
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// ListIDPClients returns all registered clients ordered by name.
+func ListIDPClients(app *server.App) ([]models.IDPClient, error) {
+	rows, err := app.DB.Query("SELECT client_id, name, redirect_uris, allowed_groups, created_at FROM idp_clients ORDER BY name, client_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.IDPClient{}
+	for rows.Next() {
+		c, err := scanIDPClient(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, rows.Err()
+}
+
+// GetIDPClient returns a client, or ErrIDPClientNotFound.
+func GetIDPClient(app *server.App, clientID string) (*models.IDPClient, error) {
+	c, err := scanIDPClient(app.DB.QueryRow("SELECT client_id, name, redirect_uris, allowed_groups, created_at FROM idp_clients WHERE client_id = ?", clientID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrIDPClientNotFound
+	}
+	return c, err
+}
+
+func scanIDPClient(scan func(...interface{}) error) (*models.IDPClient, error) {
+	var c models.IDPClient
+	var redirectJSON, groupsJSON string
+	var created sql.NullTime
+	if err := scan(&c.ClientID, &c.Name, &redirectJSON, &groupsJSON, &created); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(redirectJSON), &c.RedirectURIs)
+	json.Unmarshal([]byte(groupsJSON), &c.AllowedGroups)
+	if c.RedirectURIs == nil {
+		c.RedirectURIs = []string{}
+	}
+	if c.AllowedGroups == nil {
+		c.AllowedGroups = []string{}
+	}
+	c.CreatedAt = created.Time
+	return &c, nil
+}
+
+// CreateIDPClient registers a client. Only the hash of its secret is stored.
+func CreateIDPClient(app *server.App, c models.IDPClient, secret string) error {
+	_, err := app.DB.Exec(
+		"INSERT INTO idp_clients (client_id, name, secret_hash, redirect_uris, allowed_groups, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		c.ClientID, c.Name, HashToken(secret), MarshalListJSON(c.RedirectURIs), MarshalListJSON(c.AllowedGroups), time.Now(),
+	)
+	return err
+}
+
+// UpdateIDPClient saves a client's name, redirect URIs and allowed groups.
+func UpdateIDPClient(app *server.App, c models.IDPClient) error {
+	result, err := app.DB.Exec(
+		"UPDATE idp_clients SET name = ?, redirect_uris = ?, allowed_groups = ? WHERE client_id = ?",
+		c.Name, MarshalListJSON(c.RedirectURIs), MarshalListJSON(c.AllowedGroups), c.ClientID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIDPClientNotFound
+	}
+	return nil
+}
+
+// SetIDPClientSecret replaces a client's secret.
+func SetIDPClientSecret(app *server.App, clientID, secret string) error {
+	result, err := app.DB.Exec("UPDATE idp_clients SET secret_hash = ? WHERE client_id = ?", HashToken(secret), clientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIDPClientNotFound
+	}
+	return nil
+}
+
+// DeleteIDPClient removes a client and its pending authorization codes.
+func DeleteIDPClient(app *server.App, clientID string) error {
+	result, err := app.DB.Exec("DELETE FROM idp_clients WHERE client_id = ?", clientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIDPClientNotFound
+	}
+	return nil
+}
+
+// IDPClientSecretMatches reports whether secret belongs to the client.
+func IDPClientSecretMatches(app *server.App, clientID, secret string) bool {
+	var hash string
+	if err := app.DB.QueryRow("SELECT secret_hash FROM idp_clients WHERE client_id = ?", clientID).Scan(&hash); err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashToken(secret))) == 1
+}
+
+// CreateIDPAuthCode stores an authorization code. Only its hash is kept.
+func CreateIDPAuthCode(app *server.App, code string, c IDPAuthCode) error {
+	_, err := app.DB.Exec(
+		"INSERT INTO idp_auth_codes (code, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		HashToken(code), c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.Nonce, c.CodeChallenge, c.ExpiresAt,
+	)
+	return err
+}
+
+// ConsumeIDPAuthCode deletes an authorization code and returns it, so each
+// code can be exchanged once. Expired and unknown codes return
+// sql.ErrNoRows.
+func ConsumeIDPAuthCode(app *server.App, code string) (*IDPAuthCode, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hash := HashToken(code)
+	var c IDPAuthCode
+	err = tx.QueryRow(
+		"SELECT client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at FROM idp_auth_codes WHERE code = ?", hash,
+	).Scan(&c.ClientID, &c.UserID, &c.RedirectURI, &c.Scope, &c.Nonce, &c.CodeChallenge, &c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM idp_auth_codes WHERE code = ?", hash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	return &c, nil
+}
+
+// CleanupIDPAuthCodes deletes expired authorization codes.
+func CleanupIDPAuthCodes(app *server.App) {
+	if app.DB == nil {
+		return
+	}
+	if _, err := app.DB.Exec("DELETE FROM idp_auth_codes WHERE expires_at < ?", time.Now()); err != nil {
+		log.Printf("Error cleaning up OIDC authorization codes: %v", err)
+	}
+}
+
+// GetIDPSigningKey returns the ID and PEM-encoded private key used to sign
+// tokens, or sql.ErrNoRows if none has been created yet.
+func GetIDPSigningKey(app *server.App) (kid, keyPEM string, err error) {
+	var stored string
+	err = app.DB.QueryRow("SELECT kid, private_key FROM idp_signing_keys ORDER BY created_at DESC LIMIT 1").Scan(&kid, &stored)
+	if err != nil {
+		return "", "", err
+	}
+	keyPEM, err = decryptValue(app, stored)
+	return kid, keyPEM, err
+}
+
+// SaveIDPSigningKey stores a token signing key, encrypted at rest.
+func SaveIDPSigningKey(app *server.App, kid, keyPEM string) error {
+	stored, err := encryptValue(app, keyPEM)
+	if err != nil {
+		return err
+	}
+	_, err = app.DB.Exec("INSERT INTO idp_signing_keys (kid, private_key, created_at) VALUES (?, ?, ?)", kid, stored, time.Now())
+	return err
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrInviteInvalid is returned when an invite token is unknown, expired,
+// revoked or already used.
+var ErrInviteInvalid = errors.New("invite is invalid or has expired")
+
+const inviteColumns = "id, email, groups, note, created_by, created_at, expires_at, used_at, used_by, revoked_at"
+
+func scanInvite(scan func(...interface{}) error) (*models.Invite, error) {
+	var inv models.Invite
+	var groupsJSON string
+	var usedAt, revokedAt sql.NullTime
+	if err := scan(&inv.ID, &inv.Email, &groupsJSON, &inv.Note, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt, &usedAt, &inv.UsedBy, &revokedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(groupsJSON), &inv.Groups)
+	if inv.Groups == nil {
+		inv.Groups = []string{}
+	}
+	if usedAt.Valid {
+		inv.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		inv.RevokedAt = &revokedAt.Time
+	}
+
+	switch {
+	case inv.UsedAt != nil:
+		inv.Status = "used"
+	case inv.RevokedAt != nil:
+		inv.Status = "revoked"
+	case !inv.ExpiresAt.After(time.Now()):
+		inv.Status = "expired"
+	default:
+		inv.Status = "pending"
+	}
+	return &inv, nil
+}
+
+// CreateInvite stores the hash of a new invite token and returns its ID.
+func CreateInvite(app *server.App, token, email string, groups []string, note, createdBy string, expiresAt time.Time) (int64, error) {
+	result, err := app.DB.Exec(
+		`INSERT INTO invites (token_hash, email, groups, note, created_by, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		HashToken(token), strings.ToLower(email), MarshalListJSON(groups), note, createdBy, time.Now(), expiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ListInvites returns all invites, newest first.
+func ListInvites(app *server.App) ([]models.Invite, error) {
+	rows, err := app.DB.Query("SELECT " + inviteColumns + " FROM invites ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		inv, err := scanInvite(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *inv)
+	}
+	return invites, rows.Err()
+}
+
+// GetInviteByToken returns the pending invite for token, or ErrInviteInvalid.
+func GetInviteByToken(app *server.App, token string) (*models.Invite, error) {
+	inv, err := scanInvite(app.DB.QueryRow("SELECT "+inviteColumns+" FROM invites WHERE token_hash = ?", HashToken(token)).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status != "pending" {
+		return nil, ErrInviteInvalid
+	}
+	return inv, nil
+}
+
+// RevokeInvite marks a pending invite as revoked. It returns the number of
+// rows changed, which is 0 if the invite does not exist or is no longer
+// pending.
+func RevokeInvite(app *server.App, id int) (int64, error) {
+	result, err := app.DB.Exec(
+		"UPDATE invites SET revoked_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		time.Now(), id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// markInviteUsed claims a pending invite for usedBy. It fails with
+// ErrInviteInvalid if another request already used it.
+func markInviteUsed(tx *sql.Tx, id int, usedBy string) error {
+	now := time.Now()
+	result, err := tx.Exec(
+		`UPDATE invites SET used_at = ?, used_by = ?
+		 WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?`,
+		now, usedBy, id, now,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInviteInvalid
+	}
+	return nil
+}
+
+// CreateUserFromInvite creates a local user with the invite's groups and
+// marks the invite used, atomically.
+func CreateUserFromInvite(app *server.App, inviteID int, username, email, passwordHash, displayName string) (int64, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var groupsJSON string
+	if err := tx.QueryRow("SELECT groups FROM invites WHERE id = ?", inviteID).Scan(&groupsJSON); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInviteInvalid
+		}
+		return 0, err
+	}
+	if err := markInviteUsed(tx, inviteID, username); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, email, password_hash, display_name, groups) VALUES (?, NULLIF(?, ''), ?, ?, ?)",
+		username, email, passwordHash, displayName, groupsJSON,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// AcceptInviteForUser marks an invite used by an existing (OIDC) user and
+// adds its groups to the user's granted groups, which are kept across logins.
+// It returns the invite's groups.
+func AcceptInviteForUser(app *server.App, inviteID int, username string) ([]string, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var inviteGroupsJSON, grantedJSON string
+	if err := tx.QueryRow("SELECT groups FROM invites WHERE id = ?", inviteID).Scan(&inviteGroupsJSON); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+	if err := tx.QueryRow("SELECT granted_groups FROM users WHERE username = ?", username).Scan(&grantedJSON); err != nil {
+		return nil, err
+	}
+	if err := markInviteUsed(tx, inviteID, username); err != nil {
+		return nil, err
+	}
+
+	var inviteGroups, granted []string
+	json.Unmarshal([]byte(inviteGroupsJSON), &inviteGroups)
+	json.Unmarshal([]byte(grantedJSON), &granted)
+	granted = MergeGroups(granted, inviteGroups)
+
+	if _, err := tx.Exec(
+		"UPDATE users SET granted_groups = ?, updated_at = ? WHERE username = ?",
+		MarshalListJSON(granted), time.Now(), username,
+	); err != nil {
+		return nil, err
+	}
+	return inviteGroups, tx.Commit()
+}
+
+// GetGrantedGroups returns the groups DashGate has granted a user on top of
+// those supplied by their identity provider.
+func GetGrantedGroups(app *server.App, username string) ([]string, error) {
+	var grantedJSON string
+	err := app.DB.QueryRow("SELECT granted_groups FROM users WHERE username = ?", username).Scan(&grantedJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var granted []string
+	json.Unmarshal([]byte(grantedJSON), &granted)
+	return granted, nil
+}
+
+// MergeGroups returns base followed by any groups in extra it does not
+// already contain.
+func MergeGroups(base, extra []string) []string {
+	seen := make(map[string]bool, len(base)+len(extra))
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, list := range [][]string{base, extra} {
+		for _, g := range list {
+			if g != "" && !seen[g] {
+				seen[g] = true
+				merged = append(merged, g)
+			}
+		}
+	}
+	return merged
+}
+
+// GetInviteByID returns an invite regardless of its status.
+func GetInviteByID(app *server.App, id int) (*models.Invite, error) {
+	return scanInvite(app.DB.QueryRow("SELECT "+inviteColumns+" FROM invites WHERE id = ?", id).Scan)
+}
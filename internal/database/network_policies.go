@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/netpolicy"
+	"dashgate/internal/server"
+)
+
+// ErrNetworkPolicyNotFound is returned when no policy has the given ID.
+var ErrNetworkPolicyNotFound = errors.New("network policy not found")
+
+// ListNetworkPolicies returns all network policies, routes first.
+func ListNetworkPolicies(app *server.App) ([]models.NetworkPolicy, error) {
+	rows, err := app.DB.Query("SELECT id, kind, target, networks, description, created_at FROM network_policies ORDER BY kind DESC, target, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []models.NetworkPolicy{}
+	for rows.Next() {
+		var p models.NetworkPolicy
+		var created sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Kind, &p.Target, &p.Networks, &p.Description, &created); err != nil {
+			return nil, err
+		}
+		p.CreatedAt = created.Time
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// CreateNetworkPolicy stores a new policy and returns its ID.
+func CreateNetworkPolicy(app *server.App, p models.NetworkPolicy) (int64, error) {
+	result, err := app.DB.Exec(
+		"INSERT INTO network_policies (kind, target, networks, description, created_at) VALUES (?, ?, ?, ?, ?)",
+		p.Kind, p.Target, p.Networks, p.Description, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateNetworkPolicy saves changes to a policy.
+func UpdateNetworkPolicy(app *server.App, p models.NetworkPolicy) error {
+	result, err := app.DB.Exec(
+		"UPDATE network_policies SET kind = ?, target = ?, networks = ?, description = ? WHERE id = ?",
+		p.Kind, p.Target, p.Networks, p.Description, p.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNetworkPolicyNotFound
+	}
+	return nil
+}
+
+// DeleteNetworkPolicy removes a policy.
+func DeleteNetworkPolicy(app *server.App, id int) error {
+	result, err := app.DB.Exec("DELETE FROM network_policies WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNetworkPolicyNotFound
+	}
+	return nil
+}
+
+// ReloadNetworkPolicies parses the stored policies into app.NetworkPolicies.
+// Policies that no longer parse are skipped with a warning.
+func ReloadNetworkPolicies(app *server.App) error {
+	policies, err := ListNetworkPolicies(app)
+	if err != nil {
+		return err
+	}
+	parsed := make([]server.NetworkPolicy, 0, len(policies))
+	for _, p := range policies {
+		nets, err := netpolicy.Parse(p.Networks)
+		if err != nil {
+			log.Printf("Warning: skipping network policy %d: %v", p.ID, err)
+			continue
+		}
+		parsed = append(parsed, server.NetworkPolicy{ID: p.ID, Kind: p.Kind, Target: p.Target, Networks: nets})
+	}
+
+	app.SysConfigMu.Lock()
+	app.NetworkPolicies = parsed
+	app.SysConfigMu.Unlock()
+	return nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"dashgate/internal/models"
+	"dashgate/internal/oidc"
+	"dashgate/internal/server"
+)
+
+// ErrOIDCProviderNotFound is returned when no provider has the given ID.
+var ErrOIDCProviderNotFound = errors.New("OIDC provider not found")
+
+const oidcProviderColumns = "id, display_name, issuer, client_id, client_secret, redirect_url, scopes, groups_claim, group_mapping, enabled, sort_order"
+
+func scanOIDCProvider(app *server.App, scan func(...interface{}) error) (*models.OIDCProviderConfig, error) {
+	var p models.OIDCProviderConfig
+	var secret string
+	if err := scan(&p.ID, &p.DisplayName, &p.Issuer, &p.ClientID, &secret, &p.RedirectURL, &p.Scopes, &p.GroupsClaim, &p.GroupMapping, &p.Enabled, &p.SortOrder); err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		decrypted, err := decryptValue(app, secret)
+		if err != nil {
+			log.Printf("Warning: failed to decrypt client secret for OIDC provider %q: %v", p.ID, err)
+		} else {
+			p.ClientSecret = decrypted
+		}
+	}
+	p.HasClientSecret = p.ClientSecret != ""
+	return &p, nil
+}
+
+// ListOIDCProviders returns all additional OIDC providers in display order,
+// with their client secrets decrypted.
+func ListOIDCProviders(app *server.App) ([]models.OIDCProviderConfig, error) {
+	rows, err := app.DB.Query("SELECT " + oidcProviderColumns + " FROM oidc_providers ORDER BY sort_order, display_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []models.OIDCProviderConfig{}
+	for rows.Next() {
+		p, err := scanOIDCProvider(app, rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, *p)
+	}
+	return providers, rows.Err()
+}
+
+// GetOIDCProvider returns a single provider, or ErrOIDCProviderNotFound.
+func GetOIDCProvider(app *server.App, id string) (*models.OIDCProviderConfig, error) {
+	p, err := scanOIDCProvider(app, app.DB.QueryRow("SELECT "+oidcProviderColumns+" FROM oidc_providers WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return p, err
+}
+
+// CreateOIDCProvider stores a new provider, encrypting its client secret.
+func CreateOIDCProvider(app *server.App, p models.OIDCProviderConfig) error {
+	secret, err := encryptValue(app, p.ClientSecret)
+	if err != nil {
+		return err
+	}
+	_, err = app.DB.Exec(`INSERT INTO oidc_providers (id, display_name, issuer, client_id, client_secret, redirect_url, scopes, groups_claim, group_mapping, enabled, sort_order)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.DisplayName, p.Issuer, p.ClientID, secret, p.RedirectURL, p.Scopes, p.GroupsClaim, p.GroupMapping, p.Enabled, p.SortOrder)
+	return err
+}
+
+// UpdateOIDCProvider saves changes to a provider. An empty ClientSecret keeps
+// the stored secret.
+func UpdateOIDCProvider(app *server.App, p models.OIDCProviderConfig) error {
+	var result sql.Result
+	var err error
+	if p.ClientSecret == "" {
+		result, err = app.DB.Exec(`UPDATE oidc_providers SET display_name = ?, issuer = ?, client_id = ?, redirect_url = ?, scopes = ?, groups_claim = ?, group_mapping = ?, enabled = ?, sort_order = ? WHERE id = ?`,
+			p.DisplayName, p.Issuer, p.ClientID, p.RedirectURL, p.Scopes, p.GroupsClaim, p.GroupMapping, p.Enabled, p.SortOrder, p.ID)
+	} else {
+		secret, encErr := encryptValue(app, p.ClientSecret)
+		if encErr != nil {
+			return encErr
+		}
+		result, err = app.DB.Exec(`UPDATE oidc_providers SET display_name = ?, issuer = ?, client_id = ?, client_secret = ?, redirect_url = ?, scopes = ?, groups_claim = ?, group_mapping = ?, enabled = ?, sort_order = ? WHERE id = ?`,
+			p.DisplayName, p.Issuer, p.ClientID, secret, p.RedirectURL, p.Scopes, p.GroupsClaim, p.GroupMapping, p.Enabled, p.SortOrder, p.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOIDCProviderNotFound
+	}
+	return nil
+}
+
+// DeleteOIDCProvider removes a provider.
+func DeleteOIDCProvider(app *server.App, id string) error {
+	result, err := app.DB.Exec("DELETE FROM oidc_providers WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOIDCProviderNotFound
+	}
+	return nil
+}
+
+// ReloadOIDCProviders rediscovers the enabled additional providers and
+// replaces the runtime list, which is emptied while OIDC is turned off.
+// Providers without a redirect URL get {PublicURL}/auth/oidc/{id}/callback.
+// It returns the discovery error for each provider that could not be
+// initialized.
+func ReloadOIDCProviders(app *server.App) map[string]error {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.OIDCAuthEnabled
+	publicURL := strings.TrimRight(app.SystemConfig.PublicURL, "/")
+	app.SysConfigMu.RUnlock()
+
+	if app.DB == nil || !enabled {
+		app.SysConfigMu.Lock()
+		app.OIDCProviders = nil
+		app.SysConfigMu.Unlock()
+		return nil
+	}
+	providers, err := ListOIDCProviders(app)
+	if err != nil {
+		log.Printf("Failed to load OIDC providers: %v", err)
+		return nil
+	}
+
+	for i := range providers {
+		if providers[i].RedirectURL == "" && publicURL != "" {
+			providers[i].RedirectURL = publicURL + "/auth/oidc/" + providers[i].ID + "/callback"
+		}
+	}
+
+	return oidc.InitOIDCProviders(app, providers)
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// CreatePasswordResetToken stores the hash of a new reset token for userID.
+func CreatePasswordResetToken(app *server.App, userID int, token string, expiresAt time.Time) error {
+	_, err := app.DB.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		userID, HashToken(token), expiresAt, time.Now(),
+	)
+	return err
+}
+
+// CountPasswordResetsSince returns how many reset tokens were issued to
+// userID after since.
+func CountPasswordResetsSince(app *server.App, userID int, since time.Time) (int, error) {
+	var count int
+	err := app.DB.QueryRow(
+		"SELECT COUNT(*) FROM password_reset_tokens WHERE user_id = ? AND created_at > ?",
+		userID, since,
+	).Scan(&count)
+	return count, err
+}
+
+// GetPasswordResetUser returns the user a reset token belongs to. It returns
+// sql.ErrNoRows if the token is unknown, expired or already used.
+func GetPasswordResetUser(app *server.App, token string) (int, error) {
+	var userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := app.DB.QueryRow(
+		"SELECT user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ?",
+		HashToken(token),
+	).Scan(&userID, &expiresAt, &usedAt)
+	if err != nil {
+		return 0, err
+	}
+	if usedAt.Valid || !expiresAt.After(time.Now()) {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// ConsumePasswordResetToken marks a reset token as used and discards the
+// user's other outstanding tokens. It returns sql.ErrNoRows if the token was
+// not valid, so two concurrent requests cannot both use it.
+func ConsumePasswordResetToken(app *server.App, token string) (int, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID int
+	err = tx.QueryRow(
+		"SELECT user_id FROM password_reset_tokens WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		HashToken(token), now,
+	).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL",
+		now, HashToken(token),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	// Outstanding links from earlier requests stop working once one is used
+	if _, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now, userID,
+	); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// CleanupPasswordResetTokens deletes reset tokens older than a day. Recent
+// tokens are kept after they expire because they count towards the per-user
+// request limit.
+func CleanupPasswordResetTokens(app *server.App) {
+	if app.DB == nil {
+		return
+	}
+	if _, err := app.DB.Exec("DELETE FROM password_reset_tokens WHERE created_at < ?", time.Now().Add(-24*time.Hour)); err != nil {
+		log.Printf("Error cleaning up password reset tokens: %v", err)
+	}
+}
+
+// GetLocalUserByLogin finds a local password user by username or email,
+// case-insensitively. Accounts managed by LDAP or OIDC are not returned.
+func GetLocalUserByLogin(app *server.App, login string) (*UserRow, error) {
+	var u UserRow
+	err := app.DB.QueryRow(
+		`SELECT id, username, COALESCE(email,''), COALESCE(display_name,''), groups, password_hash, COALESCE(created_at,'')
+		 FROM users
+		 WHERE (lower(username) = lower(?) OR (email != '' AND lower(email) = lower(?)))
+		   AND password_hash NOT IN ('LDAP_USER', 'OIDC_USER')
+		 ORDER BY lower(username) = lower(?) DESC
+		 LIMIT 1`,
+		login, login, login,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.GroupsJSON, &u.PasswordHash, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// ProvisionedPasswordHash marks accounts created by a provisioning client
+// without a password. It never matches a bcrypt hash, so such accounts can
+// only sign in through an external provider.
+const ProvisionedPasswordHash = "SCIM_USER"
+
+// DirectoryUser is a user record as seen by provisioning clients.
+type DirectoryUser struct {
+	ID          int
+	Username    string
+	Email       string
+	DisplayName string
+	ExternalID  string
+	Groups      []string
+	Disabled    bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+const directoryUserColumns = `id, username, COALESCE(email,''), COALESCE(display_name,''), external_id,
+	COALESCE(groups,'[]'), disabled, created_at, updated_at`
+
+func scanDirectoryUser(scan func(...interface{}) error) (*DirectoryUser, error) {
+	var u DirectoryUser
+	var groupsJSON string
+	var created, updated sql.NullTime
+	if err := scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.ExternalID, &groupsJSON, &u.Disabled, &created, &updated); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(groupsJSON), &u.Groups)
+	u.CreatedAt = created.Time
+	u.UpdatedAt = updated.Time
+	if !updated.Valid {
+		u.UpdatedAt = u.CreatedAt
+	}
+	return &u, nil
+}
+
+// ListDirectoryUsers returns every user ordered by ID.
+func ListDirectoryUsers(app *server.App) ([]DirectoryUser, error) {
+	rows, err := app.DB.Query("SELECT " + directoryUserColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []DirectoryUser
+	for rows.Next() {
+		u, err := scanDirectoryUser(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// GetDirectoryUser returns a user by ID, or sql.ErrNoRows.
+func GetDirectoryUser(app *server.App, id int) (*DirectoryUser, error) {
+	return scanDirectoryUser(app.DB.QueryRow("SELECT "+directoryUserColumns+" FROM users WHERE id = ?", id).Scan)
+}
+
+// CreateDirectoryUser inserts a provisioned user and returns its ID.
+func CreateDirectoryUser(app *server.App, u DirectoryUser, passwordHash string) (int64, error) {
+	if passwordHash == "" {
+		passwordHash = ProvisionedPasswordHash
+	}
+	result, err := app.DB.Exec(
+		"INSERT INTO users (username, email, password_hash, display_name, external_id, disabled) VALUES (?, ?, ?, ?, ?, ?)",
+		u.Username, nullIfEmpty(u.Email), passwordHash, u.DisplayName, u.ExternalID, u.Disabled,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateDirectoryUser saves a provisioned user's attributes. A new username
+// takes the user's group grants, access requests, preferences and personal
+// API keys with it. Deactivating a user also ends their sessions.
+func UpdateDirectoryUser(app *server.App, u DirectoryUser) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldUsername string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", u.ID).Scan(&oldUsername); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE users SET username = ?, email = ?, display_name = ?, external_id = ?, disabled = ?, updated_at = ? WHERE id = ?",
+		u.Username, nullIfEmpty(u.Email), u.DisplayName, u.ExternalID, u.Disabled, time.Now(), u.ID,
+	); err != nil {
+		return err
+	}
+	if u.Username != oldUsername {
+		for _, stmt := range []struct {
+			query string
+			args  []interface{}
+		}{
+			{"UPDATE group_grants SET username = ? WHERE username = ?", []interface{}{u.Username, oldUsername}},
+			{"UPDATE access_requests SET username = ? WHERE username = ?", []interface{}{u.Username, oldUsername}},
+			{"UPDATE user_preferences SET username = ? WHERE user_id = ?", []interface{}{u.Username, u.ID}},
+			{"UPDATE api_keys SET username = ? WHERE user_id = ? AND personal = 1", []interface{}{u.Username, u.ID}},
+		} {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+	}
+	if u.Disabled {
+		if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IsUserDisabled reports whether the account with this username has been
+// deactivated.
+func IsUserDisabled(app *server.App, username string) bool {
+	var disabled bool
+	app.DB.QueryRow("SELECT disabled FROM users WHERE username = ?", username).Scan(&disabled)
+	return disabled
+}
+
+// SetUserGroupMembership adds or removes a group for a user. The group is
+// also recorded in granted_groups, so signing in through an identity
+// provider does not undo it.
+func SetUserGroupMembership(app *server.App, userID int, group string, member bool) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupsJSON, grantedJSON string
+	if err := tx.QueryRow("SELECT COALESCE(groups,'[]'), granted_groups FROM users WHERE id = ?", userID).Scan(&groupsJSON, &grantedJSON); err != nil {
+		return err
+	}
+	var groups, granted []string
+	json.Unmarshal([]byte(groupsJSON), &groups)
+	json.Unmarshal([]byte(grantedJSON), &granted)
+
+	if member {
+		groups = MergeGroups(groups, []string{group})
+		granted = MergeGroups(granted, []string{group})
+	} else {
+		groups = removeGroup(groups, group)
+		granted = removeGroup(granted, group)
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE users SET groups = ?, granted_groups = ?, updated_at = ? WHERE id = ?",
+		MarshalListJSON(groups), MarshalListJSON(granted), time.Now(), userID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetManagedGroup returns a managed group by name, or sql.ErrNoRows.
+func GetManagedGroup(app *server.App, name string) (*ManagedGroup, error) {
+	var g ManagedGroup
+	err := app.DB.QueryRow(
+		"SELECT name, COALESCE(display_name, name) FROM managed_groups WHERE name = ?", name,
+	).Scan(&g.Name, &g.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// RenameManagedGroup changes a managed group's display name. The name used
+// in user and app group lists stays the same.
+func RenameManagedGroup(app *server.App, name, displayName string) error {
+	_, err := app.DB.Exec("UPDATE managed_groups SET display_name = ? WHERE name = ?", displayName, name)
+	return err
+}
+
+func removeGroup(groups []string, group string) []string {
+	kept := groups[:0]
+	for _, g := range groups {
+		if g != group {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// nullIfEmpty stores empty strings as NULL so they do not collide in
+// UNIQUE columns.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
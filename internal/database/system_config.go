@@ -27,6 +27,13 @@ func LoadSystemConfig(app *server.App) error {
 	app.SysConfigMu.Lock()
 	defer app.SysConfigMu.Unlock()
 
+	// Security defaults for keys that have never been saved
+	app.SystemConfig.PasswordMinLength = 8
+	app.SystemConfig.PasswordCheckBreached = true
+	app.SystemConfig.LockoutThreshold = 5
+	app.SystemConfig.LockoutMinutes = 15
+	app.SystemConfig.MaxSessions = 10
+
 	found := false
 	for rows.Next() {
 		var key, value string
@@ -37,7 +44,7 @@ func LoadSystemConfig(app *server.App) error {
 
 		// Decrypt sensitive values before use
 		if encryption.IsSensitiveKey(key) {
-			decrypted, err := encryption.DecryptValue(app.EncryptionKey, value)
+			decrypted, err := decryptValue(app, value)
 			if err != nil {
 				log.Printf("WARNING: failed to decrypt config key %q, using raw value: %v", key, err)
 			} else {
@@ -45,116 +52,9 @@ func LoadSystemConfig(app *server.App) error {
 			}
 		}
 
-		switch key {
-		// General settings
-		case "session_days":
-			if d, err := strconv.Atoi(value); err == nil {
-				app.SystemConfig.SessionDays = d
-			}
-		case "cookie_secure":
-			app.SystemConfig.CookieSecure = value == "true"
-		case "setup_completed":
-			app.SystemConfig.SetupCompleted = value == "true"
-		case "admin_group":
-			app.SystemConfig.AdminGroup = value
-		case "trusted_proxies":
-			app.SystemConfig.TrustedProxies = value
-
-		// Auth providers enabled
-		case "proxy_auth_enabled":
-			app.SystemConfig.ProxyAuthEnabled = value == "true"
-		case "local_auth_enabled":
-			app.SystemConfig.LocalAuthEnabled = value == "true"
-		case "ldap_auth_enabled":
-			app.SystemConfig.LDAPAuthEnabled = value == "true"
-		case "oidc_auth_enabled":
-			app.SystemConfig.OIDCAuthEnabled = value == "true"
-		case "api_key_enabled":
-			app.SystemConfig.APIKeyEnabled = value == "true"
-
-		// LDAP settings
-		case "ldap_server":
-			app.SystemConfig.LDAPServer = value
-		case "ldap_bind_dn":
-			app.SystemConfig.LDAPBindDN = value
-		case "ldap_bind_password":
-			app.SystemConfig.LDAPBindPassword = value
-		case "ldap_base_dn":
-			app.SystemConfig.LDAPBaseDN = value
-		case "ldap_user_filter":
-			app.SystemConfig.LDAPUserFilter = value
-		case "ldap_group_filter":
-			app.SystemConfig.LDAPGroupFilter = value
-		case "ldap_user_attr":
-			app.SystemConfig.LDAPUserAttr = value
-		case "ldap_email_attr":
-			app.SystemConfig.LDAPEmailAttr = value
-		case "ldap_display_attr":
-			app.SystemConfig.LDAPDisplayAttr = value
-		case "ldap_group_attr":
-			app.SystemConfig.LDAPGroupAttr = value
-		case "ldap_start_tls":
-			app.SystemConfig.LDAPStartTLS = value == "true"
-		case "ldap_skip_verify":
-			app.SystemConfig.LDAPSkipVerify = value == "true"
-
-		// OIDC settings
-		case "oidc_issuer":
-			app.SystemConfig.OIDCIssuer = value
-		case "oidc_client_id":
-			app.SystemConfig.OIDCClientID = value
-		case "oidc_client_secret":
-			app.SystemConfig.OIDCClientSecret = value
-		case "oidc_redirect_url":
-			app.SystemConfig.OIDCRedirectURL = value
-		case "oidc_scopes":
-			app.SystemConfig.OIDCScopes = value
-		case "oidc_groups_claim":
-			app.SystemConfig.OIDCGroupsClaim = value
-		case "oidc_display_name":
-			app.SystemConfig.OIDCDisplayName = value
-
-		// Discovery settings
-		case "docker_discovery_enabled":
-			app.SystemConfig.DockerDiscoveryEnabled = value == "true"
-		case "docker_socket_path":
-			app.SystemConfig.DockerSocketPath = value
-		case "traefik_discovery_enabled":
-			app.SystemConfig.TraefikDiscoveryEnabled = value == "true"
-		case "traefik_url":
-			app.SystemConfig.TraefikURL = value
-		case "traefik_username":
-			app.SystemConfig.TraefikUsername = value
-		case "traefik_password":
-			app.SystemConfig.TraefikPassword = value
-		case "nginx_discovery_enabled":
-			app.SystemConfig.NginxDiscoveryEnabled = value == "true"
-		case "nginx_config_path":
-			app.SystemConfig.NginxConfigPath = value
-		case "npm_discovery_enabled":
-			app.SystemConfig.NPMDiscoveryEnabled = value == "true"
-		case "npm_url":
-			app.SystemConfig.NPMUrl = value
-		case "npm_email":
-			app.SystemConfig.NPMEmail = value
-		case "npm_password":
-			app.SystemConfig.NPMPassword = value
-		case "caddy_discovery_enabled":
-			app.SystemConfig.CaddyDiscoveryEnabled = value == "true"
-		case "caddy_admin_url":
-			app.SystemConfig.CaddyAdminURL = value
-		case "caddy_username":
-			app.SystemConfig.CaddyUsername = value
-		case "caddy_password":
-			app.SystemConfig.CaddyPassword = value
-		case "unraid_discovery_enabled":
-			app.SystemConfig.UnraidDiscoveryEnabled = value == "true"
-		case "unraid_url":
-			app.SystemConfig.UnraidURL = value
-		case "unraid_api_key":
-			app.SystemConfig.UnraidAPIKey = value
-		}
+		setSystemConfigValue(&app.SystemConfig, key, value)
 	}
+	applyConfigEnv(app)
 
 	if err := rows.Err(); err != nil {
 		return fmt.Errorf("error iterating system config rows: %w", err)
@@ -166,79 +66,391 @@ func LoadSystemConfig(app *server.App) error {
 	return nil
 }
 
-// SaveSystemConfig persists all fields of app.SystemConfig to the database
-// and then calls ApplySystemConfig to update runtime state.
-func SaveSystemConfig(app *server.App) error {
-	if app.DB == nil {
-		return fmt.Errorf("database not initialized")
+// setSystemConfigValue sets the SystemConfig field stored under key from its
+// string form. Unknown keys are ignored.
+func setSystemConfigValue(sc *models.SystemConfig, key, value string) {
+	switch key {
+	// General settings
+	case "session_days":
+		if d, err := strconv.Atoi(value); err == nil {
+			sc.SessionDays = d
+		}
+	case "max_sessions":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.MaxSessions = n
+		}
+	case "cookie_secure":
+		sc.CookieSecure = value == "true"
+	case "cookie_domain":
+		sc.CookieDomain = value
+	case "setup_completed":
+		sc.SetupCompleted = value == "true"
+	case "admin_group":
+		sc.AdminGroup = value
+	case "trusted_proxies":
+		sc.TrustedProxies = value
+
+	// Admin roles
+	case "role_app_editor_groups":
+		sc.RoleAppEditorGroups = value
+	case "role_discovery_manager_groups":
+		sc.RoleDiscoveryManagerGroups = value
+	case "role_user_manager_groups":
+		sc.RoleUserManagerGroups = value
+	case "role_system_admin_groups":
+		sc.RoleSystemAdminGroups = value
+	case "role_auditor_groups":
+		sc.RoleAuditorGroups = value
+
+	// Audit log
+	case "audit_retention_days":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.AuditRetentionDays = n
+		}
+
+	// Password policy and account lockout
+	case "password_min_length":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.PasswordMinLength = n
+		}
+	case "password_check_breached":
+		sc.PasswordCheckBreached = value == "true"
+	case "password_breached_list":
+		sc.PasswordBreachedList = value
+	case "password_history":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.PasswordHistory = n
+		}
+	case "lockout_threshold":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.LockoutThreshold = n
+		}
+	case "lockout_minutes":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.LockoutMinutes = n
+		}
+
+	// Email (SMTP) and password reset
+	case "public_url":
+		sc.PublicURL = value
+	case "smtp_host":
+		sc.SMTPHost = value
+	case "smtp_port":
+		if n, err := strconv.Atoi(value); err == nil {
+			sc.SMTPPort = n
+		}
+	case "smtp_username":
+		sc.SMTPUsername = value
+	case "smtp_password":
+		sc.SMTPPassword = value
+	case "smtp_from":
+		sc.SMTPFrom = value
+	case "smtp_security":
+		sc.SMTPSecurity = value
+	case "password_reset_enabled":
+		sc.PasswordResetEnabled = value == "true"
+
+	// Auth providers enabled
+	case "proxy_auth_enabled":
+		sc.ProxyAuthEnabled = value == "true"
+	case "local_auth_enabled":
+		sc.LocalAuthEnabled = value == "true"
+	case "ldap_auth_enabled":
+		sc.LDAPAuthEnabled = value == "true"
+	case "oidc_auth_enabled":
+		sc.OIDCAuthEnabled = value == "true"
+	case "api_key_enabled":
+		sc.APIKeyEnabled = value == "true"
+
+	// Proxy auth profile
+	case "proxy_auth_profile":
+		sc.ProxyAuthProfile = value
+	case "proxy_user_header":
+		sc.ProxyUserHeader = value
+	case "proxy_groups_header":
+		sc.ProxyGroupsHeader = value
+	case "proxy_name_header":
+		sc.ProxyNameHeader = value
+	case "proxy_email_header":
+		sc.ProxyEmailHeader = value
+	case "proxy_groups_separator":
+		sc.ProxyGroupsSeparator = value
+	case "proxy_jwks":
+		sc.ProxyJWKS = value
+	case "proxy_jwt_issuer":
+		sc.ProxyJWTIssuer = value
+	case "proxy_jwt_audience":
+		sc.ProxyJWTAudience = value
+
+	// LDAP settings
+	case "ldap_server":
+		sc.LDAPServer = value
+	case "ldap_bind_dn":
+		sc.LDAPBindDN = value
+	case "ldap_bind_password":
+		sc.LDAPBindPassword = value
+	case "ldap_base_dn":
+		sc.LDAPBaseDN = value
+	case "ldap_user_filter":
+		sc.LDAPUserFilter = value
+	case "ldap_group_filter":
+		sc.LDAPGroupFilter = value
+	case "ldap_user_attr":
+		sc.LDAPUserAttr = value
+	case "ldap_email_attr":
+		sc.LDAPEmailAttr = value
+	case "ldap_display_attr":
+		sc.LDAPDisplayAttr = value
+	case "ldap_group_attr":
+		sc.LDAPGroupAttr = value
+	case "ldap_start_tls":
+		sc.LDAPStartTLS = value == "true"
+	case "ldap_skip_verify":
+		sc.LDAPSkipVerify = value == "true"
+
+	// LLDAP management
+	case "lldap_enabled":
+		sc.LLDAPEnabled = value == "true"
+	case "lldap_url":
+		sc.LLDAPURL = value
+	case "lldap_admin_username":
+		sc.LLDAPAdminUsername = value
+	case "lldap_admin_password":
+		sc.LLDAPAdminPassword = value
+
+	// SCIM provisioning
+	case "scim_enabled":
+		sc.SCIMEnabled = value == "true"
+	case "scim_token_hash":
+		sc.SCIMTokenHash = value
+
+	// OIDC settings
+	case "oidc_issuer":
+		sc.OIDCIssuer = value
+	case "oidc_client_id":
+		sc.OIDCClientID = value
+	case "oidc_client_secret":
+		sc.OIDCClientSecret = value
+	case "oidc_redirect_url":
+		sc.OIDCRedirectURL = value
+	case "oidc_scopes":
+		sc.OIDCScopes = value
+	case "oidc_groups_claim":
+		sc.OIDCGroupsClaim = value
+	case "oidc_display_name":
+		sc.OIDCDisplayName = value
+	case "oidc_logout_enabled":
+		sc.OIDCLogoutEnabled = value == "true"
+	case "oidc_group_mapping":
+		sc.OIDCGroupMapping = value
+
+	// Admission rules
+	case "admission_email_domains":
+		sc.AdmissionEmailDomains = value
+	case "admission_required_groups":
+		sc.AdmissionRequiredGroups = value
+	case "admission_allow_list":
+		sc.AdmissionAllowList = value
+	case "admission_deny_list":
+		sc.AdmissionDenyList = value
+	case "admission_preprovisioned_only":
+		sc.AdmissionPreprovisionedOnly = value == "true"
+	case "access_requests_enabled":
+		sc.AccessRequestsEnabled = value == "true"
+	case "guest_mode_enabled":
+		sc.GuestModeEnabled = value == "true"
+	case "guest_categories":
+		sc.GuestCategories = value
+
+	// Discovery settings
+	case "docker_discovery_enabled":
+		sc.DockerDiscoveryEnabled = value == "true"
+	case "docker_socket_path":
+		sc.DockerSocketPath = value
+	case "traefik_discovery_enabled":
+		sc.TraefikDiscoveryEnabled = value == "true"
+	case "traefik_url":
+		sc.TraefikURL = value
+	case "traefik_username":
+		sc.TraefikUsername = value
+	case "traefik_password":
+		sc.TraefikPassword = value
+	case "nginx_discovery_enabled":
+		sc.NginxDiscoveryEnabled = value == "true"
+	case "nginx_config_path":
+		sc.NginxConfigPath = value
+	case "npm_discovery_enabled":
+		sc.NPMDiscoveryEnabled = value == "true"
+	case "npm_url":
+		sc.NPMUrl = value
+	case "npm_email":
+		sc.NPMEmail = value
+	case "npm_password":
+		sc.NPMPassword = value
+	case "caddy_discovery_enabled":
+		sc.CaddyDiscoveryEnabled = value == "true"
+	case "caddy_admin_url":
+		sc.CaddyAdminURL = value
+	case "caddy_username":
+		sc.CaddyUsername = value
+	case "caddy_password":
+		sc.CaddyPassword = value
+	case "unraid_discovery_enabled":
+		sc.UnraidDiscoveryEnabled = value == "true"
+	case "unraid_url":
+		sc.UnraidURL = value
+	case "unraid_api_key":
+		sc.UnraidAPIKey = value
 	}
+}
 
-	app.SysConfigMu.RLock()
-	configs := map[string]string{
+// systemConfigValues returns every SystemConfig field keyed by its
+// system_config key, in the string form setSystemConfigValue reads.
+func systemConfigValues(sc *models.SystemConfig) map[string]string {
+	return map[string]string{
 		// General settings
-		"session_days":    strconv.Itoa(app.SystemConfig.SessionDays),
-		"cookie_secure":   strconv.FormatBool(app.SystemConfig.CookieSecure),
-		"setup_completed": strconv.FormatBool(app.SystemConfig.SetupCompleted),
-		"admin_group":     app.SystemConfig.AdminGroup,
-		"trusted_proxies": app.SystemConfig.TrustedProxies,
+		"session_days":    strconv.Itoa(sc.SessionDays),
+		"max_sessions":    strconv.Itoa(sc.MaxSessions),
+		"cookie_secure":   strconv.FormatBool(sc.CookieSecure),
+		"cookie_domain":   sc.CookieDomain,
+		"setup_completed": strconv.FormatBool(sc.SetupCompleted),
+		"admin_group":     sc.AdminGroup,
+		"trusted_proxies": sc.TrustedProxies,
+
+		// Admin roles
+		"role_app_editor_groups":        sc.RoleAppEditorGroups,
+		"role_discovery_manager_groups": sc.RoleDiscoveryManagerGroups,
+		"role_user_manager_groups":      sc.RoleUserManagerGroups,
+		"role_system_admin_groups":      sc.RoleSystemAdminGroups,
+		"role_auditor_groups":           sc.RoleAuditorGroups,
+
+		// Audit log
+		"audit_retention_days": strconv.Itoa(sc.AuditRetentionDays),
+
+		// Password policy and account lockout
+		"password_min_length":     strconv.Itoa(sc.PasswordMinLength),
+		"password_check_breached": strconv.FormatBool(sc.PasswordCheckBreached),
+		"password_breached_list":  sc.PasswordBreachedList,
+		"password_history":        strconv.Itoa(sc.PasswordHistory),
+		"lockout_threshold":       strconv.Itoa(sc.LockoutThreshold),
+		"lockout_minutes":         strconv.Itoa(sc.LockoutMinutes),
+
+		// Email (SMTP) and password reset
+		"public_url":             sc.PublicURL,
+		"smtp_host":              sc.SMTPHost,
+		"smtp_port":              strconv.Itoa(sc.SMTPPort),
+		"smtp_username":          sc.SMTPUsername,
+		"smtp_password":          sc.SMTPPassword,
+		"smtp_from":              sc.SMTPFrom,
+		"smtp_security":          sc.SMTPSecurity,
+		"password_reset_enabled": strconv.FormatBool(sc.PasswordResetEnabled),
 
 		// Auth providers enabled
-		"proxy_auth_enabled": strconv.FormatBool(app.SystemConfig.ProxyAuthEnabled),
-		"local_auth_enabled": strconv.FormatBool(app.SystemConfig.LocalAuthEnabled),
-		"ldap_auth_enabled":  strconv.FormatBool(app.SystemConfig.LDAPAuthEnabled),
-		"oidc_auth_enabled":  strconv.FormatBool(app.SystemConfig.OIDCAuthEnabled),
-		"api_key_enabled":    strconv.FormatBool(app.SystemConfig.APIKeyEnabled),
+		"proxy_auth_enabled": strconv.FormatBool(sc.ProxyAuthEnabled),
+		"local_auth_enabled": strconv.FormatBool(sc.LocalAuthEnabled),
+		"ldap_auth_enabled":  strconv.FormatBool(sc.LDAPAuthEnabled),
+		"oidc_auth_enabled":  strconv.FormatBool(sc.OIDCAuthEnabled),
+		"api_key_enabled":    strconv.FormatBool(sc.APIKeyEnabled),
+
+		// Proxy auth profile
+		"proxy_auth_profile":     sc.ProxyAuthProfile,
+		"proxy_user_header":      sc.ProxyUserHeader,
+		"proxy_groups_header":    sc.ProxyGroupsHeader,
+		"proxy_name_header":      sc.ProxyNameHeader,
+		"proxy_email_header":     sc.ProxyEmailHeader,
+		"proxy_groups_separator": sc.ProxyGroupsSeparator,
+		"proxy_jwks":             sc.ProxyJWKS,
+		"proxy_jwt_issuer":       sc.ProxyJWTIssuer,
+		"proxy_jwt_audience":     sc.ProxyJWTAudience,
 
 		// LDAP settings
-		"ldap_server":        app.SystemConfig.LDAPServer,
-		"ldap_bind_dn":       app.SystemConfig.LDAPBindDN,
-		"ldap_bind_password": app.SystemConfig.LDAPBindPassword,
-		"ldap_base_dn":       app.SystemConfig.LDAPBaseDN,
-		"ldap_user_filter":   app.SystemConfig.LDAPUserFilter,
-		"ldap_group_filter":  app.SystemConfig.LDAPGroupFilter,
-		"ldap_user_attr":     app.SystemConfig.LDAPUserAttr,
-		"ldap_email_attr":    app.SystemConfig.LDAPEmailAttr,
-		"ldap_display_attr":  app.SystemConfig.LDAPDisplayAttr,
-		"ldap_group_attr":    app.SystemConfig.LDAPGroupAttr,
-		"ldap_start_tls":     strconv.FormatBool(app.SystemConfig.LDAPStartTLS),
-		"ldap_skip_verify":   strconv.FormatBool(app.SystemConfig.LDAPSkipVerify),
+		"ldap_server":        sc.LDAPServer,
+		"ldap_bind_dn":       sc.LDAPBindDN,
+		"ldap_bind_password": sc.LDAPBindPassword,
+		"ldap_base_dn":       sc.LDAPBaseDN,
+		"ldap_user_filter":   sc.LDAPUserFilter,
+		"ldap_group_filter":  sc.LDAPGroupFilter,
+		"ldap_user_attr":     sc.LDAPUserAttr,
+		"ldap_email_attr":    sc.LDAPEmailAttr,
+		"ldap_display_attr":  sc.LDAPDisplayAttr,
+		"ldap_group_attr":    sc.LDAPGroupAttr,
+		"ldap_start_tls":     strconv.FormatBool(sc.LDAPStartTLS),
+		"ldap_skip_verify":   strconv.FormatBool(sc.LDAPSkipVerify),
+
+		// LLDAP management
+		"lldap_enabled":        strconv.FormatBool(sc.LLDAPEnabled),
+		"lldap_url":            sc.LLDAPURL,
+		"lldap_admin_username": sc.LLDAPAdminUsername,
+		"lldap_admin_password": sc.LLDAPAdminPassword,
+
+		// SCIM provisioning
+		"scim_enabled":    strconv.FormatBool(sc.SCIMEnabled),
+		"scim_token_hash": sc.SCIMTokenHash,
 
 		// OIDC settings
-		"oidc_issuer":        app.SystemConfig.OIDCIssuer,
-		"oidc_client_id":     app.SystemConfig.OIDCClientID,
-		"oidc_client_secret": app.SystemConfig.OIDCClientSecret,
-		"oidc_redirect_url":  app.SystemConfig.OIDCRedirectURL,
-		"oidc_scopes":        app.SystemConfig.OIDCScopes,
-		"oidc_groups_claim":  app.SystemConfig.OIDCGroupsClaim,
-		"oidc_display_name":  app.SystemConfig.OIDCDisplayName,
+		"oidc_issuer":         sc.OIDCIssuer,
+		"oidc_client_id":      sc.OIDCClientID,
+		"oidc_client_secret":  sc.OIDCClientSecret,
+		"oidc_redirect_url":   sc.OIDCRedirectURL,
+		"oidc_scopes":         sc.OIDCScopes,
+		"oidc_groups_claim":   sc.OIDCGroupsClaim,
+		"oidc_display_name":   sc.OIDCDisplayName,
+		"oidc_logout_enabled": strconv.FormatBool(sc.OIDCLogoutEnabled),
+		"oidc_group_mapping":  sc.OIDCGroupMapping,
+
+		// Admission rules
+		"admission_email_domains":       sc.AdmissionEmailDomains,
+		"admission_required_groups":     sc.AdmissionRequiredGroups,
+		"admission_allow_list":          sc.AdmissionAllowList,
+		"admission_deny_list":           sc.AdmissionDenyList,
+		"admission_preprovisioned_only": strconv.FormatBool(sc.AdmissionPreprovisionedOnly),
+		"access_requests_enabled":       strconv.FormatBool(sc.AccessRequestsEnabled),
+		"guest_mode_enabled":            strconv.FormatBool(sc.GuestModeEnabled),
+		"guest_categories":              sc.GuestCategories,
 
 		// Discovery settings
-		"docker_discovery_enabled":  strconv.FormatBool(app.SystemConfig.DockerDiscoveryEnabled),
-		"docker_socket_path":        app.SystemConfig.DockerSocketPath,
-		"traefik_discovery_enabled": strconv.FormatBool(app.SystemConfig.TraefikDiscoveryEnabled),
-		"traefik_url":               app.SystemConfig.TraefikURL,
-		"traefik_username":          app.SystemConfig.TraefikUsername,
-		"traefik_password":          app.SystemConfig.TraefikPassword,
-		"nginx_discovery_enabled":   strconv.FormatBool(app.SystemConfig.NginxDiscoveryEnabled),
-		"nginx_config_path":         app.SystemConfig.NginxConfigPath,
-		"npm_discovery_enabled":     strconv.FormatBool(app.SystemConfig.NPMDiscoveryEnabled),
-		"npm_url":                   app.SystemConfig.NPMUrl,
-		"npm_email":                 app.SystemConfig.NPMEmail,
-		"npm_password":              app.SystemConfig.NPMPassword,
-		"caddy_discovery_enabled":   strconv.FormatBool(app.SystemConfig.CaddyDiscoveryEnabled),
-		"caddy_admin_url":           app.SystemConfig.CaddyAdminURL,
-		"caddy_username":            app.SystemConfig.CaddyUsername,
-		"caddy_password":            app.SystemConfig.CaddyPassword,
-		"unraid_discovery_enabled":  strconv.FormatBool(app.SystemConfig.UnraidDiscoveryEnabled),
-		"unraid_url":                app.SystemConfig.UnraidURL,
-		"unraid_api_key":            app.SystemConfig.UnraidAPIKey,
+		"docker_discovery_enabled":  strconv.FormatBool(sc.DockerDiscoveryEnabled),
+		"docker_socket_path":        sc.DockerSocketPath,
+		"traefik_discovery_enabled": strconv.FormatBool(sc.TraefikDiscoveryEnabled),
+		"traefik_url":               sc.TraefikURL,
+		"traefik_username":          sc.TraefikUsername,
+		"traefik_password":          sc.TraefikPassword,
+		"nginx_discovery_enabled":   strconv.FormatBool(sc.NginxDiscoveryEnabled),
+		"nginx_config_path":         sc.NginxConfigPath,
+		"npm_discovery_enabled":     strconv.FormatBool(sc.NPMDiscoveryEnabled),
+		"npm_url":                   sc.NPMUrl,
+		"npm_email":                 sc.NPMEmail,
+		"npm_password":              sc.NPMPassword,
+		"caddy_discovery_enabled":   strconv.FormatBool(sc.CaddyDiscoveryEnabled),
+		"caddy_admin_url":           sc.CaddyAdminURL,
+		"caddy_username":            sc.CaddyUsername,
+		"caddy_password":            sc.CaddyPassword,
+		"unraid_discovery_enabled":  strconv.FormatBool(sc.UnraidDiscoveryEnabled),
+		"unraid_url":                sc.UnraidURL,
+		"unraid_api_key":            sc.UnraidAPIKey,
+	}
+}
+
+// SaveSystemConfig persists all fields of app.SystemConfig to the database
+// and then calls ApplySystemConfig to update runtime state.
+func SaveSystemConfig(app *server.App) error {
+	if app.DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	app.SysConfigMu.Lock()
+	// Values from the environment win over any change and are never stored
+	applyConfigEnv(app)
+	configs := systemConfigValues(&app.SystemConfig)
+	app.SysConfigMu.Unlock()
+	for key := range app.ConfigEnv {
+		delete(configs, key)
 	}
-	app.SysConfigMu.RUnlock()
 
 	// Encrypt sensitive values before persisting
 	for key, value := range configs {
 		if encryption.IsSensitiveKey(key) && value != "" {
-			encrypted, err := encryption.EncryptValue(app.EncryptionKey, value)
+			encrypted, err := encryptValue(app, value)
 			if err != nil {
 				log.Printf("WARNING: failed to encrypt config key %q, storing in plaintext: %v", key, err)
 			} else {
@@ -273,6 +485,38 @@ func SaveSystemConfig(app *server.App) error {
 	return nil
 }
 
+// SetLDAPDefaults fills in the LDAP search settings left empty. Setup and
+// ApplySystemConfig share these, so a saved config and the running one agree.
+func SetLDAPDefaults(sc *models.SystemConfig) {
+	if sc.LDAPUserFilter == "" {
+		sc.LDAPUserFilter = "(uid=%s)"
+	}
+	if sc.LDAPUserAttr == "" {
+		sc.LDAPUserAttr = "uid"
+	}
+	if sc.LDAPEmailAttr == "" {
+		sc.LDAPEmailAttr = "mail"
+	}
+	if sc.LDAPDisplayAttr == "" {
+		sc.LDAPDisplayAttr = "cn"
+	}
+	if sc.LDAPGroupAttr == "" {
+		sc.LDAPGroupAttr = "memberOf"
+	}
+}
+
+// SetOIDCDefaults fills in the OIDC scopes and groups claim left empty when
+// OIDC is set up. A config saved without scopes keeps asking only for
+// openid, profile and email, as not every provider accepts a groups scope.
+func SetOIDCDefaults(sc *models.SystemConfig) {
+	if sc.OIDCScopes == "" {
+		sc.OIDCScopes = "openid profile email groups"
+	}
+	if sc.OIDCGroupsClaim == "" {
+		sc.OIDCGroupsClaim = "groups"
+	}
+}
+
 // ApplySystemConfig takes the current app.SystemConfig values and applies them
 // to the runtime auth configuration, LDAP config, and OIDC provider.
 func ApplySystemConfig(app *server.App) {
@@ -285,17 +529,13 @@ func ApplySystemConfig(app *server.App) {
 		app.AuthConfig.SessionDuration = app.SystemConfig.SessionDays
 	}
 	app.AuthConfig.CookieSecure = app.SystemConfig.CookieSecure
+	app.AuthConfig.CookieDomain = app.SystemConfig.CookieDomain
 
 	// Allow COOKIE_SECURE env var to override DB config
 	if os.Getenv("COOKIE_SECURE") == "false" {
 		app.AuthConfig.CookieSecure = false
 	}
 
-	// Allow OIDC_DISPLAY_NAME env var to override DB config
-	if dn := os.Getenv("OIDC_DISPLAY_NAME"); dn != "" {
-		app.SystemConfig.OIDCDisplayName = dn
-	}
-
 	// Determine auth mode from enabled providers (for backward compatibility)
 	if app.SystemConfig.ProxyAuthEnabled && app.SystemConfig.LocalAuthEnabled {
 		app.AuthConfig.Mode = models.AuthModeHybrid
@@ -327,6 +567,22 @@ func ApplySystemConfig(app *server.App) {
 		}
 	}
 
+	// Build the verifier for signed proxy assertions. Remote JWKS are fetched
+	// lazily on first use, so this does not block on network I/O.
+	app.ProxyJWTVerifier = nil
+	if app.SystemConfig.ProxyAuthEnabled && app.SystemConfig.ProxyJWKS != "" {
+		verifier, err := oidc.NewProxyJWTVerifier(app.HTTPClient, app.SystemConfig.ProxyJWKS, app.SystemConfig.ProxyJWTIssuer, app.SystemConfig.ProxyJWTAudience)
+		if err != nil {
+			log.Printf("Failed to configure proxy JWT verification: %v", err)
+		} else {
+			app.ProxyJWTVerifier = verifier
+		}
+	}
+
+	// LDAP defaults for settings left empty, without changing the stored config
+	withDefaults := app.SystemConfig
+	SetLDAPDefaults(&withDefaults)
+
 	// Initialize LDAP if enabled
 	if app.SystemConfig.LDAPAuthEnabled && app.SystemConfig.LDAPServer != "" {
 		app.LDAPAuth = &models.LDAPAuthConfig{
@@ -334,31 +590,15 @@ func ApplySystemConfig(app *server.App) {
 			BindDN:       app.SystemConfig.LDAPBindDN,
 			BindPassword: app.SystemConfig.LDAPBindPassword,
 			BaseDN:       app.SystemConfig.LDAPBaseDN,
-			UserFilter:   app.SystemConfig.LDAPUserFilter,
+			UserFilter:   withDefaults.LDAPUserFilter,
 			GroupFilter:  app.SystemConfig.LDAPGroupFilter,
-			UserAttr:     app.SystemConfig.LDAPUserAttr,
-			EmailAttr:    app.SystemConfig.LDAPEmailAttr,
-			DisplayAttr:  app.SystemConfig.LDAPDisplayAttr,
-			GroupAttr:    app.SystemConfig.LDAPGroupAttr,
+			UserAttr:     withDefaults.LDAPUserAttr,
+			EmailAttr:    withDefaults.LDAPEmailAttr,
+			DisplayAttr:  withDefaults.LDAPDisplayAttr,
+			GroupAttr:    withDefaults.LDAPGroupAttr,
 			StartTLS:     app.SystemConfig.LDAPStartTLS,
 			SkipVerify:   app.SystemConfig.LDAPSkipVerify,
 		}
-		// Set defaults if not specified
-		if app.LDAPAuth.UserFilter == "" {
-			app.LDAPAuth.UserFilter = "(uid=%s)"
-		}
-		if app.LDAPAuth.UserAttr == "" {
-			app.LDAPAuth.UserAttr = "uid"
-		}
-		if app.LDAPAuth.EmailAttr == "" {
-			app.LDAPAuth.EmailAttr = "mail"
-		}
-		if app.LDAPAuth.DisplayAttr == "" {
-			app.LDAPAuth.DisplayAttr = "displayName"
-		}
-		if app.LDAPAuth.GroupAttr == "" {
-			app.LDAPAuth.GroupAttr = "memberOf"
-		}
 		log.Printf("LDAP auth configured: %s", app.LDAPAuth.Server)
 	} else {
 		app.LDAPAuth = nil
@@ -381,4 +621,6 @@ func ApplySystemConfig(app *server.App) {
 		app.OAuth2Config = nil
 		app.SysConfigMu.Unlock()
 	}
+
+	ReloadOIDCProviders(app)
 }
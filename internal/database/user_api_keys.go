@@ -0,0 +1,243 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrAPIKeyNotFound is returned when a user has no personal key with the
+// given ID.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKeyReminder is a personal key that expires soon and whose owner has not
+// been reminded yet.
+type APIKeyReminder struct {
+	ID          int
+	Name        string
+	Username    string
+	DisplayName string
+	Email       string
+	ExpiresAt   time.Time
+}
+
+// RevokedAPIKey is a personal key removed because its owner outgrew it.
+type RevokedAPIKey struct {
+	ID       int
+	Name     string
+	Username string
+	Reason   string
+}
+
+// ListPersonalAPIKeys returns the personal keys owned by a user, newest
+// first.
+func ListPersonalAPIKeys(app *server.App, userID int) ([]models.APIKey, error) {
+	rows, err := app.DB.Query(
+		"SELECT id, name, key_prefix, username, groups, expires_at, last_used_at, created_at, allowed_networks FROM api_keys WHERE user_id = ? AND personal = 1 ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k := models.APIKey{Personal: true}
+		var groupsJSON string
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Username, &groupsJSON, &expiresAt, &lastUsedAt, &k.CreatedAt, &k.AllowedNetworks); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(groupsJSON), &k.Groups)
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// CountPersonalAPIKeys returns how many personal keys a user owns.
+func CountPersonalAPIKeys(app *server.App, userID int) (int, error) {
+	var n int
+	err := app.DB.QueryRow("SELECT COUNT(*) FROM api_keys WHERE user_id = ? AND personal = 1", userID).Scan(&n)
+	return n, err
+}
+
+// CreatePersonalAPIKey stores a key owned by a user and returns its ID.
+func CreatePersonalAPIKey(app *server.App, userID int, username, name, keyHash, keyPrefix, groups, allowedNetworks string, expiresAt *time.Time) (int64, error) {
+	result, err := app.DB.Exec(
+		"INSERT INTO api_keys (name, key_hash, key_prefix, user_id, username, groups, permissions, expires_at, allowed_networks, personal, created_at) VALUES (?, ?, ?, ?, ?, ?, '[\"read\"]', ?, ?, 1, ?)",
+		name, keyHash, keyPrefix, userID, username, groups, expiresAt, allowedNetworks, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DeletePersonalAPIKey removes one of a user's personal keys.
+func DeletePersonalAPIKey(app *server.App, userID, id int) error {
+	result, err := app.DB.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ? AND personal = 1", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RotatePersonalAPIKey replaces the secret of one of a user's personal keys.
+// The key keeps its name, groups and networks, and a key that expires gets
+// the same lifetime again from now. It returns the new expiry.
+func RotatePersonalAPIKey(app *server.App, userID, id int, keyHash, keyPrefix string) (*time.Time, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	var expiresAt sql.NullTime
+	err = tx.QueryRow("SELECT created_at, expires_at FROM api_keys WHERE id = ? AND user_id = ? AND personal = 1", id, userID).Scan(&createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var newExpiry *time.Time
+	if expiresAt.Valid {
+		t := now.Add(expiresAt.Time.Sub(createdAt))
+		newExpiry = &t
+	}
+	if _, err := tx.Exec(
+		"UPDATE api_keys SET key_hash = ?, key_prefix = ?, created_at = ?, expires_at = ?, last_used_at = NULL, reminder_sent_at = NULL WHERE id = ?",
+		keyHash, keyPrefix, now, newExpiry, id,
+	); err != nil {
+		return nil, err
+	}
+	return newExpiry, tx.Commit()
+}
+
+// PersonalAPIKeyOutgrown returns why a personal key may no longer be used,
+// or "" if its owner still exists, is active and holds all of its groups.
+// ownerID is 0 once the owner has been deleted.
+func PersonalAPIKeyOutgrown(app *server.App, ownerID int, keyGroups []string) string {
+	if ownerID == 0 {
+		return "owner deleted"
+	}
+	var groupsJSON string
+	var disabled bool
+	err := app.DB.QueryRow("SELECT COALESCE(groups, '[]'), disabled FROM users WHERE id = ?", ownerID).Scan(&groupsJSON, &disabled)
+	if err == sql.ErrNoRows {
+		return "owner deleted"
+	}
+	if err != nil {
+		// Keep the key on transient errors; the next check decides
+		return ""
+	}
+	if disabled {
+		return "owner deactivated"
+	}
+
+	var ownerGroups []string
+	json.Unmarshal([]byte(groupsJSON), &ownerGroups)
+	held := make(map[string]bool, len(ownerGroups))
+	for _, g := range ownerGroups {
+		held[g] = true
+	}
+	for _, g := range keyGroups {
+		if !held[g] {
+			return "owner no longer in group " + g
+		}
+	}
+	return ""
+}
+
+// RevokeOutgrownAPIKeys deletes every personal key whose owner was deleted,
+// deactivated or lost one of the key's groups, and returns what it removed.
+func RevokeOutgrownAPIKeys(app *server.App) ([]RevokedAPIKey, error) {
+	rows, err := app.DB.Query("SELECT id, name, username, COALESCE(user_id, 0), COALESCE(groups, '[]') FROM api_keys WHERE personal = 1")
+	if err != nil {
+		return nil, err
+	}
+	type personalKey struct {
+		RevokedAPIKey
+		ownerID int
+		groups  []string
+	}
+	var keys []personalKey
+	for rows.Next() {
+		var k personalKey
+		var groupsJSON string
+		if err := rows.Scan(&k.ID, &k.Name, &k.Username, &k.ownerID, &groupsJSON); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		json.Unmarshal([]byte(groupsJSON), &k.groups)
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Checked after iterating to avoid a deadlock with SetMaxOpenConns(1)
+	var revoked []RevokedAPIKey
+	for _, k := range keys {
+		if k.Reason = PersonalAPIKeyOutgrown(app, k.ownerID, k.groups); k.Reason == "" {
+			continue
+		}
+		if _, err := DeleteAPIKey(app, k.ID); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, k.RevokedAPIKey)
+	}
+	return revoked, nil
+}
+
+// APIKeysDueForReminder returns unexpired personal keys that expire before
+// the given time, whose owners have an email address and have not been
+// reminded yet.
+func APIKeysDueForReminder(app *server.App, before time.Time) ([]APIKeyReminder, error) {
+	rows, err := app.DB.Query(
+		`SELECT k.id, k.name, u.username, COALESCE(u.display_name, ''), u.email, k.expires_at
+		FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.personal = 1 AND k.reminder_sent_at IS NULL AND k.expires_at IS NOT NULL
+			AND k.expires_at > ? AND k.expires_at < ? AND COALESCE(u.email, '') != ''`,
+		time.Now(), before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []APIKeyReminder
+	for rows.Next() {
+		var k APIKeyReminder
+		if err := rows.Scan(&k.ID, &k.Name, &k.Username, &k.DisplayName, &k.Email, &k.ExpiresAt); err != nil {
+			return nil, err
+		}
+		due = append(due, k)
+	}
+	return due, rows.Err()
+}
+
+// MarkAPIKeyReminderSent records that the owner of a key was reminded of its
+// expiry.
+func MarkAPIKeyReminderSent(app *server.App, id int) error {
+	_, err := app.DB.Exec("UPDATE api_keys SET reminder_sent_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -18,37 +17,17 @@ import (
 	"golang.org/x/text/language"
 )
 
-// InitCaddyDiscovery checks environment variables and system config,
-// then starts the Caddy discovery loop if enabled.
+// InitCaddyDiscovery starts the Caddy discovery loop if it is enabled and
+// has an admin API URL.
 func InitCaddyDiscovery(app *server.App) {
-	if cu := os.Getenv("CADDY_ADMIN_URL"); cu != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.CaddyAdminURL = cu
-		app.SysConfigMu.Unlock()
-	}
-	// Also check for auth env vars
-	if envUser := os.Getenv("CADDY_USERNAME"); envUser != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.CaddyUsername = envUser
-		app.SysConfigMu.Unlock()
-	}
-	if envPass := os.Getenv("CADDY_PASSWORD"); envPass != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.CaddyPassword = envPass
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.CaddyDiscoveryEnabled
+	adminURL := app.SystemConfig.CaddyAdminURL
+	app.SysConfigMu.RUnlock()
 
-	if os.Getenv("CADDY_DISCOVERY") == "true" {
-		app.CaddyDiscoveryEnvOverride = true
-		StartCaddyDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Caddy discovery enabled (via environment variable, API: %s)", app.SystemConfig.CaddyAdminURL)
-		app.SysConfigMu.RUnlock()
-	} else if app.SystemConfig.CaddyDiscoveryEnabled && app.SystemConfig.CaddyAdminURL != "" {
+	if enabled && adminURL != "" {
 		StartCaddyDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Caddy discovery enabled (via database config, API: %s)", app.SystemConfig.CaddyAdminURL)
-		app.SysConfigMu.RUnlock()
+		log.Printf("Caddy discovery enabled (via %s, API: %s)", configSource(app, "caddy_discovery_enabled"), adminURL)
 	}
 }
 
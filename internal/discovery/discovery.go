@@ -54,6 +54,14 @@ func GetAllRawDiscoveredApps(app *server.App) []models.DiscoveredAppWithOverride
 	return result
 }
 
+// configSource describes where a discovery setting came from, for logging.
+func configSource(app *server.App, key string) string {
+	if v := app.ConfigEnvVar(key); v != "" {
+		return "environment variable " + v
+	}
+	return "database config"
+}
+
 // getDiscoveredOverride returns a copy of the override for the given URL, or nil.
 func getDiscoveredOverride(app *server.App, url string) *models.DiscoveredAppOverride {
 	app.DiscoveredOverridesMu.RLock()
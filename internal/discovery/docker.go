@@ -16,24 +16,16 @@ import (
 	"dashgate/internal/urlvalidation"
 )
 
-// InitDockerDiscovery checks environment variables and system config,
-// then starts the Docker discovery loop if enabled.
+// InitDockerDiscovery starts the Docker discovery loop if it is enabled in
+// the system config or by DASHGATE_DOCKER_DISCOVERY_ENABLED.
 func InitDockerDiscovery(app *server.App) {
-	// Check for env var override first
-	if sp := os.Getenv("DOCKER_SOCKET"); sp != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.DockerSocketPath = sp
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.DockerDiscoveryEnabled
+	app.SysConfigMu.RUnlock()
 
-	if os.Getenv("DOCKER_DISCOVERY") == "true" {
-		app.DockerDiscoveryEnvOverride = true
-		StartDockerDiscoveryLoop(app)
-		log.Println("Docker discovery enabled (via environment variable)")
-	} else if app.SystemConfig.DockerDiscoveryEnabled {
-		// Load from database config if no env var
+	if enabled {
 		StartDockerDiscoveryLoop(app)
-		log.Println("Docker discovery enabled (via database config)")
+		log.Printf("Docker discovery enabled (via %s)", configSource(app, "docker_discovery_enabled"))
 	}
 }
 
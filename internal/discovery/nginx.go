@@ -33,26 +33,16 @@ var (
 // maxIncludeFileSize is the maximum size of a file that can be included (1 MB).
 const maxIncludeFileSize = 1 << 20
 
-// InitNginxDiscovery checks environment variables and system config,
-// then starts the Nginx discovery loop if enabled.
+// InitNginxDiscovery starts the Nginx discovery loop if it is enabled.
 func InitNginxDiscovery(app *server.App) {
-	if cp := os.Getenv("NGINX_CONFIG_PATH"); cp != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.NginxConfigPath = cp
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.NginxDiscoveryEnabled
+	configPath := app.SystemConfig.NginxConfigPath
+	app.SysConfigMu.RUnlock()
 
-	if os.Getenv("NGINX_DISCOVERY") == "true" {
-		app.NginxDiscoveryEnvOverride = true
-		StartNginxDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Nginx discovery enabled (via environment variable, config path: %s)", app.SystemConfig.NginxConfigPath)
-		app.SysConfigMu.RUnlock()
-	} else if app.SystemConfig.NginxDiscoveryEnabled {
+	if enabled {
 		StartNginxDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Nginx discovery enabled (via database config, config path: %s)", app.SystemConfig.NginxConfigPath)
-		app.SysConfigMu.RUnlock()
+		log.Printf("Nginx discovery enabled (via %s, config path: %s)", configSource(app, "nginx_discovery_enabled"), configPath)
 	}
 }
 
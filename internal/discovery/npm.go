@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -37,40 +36,18 @@ func (fb *flexBool) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("flexBool: cannot unmarshal %s", string(data))
 }
 
-// InitNPMDiscovery checks environment variables and system config,
-// then starts the NPM (Nginx Proxy Manager) discovery loop if enabled.
+// InitNPMDiscovery starts the NPM (Nginx Proxy Manager) discovery loop if
+// it is enabled and has an API URL and credentials.
 func InitNPMDiscovery(app *server.App) {
-	envURL := os.Getenv("NPM_URL")
-	envEmail := os.Getenv("NPM_EMAIL")
-	envPassword := os.Getenv("NPM_PASSWORD")
-
-	if envURL != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.NPMUrl = envURL
-		app.SysConfigMu.Unlock()
-	}
-	if envEmail != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.NPMEmail = envEmail
-		app.SysConfigMu.Unlock()
-	}
-	if envPassword != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.NPMPassword = envPassword
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.NPMDiscoveryEnabled
+	npmURL := app.SystemConfig.NPMUrl
+	complete := npmURL != "" && app.SystemConfig.NPMEmail != "" && app.SystemConfig.NPMPassword != ""
+	app.SysConfigMu.RUnlock()
 
-	if envURL != "" && envEmail != "" && envPassword != "" && os.Getenv("NPM_DISCOVERY") == "true" {
-		app.NPMDiscoveryEnvOverride = true
-		StartNPMDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("NPM discovery enabled (via environment variable, API: %s)", app.SystemConfig.NPMUrl)
-		app.SysConfigMu.RUnlock()
-	} else if app.SystemConfig.NPMDiscoveryEnabled && app.SystemConfig.NPMUrl != "" && app.SystemConfig.NPMEmail != "" && app.SystemConfig.NPMPassword != "" {
+	if enabled && complete {
 		StartNPMDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("NPM discovery enabled (via database config, API: %s)", app.SystemConfig.NPMUrl)
-		app.SysConfigMu.RUnlock()
+		log.Printf("NPM discovery enabled (via %s, API: %s)", configSource(app, "npm_discovery_enabled"), npmURL)
 	}
 }
 
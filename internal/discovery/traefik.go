@@ -6,7 +6,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -18,38 +17,17 @@ import (
 	"golang.org/x/text/language"
 )
 
-// InitTraefikDiscovery checks environment variables and system config,
-// then starts the Traefik discovery loop if enabled.
+// InitTraefikDiscovery starts the Traefik discovery loop if it is enabled
+// and has an API URL.
 func InitTraefikDiscovery(app *server.App) {
-	envURL := os.Getenv("TRAEFIK_URL")
-	if envURL != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.TraefikURL = envURL
-		app.SysConfigMu.Unlock()
-	}
-	// Also check for auth env vars
-	if envUser := os.Getenv("TRAEFIK_USERNAME"); envUser != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.TraefikUsername = envUser
-		app.SysConfigMu.Unlock()
-	}
-	if envPass := os.Getenv("TRAEFIK_PASSWORD"); envPass != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.TraefikPassword = envPass
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.TraefikDiscoveryEnabled
+	traefikURL := app.SystemConfig.TraefikURL
+	app.SysConfigMu.RUnlock()
 
-	if envURL != "" && os.Getenv("TRAEFIK_DISCOVERY") == "true" {
-		app.TraefikDiscoveryEnvOverride = true
-		StartTraefikDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Traefik discovery enabled (via environment variable, API: %s)", app.SystemConfig.TraefikURL)
-		app.SysConfigMu.RUnlock()
-	} else if app.SystemConfig.TraefikDiscoveryEnabled && app.SystemConfig.TraefikURL != "" {
+	if enabled && traefikURL != "" {
 		StartTraefikDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Traefik discovery enabled (via database config, API: %s)", app.SystemConfig.TraefikURL)
-		app.SysConfigMu.RUnlock()
+		log.Printf("Traefik discovery enabled (via %s, API: %s)", configSource(app, "traefik_discovery_enabled"), traefikURL)
 	}
 }
 
@@ -8,7 +8,6 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 
@@ -33,39 +32,18 @@ const unraidGraphQLQuery = `{
   }
 }`
 
-// InitUnraidDiscovery checks environment variables and system config,
-// then starts the Unraid discovery loop if enabled.
+// InitUnraidDiscovery starts the Unraid discovery loop if it is enabled and
+// has an API URL and key.
 func InitUnraidDiscovery(app *server.App) {
-	envURL := os.Getenv("UNRAID_URL")
-	envAPIKey := os.Getenv("UNRAID_API_KEY")
-
-	if envURL != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.UnraidURL = envURL
-		app.SysConfigMu.Unlock()
-	}
-	if envAPIKey != "" {
-		app.SysConfigMu.Lock()
-		app.SystemConfig.UnraidAPIKey = envAPIKey
-		app.SysConfigMu.Unlock()
-	}
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.UnraidDiscoveryEnabled
+	unraidURL := app.SystemConfig.UnraidURL
+	hasKey := app.SystemConfig.UnraidAPIKey != ""
+	app.SysConfigMu.RUnlock()
 
-	if envURL != "" && envAPIKey != "" && os.Getenv("UNRAID_DISCOVERY") == "true" {
-		app.UnraidDiscoveryEnvOverride = true
+	if enabled && unraidURL != "" && hasKey {
 		StartUnraidDiscoveryLoop(app)
-		app.SysConfigMu.RLock()
-		log.Printf("Unraid discovery enabled (via environment variable, API: %s)", app.SystemConfig.UnraidURL)
-		app.SysConfigMu.RUnlock()
-	} else {
-		app.SysConfigMu.RLock()
-		dbEnabled := app.SystemConfig.UnraidDiscoveryEnabled
-		dbURL := app.SystemConfig.UnraidURL
-		dbAPIKey := app.SystemConfig.UnraidAPIKey
-		app.SysConfigMu.RUnlock()
-		if dbEnabled && dbURL != "" && dbAPIKey != "" {
-			StartUnraidDiscoveryLoop(app)
-			log.Printf("Unraid discovery enabled (via database config, API: %s)", dbURL)
-		}
+		log.Printf("Unraid discovery enabled (via %s, API: %s)", configSource(app, "unraid_discovery_enabled"), unraidURL)
 	}
 }
 
@@ -4,27 +4,55 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"strings"
 )
 
+// Encrypted values look like enc:<key ID>:<base64 nonce+ciphertext>. Values
+// written before key IDs existed have no ID: enc:<base64>.
 const encPrefix = "enc:"
 
 var sensitiveKeys = map[string]bool{
-	"ldap_bind_password": true,
-	"oidc_client_secret": true,
-	"npm_password":       true,
-	"traefik_password":   true,
-	"caddy_password":     true,
-	"unraid_api_key":     true,
+	"ldap_bind_password":   true,
+	"oidc_client_secret":   true,
+	"npm_password":         true,
+	"traefik_password":     true,
+	"caddy_password":       true,
+	"unraid_api_key":       true,
+	"smtp_password":        true,
+	"lldap_admin_password": true,
 }
 
 func IsSensitiveKey(key string) bool {
 	return sensitiveKeys[key]
 }
 
+// KeyID returns the identifier embedded in values encrypted with key: the
+// first 8 hex characters of its SHA-256 hash.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// ValueKeyID returns the ID of the key a value was encrypted with. The ID is
+// empty for values written before key IDs existed, and ok is false for
+// values that are not encrypted.
+func ValueKeyID(value string) (id string, ok bool) {
+	if !strings.HasPrefix(value, encPrefix) {
+		return "", false
+	}
+	// The base64 alphabet has no colon
+	id, _, found := strings.Cut(strings.TrimPrefix(value, encPrefix), ":")
+	if !found {
+		return "", true
+	}
+	return id, true
+}
+
 func EncryptValue(key []byte, plaintext string) (string, error) {
 	if len(key) == 0 {
 		return plaintext, nil
@@ -56,23 +84,48 @@ func EncryptValue(key []byte, plaintext string) (string, error) {
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 	encoded := base64.StdEncoding.EncodeToString(ciphertext)
 
-	return encPrefix + encoded, nil
+	return encPrefix + KeyID(key) + ":" + encoded, nil
 }
 
-func DecryptValue(key []byte, ciphertext string) (string, error) {
+// DecryptValue decrypts a value produced by EncryptValue. oldKeys are used
+// for values encrypted before a key rotation; the key is picked by the ID in
+// the value, and every key is tried for values without one.
+func DecryptValue(key []byte, ciphertext string, oldKeys ...[]byte) (string, error) {
 	if len(key) == 0 {
 		return ciphertext, nil
 	}
 
-	if !strings.HasPrefix(ciphertext, encPrefix) {
+	id, ok := ValueKeyID(ciphertext)
+	if !ok {
 		return ciphertext, nil
 	}
 
+	keys := append([][]byte{key}, oldKeys...)
 	encoded := strings.TrimPrefix(ciphertext, encPrefix)
-	if encoded == "" {
-		return "", nil
+	if id == "" {
+		if encoded == "" {
+			return "", nil
+		}
+		var err error
+		for _, k := range keys {
+			var plaintext string
+			if plaintext, err = decrypt(k, encoded); err == nil {
+				return plaintext, nil
+			}
+		}
+		return "", err
+	}
+
+	encoded = strings.TrimPrefix(encoded, id+":")
+	for _, k := range keys {
+		if KeyID(k) == id {
+			return decrypt(k, encoded)
+		}
 	}
+	return "", fmt.Errorf("no encryption key with ID %s", id)
+}
 
+func decrypt(key []byte, encoded string) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", fmt.Errorf("failed to base64 decode: %w", err)
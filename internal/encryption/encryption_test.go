@@ -190,3 +190,37 @@ func TestDecryptEmptyAfterPrefix(t *testing.T) {
 		t.Errorf("expected empty string, got %q", result)
 	}
 }
+
+func TestDecryptWithOldKeys(t *testing.T) {
+	oldKey := generateTestKey(t)
+	newKey := generateTestKey(t)
+
+	encrypted, _ := EncryptValue(oldKey, "rotated-secret")
+	if id, ok := ValueKeyID(encrypted); !ok || id != KeyID(oldKey) {
+		t.Fatalf("expected key ID %s in %q, got %q", KeyID(oldKey), encrypted, id)
+	}
+
+	decrypted, err := DecryptValue(newKey, encrypted, oldKey)
+	if err != nil || decrypted != "rotated-secret" {
+		t.Errorf("expected the old key to decrypt the value, got %q (%v)", decrypted, err)
+	}
+	if _, err := DecryptValue(newKey, encrypted); err == nil || !strings.Contains(err.Error(), KeyID(oldKey)) {
+		t.Errorf("expected an error naming the missing key, got %v", err)
+	}
+}
+
+func TestDecryptLegacyValueWithoutKeyID(t *testing.T) {
+	oldKey := generateTestKey(t)
+	newKey := generateTestKey(t)
+
+	encrypted, _ := EncryptValue(oldKey, "legacy-secret")
+	legacy := encPrefix + strings.TrimPrefix(encrypted, encPrefix+KeyID(oldKey)+":")
+	if id, ok := ValueKeyID(legacy); !ok || id != "" {
+		t.Fatalf("expected no key ID in %q, got %q", legacy, id)
+	}
+
+	decrypted, err := DecryptValue(newKey, legacy, oldKey)
+	if err != nil || decrypted != "legacy-secret" {
+		t.Errorf("expected every key to be tried, got %q (%v)", decrypted, err)
+	}
+}
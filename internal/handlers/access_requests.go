@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/discovery"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+const (
+	// defaultGrantDays is how long a group grant lasts when the admin does
+	// not choose an expiry.
+	defaultGrantDays = 7
+	// maxGrantDays caps group grants at a year; permanent membership
+	// belongs in the user's account.
+	maxGrantDays = 365
+	// maxPendingAccessRequests caps how many requests one user can have
+	// waiting at a time.
+	maxPendingAccessRequests = 10
+)
+
+// requestableApp is an app hidden from a user that members of Groups can
+// see. The URL is left out, as the user has no access to it yet.
+type requestableApp struct {
+	Name        string   `json:"name"`
+	Icon        string   `json:"icon"`
+	Description string   `json:"description"`
+	Groups      []string `json:"-"`
+}
+
+// requestableApps returns the configured and discovered apps user cannot see
+// but some group can, sorted by name. Admin-only apps (no groups) and hidden
+// discovered apps are never offered.
+func requestableApps(app *server.App, user *models.AuthenticatedUser) []requestableApp {
+	if user.IsAdmin {
+		return []requestableApp{}
+	}
+	visible := make(map[string]bool)
+	for _, cat := range visibleCategories(app, user) {
+		for _, a := range cat.Apps {
+			visible[a.URL] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	apps := []requestableApp{}
+	add := func(a requestableApp, url string) {
+		if visible[url] || seen[a.Name] || len(a.Groups) == 0 {
+			return
+		}
+		seen[a.Name] = true
+		apps = append(apps, a)
+	}
+
+	app.ConfigMu.RLock()
+	categories := app.Config.Categories
+	app.ConfigMu.RUnlock()
+	for _, cat := range categories {
+		for _, a := range cat.Apps {
+			add(requestableApp{Name: a.Name, Icon: a.Icon, Description: a.Description, Groups: auth.CatalogAppGroups(app, cat.Name, a)}, a.URL)
+		}
+	}
+
+	for _, d := range discovery.GetAllRawDiscoveredApps(app) {
+		if d.Override == nil || d.Override.Hidden {
+			continue
+		}
+		a := requestableApp{Name: d.Name, Icon: d.Icon, Description: d.Description, Groups: d.Override.Groups}
+		if d.Override.NameOverride != "" {
+			a.Name = d.Override.NameOverride
+		}
+		if d.Override.IconOverride != "" {
+			a.Icon = d.Override.IconOverride
+		}
+		if d.Override.DescriptionOverride != "" {
+			a.Description = d.Override.DescriptionOverride
+		}
+		url := d.URL
+		if d.Override.URLOverride != "" {
+			url = d.Override.URLOverride
+		}
+		add(a, url)
+	}
+
+	sort.Slice(apps, func(i, j int) bool { return strings.ToLower(apps[i].Name) < strings.ToLower(apps[j].Name) })
+	return apps
+}
+
+// UserAccessRequestsHandler lets the signed-in user ask for access to apps
+// they cannot see: GET /api/user/access-requests lists the apps they may
+// request, their requests and their temporary groups; POST files a request.
+func UserAccessRequestsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+		user := auth.UserFromContext(r.Context())
+		if user == nil {
+			respondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		enabled := app.SystemConfig.AccessRequestsEnabled
+		app.SysConfigMu.RUnlock()
+		if !enabled {
+			respondError(w, http.StatusNotFound, "Access requests are disabled")
+			return
+		}
+		if user.Source == "apikey" {
+			respondError(w, http.StatusForbidden, "Access cannot be requested with an API key")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			requests, err := database.ListUserAccessRequests(app, user.Username)
+			if err != nil {
+				log.Printf("Error listing access requests: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			grants, err := database.ListGroupGrants(app, user.Username)
+			if err != nil {
+				log.Printf("Error listing group grants: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"apps":     requestableApps(app, user),
+				"requests": requests,
+				"grants":   grants,
+			})
+		case http.MethodPost:
+			createAccessRequest(app, w, r, user)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func createAccessRequest(app *server.App, w http.ResponseWriter, r *http.Request, user *models.AuthenticatedUser) {
+	var req struct {
+		App    string `json:"app"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 500 {
+		respondError(w, http.StatusBadRequest, "Reason must be at most 500 characters")
+		return
+	}
+
+	var target *requestableApp
+	for _, a := range requestableApps(app, user) {
+		if a.Name == req.App {
+			target = &a
+			break
+		}
+	}
+	if target == nil {
+		respondError(w, http.StatusNotFound, "No such app to request access to")
+		return
+	}
+
+	pending, forApp, err := database.CountPendingAccessRequests(app, user.Username, target.Name)
+	if err != nil {
+		log.Printf("Error counting access requests: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if forApp {
+		respondError(w, http.StatusConflict, "You have already requested access to this app")
+		return
+	}
+	if pending >= maxPendingAccessRequests {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("You can have at most %d pending requests", maxPendingAccessRequests))
+		return
+	}
+
+	id, err := database.CreateAccessRequest(app, user.Username, target.Name, target.Groups, req.Reason)
+	if err != nil {
+		log.Printf("Error creating access request: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	audit.LogAudit(app, user.Username, "access_requested", fmt.Sprintf("Requested access to %s (request id=%d)", target.Name, id), auth.ClientIP(r))
+	respondJSON(w, http.StatusOK, map[string]interface{}{"id": id, "status": "pending"})
+}
+
+// AdminAccessRequestsHandler is the admin queue of access requests: GET
+// /api/admin/access-requests lists pending requests and active grants, POST
+// /api/admin/access-requests/{id}/approve grants a group for a number of
+// days and POST /api/admin/access-requests/{id}/deny rejects the request.
+func AdminAccessRequestsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/access-requests"), "/")
+		if rest == "" {
+			if r.Method != http.MethodGet {
+				respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			requests, err := database.ListPendingAccessRequests(app)
+			if err != nil {
+				log.Printf("Error listing access requests: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			grants, err := database.ListGroupGrants(app, "")
+			if err != nil {
+				log.Printf("Error listing group grants: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{"requests": requests, "grants": grants})
+			return
+		}
+
+		idStr, action, _ := strings.Cut(rest, "/")
+		id, err := strconv.Atoi(idStr)
+		if err != nil || (action != "approve" && action != "deny") {
+			respondError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		req, err := database.GetPendingAccessRequest(app, id)
+		if err == database.ErrAccessRequestNotFound {
+			respondError(w, http.StatusNotFound, "Request not found or already decided")
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading access request: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		if action == "deny" {
+			if err := database.DecideAccessRequest(app, id, "denied", adminName); err != nil {
+				respondAccessRequestDecisionError(w, err)
+				return
+			}
+			audit.LogAudit(app, adminName, "access_request_denied", fmt.Sprintf("Denied %s's request for %s (request id=%d)", req.Username, req.App, id), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "denied"})
+			return
+		}
+
+		var body struct {
+			Group string `json:"group"`
+			Days  int    `json:"days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		body.Group = strings.TrimSpace(body.Group)
+		if body.Group == "" && len(req.Groups) > 0 {
+			body.Group = req.Groups[0]
+		}
+		expiresAt, ok := validateGroupGrant(app, w, adminUser, body.Group, body.Days)
+		if !ok {
+			return
+		}
+
+		grantID, err := database.ApproveAccessRequest(app, id, adminName, req.Username, body.Group, expiresAt)
+		if err != nil {
+			respondAccessRequestDecisionError(w, err)
+			return
+		}
+		audit.LogAudit(app, adminName, "access_request_approved", fmt.Sprintf("Approved %s's request for %s (request id=%d): granted %s until %s", req.Username, req.App, id, body.Group, expiresAt.Format(time.RFC3339)), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]interface{}{"status": "approved", "grantId": grantID, "expiresAt": expiresAt})
+	}
+}
+
+func respondAccessRequestDecisionError(w http.ResponseWriter, err error) {
+	if err == database.ErrAccessRequestNotFound {
+		respondError(w, http.StatusConflict, "Request was already decided")
+		return
+	}
+	log.Printf("Error deciding access request: %v", err)
+	respondError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// AdminGroupGrantsHandler manages temporary group grants directly: GET
+// /api/admin/group-grants lists active grants, POST grants a group to a user
+// for a number of days and DELETE /api/admin/group-grants/{id} revokes one.
+func AdminGroupGrantsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/group-grants"), "/")
+		if idStr != "" {
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid grant ID")
+				return
+			}
+			if r.Method != http.MethodDelete {
+				respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			grant, err := database.RevokeGroupGrant(app, id)
+			if err == database.ErrGroupGrantNotFound {
+				respondError(w, http.StatusNotFound, "Grant not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error revoking group grant: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, adminName, "group_grant_revoked", fmt.Sprintf("Revoked temporary membership of %s for %s", grant.Group, grant.Username), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			grants, err := database.ListGroupGrants(app, "")
+			if err != nil {
+				log.Printf("Error listing group grants: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, grants)
+		case http.MethodPost:
+			var body struct {
+				Username string `json:"username"`
+				Group    string `json:"group"`
+				Days     int    `json:"days"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			body.Username = strings.TrimSpace(body.Username)
+			body.Group = strings.TrimSpace(body.Group)
+			if body.Username == "" {
+				respondError(w, http.StatusBadRequest, "Username is required")
+				return
+			}
+			expiresAt, ok := validateGroupGrant(app, w, adminUser, body.Group, body.Days)
+			if !ok {
+				return
+			}
+			id, err := database.GrantGroup(app, body.Username, body.Group, adminName, expiresAt)
+			if err != nil {
+				log.Printf("Error granting group: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, adminName, "group_granted", fmt.Sprintf("Granted %s to %s until %s", body.Group, body.Username, expiresAt.Format(time.RFC3339)), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]interface{}{"id": id, "expiresAt": expiresAt})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// validateGroupGrant checks the group and lifetime of a grant and returns
+// when it expires.
+func validateGroupGrant(app *server.App, w http.ResponseWriter, adminUser *models.AuthenticatedUser, group string, days int) (time.Time, bool) {
+	if group == "" {
+		respondError(w, http.StatusBadRequest, "Group is required")
+		return time.Time{}, false
+	}
+	if days == 0 {
+		days = defaultGrantDays
+	}
+	if days < 1 || days > maxGrantDays {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Expiry must be between 1 and %d days", maxGrantDays))
+		return time.Time{}, false
+	}
+	if !auth.CanGrantGroups(app, adminUser, []string{group}) {
+		respondError(w, http.StatusForbidden, "Only admins can grant admin or role groups")
+		return time.Time{}, false
+	}
+	return time.Now().Add(time.Duration(days) * 24 * time.Hour), true
+}
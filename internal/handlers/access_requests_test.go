@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// setupAccessRequestApp returns an app with access requests on and a
+// signed-in user "guest" without groups.
+func setupAccessRequestApp(t *testing.T) *server.App {
+	t.Helper()
+	app := setupForwardAuthApp(t)
+	app.SystemConfig.LocalAuthEnabled = true
+	app.SystemConfig.AccessRequestsEnabled = true
+	guestID := seedUser(t, app, "guest", "pass", "Guest", false)
+	seedSession(t, app, guestID, "guest-session")
+	return app
+}
+
+// sessionUser authenticates the holder of session the way middleware does.
+func sessionUser(t *testing.T, app *server.App, session string) *models.AuthenticatedUser {
+	t.Helper()
+	req := newGet("/")
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: session})
+	user := auth.GetAuthenticatedUser(app, req)
+	if user == nil {
+		t.Fatal("expected the session to authenticate")
+	}
+	return user
+}
+
+func canSeeApp(app *server.App, user *models.AuthenticatedUser, name string) bool {
+	for _, cat := range visibleCategories(app, user) {
+		for _, a := range cat.Apps {
+			if a.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAccessRequests_RequestApproveAndExpire(t *testing.T) {
+	app := setupAccessRequestApp(t)
+	guest := sessionUser(t, app, "guest-session")
+
+	w := httptest.NewRecorder()
+	UserAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/user/access-requests"), guest))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	apps := parseMap(w.Body.Bytes())["apps"].([]interface{})
+	if len(apps) != 2 {
+		t.Fatalf("expected Plex and Tools to be requestable, got %v", apps)
+	}
+
+	w = httptest.NewRecorder()
+	UserAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/access-requests", map[string]string{"app": "Plex", "reason": "movie night"}), guest))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 requesting Plex, got %d: %s", w.Code, w.Body.String())
+	}
+	id := int(parseMap(w.Body.Bytes())["id"].(float64))
+
+	w = httptest.NewRecorder()
+	UserAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/access-requests", map[string]string{"app": "Plex"}), guest))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a second request, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	UserAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/access-requests", map[string]string{"app": "Admin Panel"}), guest))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an admin-only app, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/access-requests/"+strconv.Itoa(id)+"/approve", map[string]interface{}{"days": 7}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 approving, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	AdminAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/access-requests/"+strconv.Itoa(id)+"/deny", nil), adminUser()))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected a decided request to be gone from the queue, got %d", w.Code)
+	}
+
+	guest = sessionUser(t, app, "guest-session")
+	if !canSeeApp(app, guest, "Plex") || canSeeApp(app, guest, "Tools") {
+		t.Errorf("expected the grant to show Plex only, groups=%v", guest.Groups)
+	}
+
+	app.DB.Exec("UPDATE group_grants SET expires_at = ?", time.Now().Add(-time.Minute))
+	auth.ExpireGroupGrants(app)
+	if guest = sessionUser(t, app, "guest-session"); canSeeApp(app, guest, "Plex") {
+		t.Error("expected Plex to disappear once the grant expired")
+	}
+
+	for _, action := range []string{"access_requested", "access_request_approved", "group_grant_expired"} {
+		var n int
+		app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = ?", action).Scan(&n)
+		if n != 1 {
+			t.Errorf("expected one %s audit entry, got %d", action, n)
+		}
+	}
+}
+
+func TestAccessRequests_FailedGrantLeavesRequestPending(t *testing.T) {
+	app := setupAccessRequestApp(t)
+	id, err := database.CreateAccessRequest(app, "guest", "Plex", []string{"media"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.DB.Exec("DROP TABLE group_grants")
+
+	w := httptest.NewRecorder()
+	AdminAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/access-requests/"+strconv.FormatInt(id, 10)+"/approve", map[string]interface{}{"days": 7}), adminUser()))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the grant fails, got %d", w.Code)
+	}
+	if _, err := database.GetPendingAccessRequest(app, int(id)); err != nil {
+		t.Errorf("expected the request to stay pending, got %v", err)
+	}
+}
+
+func TestAccessRequests_UserManagerCannotGrantAdminGroup(t *testing.T) {
+	app := setupAccessRequestApp(t)
+	manager := &models.AuthenticatedUser{Username: "manager", Groups: []string{"user_managers"}, Source: "local"}
+
+	w := httptest.NewRecorder()
+	AdminGroupGrantsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/group-grants", map[string]interface{}{"username": "guest", "group": "admins", "days": 1}), manager))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 granting an admin group, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	AdminGroupGrantsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/group-grants", map[string]interface{}{"username": "guest", "group": "media", "days": 400}), manager))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a grant over a year, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminGroupGrantsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/group-grants", map[string]interface{}{"username": "guest", "group": "media"}), manager))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 granting media, got %d: %s", w.Code, w.Body.String())
+	}
+	id := int(parseMap(w.Body.Bytes())["id"].(float64))
+
+	w = httptest.NewRecorder()
+	AdminGroupGrantsHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/group-grants/"+strconv.Itoa(id)), manager))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 revoking, got %d", w.Code)
+	}
+	if guest := sessionUser(t, app, "guest-session"); len(guest.Groups) != 0 {
+		t.Errorf("expected no groups after revoking, got %v", guest.Groups)
+	}
+}
+
+func TestAccessRequests_DisabledReturns404(t *testing.T) {
+	app := setupAccessRequestApp(t)
+	app.SystemConfig.AccessRequestsEnabled = false
+
+	w := httptest.NewRecorder()
+	UserAccessRequestsHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/user/access-requests"), sessionUser(t, app, "guest-session")))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+)
+
+func TestLogin_LocksAfterThreshold(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.LockoutThreshold = 3
+	app.SystemConfig.LockoutMinutes = 15
+	seedUser(t, app, "alice", "correct-horse", "Alice", false)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "alice", "password": "wrong"}))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+
+	// The correct password is refused while locked, regardless of case
+	w := httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "ALICE", "password": "correct-horse"}))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked, got %d", w.Code)
+	}
+
+	var action string
+	app.DB.QueryRow("SELECT action FROM audit_log WHERE action = 'account_locked'").Scan(&action)
+	if action != "account_locked" {
+		t.Error("expected account_locked audit entry")
+	}
+}
+
+func TestLogin_SuccessResetsFailures(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.LockoutThreshold = 2
+	app.SystemConfig.LockoutMinutes = 15
+	seedUser(t, app, "bob", "correct-horse", "Bob", false)
+
+	post := func(password string) int {
+		w := httptest.NewRecorder()
+		LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "bob", "password": password}))
+		return w.Code
+	}
+
+	post("wrong")
+	if code := post("correct-horse"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	post("wrong")
+	if code := post("correct-horse"); code != http.StatusOK {
+		t.Fatalf("expected failures to reset after a successful login, got %d", code)
+	}
+}
+
+func TestLocalUserHandler_Unlock(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.LockoutThreshold = 1
+	app.SystemConfig.LockoutMinutes = 15
+	userID := seedUser(t, app, "carol", "correct-horse", "Carol", false)
+
+	w := httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "carol", "password": "wrong"}))
+
+	// The admin user list reports the lock
+	w = httptest.NewRecorder()
+	LocalUsersHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/local-users"), adminUser()))
+	var users []models.LocalUser
+	json.Unmarshal(w.Body.Bytes(), &users)
+	if len(users) != 1 || users[0].LockedUntil == nil {
+		t.Fatalf("expected carol to be listed as locked, got %+v", users)
+	}
+
+	w = httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/local-users/"+strconv.Itoa(userID)+"/unlock", nil), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "carol", "password": "correct-horse"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected login after unlock, got %d", w.Code)
+	}
+}
+
+func TestPasswordPolicy_MinLengthAndBreached(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.PasswordMinLength = 12
+	app.SystemConfig.PasswordCheckBreached = true
+
+	// Plaintext and HIBP-style SHA-1 entries are both accepted
+	sum := sha1.Sum([]byte("hunter2hunter2"))
+	listPath := filepath.Join(t.TempDir(), "pwned.txt")
+	list := "my-leaked-passphrase\n" + strings.ToUpper(hex.EncodeToString(sum[:])) + ":42\r\n"
+	if err := os.WriteFile(listPath, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	app.SystemConfig.PasswordBreachedList = listPath
+
+	cases := map[string]string{
+		"short1":                "at least 12",
+		"password1234":          "breached",
+		"my-leaked-passphrase":  "breached",
+		"hunter2hunter2":        "breached",
+		"a-fine-long-password!": "",
+	}
+	for password, want := range cases {
+		err := auth.CheckPasswordPolicy(app, password)
+		if want == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", password, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", password, want, err)
+		}
+	}
+}
+
+func TestUserPasswordHandler_RejectsReuse(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.PasswordHistory = 2
+	seedUser(t, app, "dave", "first-password", "Dave", false)
+
+	change := func(current, next string) *httptest.ResponseRecorder {
+		req := newPost("/api/user/password", map[string]string{"currentPassword": current, "newPassword": next})
+		req = auth.WithUser(req, &models.AuthenticatedUser{Username: "dave", Source: "local"})
+		w := httptest.NewRecorder()
+		UserPasswordHandler(app).ServeHTTP(w, req)
+		return w
+	}
+
+	if w := change("first-password", "first-password"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected reuse of current password to be rejected, got %d", w.Code)
+	}
+	if w := change("first-password", "second-password"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := change("second-password", "first-password"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected reuse of previous password to be rejected, got %d", w.Code)
+	}
+}
+
+func TestLocalUsersHandler_CreateEnforcesPolicy(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.PasswordCheckBreached = true
+
+	req := auth.WithUser(newPost("/api/admin/local-users", map[string]interface{}{
+		"username": "erin",
+		"password": "password123",
+	}), adminUser())
+	w := httptest.NewRecorder()
+	LocalUsersHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected breached password to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// AuditLogHandler returns audit log entries as JSON, newest first. The
+// filters are user, action, ip, since and until; when more entries match
+// than limit, X-Next-Cursor holds the cursor parameter for the next page.
+func AuditLogHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid filter: "+err.Error())
+			return
+		}
+		limit := 100
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 1000 {
+				limit = n
+			}
+		}
+
+		entries, next, err := audit.Query(app, filter, limit)
+		if err != nil {
+			log.Printf("Error fetching audit logs: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to fetch audit logs")
+			return
+		}
+		if next > 0 {
+			w.Header().Set("X-Next-Cursor", strconv.Itoa(next))
+		}
+		respondJSON(w, http.StatusOK, entries)
+	}
+}
+
+// AuditLogExportHandler downloads every entry matching the same filters as
+// AuditLogHandler, oldest first, as CSV (format=csv) or JSON. Hashes are
+// included so the export can be checked against the chain. Entries are read
+// in pages, so the export does not hold the database while it is sent.
+func AuditLogExportHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid filter: "+err.Error())
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			respondError(w, http.StatusBadRequest, "Format must be csv or json")
+			return
+		}
+
+		filename := fmt.Sprintf("dashgate-audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		var count int
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"id", "timestamp", "username", "action", "detail", "ip", "prev_hash", "hash"})
+			err = audit.Each(app, filter, func(e audit.AuditEntry) error {
+				count++
+				return cw.Write([]string{strconv.Itoa(e.ID), e.Timestamp, e.Username, e.Action, e.Detail, e.IP, e.PrevHash, e.Hash})
+			})
+			cw.Flush()
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			w.Write([]byte("["))
+			err = audit.Each(app, filter, func(e audit.AuditEntry) error {
+				if count > 0 {
+					w.Write([]byte(","))
+				}
+				count++
+				return enc.Encode(e)
+			})
+			w.Write([]byte("]\n"))
+		}
+		// The status is already sent, so a failure can only be logged
+		if err != nil {
+			log.Printf("Error exporting audit log: %v", err)
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+		audit.LogAudit(app, adminName, "audit_log_exported", fmt.Sprintf("Exported %d audit log entries as %s", count, format), auth.ClientIP(r))
+	}
+}
+
+// AuditLogVerifyHandler checks the audit log's hash chain.
+func AuditLogVerifyHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		result, err := audit.Verify(app)
+		if err != nil {
+			log.Printf("Error verifying audit log: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to verify audit log")
+			return
+		}
+		if !result.Valid {
+			log.Printf("WARNING: audit log hash chain is broken at entry %d: %s", result.BrokenAt, result.Reason)
+		}
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// parseAuditFilter reads the user, action, ip, since, until and cursor
+// query parameters. Times are RFC 3339 or a date; a date in until includes
+// that whole day.
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Username: strings.TrimSpace(q.Get("user")),
+		Action:   strings.TrimSpace(q.Get("action")),
+		IP:       strings.TrimSpace(q.Get("ip")),
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			*p.dst = t
+		} else if d, err := time.Parse("2006-01-02", v); err == nil {
+			if p.name == "until" {
+				d = d.AddDate(0, 0, 1)
+			}
+			*p.dst = d
+		} else {
+			return filter, fmt.Errorf("invalid %s: use RFC 3339 or YYYY-MM-DD", p.name)
+		}
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+		filter.BeforeID = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+func seedAuditLog(app *server.App) {
+	audit.LogAudit(app, "alice", "login", "Signed in", "10.0.0.1")
+	audit.LogAudit(app, "bob", "login", "Signed in", "10.0.0.2")
+	audit.LogAudit(app, "alice", "app_created", "Created app Plex", "10.0.0.1")
+	audit.LogAudit(app, "alice", "login", "Signed in\nfrom a new device", "10.0.0.3")
+	audit.LogAudit(app, "carol", "user_deleted", "Deleted user dave", "10.0.0.1")
+}
+
+func getAuditLog(t *testing.T, app *server.App, query string) ([]audit.AuditEntry, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AuditLogHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log?"+query), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET ?%s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+	}
+	var entries []audit.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	return entries, w.Header().Get("X-Next-Cursor")
+}
+
+func TestAuditLog_FiltersAndCursor(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedAuditLog(app)
+
+	page, cursor := getAuditLog(t, app, "user=alice&limit=2")
+	if len(page) != 2 || page[0].Action != "login" || page[1].Action != "app_created" || cursor == "" {
+		t.Fatalf("expected alice's two newest entries and a cursor, got %+v (cursor %q)", page, cursor)
+	}
+	page, cursor = getAuditLog(t, app, "user=alice&limit=2&cursor="+cursor)
+	if len(page) != 1 || page[0].Detail != "Signed in" || cursor != "" {
+		t.Fatalf("expected alice's last entry and no cursor, got %+v (cursor %q)", page, cursor)
+	}
+
+	if entries, _ := getAuditLog(t, app, "action=login&ip=10.0.0.1"); len(entries) != 1 || entries[0].Username != "alice" {
+		t.Errorf("expected one login from 10.0.0.1, got %+v", entries)
+	}
+	if entries, _ := getAuditLog(t, app, "until=2000-01-01"); len(entries) != 0 {
+		t.Errorf("expected no entries before 2000, got %d", len(entries))
+	}
+	if entries, _ := getAuditLog(t, app, "since=2000-01-01T00:00:00Z"); len(entries) != 5 {
+		t.Errorf("expected every entry since 2000, got %d", len(entries))
+	}
+
+	w := httptest.NewRecorder()
+	AuditLogHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log?since=yesterday"), adminUser()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid time, got %d", w.Code)
+	}
+}
+
+func TestAuditLog_Export(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedAuditLog(app)
+
+	w := httptest.NewRecorder()
+	AuditLogExportHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log/export?format=csv&user=alice"), adminUser()))
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Fatalf("expected a CSV download, got %d %v", w.Code, w.Header())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 4 || records[0][7] != "hash" || records[3][4] != "Signed in\nfrom a new device" {
+		t.Fatalf("expected a header and alice's 3 entries oldest first, got %q (%v)", records, err)
+	}
+
+	w = httptest.NewRecorder()
+	AuditLogExportHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log/export"), adminUser()))
+	var entries []audit.AuditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 6 {
+		t.Fatalf("expected 6 entries including the CSV export, got %d (%v)", len(entries), err)
+	}
+	if entries[5].Action != "audit_log_exported" || entries[5].PrevHash != entries[4].Hash {
+		t.Errorf("expected the export to be audited and chained, got %+v", entries[5])
+	}
+
+	w = httptest.NewRecorder()
+	AuditLogExportHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log/export?format=xml"), adminUser()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+func TestAuditLog_EachReleasesConnection(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	for i := 0; i < 1200; i++ {
+		audit.LogAudit(app, "alice", "login", "Signed in", "10.0.0.1")
+	}
+
+	// The callback can use the database, as writing to a slow client would
+	// otherwise hold its only connection
+	seen, last := 0, 0
+	err := audit.Each(app, audit.Filter{Username: "alice"}, func(e audit.AuditEntry) error {
+		var n int
+		if err := app.DB.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&n); err != nil {
+			return err
+		}
+		if e.ID <= last {
+			t.Fatalf("expected entries oldest first, got %d after %d", e.ID, last)
+		}
+		seen, last = seen+1, e.ID
+		return nil
+	})
+	if err != nil || seen != 1200 {
+		t.Errorf("expected all 1200 entries, got %d (%v)", seen, err)
+	}
+}
+
+func verifyAuditLog(t *testing.T, app *server.App) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AuditLogVerifyHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/audit-log/verify"), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	return parseMap(w.Body.Bytes())
+}
+
+func TestAuditLog_VerifyDetectsTampering(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedAuditLog(app)
+
+	if result := verifyAuditLog(t, app); result["valid"] != true || result["entries"] != float64(5) || result["headHash"] == "" {
+		t.Fatalf("expected an intact chain of 5 entries, got %v", result)
+	}
+
+	app.DB.Exec("UPDATE audit_log SET detail = 'Deleted nobody' WHERE id = 5")
+	if result := verifyAuditLog(t, app); result["valid"] != false || result["brokenAt"] != float64(5) || !strings.Contains(result["reason"].(string), "modified") {
+		t.Errorf("expected the edited entry to be reported, got %v", result)
+	}
+	app.DB.Exec("UPDATE audit_log SET detail = 'Deleted user dave' WHERE id = 5")
+
+	app.DB.Exec("DELETE FROM audit_log WHERE id = 3")
+	if result := verifyAuditLog(t, app); result["valid"] != false || result["brokenAt"] != float64(4) || !strings.Contains(result["reason"].(string), "deleted") {
+		t.Errorf("expected the gap to be reported, got %v", result)
+	}
+}
+
+func TestAuditLog_RetentionKeepsChainValid(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedAuditLog(app)
+	// Ageing rows directly breaks their hashes, but they are pruned
+	app.DB.Exec("UPDATE audit_log SET timestamp = '2020-01-01T00:00:00Z' WHERE id <= 2")
+
+	n, err := audit.Prune(app, 30)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 entries to be pruned, got %d (%v)", n, err)
+	}
+	result := verifyAuditLog(t, app)
+	if result["valid"] != true || result["firstId"] != float64(3) || result["anchor"] == nil || result["entries"] != float64(4) {
+		t.Errorf("expected the remaining entries and the prune record to verify, got %v", result)
+	}
+	if entries, _ := getAuditLog(t, app, "action=audit_log_pruned"); len(entries) != 1 {
+		t.Errorf("expected the pruning to be audited, got %+v", entries)
+	}
+}
+
+func TestAuditLog_ChainsExistingEntriesOnce(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.DB.Exec("INSERT INTO audit_log (timestamp, username, action, detail, ip) VALUES ('2024-01-01T00:00:00Z', 'alice', 'login', 'Signed in', ''), ('2024-01-02T00:00:00Z', NULL, 'backup', NULL, '')")
+	if err := audit.InitAuditTable(app); err != nil {
+		t.Fatalf("InitAuditTable failed: %v", err)
+	}
+	audit.LogAudit(app, "bob", "login", "Signed in", "")
+	if result := verifyAuditLog(t, app); result["valid"] != true || result["entries"] != float64(3) {
+		t.Fatalf("expected existing entries to join the chain, got %v", result)
+	}
+
+	// Clearing a hash does not get the entry re-chained on the next start
+	app.DB.Exec("UPDATE audit_log SET detail = 'Signed out', hash = '' WHERE id = 1")
+	audit.InitAuditTable(app)
+	if result := verifyAuditLog(t, app); result["valid"] != false || result["brokenAt"] != float64(1) {
+		t.Errorf("expected the cleared entry to fail verification, got %v", result)
+	}
+}
+
+func TestAuditLog_KeyedChainSurvivesUpgradeAndRotation(t *testing.T) {
+	app := setupEncryptionApp(t)
+	// Entries chained with plain SHA-256 before the chain had a key
+	prev := ""
+	for i, detail := range []string{"Signed in", "Signed out"} {
+		timestamp := "2024-01-0" + strconv.Itoa(i+1) + "T00:00:00Z"
+		data, _ := json.Marshal([]string{prev, timestamp, "alice", "login", detail, ""})
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		app.DB.Exec("INSERT INTO audit_log (timestamp, username, action, detail, ip, prev_hash, hash) VALUES (?, 'alice', 'login', ?, '', ?, ?)",
+			timestamp, detail, prev, hash)
+		prev = hash
+	}
+	if err := audit.InitAuditTable(app); err != nil {
+		t.Fatalf("InitAuditTable failed: %v", err)
+	}
+	var stored string
+	app.DB.QueryRow("SELECT key_value FROM encryption_keys WHERE key_name = ?", audit.KeyDBKey).Scan(&stored)
+	if len(app.AuditKey) != 32 || !strings.HasPrefix(stored, "enc:") {
+		t.Fatalf("expected an audit key stored encrypted, got %q", stored)
+	}
+	audit.LogAudit(app, "bob", "login", "Signed in", "")
+	if result := verifyAuditLog(t, app); result["valid"] != true || result["entries"] != float64(3) {
+		t.Fatalf("expected the existing entries to be rehashed with the key, got %v", result)
+	}
+
+	// Rotating the encryption key re-encrypts the audit key with it
+	if _, err := database.RotateEncryptionKey(app); err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+	app.AuditKey = nil
+	audit.InitAuditTable(app)
+	if result := verifyAuditLog(t, app); result["valid"] != true {
+		t.Fatalf("expected the chain to verify after a rotation, got %v", result)
+	}
+
+	// Replacing the key does not re-chain the log with the new one
+	app.DB.Exec("DELETE FROM encryption_keys WHERE key_name = ?", audit.KeyDBKey)
+	audit.InitAuditTable(app)
+	if result := verifyAuditLog(t, app); result["valid"] != false || result["brokenAt"] != float64(1) {
+		t.Errorf("expected a replaced key to fail verification, got %v", result)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
+	"net/mail"
+	"net/url"
+	"strings"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/audit"
 	"dashgate/internal/database"
+	"dashgate/internal/mailer"
 	"dashgate/internal/server"
 )
 
@@ -31,11 +34,50 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 	response := map[string]interface{}{
 		// General settings
 		"sessionDays":    app.SystemConfig.SessionDays,
+		"maxSessions":    app.SystemConfig.MaxSessions,
 		"cookieSecure":   app.SystemConfig.CookieSecure,
+		"cookieDomain":   app.SystemConfig.CookieDomain,
 		"setupCompleted": app.SystemConfig.SetupCompleted,
 		"adminGroup":     app.SystemConfig.AdminGroup,
 		"trustedProxies": app.SystemConfig.TrustedProxies,
 
+		// Admin roles
+		"roleAppEditorGroups":        app.SystemConfig.RoleAppEditorGroups,
+		"roleDiscoveryManagerGroups": app.SystemConfig.RoleDiscoveryManagerGroups,
+		"roleUserManagerGroups":      app.SystemConfig.RoleUserManagerGroups,
+		"roleSystemAdminGroups":      app.SystemConfig.RoleSystemAdminGroups,
+		"roleAuditorGroups":          app.SystemConfig.RoleAuditorGroups,
+
+		// Audit log
+		"auditRetentionDays": app.SystemConfig.AuditRetentionDays,
+
+		// Password policy and lockout
+		"passwordMinLength":     app.SystemConfig.PasswordMinLength,
+		"passwordCheckBreached": app.SystemConfig.PasswordCheckBreached,
+		"passwordBreachedList":  app.SystemConfig.PasswordBreachedList,
+		"passwordHistory":       app.SystemConfig.PasswordHistory,
+		"lockoutThreshold":      app.SystemConfig.LockoutThreshold,
+		"lockoutMinutes":        app.SystemConfig.LockoutMinutes,
+
+		// Admission rules
+		"admissionEmailDomains":       app.SystemConfig.AdmissionEmailDomains,
+		"admissionRequiredGroups":     app.SystemConfig.AdmissionRequiredGroups,
+		"admissionAllowList":          app.SystemConfig.AdmissionAllowList,
+		"admissionDenyList":           app.SystemConfig.AdmissionDenyList,
+		"admissionPreprovisionedOnly": app.SystemConfig.AdmissionPreprovisionedOnly,
+		"accessRequestsEnabled":       app.SystemConfig.AccessRequestsEnabled,
+		"guestModeEnabled":            app.SystemConfig.GuestModeEnabled,
+		"guestCategories":             app.SystemConfig.GuestCategories,
+
+		// Email (excluding SMTP password)
+		"publicUrl":            app.SystemConfig.PublicURL,
+		"smtpHost":             app.SystemConfig.SMTPHost,
+		"smtpPort":             app.SystemConfig.SMTPPort,
+		"smtpUsername":         app.SystemConfig.SMTPUsername,
+		"smtpFrom":             app.SystemConfig.SMTPFrom,
+		"smtpSecurity":         app.SystemConfig.SMTPSecurity,
+		"passwordResetEnabled": app.SystemConfig.PasswordResetEnabled,
+
 		// Auth providers enabled
 		"proxyAuthEnabled": app.SystemConfig.ProxyAuthEnabled,
 		"localAuthEnabled": app.SystemConfig.LocalAuthEnabled,
@@ -43,6 +85,17 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 		"oidcAuthEnabled":  app.SystemConfig.OIDCAuthEnabled,
 		"apiKeyEnabled":    app.SystemConfig.APIKeyEnabled,
 
+		// Proxy auth profile
+		"proxyAuthProfile":     app.SystemConfig.ProxyAuthProfile,
+		"proxyUserHeader":      app.SystemConfig.ProxyUserHeader,
+		"proxyGroupsHeader":    app.SystemConfig.ProxyGroupsHeader,
+		"proxyNameHeader":      app.SystemConfig.ProxyNameHeader,
+		"proxyEmailHeader":     app.SystemConfig.ProxyEmailHeader,
+		"proxyGroupsSeparator": app.SystemConfig.ProxyGroupsSeparator,
+		"proxyJwks":            app.SystemConfig.ProxyJWKS,
+		"proxyJwtIssuer":       app.SystemConfig.ProxyJWTIssuer,
+		"proxyJwtAudience":     app.SystemConfig.ProxyJWTAudience,
+
 		// LDAP settings (excluding password)
 		"ldapServer":      app.SystemConfig.LDAPServer,
 		"ldapBindDN":      app.SystemConfig.LDAPBindDN,
@@ -57,12 +110,17 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 		"ldapSkipVerify":  app.SystemConfig.LDAPSkipVerify,
 
 		// OIDC settings (excluding secret)
-		"oidcDisplayName": app.SystemConfig.OIDCDisplayName,
-		"oidcIssuer":      app.SystemConfig.OIDCIssuer,
-		"oidcClientID":    app.SystemConfig.OIDCClientID,
-		"oidcRedirectURL": app.SystemConfig.OIDCRedirectURL,
-		"oidcScopes":      app.SystemConfig.OIDCScopes,
-		"oidcGroupsClaim": app.SystemConfig.OIDCGroupsClaim,
+		"oidcDisplayName":   app.SystemConfig.OIDCDisplayName,
+		"oidcIssuer":        app.SystemConfig.OIDCIssuer,
+		"oidcClientID":      app.SystemConfig.OIDCClientID,
+		"oidcRedirectURL":   app.SystemConfig.OIDCRedirectURL,
+		"oidcScopes":        app.SystemConfig.OIDCScopes,
+		"oidcGroupsClaim":   app.SystemConfig.OIDCGroupsClaim,
+		"oidcLogoutEnabled": app.SystemConfig.OIDCLogoutEnabled,
+		"oidcGroupMapping":  app.SystemConfig.OIDCGroupMapping,
+
+		// Settings set from the environment, keyed by system_config key
+		"envLocked": database.ConfigEnvLocks(app),
 	}
 
 	// Set defaults
@@ -78,10 +136,52 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	var req struct {
 		// General settings
 		SessionDays    int    `json:"sessionDays"`
+		MaxSessions    int    `json:"maxSessions"`
 		CookieSecure   bool   `json:"cookieSecure"`
+		CookieDomain   string `json:"cookieDomain"`
 		AdminGroup     string `json:"adminGroup"`
 		TrustedProxies string `json:"trustedProxies"`
 
+		// Admin roles
+		RoleAppEditorGroups        string `json:"roleAppEditorGroups"`
+		RoleDiscoveryManagerGroups string `json:"roleDiscoveryManagerGroups"`
+		RoleUserManagerGroups      string `json:"roleUserManagerGroups"`
+		RoleSystemAdminGroups      string `json:"roleSystemAdminGroups"`
+		RoleAuditorGroups          string `json:"roleAuditorGroups"`
+
+		// Audit log
+		AuditRetentionDays int `json:"auditRetentionDays"`
+
+		// Password policy and lockout
+		PasswordMinLength     int    `json:"passwordMinLength"`
+		PasswordCheckBreached bool   `json:"passwordCheckBreached"`
+		PasswordBreachedList  string `json:"passwordBreachedList"`
+		PasswordHistory       int    `json:"passwordHistory"`
+		LockoutThreshold      int    `json:"lockoutThreshold"`
+		LockoutMinutes        int    `json:"lockoutMinutes"`
+
+		// Admission rules
+		AdmissionEmailDomains       string `json:"admissionEmailDomains"`
+		AdmissionRequiredGroups     string `json:"admissionRequiredGroups"`
+		AdmissionAllowList          string `json:"admissionAllowList"`
+		AdmissionDenyList           string `json:"admissionDenyList"`
+		AdmissionPreprovisionedOnly bool   `json:"admissionPreprovisionedOnly"`
+		AccessRequestsEnabled       bool   `json:"accessRequestsEnabled"`
+
+		// Guest mode
+		GuestModeEnabled bool   `json:"guestModeEnabled"`
+		GuestCategories  string `json:"guestCategories"`
+
+		// Email
+		PublicURL            string `json:"publicUrl"`
+		SMTPHost             string `json:"smtpHost"`
+		SMTPPort             int    `json:"smtpPort"`
+		SMTPUsername         string `json:"smtpUsername"`
+		SMTPPassword         string `json:"smtpPassword"`
+		SMTPFrom             string `json:"smtpFrom"`
+		SMTPSecurity         string `json:"smtpSecurity"`
+		PasswordResetEnabled bool   `json:"passwordResetEnabled"`
+
 		// Auth providers
 		ProxyAuthEnabled bool `json:"proxyAuthEnabled"`
 		LocalAuthEnabled bool `json:"localAuthEnabled"`
@@ -89,6 +189,17 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		OIDCAuthEnabled  bool `json:"oidcAuthEnabled"`
 		APIKeyEnabled    bool `json:"apiKeyEnabled"`
 
+		// Proxy auth profile
+		ProxyAuthProfile     string `json:"proxyAuthProfile"`
+		ProxyUserHeader      string `json:"proxyUserHeader"`
+		ProxyGroupsHeader    string `json:"proxyGroupsHeader"`
+		ProxyNameHeader      string `json:"proxyNameHeader"`
+		ProxyEmailHeader     string `json:"proxyEmailHeader"`
+		ProxyGroupsSeparator string `json:"proxyGroupsSeparator"`
+		ProxyJWKS            string `json:"proxyJwks"`
+		ProxyJWTIssuer       string `json:"proxyJwtIssuer"`
+		ProxyJWTAudience     string `json:"proxyJwtAudience"`
+
 		// LDAP settings
 		LDAPServer       string `json:"ldapServer"`
 		LDAPBindDN       string `json:"ldapBindDN"`
@@ -104,13 +215,15 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		LDAPSkipVerify   bool   `json:"ldapSkipVerify"`
 
 		// OIDC settings
-		OIDCDisplayName  string `json:"oidcDisplayName"`
-		OIDCIssuer       string `json:"oidcIssuer"`
-		OIDCClientID     string `json:"oidcClientID"`
-		OIDCClientSecret string `json:"oidcClientSecret"`
-		OIDCRedirectURL  string `json:"oidcRedirectURL"`
-		OIDCScopes       string `json:"oidcScopes"`
-		OIDCGroupsClaim  string `json:"oidcGroupsClaim"`
+		OIDCDisplayName   string `json:"oidcDisplayName"`
+		OIDCIssuer        string `json:"oidcIssuer"`
+		OIDCClientID      string `json:"oidcClientID"`
+		OIDCClientSecret  string `json:"oidcClientSecret"`
+		OIDCRedirectURL   string `json:"oidcRedirectURL"`
+		OIDCScopes        string `json:"oidcScopes"`
+		OIDCGroupsClaim   string `json:"oidcGroupsClaim"`
+		OIDCLogoutEnabled bool   `json:"oidcLogoutEnabled"`
+		OIDCGroupMapping  string `json:"oidcGroupMapping"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -118,6 +231,60 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if req.MaxSessions < 0 {
+		respondError(w, http.StatusBadRequest, "Maximum sessions cannot be negative")
+		return
+	}
+	if req.AuditRetentionDays < 0 {
+		respondError(w, http.StatusBadRequest, "Audit log retention cannot be negative")
+		return
+	}
+	if req.PasswordMinLength < 0 || req.PasswordHistory < 0 || req.LockoutThreshold < 0 || req.LockoutMinutes < 0 {
+		respondError(w, http.StatusBadRequest, "Password history and lockout settings cannot be negative")
+		return
+	}
+	req.PublicURL = strings.TrimRight(strings.TrimSpace(req.PublicURL), "/")
+	if req.PublicURL != "" {
+		if u, err := url.Parse(req.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			respondError(w, http.StatusBadRequest, "Public URL must be an http:// or https:// URL")
+			return
+		}
+	}
+	if req.SMTPPort < 0 || req.SMTPPort > 65535 {
+		respondError(w, http.StatusBadRequest, "Invalid SMTP port")
+		return
+	}
+	if !mailer.IsValidSecurity(req.SMTPSecurity) {
+		respondError(w, http.StatusBadRequest, "SMTP security must be starttls, tls or none")
+		return
+	}
+	if req.SMTPFrom != "" {
+		if _, err := mail.ParseAddress(req.SMTPFrom); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid SMTP from address")
+			return
+		}
+	}
+	if req.PasswordResetEnabled && (req.PublicURL == "" || req.SMTPHost == "" || req.SMTPFrom == "") {
+		respondError(w, http.StatusBadRequest, "Password reset requires a public URL, SMTP host and from address")
+		return
+	}
+	if !auth.IsValidProxyProfile(req.ProxyAuthProfile) {
+		respondError(w, http.StatusBadRequest, "Unknown proxy auth profile")
+		return
+	}
+	if req.ProxyAuthEnabled && auth.ProxyProfileUsesJWT(req.ProxyAuthProfile) && req.ProxyJWKS == "" {
+		respondError(w, http.StatusBadRequest, "This proxy auth profile requires a JWKS URL or file path")
+		return
+	}
+	if req.ProxyAuthEnabled && auth.ProxyProfileUsesJWT(req.ProxyAuthProfile) && strings.TrimSpace(req.ProxyJWTAudience) == "" {
+		respondError(w, http.StatusBadRequest, "This proxy auth profile requires an audience (the application's AUD tag)")
+		return
+	}
+	if _, err := auth.ParseGroupMapping(req.OIDCGroupMapping); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid OIDC group mapping: "+err.Error())
+		return
+	}
+
 	// Check if enabling local auth without users
 	app.SysConfigMu.RLock()
 	currentlyDisabled := !app.SystemConfig.LocalAuthEnabled
@@ -135,11 +302,49 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	if req.SessionDays > 0 {
 		app.SystemConfig.SessionDays = req.SessionDays
 	}
+	app.SystemConfig.MaxSessions = req.MaxSessions
 	app.SystemConfig.CookieSecure = req.CookieSecure
+	app.SystemConfig.CookieDomain = strings.TrimSpace(req.CookieDomain)
 	if req.AdminGroup != "" {
 		app.SystemConfig.AdminGroup = req.AdminGroup
 	}
 	app.SystemConfig.TrustedProxies = req.TrustedProxies
+	app.SystemConfig.RoleAppEditorGroups = strings.TrimSpace(req.RoleAppEditorGroups)
+	app.SystemConfig.RoleDiscoveryManagerGroups = strings.TrimSpace(req.RoleDiscoveryManagerGroups)
+	app.SystemConfig.RoleUserManagerGroups = strings.TrimSpace(req.RoleUserManagerGroups)
+	app.SystemConfig.RoleSystemAdminGroups = strings.TrimSpace(req.RoleSystemAdminGroups)
+	app.SystemConfig.RoleAuditorGroups = strings.TrimSpace(req.RoleAuditorGroups)
+	app.SystemConfig.AuditRetentionDays = req.AuditRetentionDays
+	if req.PasswordMinLength > 0 {
+		app.SystemConfig.PasswordMinLength = req.PasswordMinLength
+	}
+	app.SystemConfig.PasswordCheckBreached = req.PasswordCheckBreached
+	app.SystemConfig.PasswordBreachedList = strings.TrimSpace(req.PasswordBreachedList)
+	app.SystemConfig.PasswordHistory = req.PasswordHistory
+	app.SystemConfig.LockoutThreshold = req.LockoutThreshold
+	if req.LockoutMinutes > 0 {
+		app.SystemConfig.LockoutMinutes = req.LockoutMinutes
+	}
+	app.SystemConfig.AdmissionEmailDomains = strings.TrimSpace(req.AdmissionEmailDomains)
+	app.SystemConfig.AdmissionRequiredGroups = strings.TrimSpace(req.AdmissionRequiredGroups)
+	app.SystemConfig.AdmissionAllowList = strings.TrimSpace(req.AdmissionAllowList)
+	app.SystemConfig.AdmissionDenyList = strings.TrimSpace(req.AdmissionDenyList)
+	app.SystemConfig.AdmissionPreprovisionedOnly = req.AdmissionPreprovisionedOnly
+	app.SystemConfig.AccessRequestsEnabled = req.AccessRequestsEnabled
+	app.SystemConfig.GuestModeEnabled = req.GuestModeEnabled
+	app.SystemConfig.GuestCategories = strings.TrimSpace(req.GuestCategories)
+
+	// Update email settings
+	app.SystemConfig.PublicURL = req.PublicURL
+	app.SystemConfig.SMTPHost = strings.TrimSpace(req.SMTPHost)
+	app.SystemConfig.SMTPPort = req.SMTPPort
+	app.SystemConfig.SMTPUsername = req.SMTPUsername
+	if req.SMTPPassword != "" {
+		app.SystemConfig.SMTPPassword = req.SMTPPassword
+	}
+	app.SystemConfig.SMTPFrom = req.SMTPFrom
+	app.SystemConfig.SMTPSecurity = req.SMTPSecurity
+	app.SystemConfig.PasswordResetEnabled = req.PasswordResetEnabled
 
 	// Update provider flags
 	app.SystemConfig.ProxyAuthEnabled = req.ProxyAuthEnabled
@@ -148,6 +353,17 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	app.SystemConfig.OIDCAuthEnabled = req.OIDCAuthEnabled
 	app.SystemConfig.APIKeyEnabled = req.APIKeyEnabled
 
+	// Update proxy auth profile
+	app.SystemConfig.ProxyAuthProfile = req.ProxyAuthProfile
+	app.SystemConfig.ProxyUserHeader = req.ProxyUserHeader
+	app.SystemConfig.ProxyGroupsHeader = req.ProxyGroupsHeader
+	app.SystemConfig.ProxyNameHeader = req.ProxyNameHeader
+	app.SystemConfig.ProxyEmailHeader = req.ProxyEmailHeader
+	app.SystemConfig.ProxyGroupsSeparator = req.ProxyGroupsSeparator
+	app.SystemConfig.ProxyJWKS = req.ProxyJWKS
+	app.SystemConfig.ProxyJWTIssuer = req.ProxyJWTIssuer
+	app.SystemConfig.ProxyJWTAudience = req.ProxyJWTAudience
+
 	// Update LDAP settings
 	app.SystemConfig.LDAPServer = req.LDAPServer
 	app.SystemConfig.LDAPBindDN = req.LDAPBindDN
@@ -174,6 +390,8 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	app.SystemConfig.OIDCRedirectURL = req.OIDCRedirectURL
 	app.SystemConfig.OIDCScopes = req.OIDCScopes
 	app.SystemConfig.OIDCGroupsClaim = req.OIDCGroupsClaim
+	app.SystemConfig.OIDCLogoutEnabled = req.OIDCLogoutEnabled
+	app.SystemConfig.OIDCGroupMapping = strings.TrimSpace(req.OIDCGroupMapping)
 
 	app.SystemConfig.SetupCompleted = true
 	app.SysConfigMu.Unlock()
@@ -189,33 +407,7 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	audit.LogAudit(app, adminName, "system_config_updated", "System configuration updated", r.RemoteAddr)
+	audit.LogAudit(app, adminName, "system_config_updated", "System configuration updated", auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
-
-// AuditLogHandler returns the recent audit log entries as JSON.
-func AuditLogHandler(app *server.App) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
-			return
-		}
-
-		limit := 100
-		if l := r.URL.Query().Get("limit"); l != "" {
-			if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 1000 {
-				limit = n
-			}
-		}
-
-		entries, err := audit.GetAuditLogs(app, limit)
-		if err != nil {
-			log.Printf("Error fetching audit logs: %v", err)
-			respondError(w, http.StatusInternalServerError, "Failed to fetch audit logs")
-			return
-		}
-
-		respondJSON(w, http.StatusOK, entries)
-	}
-}
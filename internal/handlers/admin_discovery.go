@@ -32,7 +32,8 @@ func DockerDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"enabled":     enabled,
 				"socketPath":  socketPath,
 				"appCount":    len(app.DockerDiscovery.GetApps()),
-				"envOverride": app.DockerDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("docker_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("docker_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -43,7 +44,7 @@ func DockerDiscoveryHandler(app *server.App) http.HandlerFunc {
 
 		case http.MethodPut:
 			// Update settings (only works if not controlled by env var)
-			if app.DockerDiscoveryEnvOverride {
+			if app.ConfigEnvVar("docker_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "Docker discovery is controlled by environment variables")
 				return
 			}
@@ -115,7 +116,8 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"username":    traefikUsername,
 				"hasPassword": hasPassword,
 				"appCount":    len(app.TraefikDiscovery.GetApps()),
-				"envOverride": app.TraefikDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("traefik_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("traefik_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -125,7 +127,7 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 			respondJSON(w, http.StatusOK, map[string]string{"status": "refresh triggered"})
 
 		case http.MethodPut:
-			if app.TraefikDiscoveryEnvOverride {
+			if app.ConfigEnvVar("traefik_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "Traefik discovery is controlled by environment variables")
 				return
 			}
@@ -204,7 +206,8 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"enabled":     enabled,
 				"configPath":  configPath,
 				"appCount":    len(app.NginxDiscovery.GetApps()),
-				"envOverride": app.NginxDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("nginx_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("nginx_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -213,7 +216,7 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 			respondJSON(w, http.StatusOK, map[string]string{"status": "refresh triggered"})
 
 		case http.MethodPut:
-			if app.NginxDiscoveryEnvOverride {
+			if app.ConfigEnvVar("nginx_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "Nginx discovery is controlled by environment variables")
 				return
 			}
@@ -287,7 +290,8 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"url":         npmURL,
 				"email":       npmEmail,
 				"appCount":    len(app.NPMDiscovery.GetApps()),
-				"envOverride": app.NPMDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("npm_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("npm_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -296,7 +300,7 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 			respondJSON(w, http.StatusOK, map[string]string{"status": "refresh triggered"})
 
 		case http.MethodPut:
-			if app.NPMDiscoveryEnvOverride {
+			if app.ConfigEnvVar("npm_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "NPM discovery is controlled by environment variables")
 				return
 			}
@@ -377,7 +381,8 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"username":    caddyUsername,
 				"hasPassword": hasPassword,
 				"appCount":    len(app.CaddyDiscovery.GetApps()),
-				"envOverride": app.CaddyDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("caddy_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("caddy_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -386,7 +391,7 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 			respondJSON(w, http.StatusOK, map[string]string{"status": "refresh triggered"})
 
 		case http.MethodPut:
-			if app.CaddyDiscoveryEnvOverride {
+			if app.ConfigEnvVar("caddy_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "Caddy discovery is controlled by environment variables")
 				return
 			}
@@ -713,7 +718,8 @@ func UnraidDiscoveryHandler(app *server.App) http.HandlerFunc {
 				"url":         unraidURL,
 				"hasApiKey":   hasAPIKey,
 				"appCount":    len(app.UnraidDiscovery.GetApps()),
-				"envOverride": app.UnraidDiscoveryEnvOverride,
+				"envOverride": app.ConfigEnvVar("unraid_discovery_enabled") != "",
+				"envVar":      app.ConfigEnvVar("unraid_discovery_enabled"),
 			}
 			respondJSON(w, http.StatusOK, status)
 
@@ -722,7 +728,7 @@ func UnraidDiscoveryHandler(app *server.App) http.HandlerFunc {
 			respondJSON(w, http.StatusOK, map[string]string{"status": "refresh triggered"})
 
 		case http.MethodPut:
-			if app.UnraidDiscoveryEnvOverride {
+			if app.ConfigEnvVar("unraid_discovery_enabled") != "" {
 				respondError(w, http.StatusConflict, "Unraid discovery is controlled by environment variables")
 				return
 			}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// AdminEncryptionHandler reports the encryption key and how many stored
+// secrets still use an older one.
+func AdminEncryptionHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		status, err := database.GetEncryptionStatus(app)
+		if err != nil {
+			log.Printf("Error reading encryption status: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		respondJSON(w, http.StatusOK, status)
+	}
+}
+
+// AdminEncryptionRotateHandler re-encrypts every stored secret with a new
+// key (POST).
+func AdminEncryptionRotateHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		before, err := database.GetEncryptionStatus(app)
+		if err != nil {
+			log.Printf("Error reading encryption status: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		status, err := database.RotateEncryptionKey(app)
+		if errors.Is(err, database.ErrEncryptionDisabled) {
+			respondError(w, http.StatusConflict, "Encryption is not configured")
+			return
+		}
+		if err != nil {
+			log.Printf("Error rotating encryption key: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+		detail := fmt.Sprintf("Rotated encryption key %s to %s (%d values)", before.KeyID, status.KeyID, status.Values)
+		if status.Failed > 0 {
+			detail += fmt.Sprintf(", %d could not be decrypted", status.Failed)
+		}
+		audit.LogAudit(app, adminName, "encryption_key_rotated", detail, auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, status)
+	}
+}
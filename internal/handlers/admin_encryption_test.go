@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/encryption"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func setupEncryptionApp(t *testing.T) *server.App {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	app.EncryptionKeySource = "database"
+	app.DB.Exec("INSERT INTO encryption_keys (key_name, key_value) VALUES ('system_encryption_key', ?)", hex.EncodeToString(app.EncryptionKey))
+	return app
+}
+
+func TestAdminEncryption_RotateReencryptsEverything(t *testing.T) {
+	app := setupEncryptionApp(t)
+	oldID := encryption.KeyID(app.EncryptionKey)
+
+	// A value written before key IDs existed
+	encrypted, _ := encryption.EncryptValue(app.EncryptionKey, "smtp-secret")
+	legacy := "enc:" + strings.TrimPrefix(encrypted, "enc:"+oldID+":")
+	app.DB.Exec("INSERT INTO system_config (key, value) VALUES ('smtp_password', ?), ('smtp_host', 'mail.local')", legacy)
+	if err := database.CreateOIDCProvider(app, models.OIDCProviderConfig{ID: "corp", DisplayName: "Corp", Issuer: "https://sso.corp", ClientID: "dashgate", ClientSecret: "provider-secret"}); err != nil {
+		t.Fatalf("CreateOIDCProvider failed: %v", err)
+	}
+	if err := database.SaveIDPSigningKey(app, "kid1", "signing-key-pem"); err != nil {
+		t.Fatalf("SaveIDPSigningKey failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	AdminEncryptionHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/encryption"), adminUser()))
+	status := parseMap(w.Body.Bytes())
+	if status["keyId"] != oldID || status["values"] != float64(3) || status["pending"] != float64(1) {
+		t.Fatalf("expected 3 values with the legacy one pending, got %v", status)
+	}
+
+	w = httptest.NewRecorder()
+	AdminEncryptionRotateHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/encryption/rotate", nil), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	status = parseMap(w.Body.Bytes())
+	newID := encryption.KeyID(app.EncryptionKey)
+	if newID == oldID || status["keyId"] != newID || status["pending"] != float64(0) || len(app.OldEncryptionKeys) != 0 {
+		t.Fatalf("expected a new key with nothing pending and no old keys, got %v", status)
+	}
+
+	var storedKey string
+	var retired int
+	app.DB.QueryRow("SELECT key_value FROM encryption_keys WHERE key_name = 'system_encryption_key'").Scan(&storedKey)
+	app.DB.QueryRow("SELECT COUNT(*) FROM encryption_keys WHERE key_name != 'system_encryption_key'").Scan(&retired)
+	if storedKey != hex.EncodeToString(app.EncryptionKey) || retired != 0 {
+		t.Errorf("expected only the new key to be stored, found %d retired keys", retired)
+	}
+
+	var smtp string
+	app.DB.QueryRow("SELECT value FROM system_config WHERE key = 'smtp_password'").Scan(&smtp)
+	if !strings.HasPrefix(smtp, "enc:"+newID+":") {
+		t.Errorf("expected smtp_password to use the new key, got %q", smtp)
+	}
+	if p, err := database.GetOIDCProvider(app, "corp"); err != nil || p.ClientSecret != "provider-secret" {
+		t.Errorf("expected the provider secret to survive rotation, got %+v (%v)", p, err)
+	}
+	if _, pem, err := database.GetIDPSigningKey(app); err != nil || pem != "signing-key-pem" {
+		t.Errorf("expected the signing key to survive rotation, got %q (%v)", pem, err)
+	}
+	if err := database.LoadSystemConfig(app); err != nil || app.SystemConfig.SMTPPassword != "smtp-secret" {
+		t.Errorf("expected smtp_password to decrypt after rotation, got %q (%v)", app.SystemConfig.SMTPPassword, err)
+	}
+}
+
+func TestAdminEncryption_KeepsOldKeyWhenValuesFail(t *testing.T) {
+	app := setupEncryptionApp(t)
+	oldID := encryption.KeyID(app.EncryptionKey)
+	unknown, _ := encryption.EncryptValue([]byte("fedcba9876543210fedcba9876543210"), "lost")
+	app.DB.Exec("INSERT INTO system_config (key, value) VALUES ('npm_password', ?)", unknown)
+
+	w := httptest.NewRecorder()
+	AdminEncryptionRotateHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/encryption/rotate", nil), adminUser()))
+	status := parseMap(w.Body.Bytes())
+	if w.Code != http.StatusOK || status["failed"] != float64(1) {
+		t.Fatalf("expected the undecryptable value to be reported, got %d: %v", w.Code, status)
+	}
+	if len(app.OldEncryptionKeys) != 1 || encryption.KeyID(app.OldEncryptionKeys[0]) != oldID {
+		t.Error("expected the old key to be kept for decryption")
+	}
+	var retired int
+	app.DB.QueryRow("SELECT COUNT(*) FROM encryption_keys WHERE key_name = ?", "retired_encryption_key:"+oldID).Scan(&retired)
+	if retired != 1 {
+		t.Error("expected the old key to stay stored until rotation completes")
+	}
+}
+
+func TestInitEncryptionKey_FromFileKeepsOldKeys(t *testing.T) {
+	app := setupEncryptionApp(t)
+	stored := app.EncryptionKey
+	fileKey := strings.Repeat("ab", 32)
+	oldKey := strings.Repeat("cd", 32)
+	path := filepath.Join(t.TempDir(), "encryption_key")
+	os.WriteFile(path, []byte(fileKey+"\n"), 0600)
+	t.Setenv("ENCRYPTION_KEY_FILE", path)
+	t.Setenv("ENCRYPTION_OLD_KEYS", oldKey)
+
+	database.InitEncryptionKey(app)
+	if hex.EncodeToString(app.EncryptionKey) != fileKey || app.EncryptionKeySource != "file" {
+		t.Fatalf("expected the key from ENCRYPTION_KEY_FILE, got source %q", app.EncryptionKeySource)
+	}
+	ids := map[string]bool{}
+	for _, k := range app.OldEncryptionKeys {
+		ids[encryption.KeyID(k)] = true
+	}
+	decoded, _ := hex.DecodeString(oldKey)
+	if len(ids) != 2 || !ids[encryption.KeyID(stored)] || !ids[encryption.KeyID(decoded)] {
+		t.Errorf("expected the stored key and ENCRYPTION_OLD_KEYS to be kept for decryption, got %v", ids)
+	}
+
+	// Rotating re-encrypts with the configured key rather than replacing it
+	encrypted, _ := encryption.EncryptValue(stored, "caddy-secret")
+	app.DB.Exec("INSERT INTO system_config (key, value) VALUES ('caddy_password', ?)", encrypted)
+	status, err := database.RotateEncryptionKey(app)
+	if err != nil || status.KeyID != encryption.KeyID(app.EncryptionKey) || status.Pending != 0 || hex.EncodeToString(app.EncryptionKey) != fileKey {
+		t.Errorf("expected values to move to the file key, got %+v (%v)", status, err)
+	}
+
+	// The replaced stored key is dropped with the rotation and not loaded again
+	var stale int
+	app.DB.QueryRow("SELECT COUNT(*) FROM encryption_keys WHERE key_name = 'system_encryption_key'").Scan(&stale)
+	database.InitEncryptionKey(app)
+	if stale != 0 || len(app.OldEncryptionKeys) != 1 || encryption.KeyID(app.OldEncryptionKeys[0]) != encryption.KeyID(decoded) {
+		t.Errorf("expected only ENCRYPTION_OLD_KEYS to remain after the rotation, got %d stored and %d old keys", stale, len(app.OldEncryptionKeys))
+	}
+}
+
+func TestAdminEncryption_RequiresPost(t *testing.T) {
+	app := setupEncryptionApp(t)
+	w := httptest.NewRecorder()
+	AdminEncryptionRotateHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/encryption/rotate"), adminUser()))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
@@ -1,13 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"dashgate/internal/audit"
 	"dashgate/internal/auth"
 	"dashgate/internal/database"
 	"dashgate/internal/lldap"
+	"dashgate/internal/models"
 	"dashgate/internal/server"
+	"dashgate/internal/urlvalidation"
 )
 
 // AdminCheckHandler returns the admin status of the authenticated user
@@ -21,7 +30,8 @@ func AdminCheckHandler(app *server.App) http.HandlerFunc {
 		app.SysConfigMu.RLock()
 		response := map[string]interface{}{
 			"isAdmin":          user.IsAdmin,
-			"lldapEnabled":     app.LLDAPConfig != nil,
+			"roles":            auth.UserRoles(app, user),
+			"lldapEnabled":     lldap.Configured(app),
 			"authMode":         string(app.AuthConfig.Mode),
 			"localAuthEnabled": app.DB != nil,
 			"needsSetup":       needsSetup,
@@ -34,48 +44,449 @@ func AdminCheckHandler(app *server.App) http.HandlerFunc {
 	}
 }
 
-// AdminLLDAPUsersHandler returns a read-only list of users from the LLDAP directory.
+// lldapUserIDPattern matches the user IDs LLDAP accepts.
+var lldapUserIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+// lldapBuiltinGroups grant rights inside LLDAP itself.
+var lldapBuiltinGroups = map[string]bool{
+	"lldap_admin":            true,
+	"lldap_password_manager": true,
+	"lldap_strict_readonly":  true,
+}
+
+// lldapGroupPrivileged reports whether only full admins may grant the group.
+func lldapGroupPrivileged(app *server.App, group string) bool {
+	return lldapBuiltinGroups[strings.ToLower(group)] || auth.IsPrivilegedGroup(app, group)
+}
+
+// lldapCanManage reports whether the user may act on an LLDAP account or
+// group membership involving these groups.
+func lldapCanManage(app *server.App, user *models.AuthenticatedUser, groups []string) bool {
+	if user != nil && user.IsAdmin {
+		return true
+	}
+	for _, g := range groups {
+		if lldapGroupPrivileged(app, g) {
+			return false
+		}
+	}
+	return true
+}
+
+// respondLLDAPError reports a failed LLDAP request. The directory's own
+// message is passed on, since it usually explains the problem (e.g. a
+// duplicate user ID).
+func respondLLDAPError(w http.ResponseWriter, err error) {
+	log.Printf("LLDAP operation failed: %v", err)
+	if err == lldap.ErrNotConfigured {
+		respondError(w, http.StatusServiceUnavailable, "LLDAP not configured")
+		return
+	}
+	respondError(w, http.StatusBadGateway, "LLDAP request failed: "+err.Error())
+}
+
+// findLLDAPUser returns the LLDAP user with the given ID, or nil.
+func findLLDAPUser(app *server.App, id string) (*models.LLDAPUser, error) {
+	users, err := lldap.ListUsers(app)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if users[i].ID == id {
+			return &users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findLLDAPGroup returns the LLDAP group with the given ID, or nil.
+func findLLDAPGroup(app *server.App, id int) (*models.LLDAPGroup, error) {
+	groups, err := lldap.ListGroups(app)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if groups[i].ID == id {
+			return &groups[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// AdminLLDAPUsersHandler lists (GET) and creates (POST) LLDAP users.
 func AdminLLDAPUsersHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if app.LLDAPConfig == nil {
+		if !lldap.Configured(app) {
 			respondError(w, http.StatusServiceUnavailable, "LLDAP not configured")
 			return
 		}
 
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			users, err := lldap.ListUsers(app)
+			if err != nil {
+				log.Printf("LLDAP operation failed: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, users)
+		case http.MethodPost:
+			createLLDAPUser(app, w, r)
+		default:
 			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func createLLDAPUser(app *server.App, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID          string `json:"id"`
+		Email       string `json:"email"`
+		DisplayName string `json:"displayName"`
+		Password    string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.ID = strings.TrimSpace(req.ID)
+	req.Email = strings.TrimSpace(req.Email)
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+
+	if !lldapUserIDPattern.MatchString(req.ID) {
+		respondError(w, http.StatusBadRequest, "User ID may only contain letters, digits, '.', '_', '@' and '-'")
+		return
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		respondError(w, http.StatusBadRequest, "A valid email address is required")
+		return
+	}
+	if req.Password != "" {
+		if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := lldap.CreateUser(app, models.LLDAPUser{ID: req.ID, Email: req.Email, DisplayName: req.DisplayName}); err != nil {
+		respondLLDAPError(w, err)
+		return
+	}
+
+	adminName := ""
+	if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+		adminName = adminUser.Username
+	}
+	audit.LogAudit(app, adminName, "lldap_user_created", fmt.Sprintf("Created LLDAP user %q", req.ID), auth.ClientIP(r))
+
+	resp := map[string]string{"status": "created"}
+	if req.Password != "" {
+		if err := lldap.SetPassword(app, req.ID, req.Password); err != nil {
+			log.Printf("Failed to set password for new LLDAP user %q: %v", req.ID, err)
+			resp["warning"] = "User created, but the password could not be set: " + err.Error()
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// AdminLLDAPUserHandler deletes an LLDAP user (DELETE /api/admin/users/{id})
+// or sets their password (POST /api/admin/users/{id}/password).
+func AdminLLDAPUserHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !lldap.Configured(app) {
+			respondError(w, http.StatusServiceUnavailable, "LLDAP not configured")
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/api/admin/users/")
+		userID, action, _ := strings.Cut(path, "/")
+		if userID == "" || (action != "" && action != "password") {
+			respondError(w, http.StatusNotFound, "Not found")
 			return
 		}
 
-		users, err := lldap.ListUsers(app)
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		target, err := findLLDAPUser(app, userID)
 		if err != nil {
-			log.Printf("LLDAP operation failed: %v", err)
-			respondError(w, http.StatusInternalServerError, "Internal server error")
+			respondLLDAPError(w, err)
+			return
+		}
+		if target == nil {
+			respondError(w, http.StatusNotFound, "User not found")
 			return
 		}
-		respondJSON(w, http.StatusOK, users)
+		if !lldapCanManage(app, adminUser, target.Groups) {
+			respondError(w, http.StatusForbidden, "Only admins can manage admin or role accounts")
+			return
+		}
+
+		switch {
+		case action == "password" && r.Method == http.MethodPost:
+			var req struct {
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := lldap.SetPassword(app, userID, req.Password); err != nil {
+				if err == lldap.ErrPasswordResetUnavailable {
+					respondError(w, http.StatusBadRequest, "Setting LLDAP passwords requires LDAP sign-in to be configured with an LLDAP admin or password manager bind user")
+					return
+				}
+				respondLLDAPError(w, err)
+				return
+			}
+			audit.LogAudit(app, adminName, "lldap_password_reset", fmt.Sprintf("Set password for LLDAP user %q", userID), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+		case action == "" && r.Method == http.MethodDelete:
+			if adminUser != nil && strings.EqualFold(userID, adminUser.Username) {
+				respondError(w, http.StatusBadRequest, "Cannot delete yourself")
+				return
+			}
+			if err := lldap.DeleteUser(app, userID); err != nil {
+				respondLLDAPError(w, err)
+				return
+			}
+			audit.LogAudit(app, adminName, "lldap_user_deleted", fmt.Sprintf("Deleted LLDAP user %q", userID), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
 	}
 }
 
-// AdminLLDAPGroupsHandler returns a read-only list of groups from the LLDAP directory.
+// AdminLLDAPGroupsHandler lists (GET) and creates (POST) LLDAP groups.
 func AdminLLDAPGroupsHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if app.LLDAPConfig == nil {
+		if !lldap.Configured(app) {
 			respondError(w, http.StatusServiceUnavailable, "LLDAP not configured")
 			return
 		}
 
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			groups, err := lldap.ListGroups(app)
+			if err != nil {
+				log.Printf("LLDAP operation failed: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, groups)
+		case http.MethodPost:
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			req.Name = strings.TrimSpace(req.Name)
+			if req.Name == "" || len(req.Name) > 64 {
+				respondError(w, http.StatusBadRequest, "Group name must be 1-64 characters")
+				return
+			}
+			id, err := lldap.CreateGroup(app, req.Name)
+			if err != nil {
+				respondLLDAPError(w, err)
+				return
+			}
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "lldap_group_created", fmt.Sprintf("Created LLDAP group %q (id=%d)", req.Name, id), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]interface{}{"status": "created", "id": id})
+		default:
 			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// AdminLLDAPGroupHandler deletes an LLDAP group (DELETE
+// /api/admin/groups/{id}) and adds (PUT) or removes (DELETE) members at
+// /api/admin/groups/{id}/members/{userId}.
+func AdminLLDAPGroupHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !lldap.Configured(app) {
+			respondError(w, http.StatusServiceUnavailable, "LLDAP not configured")
 			return
 		}
 
-		groups, err := lldap.ListGroups(app)
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/groups/"), "/")
+		groupID, err := strconv.Atoi(parts[0])
 		if err != nil {
-			log.Printf("LLDAP operation failed: %v", err)
-			respondError(w, http.StatusInternalServerError, "Internal server error")
+			respondError(w, http.StatusBadRequest, "Invalid group ID")
+			return
+		}
+		memberID := ""
+		if len(parts) == 3 && parts[1] == "members" && parts[2] != "" {
+			memberID = parts[2]
+		} else if len(parts) != 1 {
+			respondError(w, http.StatusNotFound, "Not found")
 			return
 		}
-		respondJSON(w, http.StatusOK, groups)
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		group, err := findLLDAPGroup(app, groupID)
+		if err != nil {
+			respondLLDAPError(w, err)
+			return
+		}
+		if group == nil {
+			respondError(w, http.StatusNotFound, "Group not found")
+			return
+		}
+		if !lldapCanManage(app, adminUser, []string{group.DisplayName}) {
+			respondError(w, http.StatusForbidden, "Only admins can manage admin or role groups")
+			return
+		}
+
+		switch {
+		case memberID == "" && r.Method == http.MethodDelete:
+			if err := lldap.DeleteGroup(app, groupID); err != nil {
+				respondLLDAPError(w, err)
+				return
+			}
+			audit.LogAudit(app, adminName, "lldap_group_deleted", fmt.Sprintf("Deleted LLDAP group %q (id=%d)", group.DisplayName, groupID), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		case memberID != "" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+			member, err := findLLDAPUser(app, memberID)
+			if err != nil {
+				respondLLDAPError(w, err)
+				return
+			}
+			if member == nil {
+				respondError(w, http.StatusNotFound, "User not found")
+				return
+			}
+			if !lldapCanManage(app, adminUser, member.Groups) {
+				respondError(w, http.StatusForbidden, "Only admins can manage admin or role accounts")
+				return
+			}
+			if r.Method == http.MethodPut {
+				err = lldap.AddUserToGroup(app, memberID, groupID)
+			} else {
+				err = lldap.RemoveUserFromGroup(app, memberID, groupID)
+			}
+			if err != nil {
+				respondLLDAPError(w, err)
+				return
+			}
+			if r.Method == http.MethodPut {
+				audit.LogAudit(app, adminName, "lldap_member_added", fmt.Sprintf("Added LLDAP user %q to group %q", memberID, group.DisplayName), auth.ClientIP(r))
+			} else {
+				audit.LogAudit(app, adminName, "lldap_member_removed", fmt.Sprintf("Removed LLDAP user %q from group %q", memberID, group.DisplayName), auth.ClientIP(r))
+			}
+			respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// AdminLLDAPConfigHandler gets (GET) and updates (PUT) the LLDAP connection
+// settings. The admin password is write-only.
+func AdminLLDAPConfigHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			configured, connected, lastError := lldap.Status(app)
+			app.SysConfigMu.RLock()
+			resp := map[string]interface{}{
+				"enabled":     app.SystemConfig.LLDAPEnabled,
+				"url":         app.SystemConfig.LLDAPURL,
+				"username":    app.SystemConfig.LLDAPAdminUsername,
+				"hasPassword": app.SystemConfig.LLDAPAdminPassword != "",
+				"envOverride": app.ConfigEnvVar("lldap_enabled") != "",
+				"configured":  configured,
+				"connected":   connected,
+				"lastError":   lastError,
+			}
+			app.SysConfigMu.RUnlock()
+			respondJSON(w, http.StatusOK, resp)
+
+		case http.MethodPut:
+			if app.ConfigEnvVar("lldap_enabled") != "" {
+				respondError(w, http.StatusConflict, "LLDAP is controlled by environment variables")
+				return
+			}
+
+			var req struct {
+				Enabled  bool   `json:"enabled"`
+				URL      string `json:"url"`
+				Username string `json:"username"`
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			req.URL = strings.TrimSpace(req.URL)
+			req.Username = strings.TrimSpace(req.Username)
+
+			app.SysConfigMu.RLock()
+			password := app.SystemConfig.LLDAPAdminPassword
+			app.SysConfigMu.RUnlock()
+			if req.Password != "" {
+				password = req.Password
+			}
+
+			if req.Enabled {
+				if req.URL == "" || req.Username == "" || password == "" {
+					respondError(w, http.StatusBadRequest, "URL, admin username and password are required")
+					return
+				}
+				if err := urlvalidation.ValidateDiscoveryURL(req.URL); err != nil {
+					respondError(w, http.StatusBadRequest, "Invalid URL: "+err.Error())
+					return
+				}
+			}
+
+			app.SysConfigMu.Lock()
+			app.SystemConfig.LLDAPEnabled = req.Enabled
+			app.SystemConfig.LLDAPURL = req.URL
+			app.SystemConfig.LLDAPAdminUsername = req.Username
+			app.SystemConfig.LLDAPAdminPassword = password
+			app.SysConfigMu.Unlock()
+
+			if err := database.SaveSystemConfig(app); err != nil {
+				log.Printf("Failed to save LLDAP config: %v", err)
+				respondError(w, http.StatusInternalServerError, "Failed to save configuration")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "lldap_config_updated", fmt.Sprintf("Updated LLDAP settings (enabled=%v, url=%s)", req.Enabled, req.URL), auth.ClientIP(r))
+
+			resp := map[string]string{"status": "ok"}
+			if req.Enabled {
+				if err := lldap.Test(app, req.URL, req.Username, password); err != nil {
+					resp["warning"] = "Saved, but LLDAP could not be reached: " + err.Error()
+				}
+			}
+			lldap.Configure(app)
+			respondJSON(w, http.StatusOK, resp)
+
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
 	}
 }
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/netpolicy"
+	"dashgate/internal/server"
+)
+
+// AdminNetworkPoliciesHandler handles GET (list) and POST (create) for the
+// route and group network policies.
+func AdminNetworkPoliciesHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			policies, err := database.ListNetworkPolicies(app)
+			if err != nil {
+				log.Printf("Error listing network policies: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"policies": policies,
+				"aliases":  netpolicy.Aliases,
+				"yourIP":   auth.ClientIP(r),
+			})
+		case http.MethodPost:
+			var p models.NetworkPolicy
+			if !decodeNetworkPolicy(w, r, &p) {
+				return
+			}
+			if !validateNetworkPolicy(w, r, &p) {
+				return
+			}
+
+			id, err := database.CreateNetworkPolicy(app, p)
+			if err != nil {
+				log.Printf("Error creating network policy: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			database.ReloadNetworkPolicies(app)
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "network_policy_created", fmt.Sprintf("Created %s network policy for %s: %s", p.Kind, p.Target, p.Networks), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "id": id})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// AdminNetworkPolicyHandler handles PUT (update) and DELETE for a single
+// policy at /api/admin/network-policies/{id}.
+func AdminNetworkPolicyHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/network-policies/"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid policy ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var p models.NetworkPolicy
+			if !decodeNetworkPolicy(w, r, &p) {
+				return
+			}
+			p.ID = id
+			if !validateNetworkPolicy(w, r, &p) {
+				return
+			}
+
+			err := database.UpdateNetworkPolicy(app, p)
+			if err == database.ErrNetworkPolicyNotFound {
+				respondError(w, http.StatusNotFound, "Policy not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error updating network policy: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			database.ReloadNetworkPolicies(app)
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "network_policy_updated", fmt.Sprintf("Updated network policy id=%d (%s %s: %s)", id, p.Kind, p.Target, p.Networks), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		case http.MethodDelete:
+			err := database.DeleteNetworkPolicy(app, id)
+			if err == database.ErrNetworkPolicyNotFound {
+				respondError(w, http.StatusNotFound, "Policy not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error deleting network policy: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			database.ReloadNetworkPolicies(app)
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "network_policy_deleted", fmt.Sprintf("Deleted network policy id=%d", id), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func decodeNetworkPolicy(w http.ResponseWriter, r *http.Request, p *models.NetworkPolicy) bool {
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	p.Kind = strings.TrimSpace(p.Kind)
+	p.Target = strings.TrimSpace(p.Target)
+	p.Networks = strings.TrimSpace(p.Networks)
+	p.Description = strings.TrimSpace(p.Description)
+	return true
+}
+
+// validateNetworkPolicy checks the policy and refuses a route policy that
+// would lock the requesting admin out of the admin API.
+func validateNetworkPolicy(w http.ResponseWriter, r *http.Request, p *models.NetworkPolicy) bool {
+	if p.Kind != "route" && p.Kind != "group" {
+		respondError(w, http.StatusBadRequest, "Kind must be \"route\" or \"group\"")
+		return false
+	}
+	if p.Target == "" || p.Networks == "" {
+		respondError(w, http.StatusBadRequest, "Target and networks are required")
+		return false
+	}
+	if p.Kind == "route" && !strings.HasPrefix(p.Target, "/") {
+		respondError(w, http.StatusBadRequest, "Route target must be a path starting with /")
+		return false
+	}
+	nets, err := netpolicy.Parse(p.Networks)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Networks: "+err.Error())
+		return false
+	}
+
+	// Saving a policy that excludes the admin's own address from the path
+	// they are using would make it impossible to undo.
+	if p.Kind == "route" && auth.RouteMatches(p.Target, r.URL.Path) {
+		ip := auth.ClientIP(r)
+		if !netpolicy.Contains(nets, net.ParseIP(ip)) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("This policy would block your own address (%s) from the admin API", ip))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// oidcClientIDPattern limits client IDs to short slugs such as "grafana".
+var oidcClientIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// AdminOIDCClientsHandler handles GET (list) and POST (register) for the apps
+// that sign users in through DashGate's OpenID provider. The client secret is
+// generated by DashGate and only returned once.
+func AdminOIDCClientsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			clients, err := database.ListIDPClients(app)
+			if err != nil {
+				log.Printf("Error listing OIDC clients: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"clients": clients,
+				"issuer":  idpIssuer(app),
+			})
+		case http.MethodPost:
+			var c models.IDPClient
+			if !decodeOIDCClient(w, r, &c) {
+				return
+			}
+			if !oidcClientIDPattern.MatchString(c.ClientID) {
+				respondError(w, http.StatusBadRequest, "Client ID must be 1-64 lowercase letters, digits, dots, underscores or hyphens")
+				return
+			}
+
+			secret, err := auth.GenerateSessionToken()
+			if err != nil {
+				log.Printf("Error generating client secret: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if err := database.CreateIDPClient(app, c, secret); err != nil {
+				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+					respondError(w, http.StatusConflict, "A client with this ID already exists")
+					return
+				}
+				log.Printf("Error creating OIDC client: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "oidc_client_created", fmt.Sprintf("Registered OIDC client %s (%s)", c.ClientID, c.Name), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"clientID":     c.ClientID,
+				"clientSecret": secret, // Only returned once!
+			})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// AdminOIDCClientHandler handles PUT (update) and DELETE for a single client
+// at /api/admin/oidc-clients/{id}, and POST /api/admin/oidc-clients/{id}/secret
+// to replace its secret.
+func AdminOIDCClientHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/oidc-clients/"), "/")
+		if !oidcClientIDPattern.MatchString(id) || (action != "" && action != "secret") {
+			respondError(w, http.StatusBadRequest, "Invalid client ID")
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch {
+		case r.Method == http.MethodPut && action == "":
+			var c models.IDPClient
+			if !decodeOIDCClient(w, r, &c) {
+				return
+			}
+			c.ClientID = id
+
+			err := database.UpdateIDPClient(app, c)
+			if err == database.ErrIDPClientNotFound {
+				respondError(w, http.StatusNotFound, "Client not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error updating OIDC client: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, adminName, "oidc_client_updated", fmt.Sprintf("Updated OIDC client %s (%s)", c.ClientID, c.Name), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		case r.Method == http.MethodPost && action == "secret":
+			secret, err := auth.GenerateSessionToken()
+			if err != nil {
+				log.Printf("Error generating client secret: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			err = database.SetIDPClientSecret(app, id, secret)
+			if err == database.ErrIDPClientNotFound {
+				respondError(w, http.StatusNotFound, "Client not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error replacing OIDC client secret: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, adminName, "oidc_client_secret_rotated", "Replaced secret of OIDC client "+id, auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"clientID":     id,
+				"clientSecret": secret, // Only returned once!
+			})
+		case r.Method == http.MethodDelete && action == "":
+			err := database.DeleteIDPClient(app, id)
+			if err == database.ErrIDPClientNotFound {
+				respondError(w, http.StatusNotFound, "Client not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error deleting OIDC client: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, adminName, "oidc_client_deleted", "Deleted OIDC client "+id, auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func decodeOIDCClient(w http.ResponseWriter, r *http.Request, c *models.IDPClient) bool {
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	c.ClientID = strings.TrimSpace(c.ClientID)
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required")
+		return false
+	}
+
+	var uris []string
+	for _, u := range c.RedirectURIs {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Fragment != "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Redirect URI %q must be an http:// or https:// URL without a fragment", u))
+			return false
+		}
+		uris = append(uris, u)
+	}
+	if len(uris) == 0 {
+		respondError(w, http.StatusBadRequest, "At least one redirect URI is required")
+		return false
+	}
+	c.RedirectURIs = uris
+
+	var groups []string
+	for _, g := range c.AllowedGroups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	c.AllowedGroups = groups
+	return true
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// oidcProviderIDPattern limits provider IDs to short slugs, as they appear in
+// the login and callback URLs.
+var oidcProviderIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// AdminOIDCProvidersHandler handles GET (list) and POST (create) for the
+// additional OIDC providers.
+func AdminOIDCProvidersHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			providers, err := database.ListOIDCProviders(app)
+			if err != nil {
+				log.Printf("Error listing OIDC providers: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+
+			// Report which providers are currently available for sign-in
+			app.SysConfigMu.RLock()
+			active := make(map[string]bool, len(app.OIDCProviders))
+			for _, c := range app.OIDCProviders {
+				active[c.ID] = true
+			}
+			app.SysConfigMu.RUnlock()
+
+			type providerStatus struct {
+				models.OIDCProviderConfig
+				Active bool `json:"active"`
+			}
+			result := make([]providerStatus, 0, len(providers))
+			for _, p := range providers {
+				result = append(result, providerStatus{OIDCProviderConfig: p, Active: active[p.ID]})
+			}
+			respondJSON(w, http.StatusOK, result)
+		case http.MethodPost:
+			var p models.OIDCProviderConfig
+			if !decodeOIDCProvider(w, r, &p) {
+				return
+			}
+			if !oidcProviderIDPattern.MatchString(p.ID) || p.ID == "callback" || p.ID == "default" {
+				respondError(w, http.StatusBadRequest, "ID must be 1-32 lowercase letters, digits or hyphens")
+				return
+			}
+			if !validateOIDCProvider(app, w, &p) {
+				return
+			}
+
+			if err := database.CreateOIDCProvider(app, p); err != nil {
+				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+					respondError(w, http.StatusConflict, "A provider with this ID already exists")
+					return
+				}
+				log.Printf("Error creating OIDC provider: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "oidc_provider_created", fmt.Sprintf("Created OIDC provider %s (%s)", p.ID, p.Issuer), auth.ClientIP(r))
+			respondOIDCProviderSaved(app, w, p.ID)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// AdminOIDCProviderHandler handles PUT (update) and DELETE for a single
+// provider at /api/admin/oidc-providers/{id}.
+func AdminOIDCProviderHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/oidc-providers/")
+		if !oidcProviderIDPattern.MatchString(id) {
+			respondError(w, http.StatusBadRequest, "Invalid provider ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var p models.OIDCProviderConfig
+			if !decodeOIDCProvider(w, r, &p) {
+				return
+			}
+			p.ID = id
+			if !validateOIDCProvider(app, w, &p) {
+				return
+			}
+
+			err := database.UpdateOIDCProvider(app, p)
+			if err == database.ErrOIDCProviderNotFound {
+				respondError(w, http.StatusNotFound, "Provider not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error updating OIDC provider: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "oidc_provider_updated", fmt.Sprintf("Updated OIDC provider %s (%s)", p.ID, p.Issuer), auth.ClientIP(r))
+			respondOIDCProviderSaved(app, w, p.ID)
+		case http.MethodDelete:
+			err := database.DeleteOIDCProvider(app, id)
+			if err == database.ErrOIDCProviderNotFound {
+				respondError(w, http.StatusNotFound, "Provider not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error deleting OIDC provider: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			audit.LogAudit(app, adminName, "oidc_provider_deleted", "Deleted OIDC provider "+id, auth.ClientIP(r))
+			database.ReloadOIDCProviders(app)
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func decodeOIDCProvider(w http.ResponseWriter, r *http.Request, p *models.OIDCProviderConfig) bool {
+	var req struct {
+		models.OIDCProviderConfig
+		ClientSecret string `json:"clientSecret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	*p = req.OIDCProviderConfig
+	p.ClientSecret = req.ClientSecret
+	p.ID = strings.TrimSpace(p.ID)
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	p.Issuer = strings.TrimSpace(p.Issuer)
+	p.ClientID = strings.TrimSpace(p.ClientID)
+	p.RedirectURL = strings.TrimSpace(p.RedirectURL)
+	p.Scopes = strings.TrimSpace(p.Scopes)
+	p.GroupsClaim = strings.TrimSpace(p.GroupsClaim)
+	p.GroupMapping = strings.TrimSpace(p.GroupMapping)
+	return true
+}
+
+func validateOIDCProvider(app *server.App, w http.ResponseWriter, p *models.OIDCProviderConfig) bool {
+	if p.DisplayName == "" || p.Issuer == "" || p.ClientID == "" {
+		respondError(w, http.StatusBadRequest, "Display name, issuer and client ID are required")
+		return false
+	}
+	if u, err := url.Parse(p.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondError(w, http.StatusBadRequest, "Issuer must be an http:// or https:// URL")
+		return false
+	}
+	if p.RedirectURL == "" {
+		app.SysConfigMu.RLock()
+		publicURL := app.SystemConfig.PublicURL
+		app.SysConfigMu.RUnlock()
+		if publicURL == "" {
+			respondError(w, http.StatusBadRequest, "Set a redirect URL, or a public URL so one can be derived")
+			return false
+		}
+	}
+	if _, err := auth.ParseGroupMapping(p.GroupMapping); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid group mapping: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// respondOIDCProviderSaved reloads the providers and reports whether the saved
+// one could be reached, so the admin sees discovery problems right away.
+func respondOIDCProviderSaved(app *server.App, w http.ResponseWriter, id string) {
+	resp := map[string]string{"status": "ok"}
+	if err := database.ReloadOIDCProviders(app)[id]; err != nil {
+		resp["warning"] = "Saved, but the provider could not be reached: " + err.Error()
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// addOIDCProvider registers a second fake provider as "family" through the
+// admin API.
+func addOIDCProvider(t *testing.T, app *server.App, mapping string) *fakeOIDCProvider {
+	t.Helper()
+	provider := newFakeOIDCProvider(t)
+	w := httptest.NewRecorder()
+	AdminOIDCProvidersHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/oidc-providers", map[string]interface{}{
+		"id":           "family",
+		"displayName":  "Family Login",
+		"issuer":       provider.server.URL,
+		"clientID":     "dashgate-family",
+		"clientSecret": "family-secret",
+		"groupMapping": mapping,
+		"enabled":      true,
+	}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["warning"] != "" {
+		t.Fatalf("unexpected warning: %s", resp["warning"])
+	}
+	return provider
+}
+
+func TestOIDCProviders_LoginWithAdditionalProvider(t *testing.T) {
+	app, _ := setupOIDCApp(t)
+	app.SystemConfig.PublicURL = "http://dash.example.com"
+	family := addOIDCProvider(t, app, "fam-admins = admins, family")
+	family.idClaims = map[string]interface{}{
+		"sub":                "kid-1",
+		"preferred_username": "robin",
+		"groups":             []string{"fam-admins", "kids"},
+	}
+
+	w := httptest.NewRecorder()
+	auth.OIDCProviderHandler(app).ServeHTTP(w, newGet("/auth/oidc/family"))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect to provider, got %d: %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	u, _ := url.Parse(location)
+	if got := u.Query().Get("redirect_uri"); got != "http://dash.example.com/auth/oidc/family/callback" {
+		t.Errorf("expected derived redirect URI, got %q", got)
+	}
+	if u.Query().Get("client_id") != "dashgate-family" {
+		t.Errorf("expected the provider's own client ID, got %q", u.Query().Get("client_id"))
+	}
+	code, state := family.authorize(t, location)
+
+	w = httptest.NewRecorder()
+	auth.OIDCProviderHandler(app).ServeHTTP(w, newGet("/auth/oidc/family/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state)))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var groups, source string
+	app.DB.QueryRow("SELECT groups FROM users WHERE username = 'robin'").Scan(&groups)
+	app.DB.QueryRow("SELECT auth_source FROM sessions").Scan(&source)
+	if groups != `["admins","family","kids"]` {
+		t.Errorf("expected mapped groups, got %s", groups)
+	}
+	if source != "oidc:family" {
+		t.Errorf("expected auth source oidc:family, got %q", source)
+	}
+}
+
+func TestOIDCProviders_StateBoundToProvider(t *testing.T) {
+	app, primary := setupOIDCApp(t)
+	app.SystemConfig.PublicURL = "http://dash.example.com"
+	addOIDCProvider(t, app, "")
+	primary.idClaims = map[string]interface{}{"sub": "user-9", "preferred_username": "eve"}
+
+	// A login started with the primary provider cannot finish at another's callback
+	w := httptest.NewRecorder()
+	auth.OIDCAuthHandler(app).ServeHTTP(w, newGet("/auth/oidc"))
+	code, state := primary.authorize(t, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	auth.OIDCProviderHandler(app).ServeHTTP(w, newGet("/auth/oidc/family/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected state from another provider to be rejected, got %d", w.Code)
+	}
+}
+
+func TestOIDCProviders_ListedOnLoginConfig(t *testing.T) {
+	app, _ := setupOIDCApp(t)
+	app.SystemConfig.PublicURL = "http://dash.example.com"
+	addOIDCProvider(t, app, "")
+
+	w := httptest.NewRecorder()
+	AuthConfigHandler(app).ServeHTTP(w, newGet("/api/auth/config"))
+	var cfg struct {
+		OIDCEnabled   bool              `json:"oidcEnabled"`
+		OIDCProviders []oidcLoginOption `json:"oidcProviders"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if !cfg.OIDCEnabled || len(cfg.OIDCProviders) != 2 {
+		t.Fatalf("expected two providers, got %+v", cfg)
+	}
+	if cfg.OIDCProviders[0].LoginURL != "/auth/oidc" || cfg.OIDCProviders[1].LoginURL != "/auth/oidc/family" {
+		t.Errorf("unexpected login URLs: %+v", cfg.OIDCProviders)
+	}
+
+	// Turning OIDC off hides every provider
+	app.SystemConfig.OIDCAuthEnabled = false
+	if options := oidcLoginOptions(app); len(options) != 0 {
+		t.Errorf("expected no providers while OIDC is disabled, got %+v", options)
+	}
+}
+
+func TestOIDCProviders_Validation(t *testing.T) {
+	app, _ := setupOIDCApp(t)
+	app.SystemConfig.PublicURL = "http://dash.example.com"
+	cases := []map[string]interface{}{
+		{"id": "Bad ID", "displayName": "x", "issuer": "https://id.example.com", "clientID": "c"},
+		{"id": "callback", "displayName": "x", "issuer": "https://id.example.com", "clientID": "c"},
+		{"id": "ok", "displayName": "x", "issuer": "not-a-url", "clientID": "c"},
+		{"id": "ok", "displayName": "x", "issuer": "https://id.example.com", "clientID": "c", "groupMapping": "no equals sign"},
+	}
+	for _, body := range cases {
+		w := httptest.NewRecorder()
+		AdminOIDCProvidersHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/oidc-providers", body), adminUser()))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %v, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestApplyGroupMapping(t *testing.T) {
+	mapping := "# comment\n/admins = admins\nfamily = family, media\n"
+	got := auth.ApplyGroupMapping([]string{"/admins", "family", "other", "media"}, mapping)
+	if strings.Join(got, ",") != "admins,family,media,other" {
+		t.Errorf("unexpected mapped groups: %v", got)
+	}
+	if _, err := auth.ParseGroupMapping("= admins"); err == nil {
+		t.Error("expected a rule without a provider group to be rejected")
+	}
+}
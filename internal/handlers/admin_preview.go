@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// AdminPreviewHandler manages the admin "view as" preview at
+// /api/admin/preview: GET returns the active preview, POST starts one for a
+// username or a set of groups, and DELETE ends it.
+func AdminPreviewHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			preview := auth.GetPreview(app, r, adminUser)
+			if preview == nil {
+				respondJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"active":   true,
+				"username": preview.Username,
+				"groups":   preview.Groups,
+				"label":    preview.Label(),
+			})
+		case http.MethodPost:
+			var req auth.Preview
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			req.Username = strings.TrimSpace(req.Username)
+			groups := make([]string, 0, len(req.Groups))
+			for _, g := range req.Groups {
+				if g = strings.TrimSpace(g); g != "" {
+					groups = append(groups, g)
+				}
+			}
+			req.Groups = groups
+
+			if req.Username != "" {
+				if len(req.Groups) > 0 {
+					respondError(w, http.StatusBadRequest, "Preview either a user or a set of groups, not both")
+					return
+				}
+				if app.DB == nil {
+					respondError(w, http.StatusServiceUnavailable, "Database not available")
+					return
+				}
+				if _, err := database.GetUserIDByUsername(app, req.Username); err != nil {
+					if err == sql.ErrNoRows {
+						respondError(w, http.StatusNotFound, "User not found")
+						return
+					}
+					log.Printf("Error looking up preview user: %v", err)
+					respondError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+			}
+
+			auth.SetPreviewCookie(app, w, req)
+			audit.LogAudit(app, adminName, "preview_started", "Previewing the dashboard as "+req.Label(), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "ok", "label": req.Label()})
+		case http.MethodDelete:
+			if preview := auth.GetPreview(app, r, adminUser); preview != nil {
+				audit.LogAudit(app, adminName, "preview_ended", "Stopped previewing the dashboard as "+preview.Label(), auth.ClientIP(r))
+			}
+			auth.ClearPreviewCookie(app, w)
+			respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
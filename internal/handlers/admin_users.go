@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/audit"
@@ -59,12 +60,38 @@ func LocalUserHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
+		// User managers cannot act on accounts that hold admin rights or roles
+		if !user.IsAdmin {
+			groups, err := database.GetUserGroupsByID(app, userID)
+			if err != nil && err != sql.ErrNoRows {
+				log.Printf("Error getting user groups: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !auth.CanGrantGroups(app, user, groups) {
+				respondError(w, http.StatusForbidden, "Only admins can manage admin or role accounts")
+				return
+			}
+		}
+
 		// Check for password reset endpoint
 		if len(parts) > 1 && parts[1] == "password" {
 			resetUserPassword(app, w, r, userID)
 			return
 		}
 
+		// Clear a login lockout
+		if len(parts) > 1 && parts[1] == "unlock" {
+			unlockLocalUser(app, w, r, userID)
+			return
+		}
+
+		// Session management endpoints
+		if len(parts) > 1 && parts[1] == "sessions" {
+			adminUserSessions(app, w, r, userID, parts[2:])
+			return
+		}
+
 		switch r.Method {
 		case http.MethodPut:
 			updateLocalUser(app, w, r, userID, user.Username)
@@ -89,11 +116,15 @@ func listLocalUsers(app *server.App, w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var u models.LocalUser
 		var groupsJSON string
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &groupsJSON, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &groupsJSON, &u.CreatedAt, &u.UpdatedAt, &lockedUntil, &u.Disabled); err != nil {
 			log.Printf("Error scanning user: %v", err)
 			continue
 		}
 		json.Unmarshal([]byte(groupsJSON), &u.Groups)
+		if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+			u.LockedUntil = &lockedUntil.Time
+		}
 		users = append(users, u)
 	}
 
@@ -125,8 +156,13 @@ func createLocalUser(app *server.App, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Password) < 8 {
-		respondError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+	if !auth.CanGrantGroups(app, auth.GetUserFromContext(r), req.Groups) {
+		respondError(w, http.StatusForbidden, "Only admins can grant admin or role groups")
+		return
+	}
+
+	if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -161,7 +197,7 @@ func createLocalUser(app *server.App, w http.ResponseWriter, r *http.Request) {
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	audit.LogAudit(app, adminName, "user_created", fmt.Sprintf("Created user %q (id=%d)", req.Username, id), r.RemoteAddr)
+	audit.LogAudit(app, adminName, "user_created", fmt.Sprintf("Created user %q (id=%d)", req.Username, id), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{"status": "created", "id": id})
 }
@@ -181,6 +217,10 @@ func updateLocalUser(app *server.App, w http.ResponseWriter, r *http.Request, us
 	// Prevent admin from removing their own admin role
 	var targetUsername string
 	targetUsername, _ = database.GetUsernameByID(app, userID)
+	if !auth.CanGrantGroups(app, auth.GetUserFromContext(r), req.Groups) {
+		respondError(w, http.StatusForbidden, "Only admins can grant admin or role groups")
+		return
+	}
 	if targetUsername == currentUsername {
 		if !auth.CheckIsAdmin(app, req.Groups) {
 			respondError(w, http.StatusForbidden, "Cannot remove admin role from your own account")
@@ -212,7 +252,7 @@ func updateLocalUser(app *server.App, w http.ResponseWriter, r *http.Request, us
 	// Invalidate all sessions for this user since their privileges changed
 	database.InvalidateUserSessions(app, userID)
 
-	audit.LogAudit(app, currentUsername, "user_updated", fmt.Sprintf("Updated user id=%d", userID), r.RemoteAddr)
+	audit.LogAudit(app, currentUsername, "user_updated", fmt.Sprintf("Updated user id=%d", userID), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
@@ -253,7 +293,7 @@ func deleteLocalUser(app *server.App, w http.ResponseWriter, r *http.Request, us
 		return
 	}
 
-	audit.LogAudit(app, currentUsername, "user_deleted", fmt.Sprintf("Deleted user %q (id=%d)", username, userID), r.RemoteAddr)
+	audit.LogAudit(app, currentUsername, "user_deleted", fmt.Sprintf("Deleted user %q (id=%d)", username, userID), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -278,8 +318,28 @@ func resetUserPassword(app *server.App, w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	if len(req.Password) < 8 {
-		respondError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+	if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	oldHash, err := database.GetPasswordHashByID(app, userID)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := auth.CheckPasswordHistory(app, userID, req.Password, oldHash); err != nil {
+		if err == auth.ErrPasswordReused {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error checking password history: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+		}
 		return
 	}
 
@@ -304,6 +364,8 @@ func resetUserPassword(app *server.App, w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	auth.RecordPasswordChange(app, userID, oldHash)
+
 	// Invalidate all user sessions after password reset
 	database.InvalidateUserSessions(app, userID)
 
@@ -312,7 +374,39 @@ func resetUserPassword(app *server.App, w http.ResponseWriter, r *http.Request,
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	audit.LogAudit(app, adminName, "password_reset", fmt.Sprintf("Reset password for user id=%d", userID), r.RemoteAddr)
+	audit.LogAudit(app, adminName, "password_reset", fmt.Sprintf("Reset password for user id=%d", userID), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "password_reset"})
 }
+
+// unlockLocalUser clears the failed login count and any lockout for a user.
+func unlockLocalUser(app *server.App, w http.ResponseWriter, r *http.Request, userID int) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	username, err := database.GetUsernameByID(app, userID)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if err := database.ClearLoginAttempts(app, username); err != nil {
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	adminName := ""
+	if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+		adminName = adminUser.Username
+	}
+	audit.LogAudit(app, adminName, "account_unlocked", fmt.Sprintf("Unlocked user %q (id=%d)", username, userID), auth.ClientIP(r))
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "unlocked"})
+}
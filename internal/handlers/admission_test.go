@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+)
+
+func TestAdmission_OIDCDeniedByEmailDomain(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	app.SystemConfig.AdmissionEmailDomains = "example.com"
+	provider.idClaims = map[string]interface{}{"sub": "g-1", "preferred_username": "stranger", "email": "stranger@gmail.com", "groups": []string{}}
+
+	w := oidcLogin(t, app, provider, "/auth/oidc")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login?error=access_denied" {
+		t.Fatalf("expected redirect to the login error page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	var users, sessions, denials int
+	app.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'stranger'").Scan(&users)
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&sessions)
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'login_denied' AND username = 'stranger'").Scan(&denials)
+	if users != 0 || sessions != 0 {
+		t.Errorf("expected no user or session, got %d users, %d sessions", users, sessions)
+	}
+	if denials != 1 {
+		t.Errorf("expected one login_denied audit entry, got %d", denials)
+	}
+
+	provider.idClaims = map[string]interface{}{"sub": "g-2", "preferred_username": "colleague", "email": "colleague@Example.com", "groups": []string{}}
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/" {
+		t.Fatalf("expected an allowed domain to sign in, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestAdmission_UnverifiedEmailIgnored(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	app.SystemConfig.AdmissionEmailDomains = "example.com"
+	provider.idClaims = map[string]interface{}{"sub": "u-1", "preferred_username": "mallory", "email": "mallory@example.com", "email_verified": false, "groups": []string{}}
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/login?error=access_denied" {
+		t.Fatalf("expected an unverified email to fail the domain rule, got %q", w.Header().Get("Location"))
+	}
+
+	app.SystemConfig.AdmissionEmailDomains = ""
+	app.SystemConfig.AdmissionAllowList = "mallory@example.com"
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/login?error=access_denied" {
+		t.Fatalf("expected an unverified email to miss the allow list, got %q", w.Header().Get("Location"))
+	}
+
+	provider.idClaims["email_verified"] = true
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/" {
+		t.Fatalf("expected a verified email to be allowed, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestAdmission_InviteNeedsVerifiedEmail(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	if _, err := database.CreateInvite(app, "bound-token", "newhire@example.com", nil, "", "admin", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.idClaims = map[string]interface{}{"sub": "n-1", "preferred_username": "newhire", "email": "newhire@example.com", "email_verified": "false", "groups": []string{}}
+	if w := oidcLogin(t, app, provider, "/auth/oidc?invite=bound-token"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected an unverified email to be refused the invite, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	delete(provider.idClaims, "email_verified")
+	if w := oidcLogin(t, app, provider, "/auth/oidc?invite=bound-token"); w.Header().Get("Location") != "/" {
+		t.Fatalf("expected the invite to be accepted, got %d %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+}
+
+func TestAdmission_PreprovisionedOnly(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	app.SystemConfig.AdmissionPreprovisionedOnly = true
+	provider.idClaims = map[string]interface{}{"sub": "p-1", "preferred_username": "newcomer", "groups": []string{}}
+
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/login?error=access_denied" {
+		t.Fatalf("expected unknown user to be denied, got %q", w.Header().Get("Location"))
+	}
+
+	// Accounts with a password must be linked explicitly, so pre-provision
+	// one without
+	if _, err := database.CreateDirectoryUser(app, database.DirectoryUser{Username: "newcomer"}, ""); err != nil {
+		t.Fatalf("failed to provision user: %v", err)
+	}
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/" {
+		t.Fatalf("expected pre-provisioned user to sign in, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestAdmission_Rules(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	candidate := func(username, email string, groups ...string) auth.AdmissionCandidate {
+		return auth.AdmissionCandidate{Source: "ldap", Username: username, Email: email, Groups: groups}
+	}
+
+	app.SystemConfig.AdmissionRequiredGroups = "dashgate-users, admins"
+	app.SystemConfig.AdmissionAllowList = "Vip@example.com"
+	app.SystemConfig.AdmissionDenyList = "banned\nbad@example.com"
+
+	cases := []struct {
+		c       auth.AdmissionCandidate
+		allowed bool
+	}{
+		{candidate("ann", "ann@example.com", "Admins"), true},
+		{candidate("bob", "bob@example.com", "media"), false},
+		{candidate("vip", "vip@example.com"), true},
+		{candidate("banned", "", "admins"), false},
+		{candidate("carl", "BAD@example.com", "admins"), false},
+	}
+	for _, tc := range cases {
+		err := auth.CheckAdmission(app, tc.c)
+		if (err == nil) != tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tc.c.Username, tc.allowed, err)
+		}
+	}
+
+	// An allow list on its own admits nobody else
+	app.SystemConfig.AdmissionRequiredGroups = ""
+	if err := auth.CheckAdmission(app, candidate("ann", "ann@example.com", "admins")); err == nil {
+		t.Error("expected users missing from a lone allow list to be denied")
+	}
+}
+
+func TestAdmission_LoginPageShowsKnownErrorsOnly(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.Templates = template.Must(template.New("").Funcs(app.TemplateFuncMap).ParseGlob("../../templates/*.html"))
+
+	w := httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newGet("/login?error=access_denied"))
+	if !strings.Contains(w.Body.String(), "not allowed to sign in") {
+		t.Error("expected the access denied message on the login page")
+	}
+
+	w = httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newGet("/login?error=%3Cb%3Ehello"))
+	if strings.Contains(w.Body.String(), "hello") {
+		t.Error("expected unknown error codes to be ignored")
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/audit"
 	"dashgate/internal/database"
 	"dashgate/internal/models"
+	"dashgate/internal/netpolicy"
 	"dashgate/internal/server"
 
 	"golang.org/x/crypto/bcrypt"
@@ -51,7 +53,7 @@ func listAPIKeys(app *server.App, w http.ResponseWriter, r *http.Request) {
 		var groupsJSON, permsJSON string
 		var expiresAt, lastUsedAt sql.NullTime
 
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Username, &groupsJSON, &permsJSON, &expiresAt, &lastUsedAt, &k.CreatedAt); err != nil {
+		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Username, &groupsJSON, &permsJSON, &expiresAt, &lastUsedAt, &k.CreatedAt, &k.AllowedNetworks, &k.Personal); err != nil {
 			continue
 		}
 
@@ -82,6 +84,8 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 		Groups      []string `json:"groups"`
 		Permissions []string `json:"permissions"`
 		ExpiresIn   int      `json:"expiresIn"` // days, 0 = never
+		// AllowedNetworks limits where the key works from; empty is anywhere
+		AllowedNetworks string `json:"allowedNetworks"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -98,23 +102,19 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 		req.Username = "api-key"
 	}
 
-	if len(req.Permissions) == 0 {
-		req.Permissions = []string{"read"}
+	req.AllowedNetworks = strings.TrimSpace(req.AllowedNetworks)
+	if _, err := netpolicy.Parse(req.AllowedNetworks); err != nil {
+		respondError(w, http.StatusBadRequest, "Allowed networks: "+err.Error())
+		return
 	}
 
-	// Generate API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		log.Printf("Error generating random bytes for API key: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to generate key")
-		return
+	if len(req.Permissions) == 0 {
+		req.Permissions = []string{"read"}
 	}
-	apiKey := base64.URLEncoding.EncodeToString(keyBytes)
-	keyPrefix := apiKey[:8]
 
-	// Hash the key
-	keyHash, err := bcrypt.GenerateFromPassword([]byte(apiKey), bcrypt.DefaultCost)
+	apiKey, keyPrefix, keyHash, err := generateAPIKey()
 	if err != nil {
+		log.Printf("Error generating API key: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to generate key")
 		return
 	}
@@ -128,7 +128,7 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 		expiresAt = &t
 	}
 
-	id, err := database.CreateAPIKey(app, req.Name, string(keyHash), keyPrefix, req.Username, string(groupsJSON), string(permsJSON), expiresAt)
+	id, err := database.CreateAPIKey(app, req.Name, keyHash, keyPrefix, req.Username, string(groupsJSON), string(permsJSON), expiresAt, req.AllowedNetworks)
 	if err != nil {
 		log.Printf("Error creating API key: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to create key")
@@ -140,7 +140,7 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	audit.LogAudit(app, adminName, "api_key_created", fmt.Sprintf("Created API key %q (id=%d, prefix=%s)", req.Name, id, keyPrefix), r.RemoteAddr)
+	audit.LogAudit(app, adminName, "api_key_created", fmt.Sprintf("Created API key %q (id=%d, prefix=%s)", req.Name, id, keyPrefix), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"id":     id,
@@ -180,7 +180,23 @@ func deleteAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	audit.LogAudit(app, adminName, "api_key_deleted", fmt.Sprintf("Deleted API key id=%d", id), r.RemoteAddr)
+	audit.LogAudit(app, adminName, "api_key_deleted", fmt.Sprintf("Deleted API key id=%d", id), auth.ClientIP(r))
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
+
+// generateAPIKey returns a new random key, the prefix used to look it up and
+// its bcrypt hash.
+func generateAPIKey() (key, prefix, hash string, err error) {
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", "", "", err
+	}
+	key = base64.URLEncoding.EncodeToString(keyBytes)
+
+	keyHash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", "", err
+	}
+	return key, key[:8], string(keyHash), nil
+}
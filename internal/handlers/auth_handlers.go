@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"time"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/database"
@@ -13,6 +12,14 @@ import (
 	"dashgate/internal/server"
 )
 
+// loginErrorMessages are the messages the login page shows for its ?error=
+// codes. Only known codes are displayed, so the page cannot be made to show
+// arbitrary text.
+var loginErrorMessages = map[string]string{
+	"access_denied":         auth.AdmissionDeniedMessage,
+	"account_link_required": auth.IdentityConflictMessage,
+}
+
 // LoginHandler handles GET (render login page) and POST (authenticate user).
 func LoginHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -37,13 +44,15 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 			// Pass auth options to template
 			app.SysConfigMu.RLock()
 			data := map[string]interface{}{
-				"OIDCEnabled":     app.SystemConfig.OIDCAuthEnabled && app.OIDCProvider != nil,
-				"LDAPEnabled":     app.SystemConfig.LDAPAuthEnabled && app.LDAPAuth != nil,
-				"OIDCDisplayName": app.SystemConfig.OIDCDisplayName,
-				"CSPNonce":        middleware.GetCSPNonce(r),
-				"Version":         app.Version,
+				"LDAPEnabled": app.SystemConfig.LDAPAuthEnabled && app.LDAPAuth != nil,
+				"Error":       loginErrorMessages[r.URL.Query().Get("error")],
+				"CSPNonce":    middleware.GetCSPNonce(r),
+				"Version":     app.Version,
 			}
 			app.SysConfigMu.RUnlock()
+			providers := oidcLoginOptions(app)
+			data["OIDCEnabled"] = len(providers) > 0
+			data["OIDCProviders"] = providers
 
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			if err := app.GetTemplates().ExecuteTemplate(w, "login.html", data); err != nil {
@@ -67,6 +76,7 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 		var req struct {
 			Username string `json:"username"`
 			Password string `json:"password"`
+			Redirect string `json:"redirect"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -79,6 +89,13 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
+		// Refuse locked accounts before checking the password so a lockout
+		// cannot be used to confirm a guessed password
+		if auth.IsAccountLocked(app, req.Username) {
+			respondError(w, http.StatusTooManyRequests, "Too many failed attempts. Try again later.")
+			return
+		}
+
 		var authUser *models.AuthenticatedUser
 		var userID int
 
@@ -89,7 +106,7 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 
 		if localEnabled {
 			user, err := database.GetUserByUsername(app, req.Username)
-			if err == nil {
+			if err == nil && !user.Disabled {
 				if auth.CheckPassword(req.Password, user.PasswordHash) {
 					var groups []string
 					json.Unmarshal([]byte(user.GroupsJSON), &groups)
@@ -115,65 +132,62 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 		if authUser == nil && ldapEnabled {
 			ldapUser, err := auth.AuthenticateLDAP(app, req.Username, req.Password)
 			if err == nil {
-				authUser = ldapUser
+				ext := auth.ExternalIdentity{
+					Provider:    "ldap",
+					Subject:     auth.LDAPSubject(req.Username),
+					Username:    req.Username,
+					Email:       ldapUser.Email,
+					DisplayName: ldapUser.DisplayName,
+					Groups:      ldapUser.Groups,
+				}
+				// A linked LDAP account signs in to the DashGate account it
+				// is linked to, which may have a different username
+				if linked := auth.LinkedUsername(app, ext.Provider, ext.Subject); linked != "" {
+					ext.Username = linked
+					ldapUser.Username = linked
+				}
 
-				// Create or update local user record for LDAP user using upsert to avoid race conditions
-				groupsJSON, _ := json.Marshal(authUser.Groups)
-				if err := database.UpsertLDAPUser(app, req.Username, authUser.Email, authUser.DisplayName, string(groupsJSON)); err != nil {
-					log.Printf("Failed to upsert LDAP user: %v", err)
-					respondError(w, http.StatusInternalServerError, "Internal server error")
+				candidate := auth.AdmissionCandidate{Source: "ldap", Username: ext.Username, Email: ldapUser.Email, Groups: ldapUser.Groups}
+				if err := auth.CheckAdmission(app, candidate); err != nil {
+					auth.LogAdmissionDenied(app, r, candidate, err)
+					respondError(w, http.StatusForbidden, auth.AdmissionDeniedMessage)
+					return
+				}
+
+				userID, err = auth.ResolveExternalUser(app, ext)
+				if err == auth.ErrIdentityConflict {
+					auth.LogIdentityConflict(app, r, ext)
+					respondError(w, http.StatusForbidden, auth.IdentityConflictMessage)
 					return
 				}
-				userID, err = database.GetUserIDByUsername(app, req.Username)
 				if err != nil {
-					log.Printf("Failed to retrieve LDAP user ID: %v", err)
+					log.Printf("Failed to resolve LDAP user: %v", err)
 					respondError(w, http.StatusInternalServerError, "Internal server error")
 					return
 				}
+				authUser = ldapUser
 			}
 		}
 
 		if authUser == nil {
+			auth.RecordLoginFailure(app, r, req.Username)
 			respondError(w, http.StatusUnauthorized, "Invalid username or password")
 			return
 		}
+		auth.RecordLoginSuccess(app, req.Username)
 
-		// Invalidate any existing sessions for this user to prevent session fixation
-		database.InvalidateUserSessions(app, userID)
-
-		// Create session
-		token, err := auth.GenerateSessionToken()
-		if err != nil {
-			log.Printf("Error generating session token: %v", err)
-			respondError(w, http.StatusInternalServerError, "Internal server error")
-			return
-		}
-
-		app.SysConfigMu.RLock()
-		sessionDuration := app.AuthConfig.SessionDuration
-		cookieName := app.AuthConfig.CookieName
-		cookieSecure := app.AuthConfig.CookieSecure
-		app.SysConfigMu.RUnlock()
-
-		expiresAt := time.Now().Add(time.Duration(sessionDuration) * 24 * time.Hour)
-		if err := database.CreateSession(app, userID, token, expiresAt); err != nil {
+		if err := auth.StartSession(app, w, r, userID, authUser.Source); err != nil {
 			log.Printf("Error creating session: %v", err)
 			respondError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
 
-		// Set cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     cookieName,
-			Value:    token,
-			Path:     "/",
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Secure:   cookieSecure,
-			SameSite: http.SameSiteLaxMode,
-		})
+		redirect := "/"
+		if req.Redirect != "" && auth.IsSafeRedirect(app, req.Redirect) {
+			redirect = req.Redirect
+		}
 
-		respondJSON(w, http.StatusOK, map[string]string{"status": "ok", "redirect": "/"})
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ok", "redirect": redirect})
 	}
 }
 
@@ -187,28 +201,26 @@ func LogoutHandler(app *server.App) http.HandlerFunc {
 
 		app.SysConfigMu.RLock()
 		cookieName := app.AuthConfig.CookieName
-		cookieSecure := app.AuthConfig.CookieSecure
 		app.SysConfigMu.RUnlock()
 
 		// Get session cookie
+		response := map[string]string{"status": "ok"}
 		cookie, err := r.Cookie(cookieName)
 		if err == nil && app.DB != nil {
+			// Sign OIDC users out of the provider too, when enabled
+			if source, idToken, err := database.GetSessionLogin(app, cookie.Value); err == nil {
+				if logoutURL := auth.OIDCLogoutURL(app, source, idToken); logoutURL != "" {
+					response["redirect"] = logoutURL
+				}
+			}
+
 			// Delete session from database
 			database.DeleteSession(app, cookie.Value)
 		}
 
-		// Clear cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     cookieName,
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-			Secure:   cookieSecure,
-			SameSite: http.SameSiteLaxMode,
-		})
+		auth.ClearSessionCookie(app, w)
 
-		respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		respondJSON(w, http.StatusOK, response)
 	}
 }
 
@@ -242,12 +254,47 @@ func AuthConfigHandler(app *server.App) http.HandlerFunc {
 		cfg := map[string]interface{}{
 			"localEnabled":    app.SystemConfig.LocalAuthEnabled,
 			"ldapEnabled":     app.SystemConfig.LDAPAuthEnabled,
-			"oidcEnabled":     app.SystemConfig.OIDCAuthEnabled,
 			"proxyEnabled":    app.SystemConfig.ProxyAuthEnabled,
 			"oidcDisplayName": app.SystemConfig.OIDCDisplayName,
 		}
 		app.SysConfigMu.RUnlock()
+		cfg["passwordResetEnabled"] = passwordResetAvailable(app)
+		providers := oidcLoginOptions(app)
+		cfg["oidcEnabled"] = len(providers) > 0
+		cfg["oidcProviders"] = providers
 
 		respondJSON(w, http.StatusOK, cfg)
 	}
 }
+
+// oidcLoginOption is an OIDC provider offered on the login page.
+type oidcLoginOption struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	LoginURL    string `json:"loginURL"`
+}
+
+// oidcLoginOptions lists the OIDC providers users can currently sign in
+// with: the primary provider first, then the additional ones in order.
+func oidcLoginOptions(app *server.App) []oidcLoginOption {
+	options := []oidcLoginOption{}
+	if primary := auth.GetOIDCClient(app, ""); primary != nil {
+		name := primary.DisplayName
+		if name == "" {
+			name = "SSO"
+		}
+		options = append(options, oidcLoginOption{DisplayName: name, LoginURL: "/auth/oidc"})
+	}
+
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.OIDCAuthEnabled
+	clients := app.OIDCProviders
+	app.SysConfigMu.RUnlock()
+	if !enabled {
+		return options
+	}
+	for _, c := range clients {
+		options = append(options, oidcLoginOption{ID: c.ID, DisplayName: c.DisplayName, LoginURL: "/auth/oidc/" + c.ID})
+	}
+	return options
+}
@@ -1,10 +1,23 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+
+	"github.com/go-jose/go-jose/v3"
 )
 
 func TestLoginPost_ValidLocal(t *testing.T) {
@@ -202,4 +215,147 @@ func TestAuthConfig_WrongMethod(t *testing.T) {
 	}
 }
 
+func enableProxyAuth(t *testing.T, app *server.App, profile string) {
+	t.Helper()
+	app.SystemConfig.ProxyAuthEnabled = true
+	app.SystemConfig.ProxyAuthProfile = profile
+	app.SystemConfig.TrustedProxies = "192.0.2.0/24"
+	database.ApplySystemConfig(app)
+}
+
+func TestAuthMe_AuthentikProxyHeaders(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	enableProxyAuth(t, app, "authentik")
+
+	req := newGet("/api/auth/me")
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set("X-authentik-username", "alice")
+	req.Header.Set("X-authentik-groups", "media|admins")
+	req.Header.Set("X-authentik-name", "Alice")
+	w := httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var user models.AuthenticatedUser
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if user.Username != "alice" || user.Source != "authentik" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if len(user.Groups) != 2 || user.Groups[1] != "admins" || !user.IsAdmin {
+		t.Fatalf("expected |-separated groups with admin, got %+v", user)
+	}
+}
+
+func TestAuthMe_ProxyHeadersFromUntrustedIP(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	enableProxyAuth(t, app, "oauth2-proxy")
+
+	req := newGet("/api/auth/me")
+	req.RemoteAddr = "198.51.100.7:4321"
+	req.Header.Set("X-Forwarded-User", "mallory")
+	w := httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestAuthMe_CloudflareAssertion(t *testing.T) {
+	app := setupTestAppWithDB(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"}}}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, mustJSON(jwks), 0600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+
+	app.SystemConfig.ProxyJWKS = jwksPath
+	app.SystemConfig.ProxyJWTIssuer = "https://team.cloudflareaccess.com"
+	app.SystemConfig.ProxyJWTAudience = "aud-tag"
+	enableProxyAuth(t, app, "cloudflare")
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "k1"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	sign := func(aud string) string {
+		payload := mustJSON(map[string]interface{}{
+			"iss":   "https://team.cloudflareaccess.com",
+			"aud":   []string{aud},
+			"sub":   "user-1",
+			"email": "bob@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+		})
+		jws, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		out, _ := jws.CompactSerialize()
+		return out
+	}
+
+	// Valid assertion from an untrusted IP is accepted
+	req := newGet("/api/auth/me")
+	req.RemoteAddr = "198.51.100.7:4321"
+	req.Header.Set("Cf-Access-Jwt-Assertion", sign("aud-tag"))
+	w := httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if m := parseMap(w.Body.Bytes()); m["username"] != "bob@example.com" || m["source"] != "cloudflare" {
+		t.Fatalf("unexpected user: %v", m)
+	}
+
+	// Wrong audience is rejected
+	req = newGet("/api/auth/me")
+	req.Header.Set("Cf-Access-Jwt-Assertion", sign("other-app"))
+	w = httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong audience, got %d", w.Code)
+	}
+
+	// Bare email header without an assertion is rejected
+	req = newGet("/api/auth/me")
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set("Cf-Access-Authenticated-User-Email", "bob@example.com")
+	w = httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without assertion, got %d", w.Code)
+	}
+}
+
+func TestSystemConfig_CloudflareRequiresAudience(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	body := map[string]interface{}{
+		"proxyAuthEnabled": true,
+		"proxyAuthProfile": "cloudflare",
+		"proxyJwks":        "https://team.cloudflareaccess.com/cdn-cgi/access/certs",
+		"smtpSecurity":     "starttls",
+	}
+	w := httptest.NewRecorder()
+	SystemConfigHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/system-config", body), adminUser()))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "audience") {
+		t.Fatalf("expected 400 without an audience, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A config without an audience from elsewhere (e.g. the environment)
+	// gets no verifier, so every assertion is refused
+	app.SystemConfig.ProxyJWKS = "https://team.cloudflareaccess.com/cdn-cgi/access/certs"
+	enableProxyAuth(t, app, "cloudflare")
+	if app.ProxyJWTVerifier != nil {
+		t.Error("expected no verifier without an audience")
+	}
+}
+
 var _ = strings.HasPrefix
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+func TestConfigEnv_LocksSettings(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	secretFile := filepath.Join(t.TempDir(), "oidc_secret")
+	os.WriteFile(secretFile, []byte("from-a-secret\n"), 0600)
+	t.Setenv("DASHGATE_SESSION_DAYS", "30")
+	t.Setenv("DASHGATE_GUEST_MODE_ENABLED", "TRUE")
+	t.Setenv("DASHGATE_OIDC_CLIENT_SECRET_FILE", secretFile)
+	t.Setenv("TRAEFIK_URL", "http://traefik:8080")
+
+	if err := database.LoadConfigEnv(app); err != nil {
+		t.Fatalf("LoadConfigEnv failed: %v", err)
+	}
+	sc := app.SystemConfig
+	if sc.SessionDays != 30 || !sc.GuestModeEnabled || sc.OIDCClientSecret != "from-a-secret" || sc.TraefikURL != "http://traefik:8080" {
+		t.Fatalf("expected environment values to be applied, got %+v", sc)
+	}
+
+	w := httptest.NewRecorder()
+	SystemConfigHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/system-config"), adminUser()))
+	locked, _ := parseMap(w.Body.Bytes())["envLocked"].(map[string]interface{})
+	if locked["session_days"] != "DASHGATE_SESSION_DAYS" || locked["traefik_url"] != "TRAEFIK_URL" || locked["oidc_client_secret"] != "DASHGATE_OIDC_CLIENT_SECRET" {
+		t.Errorf("expected the locked keys and their variables, got %v", locked)
+	}
+
+	w = httptest.NewRecorder()
+	body := map[string]interface{}{"sessionDays": 3, "proxyAuthEnabled": true, "proxyAuthProfile": "authelia", "smtpSecurity": "starttls"}
+	SystemConfigHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/system-config", body), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 saving settings, got %d: %s", w.Code, w.Body.String())
+	}
+	if app.SystemConfig.SessionDays != 30 || !app.SystemConfig.GuestModeEnabled {
+		t.Errorf("expected locked settings to keep their environment values, got session days %d", app.SystemConfig.SessionDays)
+	}
+	var stored int
+	app.DB.QueryRow("SELECT COUNT(*) FROM system_config WHERE key IN ('session_days', 'oidc_client_secret', 'traefik_url')").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("expected values from the environment not to be stored, found %d rows", stored)
+	}
+	var proxy string
+	app.DB.QueryRow("SELECT value FROM system_config WHERE key = 'proxy_auth_enabled'").Scan(&proxy)
+	if proxy != "true" {
+		t.Errorf("expected unlocked settings to be saved, got %q", proxy)
+	}
+}
+
+func TestConfigEnv_InvalidValues(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	t.Setenv("DASHGATE_MAX_SESSIONS", "ten")
+	t.Setenv("DASHGATE_LOCAL_AUTH_ENABLED", "maybe")
+	t.Setenv("DASHGATE_SMTP_PASSWORD", "inline")
+	t.Setenv("DASHGATE_SMTP_PASSWORD_FILE", "/run/secrets/smtp")
+
+	err := database.LoadConfigEnv(app)
+	if err == nil {
+		t.Fatal("expected invalid values to be rejected")
+	}
+	for _, want := range []string{"DASHGATE_MAX_SESSIONS", "DASHGATE_LOCAL_AUTH_ENABLED", "DASHGATE_SMTP_PASSWORD_FILE are both set"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got: %v", want, err)
+		}
+	}
+	if len(app.ConfigEnv) != 0 {
+		t.Error("expected nothing to be locked after an error")
+	}
+}
+
+func TestConfigEnv_LegacySwitchesOnlyTurnOn(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.NginxDiscoveryEnabled = true
+	t.Setenv("DOCKER_DISCOVERY", "true")
+	t.Setenv("NGINX_DISCOVERY", "false")
+	t.Setenv("CADDY_DISCOVERY", "yes")
+
+	if err := database.LoadConfigEnv(app); err != nil {
+		t.Fatalf("expected other values of legacy switches to be ignored, got %v", err)
+	}
+	if !app.SystemConfig.DockerDiscoveryEnabled || !app.SystemConfig.NginxDiscoveryEnabled || app.SystemConfig.CaddyDiscoveryEnabled {
+		t.Errorf("expected only DOCKER_DISCOVERY to have an effect, got %+v", app.SystemConfig)
+	}
+	locks := database.ConfigEnvLocks(app)
+	if locks["docker_discovery_enabled"] != "DOCKER_DISCOVERY" || locks["nginx_discovery_enabled"] != "" || locks["caddy_discovery_enabled"] != "" {
+		t.Errorf("expected only docker discovery to be locked, got %v", locks)
+	}
+}
+
+func TestConfigEnv_DiscoveryLocked(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.DockerDiscovery = server.NewDiscoveryManager()
+	t.Setenv("DASHGATE_DOCKER_DISCOVERY_ENABLED", "false")
+	if err := database.LoadConfigEnv(app); err != nil {
+		t.Fatalf("LoadConfigEnv failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	DockerDiscoveryHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/docker-discovery"), adminUser()))
+	if status := parseMap(w.Body.Bytes()); status["envOverride"] != true || status["envVar"] != "DASHGATE_DOCKER_DISCOVERY_ENABLED" {
+		t.Errorf("expected the env override to be reported, got %v", status)
+	}
+
+	w = httptest.NewRecorder()
+	DockerDiscoveryHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/docker-discovery", map[string]interface{}{"enabled": true}), adminUser()))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 changing a locked source, got %d", w.Code)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"dashgate/internal/auth"
-	"dashgate/internal/config"
 	"dashgate/internal/database"
 	"dashgate/internal/discovery"
 	"dashgate/internal/health"
@@ -17,7 +16,8 @@ import (
 
 // filterAppsByGroups returns only the categories (and apps within them) that the
 // user is allowed to see based on their group membership. Admins see all apps.
-// Apps with no groups assigned are only visible to admins.
+// Apps with no groups assigned are only visible to admins, and apps in a public
+// guest category are also shared with the anonymous group.
 func filterAppsByGroups(sApp *server.App, categories []models.Category, userGroups []string, isAdmin bool) []models.Category {
 	groupSet := make(map[string]bool)
 	for _, g := range userGroups {
@@ -34,7 +34,7 @@ func filterAppsByGroups(sApp *server.App, categories []models.Category, userGrou
 				filteredApps = append(filteredApps, a)
 				continue
 			}
-			appGroups := config.GetAppGroups(sApp, a)
+			appGroups := auth.CatalogAppGroups(sApp, cat.Name, a)
 			// No groups assigned = admin-only
 			if len(appGroups) == 0 {
 				continue
@@ -57,8 +57,123 @@ func filterAppsByGroups(sApp *server.App, categories []models.Category, userGrou
 	return filtered
 }
 
+// visibleCategories returns the configured and discovered apps user may see,
+// with their current health status.
+func visibleCategories(app *server.App, user *models.AuthenticatedUser) []models.Category {
+	app.ConfigMu.RLock()
+	categories := make([]models.Category, len(app.Config.Categories))
+	copy(categories, app.Config.Categories)
+	app.ConfigMu.RUnlock()
+
+	viewerGroups := auth.ViewerGroups(app, user)
+	filteredCategories := filterAppsByGroups(app, categories, viewerGroups, user.IsAdmin)
+
+	// Build set of config app URLs to prevent duplicates with discovered apps
+	configURLs := make(map[string]bool)
+	for _, cat := range filteredCategories {
+		for _, a := range cat.Apps {
+			configURLs[a.URL] = true
+		}
+	}
+
+	// Add discovered apps that have overrides (opt-in model)
+	userGroupSet := make(map[string]bool)
+	for _, g := range viewerGroups {
+		userGroupSet[strings.TrimSpace(g)] = true
+	}
+
+	rawDiscovered := discovery.GetAllRawDiscoveredApps(app)
+	discoveredByCategory := make(map[string][]models.App)
+
+	for _, dApp := range rawDiscovered {
+		// Skip if already in config apps
+		if configURLs[dApp.URL] {
+			continue
+		}
+		// Skip if no override (not configured = not shown)
+		if dApp.Override == nil {
+			continue
+		}
+		// Skip if hidden
+		if dApp.Override.Hidden {
+			continue
+		}
+		// Check group access (admins see all; no groups = visible to all
+		// signed-in users, but not to guests)
+		if auth.IsGuest(user) && len(dApp.Override.Groups) == 0 {
+			continue
+		}
+		if !user.IsAdmin && len(dApp.Override.Groups) > 0 {
+			hasAccess := false
+			for _, g := range dApp.Override.Groups {
+				if userGroupSet[g] {
+					hasAccess = true
+					break
+				}
+			}
+			if !hasAccess {
+				continue
+			}
+		}
+
+		// Apply overrides
+		name := dApp.Name
+		if dApp.Override.NameOverride != "" {
+			name = dApp.Override.NameOverride
+		}
+		appURL := dApp.URL
+		if dApp.Override.URLOverride != "" {
+			appURL = dApp.Override.URLOverride
+		}
+		icon := dApp.Icon
+		if dApp.Override.IconOverride != "" {
+			icon = dApp.Override.IconOverride
+		}
+		desc := dApp.Description
+		if dApp.Override.DescriptionOverride != "" {
+			desc = dApp.Override.DescriptionOverride
+		}
+
+		category := dApp.Override.Category
+		if category == "" {
+			category = "Discovered"
+		}
+
+		a := models.App{
+			Name:        name,
+			URL:         appURL,
+			Icon:        icon,
+			Description: desc,
+			Groups:      dApp.Override.Groups,
+			Status:      health.GetHealthStatus(app, appURL),
+		}
+		discoveredByCategory[category] = append(discoveredByCategory[category], a)
+	}
+
+	// Merge discovered apps into existing categories or create new ones
+	for catName, apps := range discoveredByCategory {
+		merged := false
+		for i, cat := range filteredCategories {
+			if cat.Name == catName {
+				filteredCategories[i].Apps = append(filteredCategories[i].Apps, apps...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			filteredCategories = append(filteredCategories, models.Category{
+				Name: catName,
+				Apps: apps,
+			})
+		}
+	}
+
+	return filteredCategories
+}
+
 // DashboardHandler serves the main DashGate page. It redirects to /setup if
-// first-time setup is needed, and to /login if no user is authenticated.
+// first-time setup is needed, and to /login if no user is authenticated and
+// guest mode is off.
 func DashboardHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -72,7 +187,10 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		user := auth.GetAuthenticatedUser(app, r)
+		user, preview := auth.GetViewingUser(app, r)
+		if user == nil {
+			user = auth.GuestUser(app)
+		}
 		if user == nil {
 			if app.AuthConfig.Mode == models.AuthModeLocal || app.AuthConfig.Mode == models.AuthModeHybrid {
 				http.Redirect(w, r, "/login", http.StatusFound)
@@ -82,108 +200,7 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		app.ConfigMu.RLock()
-		categories := make([]models.Category, len(app.Config.Categories))
-		copy(categories, app.Config.Categories)
-		app.ConfigMu.RUnlock()
-
-		filteredCategories := filterAppsByGroups(app, categories, user.Groups, user.IsAdmin)
-
-		// Build set of config app URLs to prevent duplicates with discovered apps
-		configURLs := make(map[string]bool)
-		for _, cat := range filteredCategories {
-			for _, a := range cat.Apps {
-				configURLs[a.URL] = true
-			}
-		}
-
-		// Add discovered apps that have overrides (opt-in model)
-		userGroupSet := make(map[string]bool)
-		for _, g := range user.Groups {
-			userGroupSet[strings.TrimSpace(g)] = true
-		}
-
-		rawDiscovered := discovery.GetAllRawDiscoveredApps(app)
-		discoveredByCategory := make(map[string][]models.App)
-
-		for _, dApp := range rawDiscovered {
-			// Skip if already in config apps
-			if configURLs[dApp.URL] {
-				continue
-			}
-			// Skip if no override (not configured = not shown)
-			if dApp.Override == nil {
-				continue
-			}
-			// Skip if hidden
-			if dApp.Override.Hidden {
-				continue
-			}
-			// Check group access (admins see all; no groups = visible to all)
-			if !user.IsAdmin && len(dApp.Override.Groups) > 0 {
-				hasAccess := false
-				for _, g := range dApp.Override.Groups {
-					if userGroupSet[g] {
-						hasAccess = true
-						break
-					}
-				}
-				if !hasAccess {
-					continue
-				}
-			}
-
-			// Apply overrides
-			name := dApp.Name
-			if dApp.Override.NameOverride != "" {
-				name = dApp.Override.NameOverride
-			}
-			appURL := dApp.URL
-			if dApp.Override.URLOverride != "" {
-				appURL = dApp.Override.URLOverride
-			}
-			icon := dApp.Icon
-			if dApp.Override.IconOverride != "" {
-				icon = dApp.Override.IconOverride
-			}
-			desc := dApp.Description
-			if dApp.Override.DescriptionOverride != "" {
-				desc = dApp.Override.DescriptionOverride
-			}
-
-			category := dApp.Override.Category
-			if category == "" {
-				category = "Discovered"
-			}
-
-			a := models.App{
-				Name:        name,
-				URL:         appURL,
-				Icon:        icon,
-				Description: desc,
-				Groups:      dApp.Override.Groups,
-				Status:      health.GetHealthStatus(app, appURL),
-			}
-			discoveredByCategory[category] = append(discoveredByCategory[category], a)
-		}
-
-		// Merge discovered apps into existing categories or create new ones
-		for catName, apps := range discoveredByCategory {
-			merged := false
-			for i, cat := range filteredCategories {
-				if cat.Name == catName {
-					filteredCategories[i].Apps = append(filteredCategories[i].Apps, apps...)
-					merged = true
-					break
-				}
-			}
-			if !merged {
-				filteredCategories = append(filteredCategories, models.Category{
-					Name: catName,
-					Apps: apps,
-				})
-			}
-		}
+		filteredCategories := visibleCategories(app, user)
 
 		app.ConfigMu.RLock()
 		title := app.Config.Title
@@ -195,6 +212,13 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 			Categories: filteredCategories,
 			Version:    app.Version,
 		}
+		if preview != nil {
+			data.Preview = preview.Label()
+		}
+		if auth.IsGuest(user) {
+			data.User = ""
+			data.Guest = true
+		}
 
 		// Render template to buffer first to avoid partial writes on error
 		var buf bytes.Buffer
@@ -218,22 +242,20 @@ func HealthHandler(app *server.App) http.HandlerFunc {
 	}
 }
 
-// APIHealthHandler returns JSON with the user's visible apps and their health statuses.
+// APIHealthHandler returns JSON with the user's visible apps, including
+// discovered ones, and their health statuses. Visitors who are not signed in
+// get the public apps while guest mode is on.
 func APIHealthHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := auth.GetAuthenticatedUser(app, r)
+		user, _ := auth.GetViewingUser(app, r)
+		if user == nil {
+			user = auth.GuestUser(app)
+		}
 		if user == nil {
 			respondError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		app.ConfigMu.RLock()
-		categories := make([]models.Category, len(app.Config.Categories))
-		copy(categories, app.Config.Categories)
-		app.ConfigMu.RUnlock()
-
-		filteredCategories := filterAppsByGroups(app, categories, user.Groups, user.IsAdmin)
-
-		respondJSON(w, http.StatusOK, filteredCategories)
+		respondJSON(w, http.StatusOK, visibleCategories(app, user))
 	}
 }
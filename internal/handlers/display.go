@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+	"dashgate/internal/netpolicy"
+	"dashgate/internal/server"
+)
+
+// AdminDisplayTokensHandler handles GET (list) and POST (create) for display
+// tokens. The token is only returned once, when it is created.
+func AdminDisplayTokensHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			tokens, err := database.ListDisplayTokens(app)
+			if err != nil {
+				log.Printf("Error listing display tokens: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, tokens)
+		case http.MethodPost:
+			createDisplayToken(app, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func createDisplayToken(app *server.App, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name            string   `json:"name"`
+		Groups          []string `json:"groups"`
+		AllowedNetworks string   `json:"allowedNetworks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		respondError(w, http.StatusBadRequest, "Name is required and must be at most 100 characters")
+		return
+	}
+	var groups []string
+	for _, g := range req.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		respondError(w, http.StatusBadRequest, "At least one group is required")
+		return
+	}
+	req.AllowedNetworks = strings.TrimSpace(req.AllowedNetworks)
+	if _, err := netpolicy.Parse(req.AllowedNetworks); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		log.Printf("Error generating display token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	adminName := ""
+	if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+		adminName = adminUser.Username
+	}
+
+	id, err := database.CreateDisplayToken(app, req.Name, token, groups, req.AllowedNetworks, adminName)
+	if err != nil {
+		log.Printf("Error creating display token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	audit.LogAudit(app, adminName, "display_token_created", fmt.Sprintf("Created display token %q (id=%d) for groups %s", req.Name, id, strings.Join(groups, ", ")), auth.ClientIP(r))
+
+	path := "/display/" + url.PathEscape(token)
+	app.SysConfigMu.RLock()
+	link := ""
+	if app.SystemConfig.PublicURL != "" {
+		link = strings.TrimRight(app.SystemConfig.PublicURL, "/") + path
+	}
+	app.SysConfigMu.RUnlock()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":   id,
+		"path": path,
+		"url":  link,
+	})
+}
+
+// AdminDisplayTokenHandler revokes a display token
+// (DELETE /api/admin/display-tokens/{id}).
+func AdminDisplayTokenHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+		if r.Method != http.MethodDelete {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/display-tokens/"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid display token ID")
+			return
+		}
+
+		token, err := database.DeleteDisplayToken(app, id)
+		if err == database.ErrDisplayTokenNotFound {
+			respondError(w, http.StatusNotFound, "Display token not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error deleting display token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+		audit.LogAudit(app, adminName, "display_token_revoked", fmt.Sprintf("Revoked display token %q (id=%d)", token.Name, id), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+	}
+}
+
+// DisplayHandler serves the read-only dashboard of a display token: GET
+// /display/{token} renders a full-screen page without settings or menus, and
+// GET /display/{token}/health returns its apps and their health statuses.
+// The token in the path is the only credential, so no cookies are needed and
+// it is never accepted anywhere else.
+func DisplayHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		rest := strings.TrimPrefix(r.URL.Path, "/display/")
+		token, sub, _ := strings.Cut(rest, "/")
+		if app.DB == nil || token == "" || (sub != "" && sub != "health") {
+			http.NotFound(w, r)
+			return
+		}
+		display, err := database.GetDisplayTokenByToken(app, token)
+		if err != nil {
+			if err != database.ErrDisplayTokenNotFound {
+				log.Printf("Error loading display token: %v", err)
+			}
+			http.NotFound(w, r)
+			return
+		}
+		if display.AllowedNetworks != "" {
+			nets, err := netpolicy.Parse(display.AllowedNetworks)
+			if err != nil || !netpolicy.Contains(nets, net.ParseIP(auth.ClientIP(r))) {
+				log.Printf("Display token %q used from %s outside its allowed networks", display.Name, auth.ClientIP(r))
+				respondError(w, http.StatusForbidden, "This display is not allowed from your network")
+				return
+			}
+		}
+
+		// Display tokens never hold admin rights, whatever their groups
+		viewer := &models.AuthenticatedUser{
+			Username:    "display:" + display.Name,
+			DisplayName: display.Name,
+			Groups:      display.Groups,
+			Source:      "display",
+		}
+		categories := visibleCategories(app, viewer)
+
+		if sub == "health" {
+			respondJSON(w, http.StatusOK, categories)
+			return
+		}
+
+		app.ConfigMu.RLock()
+		title := app.Config.Title
+		app.ConfigMu.RUnlock()
+
+		data := map[string]interface{}{
+			"Title":      title,
+			"Name":       display.Name,
+			"Categories": categories,
+			"CSPNonce":   middleware.GetCSPNonce(r),
+			"Version":    app.Version,
+		}
+		var buf bytes.Buffer
+		if err := app.GetTemplates().ExecuteTemplate(&buf, "display.html", data); err != nil {
+			log.Printf("Template error: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
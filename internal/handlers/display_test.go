@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// createDisplay mints a display token through the admin API and returns its path.
+func createDisplay(t *testing.T, app *server.App, body map[string]interface{}) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AdminDisplayTokensHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/display-tokens", body), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 creating a display token, got %d: %s", w.Code, w.Body.String())
+	}
+	return parseMap(w.Body.Bytes())["path"].(string)
+}
+
+func TestDisplay_ShowsGroupAppsWithoutCookies(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	app.Templates = template.Must(template.New("").Funcs(app.TemplateFuncMap).ParseGlob("../../templates/*.html"))
+	path := createDisplay(t, app, map[string]interface{}{"name": "Hallway", "groups": []string{"media", "admins"}})
+
+	w := httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, newGet(path))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Plex") || strings.Contains(body, "Admin Panel") {
+		t.Error("expected the display to show Plex but not admin-only apps")
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("expected the display not to set cookies")
+	}
+
+	w = httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, newGet(path+"/health"))
+	var cats []models.Category
+	json.Unmarshal(w.Body.Bytes(), &cats)
+	if w.Code != http.StatusOK || len(cats) == 0 || cats[0].Apps[0].Name != "Plex" {
+		t.Errorf("expected Plex in the health view, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, newGet("/display/not-a-token"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown token, got %d", w.Code)
+	}
+}
+
+func TestDisplay_TokenRejectedByAPIs(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	app.SystemConfig.APIKeyEnabled = true
+	token := strings.TrimPrefix(createDisplay(t, app, map[string]interface{}{"name": "TV", "groups": []string{"media"}}), "/display/")
+
+	req := newGet("/api/admin/check")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if user := auth.GetAuthenticatedUser(app, req); user != nil {
+		t.Errorf("expected a display token not to authenticate API requests, got %+v", user)
+	}
+	req = newGet("/api/user/profile")
+	req.Header.Set("X-API-Key", token)
+	if user := auth.GetAuthenticatedUser(app, req); user != nil {
+		t.Errorf("expected a display token not to work as an API key, got %+v", user)
+	}
+}
+
+func TestDisplay_NetworksAndRevocation(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	path := createDisplay(t, app, map[string]interface{}{"name": "Kitchen", "groups": []string{"media"}, "allowedNetworks": "10.0.0.0/8"})
+
+	req := newGet(path + "/health")
+	req.RemoteAddr = "203.0.113.9:4000"
+	w := httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 outside the allowed networks, got %d", w.Code)
+	}
+
+	req = newGet(path + "/health")
+	req.RemoteAddr = "10.1.2.3:4000"
+	w = httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from an allowed network, got %d", w.Code)
+	}
+
+	var id int
+	app.DB.QueryRow("SELECT id FROM display_tokens WHERE name = 'Kitchen'").Scan(&id)
+	w = httptest.NewRecorder()
+	AdminDisplayTokenHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/display-tokens/"+strconv.Itoa(id)), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 revoking, got %d", w.Code)
+	}
+
+	req = newGet(path + "/health")
+	req.RemoteAddr = "10.1.2.3:4000"
+	w = httptest.NewRecorder()
+	DisplayHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once revoked, got %d", w.Code)
+	}
+
+	var audits int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action IN ('display_token_created', 'display_token_revoked')").Scan(&audits)
+	if audits != 2 {
+		t.Errorf("expected creation and revocation to be audited, got %d entries", audits)
+	}
+}
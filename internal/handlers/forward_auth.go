@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// ForwardAuthHandler implements the forward-auth contract used by Traefik
+// (ForwardAuth), Caddy (forward_auth) and nginx (auth_request). The proxy
+// sends the original request's URL in X-Original-URL or X-Forwarded-* headers;
+// DashGate answers 200 with Remote-* identity headers when the signed-in user
+// may access the matching app, 401 with a login redirect when nobody is signed
+// in, and 403 otherwise. Hosts that match no known app are admin-only. While
+// guest mode is on, visitors who are not signed in may reach public apps, with
+// an empty Remote-User.
+//
+// Only the session cookie identifies the user: proxies copy the client's
+// headers into the check, so Remote-* headers in it cannot be trusted.
+func ForwardAuthHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		target, ok := auth.ForwardedURL(r.Header.Get)
+		if !ok {
+			respondError(w, http.StatusBadRequest, "Missing X-Original-URL or X-Forwarded-Host header")
+			return
+		}
+
+		protected, found := auth.FindProtectedApp(app, target)
+		user := auth.GetSessionUser(app, r)
+		if user == nil {
+			if guest := auth.GuestUser(app); guest != nil && found && auth.CanAccessApp(app, guest, protected) {
+				user = guest
+			}
+		}
+		if user == nil {
+			loginURL := forwardAuthLoginURL(app, r.URL.Query().Get("rd"), target)
+			w.Header().Set("Location", loginURL)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			escaped := html.EscapeString(loginURL)
+			w.Write([]byte(`<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=` + escaped +
+				`"></head><body><a href="` + escaped + `">Sign in</a></body></html>`))
+			return
+		}
+
+		allowed := user.IsAdmin
+		if found {
+			allowed = auth.CanAccessApp(app, user, protected)
+		}
+		if !allowed {
+			respondError(w, http.StatusForbidden, "Access denied")
+			return
+		}
+
+		w.Header().Set("Remote-User", user.Username)
+		w.Header().Set("Remote-Groups", strings.Join(user.Groups, ","))
+		w.Header().Set("Remote-Name", user.DisplayName)
+		w.Header().Set("Remote-Email", user.Email)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// forwardAuthLoginURL builds the login URL the proxy should send unauthenticated
+// users to. rd is the externally reachable DashGate URL; it is only used when
+// its scheme and host match the Public URL setting or the app being accessed,
+// so the endpoint cannot redirect elsewhere. Otherwise a relative /login is
+// used, which only works when DashGate shares the app's origin.
+func forwardAuthLoginURL(app *server.App, rd string, original *url.URL) string {
+	base := ""
+	if u, err := url.Parse(rd); err == nil && u.Host != "" && trustedLoginOrigin(app, u, original) {
+		base = u.Scheme + "://" + u.Host + strings.TrimSuffix(u.EscapedPath(), "/")
+	}
+	return base + "/login?redirect=" + url.QueryEscape(original.String())
+}
+
+// trustedLoginOrigin reports whether u has the scheme and host of the Public
+// URL setting or of the app being accessed.
+func trustedLoginOrigin(app *server.App, u, original *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if sameOrigin(u, original) {
+		return true
+	}
+	app.SysConfigMu.RLock()
+	publicURL := app.SystemConfig.PublicURL
+	app.SysConfigMu.RUnlock()
+	p, err := url.Parse(publicURL)
+	return publicURL != "" && err == nil && sameOrigin(u, p)
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
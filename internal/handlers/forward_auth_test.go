@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func setupForwardAuthApp(t *testing.T) *server.App {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	app.Config.Categories = []models.Category{{
+		Name: "Media",
+		Apps: []models.App{
+			{Name: "Plex", URL: "https://plex.example.com", Groups: []string{"media"}},
+			{Name: "Admin Panel", URL: "https://tools.example.com/admin"},
+			{Name: "Tools", URL: "https://tools.example.com", Groups: []string{"users"}},
+		},
+	}}
+
+	app.DockerDiscovery = server.NewDiscoveryManager()
+	app.TraefikDiscovery = server.NewDiscoveryManager()
+	app.NginxDiscovery = server.NewDiscoveryManager()
+	app.NPMDiscovery = server.NewDiscoveryManager()
+	app.CaddyDiscovery = server.NewDiscoveryManager()
+	app.UnraidDiscovery = server.NewDiscoveryManager()
+	app.DiscoveredOverrides = map[string]*models.DiscoveredAppOverride{
+		"http://10.0.0.5:8080": {URL: "http://10.0.0.5:8080", URLOverride: "https://wiki.example.com"},
+	}
+	app.DockerDiscovery.Enabled = true
+	app.DockerDiscovery.SetApps([]models.App{{Name: "Wiki", URL: "http://10.0.0.5:8080"}})
+	return app
+}
+
+func seedForwardAuthUser(t *testing.T, app *server.App, username, groupsJSON string) string {
+	t.Helper()
+	userID := seedUser(t, app, username, "letmein", username, false)
+	if _, err := app.DB.Exec("UPDATE users SET groups = ? WHERE id = ?", groupsJSON, userID); err != nil {
+		t.Fatalf("failed to set groups: %v", err)
+	}
+	token := "fwd-session-" + username
+	seedSession(t, app, userID, token)
+	return token
+}
+
+func forwardAuthRequest(token, proto, host, uri string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/verify", nil)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", host)
+	req.Header.Set("X-Forwarded-Uri", uri)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: "test_session", Value: token})
+	}
+	return req
+}
+
+func TestForwardAuth_Allowed(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "alice", `["media"]`)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "plex.example.com", "/web/index.html"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Remote-User"); got != "alice" {
+		t.Errorf("expected Remote-User alice, got %q", got)
+	}
+	if got := w.Header().Get("Remote-Groups"); got != "media" {
+		t.Errorf("expected Remote-Groups media, got %q", got)
+	}
+	if got := w.Header().Get("Remote-Email"); got != "alice@test.local" {
+		t.Errorf("expected Remote-Email alice@test.local, got %q", got)
+	}
+}
+
+func TestForwardAuth_DeniedByGroup(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "bob", `["users"]`)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "plex.example.com", "/"))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestForwardAuth_LongestPathPrefixWins(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "carol", `["users"]`)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "tools.example.com", "/dashboard"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for /dashboard, got %d", w.Code)
+	}
+
+	// /admin belongs to the groupless (admin-only) catalog entry
+	w = httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "tools.example.com", "/admin/users"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for /admin/users, got %d", w.Code)
+	}
+}
+
+func TestForwardAuth_UnknownHostAdminOnly(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "dave", `["media"]`)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "unknown.example.com", "/"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", w.Code)
+	}
+
+	adminToken := seedForwardAuthUser(t, app, "root", `["admins"]`)
+	w = httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(adminToken, "https", "unknown.example.com", "/"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for admin, got %d", w.Code)
+	}
+}
+
+func TestForwardAuth_DiscoveredAppWithoutGroups(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "gina", `[]`)
+
+	// Configured discovered apps without groups are open to every signed-in user
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest(token, "https", "wiki.example.com", "/"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestForwardAuth_UnauthenticatedRedirectsToLogin(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	app.SystemConfig.PublicURL = "https://dash.example.com"
+
+	req := forwardAuthRequest("", "https", "plex.example.com", "/web?x=1")
+	req.URL.RawQuery = "rd=https://dash.example.com"
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	want := "https://dash.example.com/login?redirect=https%3A%2F%2Fplex.example.com%2Fweb%3Fx%3D1"
+	if loc != want {
+		t.Errorf("expected Location %q, got %q", want, loc)
+	}
+}
+
+func TestForwardAuth_ForeignRedirectIgnored(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	app.SystemConfig.PublicURL = "https://dash.example.com"
+
+	for _, rd := range []string{"https://evil.example", "https://dash.example.com@evil.example", "http://dash.example.com", "javascript:alert(1)"} {
+		req := forwardAuthRequest("", "https", "plex.example.com", "/")
+		req.URL.RawQuery = "rd=" + url.QueryEscape(rd)
+		w := httptest.NewRecorder()
+		ForwardAuthHandler(app).ServeHTTP(w, req)
+
+		loc := w.Header().Get("Location")
+		if w.Code != http.StatusUnauthorized || !strings.HasPrefix(loc, "/login?redirect=") || strings.Contains(w.Body.String(), "evil") {
+			t.Errorf("rd=%s: expected a relative login redirect, got %d %q", rd, w.Code, loc)
+		}
+	}
+}
+
+func TestForwardAuth_IgnoresProxyHeaders(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	// Without local sign-in, the proxy is trusted to identify users elsewhere
+	app.SystemConfig.LocalAuthEnabled = false
+	app.SystemConfig.OIDCAuthEnabled = true
+	app.SystemConfig.TrustedProxies = "192.0.2.0/24"
+	database.ApplySystemConfig(app)
+
+	req := forwardAuthRequest("", "https", "plex.example.com", "/")
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set("Remote-User", "admin")
+	req.Header.Set("Remote-Groups", "admins,media")
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Remote-User") != "" {
+		t.Errorf("expected spoofed proxy headers to be ignored, got %d (Remote-User %q)", w.Code, w.Header().Get("Remote-User"))
+	}
+}
+
+func TestForwardAuth_OriginalURLHeader(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	token := seedForwardAuthUser(t, app, "erin", `["media"]`)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/verify", nil)
+	req.Header.Set("X-Original-URL", "https://PLEX.example.com:443/library")
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: token})
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestForwardAuth_MissingHeaders(t *testing.T) {
+	app := setupForwardAuthApp(t)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/verify", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestLoginPost_AbsoluteRedirectToKnownApp(t *testing.T) {
+	app := setupForwardAuthApp(t)
+	seedUser(t, app, "frank", "letmein", "Frank", false)
+
+	for redirect, want := range map[string]string{
+		"https://plex.example.com/web": "https://plex.example.com/web",
+		"https://evil.example.net/":    "/",
+	} {
+		w := httptest.NewRecorder()
+		LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{
+			"username": "frank",
+			"password": "letmein",
+			"redirect": redirect,
+		}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := parseMap(w.Body.Bytes())["redirect"]; got != want {
+			t.Errorf("redirect %q: expected %q, got %v", redirect, want, got)
+		}
+		if !strings.Contains(w.Header().Get("Set-Cookie"), "test_session=") {
+			t.Errorf("expected session cookie to be set")
+		}
+	}
+}
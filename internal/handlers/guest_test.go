@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// setupGuestApp returns an app in guest mode with a public "Lobby" category,
+// Jellyfin shared with the anonymous group, Plex for media members only and
+// a discovered Wiki without groups.
+func setupGuestApp(t *testing.T) *server.App {
+	t.Helper()
+	app := setupForwardAuthApp(t)
+	app.Config.Categories = []models.Category{
+		{Name: "Lobby", Apps: []models.App{{Name: "Weather", URL: "https://weather.example.com"}}},
+		{Name: "Media", Apps: []models.App{
+			{Name: "Jellyfin", URL: "https://jellyfin.example.com", Groups: []string{"anonymous", "media"}},
+			{Name: "Plex", URL: "https://plex.example.com", Groups: []string{"media"}},
+		}},
+	}
+	app.SystemConfig.LocalAuthEnabled = true
+	app.SystemConfig.SetupCompleted = true
+	app.SystemConfig.GuestModeEnabled = true
+	app.SystemConfig.GuestCategories = "lobby"
+	return app
+}
+
+func TestGuestMode_PublicAppsOnly(t *testing.T) {
+	app := setupGuestApp(t)
+
+	if guest := healthAppNames(t, app); !slices.Equal(guest, []string{"Weather", "Jellyfin"}) {
+		t.Errorf("expected guests to see Weather and Jellyfin only, got %v", guest)
+	}
+
+	session := &http.Cookie{Name: "test_session", Value: seedForwardAuthUser(t, app, "alice", `["media"]`)}
+	if signedIn := healthAppNames(t, app, session); !slices.Equal(signedIn, []string{"Weather", "Jellyfin", "Plex", "Wiki"}) {
+		t.Errorf("expected alice to see every app, got %v", signedIn)
+	}
+
+	app.SystemConfig.GuestModeEnabled = false
+	w := httptest.NewRecorder()
+	APIHealthHandler(app).ServeHTTP(w, newGet("/api/health"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with guest mode off, got %d", w.Code)
+	}
+	if signedIn := healthAppNames(t, app, session); slices.Contains(signedIn, "Weather") {
+		t.Error("expected the public category to be admin-only again with guest mode off")
+	}
+}
+
+func TestGuestMode_ForwardAuth(t *testing.T) {
+	app := setupGuestApp(t)
+
+	w := httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest("", "https", "jellyfin.example.com", "/"))
+	if w.Code != http.StatusOK || w.Header().Get("Remote-User") != "" {
+		t.Errorf("expected guests through to Jellyfin anonymously, got %d user=%q", w.Code, w.Header().Get("Remote-User"))
+	}
+
+	w = httptest.NewRecorder()
+	ForwardAuthHandler(app).ServeHTTP(w, forwardAuthRequest("", "https", "plex.example.com", "/"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected guests to be sent to sign in for Plex, got %d", w.Code)
+	}
+}
+
+func TestGuestMode_LoginRedirect(t *testing.T) {
+	app := setupGuestApp(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := middleware.AutoLoginRedirect(app, next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGet("/"))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected guests to reach the dashboard, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newGet("/api/user/profile"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for user APIs, got %d", w.Code)
+	}
+
+	app.SystemConfig.GuestModeEnabled = false
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newGet("/"))
+	if w.Code != http.StatusFound {
+		t.Errorf("expected a login redirect with guest mode off, got %d", w.Code)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"dashgate/internal/auth"
 	"dashgate/internal/crypto"
+	"dashgate/internal/database"
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 
@@ -40,6 +41,9 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		password_hash TEXT NOT NULL,
 		display_name TEXT,
 		groups TEXT DEFAULT '[]',
+		granted_groups TEXT NOT NULL DEFAULT '[]',
+		disabled INTEGER NOT NULL DEFAULT 0,
+		external_id TEXT NOT NULL DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -49,6 +53,11 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		token TEXT UNIQUE NOT NULL,
 		expires_at DATETIME NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		auth_source TEXT NOT NULL DEFAULT '',
+		last_seen_at DATETIME,
+		id_token TEXT NOT NULL DEFAULT '',
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);
 	CREATE TABLE IF NOT EXISTS system_config (
@@ -56,6 +65,11 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		value TEXT NOT NULL,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS encryption_keys (
+		key_name TEXT PRIMARY KEY,
+		key_value TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	CREATE TABLE IF NOT EXISTS api_keys (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
@@ -67,12 +81,34 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		permissions TEXT DEFAULT '["read"]',
 		expires_at DATETIME,
 		last_used_at DATETIME,
+		allowed_networks TEXT NOT NULL DEFAULT '',
+		personal INTEGER NOT NULL DEFAULT 0,
+		reminder_sent_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
 	);
 	CREATE TABLE IF NOT EXISTS oidc_states (
 		state TEXT PRIMARY KEY,
 		redirect_url TEXT,
+		invite_id INTEGER NOT NULL DEFAULT 0,
+		code_verifier TEXT NOT NULL DEFAULT '',
+		nonce TEXT NOT NULL DEFAULT '',
+		provider_id TEXT NOT NULL DEFAULT '',
+		link_user_id INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS oidc_providers (
+		id TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL,
+		issuer TEXT NOT NULL,
+		client_id TEXT NOT NULL,
+		client_secret TEXT NOT NULL DEFAULT '',
+		redirect_url TEXT NOT NULL DEFAULT '',
+		scopes TEXT NOT NULL DEFAULT '',
+		groups_claim TEXT NOT NULL DEFAULT '',
+		group_mapping TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		sort_order INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE TABLE IF NOT EXISTS user_preferences (
@@ -88,7 +124,9 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		username TEXT,
 		action TEXT,
 		detail TEXT,
-		ip TEXT
+		ip TEXT,
+		prev_hash TEXT NOT NULL DEFAULT '',
+		hash TEXT NOT NULL DEFAULT ''
 	);
 	CREATE TABLE IF NOT EXISTS discovered_app_overrides (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -104,6 +142,117 @@ func setupTestAppWithDB(t testing.TB) *server.App {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		username TEXT PRIMARY KEY,
+		failed_count INTEGER NOT NULL DEFAULT 0,
+		last_failed_at DATETIME,
+		locked_until DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS password_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT UNIQUE NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		groups TEXT NOT NULL DEFAULT '[]',
+		note TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		used_by TEXT NOT NULL DEFAULT '',
+		revoked_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME,
+		UNIQUE (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS network_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		target TEXT NOT NULL,
+		networks TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS idp_clients (
+		client_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		secret_hash TEXT NOT NULL,
+		redirect_uris TEXT NOT NULL DEFAULT '[]',
+		allowed_groups TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS idp_auth_codes (
+		code TEXT PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		redirect_uri TEXT NOT NULL,
+		scope TEXT NOT NULL,
+		nonce TEXT NOT NULL DEFAULT '',
+		code_challenge TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (client_id) REFERENCES idp_clients(client_id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS idp_signing_keys (
+		kid TEXT PRIMARY KEY,
+		private_key TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS access_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		app_name TEXT NOT NULL,
+		groups TEXT NOT NULL DEFAULT '[]',
+		reason TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		decided_by TEXT NOT NULL DEFAULT '',
+		decided_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS group_grants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		group_name TEXT NOT NULL,
+		granted_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS display_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		token_prefix TEXT NOT NULL,
+		groups TEXT NOT NULL DEFAULT '[]',
+		allowed_networks TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	);
 	CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 	CREATE TABLE IF NOT EXISTS managed_groups (
@@ -171,7 +320,7 @@ func seedSession(t testing.TB, app *server.App, userID int, token string) {
 	t.Helper()
 	_, err := app.DB.Exec(
 		"INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, datetime('now', '+7 days'))",
-		userID, token,
+		userID, database.HashToken(token),
 	)
 	if err != nil {
 		t.Fatalf("failed to seed session: %v", err)
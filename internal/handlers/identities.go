@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// identityLinkOption is a provider the signed-in user can link to their
+// account.
+type identityLinkOption struct {
+	Provider    string `json:"provider"`
+	DisplayName string `json:"displayName"`
+	LinkURL     string `json:"linkURL,omitempty"`
+}
+
+// UserIdentitiesHandler manages the external sign-ins linked to the
+// signed-in user's account: GET /api/user/identities lists them with the
+// providers that can be linked, POST /api/user/identities/ldap links an LDAP
+// account after checking its password, and DELETE /api/user/identities/{id}
+// unlinks one. OIDC providers are linked by visiting their linkURL.
+func UserIdentitiesHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.UserFromContext(r.Context())
+		if user == nil {
+			respondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Proxy and API key users have no DashGate account to link to
+		row, err := database.GetUserByUsername(app, user.Username)
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "No DashGate account to link to")
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up user: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/identities"), "/")
+
+		switch {
+		case r.Method == http.MethodGet && idPart == "":
+			listIdentities(app, w, row)
+
+		case r.Method == http.MethodPost && idPart == "ldap":
+			linkLDAPIdentity(app, w, r, row)
+
+		case r.Method == http.MethodDelete && idPart != "":
+			identityID, err := strconv.Atoi(idPart)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid identity ID")
+				return
+			}
+			unlinkIdentity(app, w, r, row, identityID)
+
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func listIdentities(app *server.App, w http.ResponseWriter, row *database.UserRow) {
+	identities, err := database.ListUserIdentities(app, row.ID)
+	if err != nil {
+		log.Printf("Error listing identities: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	providers := []identityLinkOption{}
+	for _, o := range oidcLoginOptions(app) {
+		provider := "oidc"
+		if o.ID != "" {
+			provider = "oidc:" + o.ID
+		}
+		providers = append(providers, identityLinkOption{Provider: provider, DisplayName: o.DisplayName, LinkURL: o.LoginURL + "?link=1"})
+	}
+	app.SysConfigMu.RLock()
+	if app.SystemConfig.LDAPAuthEnabled && app.LDAPAuth != nil {
+		providers = append(providers, identityLinkOption{Provider: "ldap", DisplayName: "LDAP"})
+	}
+	app.SysConfigMu.RUnlock()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"identities":  identities,
+		"providers":   providers,
+		"hasPassword": hasLocalPassword(row.PasswordHash),
+	})
+}
+
+// linkLDAPIdentity links an LDAP account to the user. The LDAP password is
+// checked like a sign-in, including the lockout on repeated failures.
+func linkLDAPIdentity(app *server.App, w http.ResponseWriter, r *http.Request, row *database.UserRow) {
+	app.SysConfigMu.RLock()
+	ldapEnabled := app.SystemConfig.LDAPAuthEnabled && app.LDAPAuth != nil
+	app.SysConfigMu.RUnlock()
+	if !ldapEnabled {
+		respondError(w, http.StatusBadRequest, "LDAP authentication is not enabled")
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "Username and password required")
+		return
+	}
+	if auth.IsAccountLocked(app, req.Username) {
+		respondError(w, http.StatusTooManyRequests, "Too many failed attempts. Try again later.")
+		return
+	}
+
+	ldapUser, err := auth.AuthenticateLDAP(app, req.Username, req.Password)
+	if err != nil {
+		auth.RecordLoginFailure(app, r, req.Username)
+		respondError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	auth.RecordLoginSuccess(app, req.Username)
+
+	subject := auth.LDAPSubject(req.Username)
+	err = database.LinkIdentity(app, row.ID, "ldap", subject, ldapUser.Email)
+	if err == database.ErrIdentityLinked {
+		audit.LogAudit(app, row.Username, "identity_conflict", fmt.Sprintf("Linking ldap (subject %s) refused: linked to another account", subject), auth.ClientIP(r))
+		respondError(w, http.StatusConflict, "This LDAP account is already linked to another user")
+		return
+	}
+	if err != nil {
+		log.Printf("Error linking identity: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	audit.LogAudit(app, row.Username, "identity_linked", fmt.Sprintf("Linked ldap (subject %s)", subject), auth.ClientIP(r))
+	respondJSON(w, http.StatusOK, map[string]string{"status": "linked"})
+}
+
+// unlinkIdentity removes one of the user's identities, refusing to remove
+// the last way to sign in to an account without a password.
+func unlinkIdentity(app *server.App, w http.ResponseWriter, r *http.Request, row *database.UserRow, identityID int) {
+	identities, err := database.ListUserIdentities(app, row.ID)
+	if err != nil {
+		log.Printf("Error listing identities: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	var target *models.Identity
+	for i := range identities {
+		if identities[i].ID == identityID {
+			target = &identities[i]
+		}
+	}
+	if target == nil {
+		respondError(w, http.StatusNotFound, "Identity not found")
+		return
+	}
+	if len(identities) == 1 && !hasLocalPassword(row.PasswordHash) {
+		respondError(w, http.StatusConflict, "This is the only way to sign in to your account. Link another sign-in first.")
+		return
+	}
+
+	if _, err := database.DeleteUserIdentity(app, row.ID, identityID); err != nil {
+		log.Printf("Error unlinking identity: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	audit.LogAudit(app, row.Username, "identity_unlinked", fmt.Sprintf("Unlinked %s (subject %s)", target.Provider, target.Subject), auth.ClientIP(r))
+	respondJSON(w, http.StatusOK, map[string]string{"status": "unlinked"})
+}
+
+// hasLocalPassword reports whether a stored password hash is a real
+// password rather than the marker of an externally managed account.
+func hasLocalPassword(passwordHash string) bool {
+	switch passwordHash {
+	case "", "LDAP_USER", "OIDC_USER", database.ProvisionedPasswordHash:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+)
+
+func TestResolveExternalUser_ConflictPolicy(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedUser(t, app, "alice", "password123", "Alice", false)
+
+	// A new OIDC subject cannot take over a local account by username
+	_, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-alice", Username: "alice"})
+	if err != auth.ErrIdentityConflict {
+		t.Fatalf("expected a conflict for a local account, got %v", err)
+	}
+
+	bobID, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-bob", Username: "bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("expected a new account, got %v", err)
+	}
+
+	// Nor can a second subject claim an account already linked to another
+	if _, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc:other", Subject: "sub-evil", Username: "bob"}); err != auth.ErrIdentityConflict {
+		t.Errorf("expected a conflict for a linked account, got %v", err)
+	}
+
+	// The linked subject keeps signing in to bob after a rename upstream
+	id, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-bob", Username: "robert", DisplayName: "Robert"})
+	if err != nil || id != bobID {
+		t.Fatalf("expected the linked account %d, got %d (%v)", bobID, id, err)
+	}
+	if username, _ := database.GetUsernameByID(app, bobID); username != "bob" {
+		t.Errorf("expected the username to stay bob, got %q", username)
+	}
+
+	// Accounts created by the same kind of provider before identities
+	// existed are adopted once
+	app.DB.Exec("INSERT INTO users (username, password_hash, groups) VALUES ('carol', 'OIDC_USER', '[]')")
+	if _, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-carol", Username: "carol"}); err != nil {
+		t.Errorf("expected a legacy OIDC account to be adopted, got %v", err)
+	}
+	if _, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "ldap", Subject: "carol", Username: "carol"}); err != auth.ErrIdentityConflict {
+		t.Errorf("expected LDAP not to adopt an OIDC account, got %v", err)
+	}
+
+	// Only the primary OIDC provider adopts them, as it cannot be told
+	// which provider created them
+	app.DB.Exec("INSERT INTO users (username, password_hash, groups) VALUES ('dan', 'OIDC_USER', '[]')")
+	if _, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc:other", Subject: "sub-dan", Username: "dan"}); err != auth.ErrIdentityConflict {
+		t.Errorf("expected an additional provider not to adopt a legacy OIDC account, got %v", err)
+	}
+}
+
+func TestResolveExternalUser_LinkedAccountKeepsProfile(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	aliceID := seedUser(t, app, "alice", "password123", "Alice", true)
+	if err := database.LinkIdentity(app, aliceID, "oidc", "sub-alice", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ext := auth.ExternalIdentity{Provider: "oidc", Subject: "sub-alice", Username: "alice", Email: "a@idp.example", DisplayName: "IdP Alice", Groups: []string{"guests"}}
+	if id, err := auth.ResolveExternalUser(app, ext); err != nil || id != aliceID {
+		t.Fatalf("expected alice's account, got %d (%v)", id, err)
+	}
+	user, _ := database.GetUserByID(app, aliceID)
+	if user.GroupsJSON != `["admins"]` || user.Email != "alice@test.local" || user.DisplayName != "Alice" {
+		t.Errorf("expected a linked local account to keep its profile, got %+v", user)
+	}
+
+	// An account the provider created follows it, but not a provider
+	// linked to it later
+	bobID, err := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-bob", Username: "bob", Groups: []string{"media"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.LinkIdentity(app, bobID, "oidc:other", "other-bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc:other", Subject: "other-bob", Username: "bob", Groups: []string{"admins"}})
+	if user, _ := database.GetUserByID(app, bobID); user.GroupsJSON != `["media"]` {
+		t.Errorf("expected a linked provider not to change bob's groups, got %s", user.GroupsJSON)
+	}
+	auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-bob", Username: "bob", Groups: []string{"media", "kids"}})
+	if user, _ := database.GetUserByID(app, bobID); user.GroupsJSON != `["media","kids"]` {
+		t.Errorf("expected the creating provider to update bob's groups, got %s", user.GroupsJSON)
+	}
+}
+
+func TestUserIdentities_ListAndUnlink(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	aliceID := seedUser(t, app, "alice", "password123", "Alice", false)
+	alice := &models.AuthenticatedUser{Username: "alice"}
+
+	if err := database.LinkIdentity(app, aliceID, "oidc", "sub-alice", "alice@example.com"); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	bobID, _ := auth.ResolveExternalUser(app, auth.ExternalIdentity{Provider: "oidc", Subject: "sub-bob", Username: "bob"})
+	if err := database.LinkIdentity(app, bobID, "oidc", "sub-alice", ""); err != database.ErrIdentityLinked {
+		t.Errorf("expected linking someone else's identity to fail, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	UserIdentitiesHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/user/identities"), alice))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := parseMap(w.Body.Bytes())
+	identities := resp["identities"].([]interface{})
+	if len(identities) != 1 || resp["hasPassword"] != true {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	identityID := int(identities[0].(map[string]interface{})["id"].(float64))
+
+	// Bob has no password, so his only identity cannot be removed
+	bobIdentities, _ := database.ListUserIdentities(app, bobID)
+	w = httptest.NewRecorder()
+	UserIdentitiesHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/user/identities/"+strconv.Itoa(bobIdentities[0].ID)), &models.AuthenticatedUser{Username: "bob"}))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 removing the last sign-in method, got %d", w.Code)
+	}
+
+	// Nor can alice remove bob's identity
+	w = httptest.NewRecorder()
+	UserIdentitiesHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/user/identities/"+strconv.Itoa(bobIdentities[0].ID)), alice))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's identity, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	UserIdentitiesHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/user/identities/"+strconv.Itoa(identityID)), alice))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, _ := database.CountUserIdentities(app, aliceID); n != 0 {
+		t.Errorf("expected the identity to be unlinked, got %d left", n)
+	}
+}
+
+func TestOIDC_LinkToSignedInAccount(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	aliceID := seedUser(t, app, "alice", "password123", "Alice", false)
+	provider.idClaims = map[string]interface{}{"sub": "sso-42", "preferred_username": "alice.sso", "email": "alice@example.com"}
+
+	// Linking needs a signed-in user
+	w := httptest.NewRecorder()
+	auth.OIDCAuthHandler(app).ServeHTTP(w, newGet("/auth/oidc?link=1"))
+	if w.Header().Get("Location") != "/login" {
+		t.Fatalf("expected anonymous linking to go to the login page, got %q", w.Header().Get("Location"))
+	}
+
+	seedSession(t, app, aliceID, "alice-session")
+	cookie := &http.Cookie{Name: app.AuthConfig.CookieName, Value: "alice-session"}
+	start := newGet("/auth/oidc?link=1")
+	start.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	auth.OIDCAuthHandler(app).ServeHTTP(w, start)
+	code, state := provider.authorize(t, w.Header().Get("Location"))
+
+	callback := newGet("/auth/oidc/callback?code=" + url.QueryEscape(code) + "&state=" + url.QueryEscape(state))
+	callback.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	auth.OIDCCallbackHandler(app).ServeHTTP(w, callback)
+	if w.Header().Get("Location") != "/?identity=linked" {
+		t.Fatalf("expected the link to succeed, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// Signing in with the provider now reaches alice, not a new alice.sso
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Header().Get("Location") != "/" {
+		t.Fatalf("expected sign-in to succeed, got %q", w.Header().Get("Location"))
+	}
+	var users, sessions int
+	app.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'alice.sso'").Scan(&users)
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", aliceID).Scan(&sessions)
+	if users != 0 || sessions != 2 {
+		t.Errorf("expected the sign-in to use alice's account, got %d new users and %d sessions", users, sessions)
+	}
+}
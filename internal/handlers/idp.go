@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/idp"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// idpCodeLifetime is how long a client has to exchange an authorization code.
+const idpCodeLifetime = 5 * time.Minute
+
+// idpScopes are the scopes the provider understands. Others are dropped.
+var idpScopes = []string{"openid", "profile", "email", "groups"}
+
+// idpIssuer returns the provider's issuer URL, or "" when no public URL is
+// configured and the provider is therefore unavailable.
+func idpIssuer(app *server.App) string {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	return strings.TrimRight(app.SystemConfig.PublicURL, "/")
+}
+
+// requireIDP writes an error and returns "" unless the provider can serve
+// requests.
+func requireIDP(app *server.App, w http.ResponseWriter) string {
+	if app.DB == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return ""
+	}
+	issuer := idpIssuer(app)
+	if issuer == "" {
+		respondError(w, http.StatusNotFound, "OpenID provider is not available until a public URL is set")
+	}
+	return issuer
+}
+
+func respondOAuthError(w http.ResponseWriter, status int, code, description string) {
+	respondJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// IDPDiscoveryHandler serves the OpenID provider metadata at
+// /.well-known/openid-configuration.
+func IDPDiscoveryHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		issuer := requireIDP(app, w)
+		if issuer == "" {
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/oauth2/authorize",
+			"token_endpoint":                        issuer + "/oauth2/token",
+			"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+			"jwks_uri":                              issuer + "/oauth2/jwks",
+			"response_types_supported":              []string{"code"},
+			"grant_types_supported":                 []string{"authorization_code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"scopes_supported":                      idpScopes,
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+			"claims_supported":                      []string{"sub", "name", "preferred_username", "email", "groups"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	}
+}
+
+// IDPJWKSHandler serves the public key tokens are signed with.
+func IDPJWKSHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requireIDP(app, w) == "" {
+			return
+		}
+		keys, err := idp.JWKS(app)
+		if err != nil {
+			log.Printf("Error loading OpenID provider signing key: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		respondJSON(w, http.StatusOK, keys)
+	}
+}
+
+// IDPAuthorizeHandler starts the authorization code flow. Signed-out users
+// are sent to the login page and brought back afterwards; signed-in users
+// in one of the client's allowed groups are redirected straight back to the
+// client with a code. There is no consent screen, as every client is
+// registered by an administrator.
+func IDPAuthorizeHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requireIDP(app, w) == "" {
+			return
+		}
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Problems with the client or redirect URI are shown to the user,
+		// as redirecting would hand the response to an unverified URL
+		q := r.URL.Query()
+		client, err := database.GetIDPClient(app, q.Get("client_id"))
+		if err == database.ErrIDPClientNotFound {
+			respondError(w, http.StatusBadRequest, "Unknown client")
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading OIDC client: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		redirectURI := q.Get("redirect_uri")
+		if !slices.Contains(client.RedirectURIs, redirectURI) {
+			respondError(w, http.StatusBadRequest, "redirect_uri is not registered for this client")
+			return
+		}
+
+		reply := func(params url.Values) {
+			if state := q.Get("state"); state != "" {
+				params.Set("state", state)
+			}
+			target, _ := url.Parse(redirectURI)
+			query := target.Query()
+			for k, v := range params {
+				query[k] = v
+			}
+			target.RawQuery = query.Encode()
+			http.Redirect(w, r, target.String(), http.StatusFound)
+		}
+		fail := func(code, description string) {
+			reply(url.Values{"error": {code}, "error_description": {description}})
+		}
+
+		if q.Get("response_type") != "code" {
+			fail("unsupported_response_type", "Only the authorization code flow is supported")
+			return
+		}
+		var scopes []string
+		for _, s := range strings.Fields(q.Get("scope")) {
+			if slices.Contains(idpScopes, s) && !slices.Contains(scopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+		if !slices.Contains(scopes, "openid") {
+			fail("invalid_scope", "The openid scope is required")
+			return
+		}
+		challenge := q.Get("code_challenge")
+		if challenge != "" && q.Get("code_challenge_method") != "S256" {
+			fail("invalid_request", "Only the S256 code challenge method is supported")
+			return
+		}
+
+		user := auth.GetAuthenticatedUser(app, r)
+		if user == nil || user.Source == "apikey" {
+			if q.Get("prompt") == "none" {
+				fail("login_required", "The user is not signed in")
+				return
+			}
+			back := "/oauth2/authorize?" + q.Encode()
+			http.Redirect(w, r, "/login?redirect="+url.QueryEscape(back), http.StatusFound)
+			return
+		}
+
+		// Tokens carry the user's ID, so proxy-only users cannot sign in
+		row, err := database.GetUserByUsername(app, user.Username)
+		if err == sql.ErrNoRows || (err == nil && row.Disabled) {
+			fail("access_denied", "No active DashGate account")
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up user: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !idpClientAllows(client, idpUserGroups(app, row)) {
+			audit.LogAudit(app, row.Username, "oidc_client_denied", fmt.Sprintf("Denied sign-in to OIDC client %s: not in an allowed group", client.ClientID), auth.ClientIP(r))
+			fail("access_denied", "You are not allowed to use this app")
+			return
+		}
+
+		code, err := auth.GenerateSessionToken()
+		if err != nil {
+			log.Printf("Error generating authorization code: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := database.CreateIDPAuthCode(app, code, database.IDPAuthCode{
+			ClientID:      client.ClientID,
+			UserID:        row.ID,
+			RedirectURI:   redirectURI,
+			Scope:         strings.Join(scopes, " "),
+			Nonce:         q.Get("nonce"),
+			CodeChallenge: challenge,
+			ExpiresAt:     time.Now().Add(idpCodeLifetime),
+		}); err != nil {
+			log.Printf("Error storing authorization code: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		reply(url.Values{"code": {code}})
+	}
+}
+
+// IDPTokenHandler exchanges an authorization code for an ID token and an
+// access token. Clients authenticate with client_secret_basic or
+// client_secret_post. Refresh tokens are not issued.
+func IDPTokenHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		issuer := requireIDP(app, w)
+		if issuer == "" {
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+			return
+		}
+
+		clientID, secret, basic := r.BasicAuth()
+		if basic {
+			// RFC 6749 form-encodes the credentials before base64
+			clientID, _ = url.QueryUnescape(clientID)
+			secret, _ = url.QueryUnescape(secret)
+		} else {
+			clientID = r.PostForm.Get("client_id")
+			secret = r.PostForm.Get("client_secret")
+		}
+		if clientID == "" || !database.IDPClientSecretMatches(app, clientID, secret) {
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="dashgate"`)
+			}
+			respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return
+		}
+
+		if r.PostForm.Get("grant_type") != "authorization_code" {
+			respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only the authorization_code grant is supported")
+			return
+		}
+		grant, err := database.ConsumeIDPAuthCode(app, r.PostForm.Get("code"))
+		if err == sql.ErrNoRows {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Unknown, used or expired code")
+			return
+		}
+		if err != nil {
+			log.Printf("Error consuming authorization code: %v", err)
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+			return
+		}
+		if grant.ClientID != clientID || grant.RedirectURI != r.PostForm.Get("redirect_uri") {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Code was issued to another client or redirect URI")
+			return
+		}
+		if grant.CodeChallenge != "" {
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(grant.CodeChallenge)) != 1 {
+				respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Code verifier does not match")
+				return
+			}
+		}
+
+		row, err := database.GetUserByID(app, grant.UserID)
+		if err != nil || row.Disabled {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "User is no longer active")
+			return
+		}
+
+		claims := idpUserClaims(app, row, grant.Scope)
+		idToken, err := idp.SignIDToken(app, issuer, clientID, claims, grant.Nonce)
+		if err != nil {
+			log.Printf("Error signing ID token: %v", err)
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+			return
+		}
+		accessToken, err := idp.SignAccessToken(app, issuer, clientID, claims.Subject, grant.Scope)
+		if err != nil {
+			log.Printf("Error signing access token: %v", err)
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+			return
+		}
+
+		audit.LogAudit(app, row.Username, "oidc_client_login", "Signed in to OIDC client "+clientID, auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(idp.TokenLifetime.Seconds()),
+			"id_token":     idToken,
+			"scope":        grant.Scope,
+		})
+	}
+}
+
+// IDPUserInfoHandler returns the claims of the user an access token was
+// issued for. The user is reloaded, so deactivated users and group changes
+// take effect before the token expires.
+func IDPUserInfoHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		issuer := requireIDP(app, w)
+		if issuer == "" {
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		unauthorized := func() {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondOAuthError(w, http.StatusUnauthorized, "invalid_token", "Invalid or expired access token")
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			unauthorized()
+			return
+		}
+		claims, err := idp.VerifyAccessToken(app, issuer, token)
+		if err != nil {
+			if err != idp.ErrInvalidToken {
+				log.Printf("Error verifying access token: %v", err)
+			}
+			unauthorized()
+			return
+		}
+		// Deleting a client revokes the tokens issued to it
+		if _, err := database.GetIDPClient(app, claims.ClientID); err != nil {
+			unauthorized()
+			return
+		}
+		userID, _ := strconv.Atoi(claims.Subject)
+		row, err := database.GetUserByID(app, userID)
+		if err != nil || row.Disabled {
+			unauthorized()
+			return
+		}
+		respondJSON(w, http.StatusOK, idpUserClaims(app, row, claims.Scope))
+	}
+}
+
+// idpUserGroups returns the groups of a user's account together with those
+// from unexpired temporary grants.
+func idpUserGroups(app *server.App, row *database.UserRow) []string {
+	var groups []string
+	json.Unmarshal([]byte(row.GroupsJSON), &groups)
+	granted, err := database.ActiveGrantedGroups(app, row.Username)
+	if err != nil {
+		log.Printf("Error loading group grants for %q: %v", row.Username, err)
+	}
+	for _, g := range granted {
+		if !slices.Contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// idpClientAllows reports whether a user in groups may sign in to a client.
+// Clients without allowed groups are open to every active user.
+func idpClientAllows(client *models.IDPClient, groups []string) bool {
+	if len(client.AllowedGroups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		if slices.Contains(client.AllowedGroups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// idpUserClaims returns the claims of a user that the granted scopes
+// release.
+func idpUserClaims(app *server.App, row *database.UserRow, scope string) idp.UserClaims {
+	claims := idp.UserClaims{Subject: strconv.Itoa(row.ID)}
+	for _, s := range strings.Fields(scope) {
+		switch s {
+		case "profile":
+			claims.PreferredUsername = row.Username
+			claims.Name = row.DisplayName
+			if claims.Name == "" {
+				claims.Name = row.Username
+			}
+		case "email":
+			claims.Email = row.Email
+		case "groups":
+			claims.Groups = idpUserGroups(app, row)
+		}
+	}
+	return claims
+}
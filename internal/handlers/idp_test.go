@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/idp"
+	"dashgate/internal/server"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+const testIssuer = "https://dash.example.com"
+
+// setupIDPApp returns an app with a public URL, a "grafana" client limited to
+// the media group and a signed-in user "alice" in that group.
+func setupIDPApp(t *testing.T) (app *server.App, aliceID int, secret string) {
+	t.Helper()
+	app = setupTestAppWithDB(t)
+	app.SystemConfig.LocalAuthEnabled = true
+	app.SystemConfig.PublicURL = testIssuer + "/"
+	aliceID = seedUser(t, app, "alice", "pass", "Alice", false)
+	app.DB.Exec(`UPDATE users SET groups = '["family","media"]', email = 'alice@example.com' WHERE id = ?`, aliceID)
+	seedSession(t, app, aliceID, "alice-session")
+
+	w := httptest.NewRecorder()
+	AdminOIDCClientsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/oidc-clients", map[string]interface{}{
+		"clientID":      "grafana",
+		"name":          "Grafana",
+		"redirectURIs":  []string{"https://grafana.example.com/login/generic_oauth"},
+		"allowedGroups": []string{"media"},
+	}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 registering client, got %d: %s", w.Code, w.Body.String())
+	}
+	return app, aliceID, parseMap(w.Body.Bytes())["clientSecret"].(string)
+}
+
+// authorize runs the authorize endpoint as the holder of session and returns
+// the redirect it answered with.
+func authorize(t *testing.T, app *server.App, session string, params url.Values) *url.URL {
+	t.Helper()
+	req := newGet("/oauth2/authorize?" + params.Encode())
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "test_session", Value: session})
+	}
+	w := httptest.NewRecorder()
+	IDPAuthorizeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	return loc
+}
+
+func authorizeParams() url.Values {
+	return url.Values{
+		"client_id":     {"grafana"},
+		"redirect_uri":  {"https://grafana.example.com/login/generic_oauth"},
+		"response_type": {"code"},
+		"scope":         {"openid profile email groups"},
+		"state":         {"xyz"},
+		"nonce":         {"n-0S6"},
+	}
+}
+
+func exchangeCode(app *server.App, secret string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("grant_type", "authorization_code")
+	form.Set("redirect_uri", "https://grafana.example.com/login/generic_oauth")
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("grafana", secret)
+	w := httptest.NewRecorder()
+	IDPTokenHandler(app).ServeHTTP(w, req)
+	return w
+}
+
+func TestIDP_AuthorizationCodeFlow(t *testing.T) {
+	app, aliceID, secret := setupIDPApp(t)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	params := authorizeParams()
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	params.Set("code_challenge_method", "S256")
+
+	loc := authorize(t, app, "alice-session", params)
+	code := loc.Query().Get("code")
+	if loc.Host != "grafana.example.com" || code == "" || loc.Query().Get("state") != "xyz" {
+		t.Fatalf("expected a code for grafana, got %s", loc)
+	}
+
+	if w := exchangeCode(app, secret, url.Values{"code": {code}, "code_verifier": {"wrong"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a bad verifier to fail, got %d", w.Code)
+	}
+
+	// The failed exchange used up the code
+	code = authorize(t, app, "alice-session", params).Query().Get("code")
+	w := exchangeCode(app, secret, url.Values{"code": {code}, "code_verifier": {verifier}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	tokens := parseMap(w.Body.Bytes())
+
+	key, err := idp.SigningKey(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifierOIDC := oidc.NewVerifier(testIssuer, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.Private.PublicKey}}, &oidc.Config{ClientID: "grafana"})
+	idToken, err := verifierOIDC.Verify(context.Background(), tokens["id_token"].(string))
+	if err != nil {
+		t.Fatalf("expected a valid ID token: %v", err)
+	}
+	var claims idp.UserClaims
+	idToken.Claims(&claims)
+	if idToken.Nonce != "n-0S6" || claims.PreferredUsername != "alice" || len(claims.Groups) != 2 {
+		t.Errorf("unexpected ID token claims: nonce=%q %+v", idToken.Nonce, claims)
+	}
+
+	if w := exchangeCode(app, secret, url.Values{"code": {code}, "code_verifier": {verifier}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a reused code to fail, got %d", w.Code)
+	}
+
+	userinfo := func() *httptest.ResponseRecorder {
+		req := newGet("/oauth2/userinfo")
+		req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+		w := httptest.NewRecorder()
+		IDPUserInfoHandler(app).ServeHTTP(w, req)
+		return w
+	}
+	w = userinfo()
+	if info := parseMap(w.Body.Bytes()); w.Code != http.StatusOK || info["email"] != "alice@example.com" {
+		t.Fatalf("expected alice's userinfo, got %d: %s", w.Code, w.Body.String())
+	}
+
+	app.DB.Exec("UPDATE users SET disabled = 1 WHERE id = ?", aliceID)
+	if w := userinfo(); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 once alice is deactivated, got %d", w.Code)
+	}
+}
+
+func TestIDP_IDTokenIsNotAnAccessToken(t *testing.T) {
+	app, _, secret := setupIDPApp(t)
+	code := authorize(t, app, "alice-session", authorizeParams()).Query().Get("code")
+	tokens := parseMap(exchangeCode(app, secret, url.Values{"code": {code}}).Body.Bytes())
+
+	req := newGet("/oauth2/userinfo")
+	req.Header.Set("Authorization", "Bearer "+tokens["id_token"].(string))
+	w := httptest.NewRecorder()
+	IDPUserInfoHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an ID token, got %d", w.Code)
+	}
+}
+
+func TestIDP_AuthorizeEnforcesAllowedGroups(t *testing.T) {
+	app, _, _ := setupIDPApp(t)
+	bobID := seedUser(t, app, "bob", "pass", "Bob", false)
+	app.DB.Exec(`UPDATE users SET groups = '["family"]' WHERE id = ?`, bobID)
+	seedSession(t, app, bobID, "bob-session")
+
+	loc := authorize(t, app, "bob-session", authorizeParams())
+	if loc.Query().Get("error") != "access_denied" || loc.Query().Get("code") != "" {
+		t.Errorf("expected access_denied for bob, got %s", loc)
+	}
+	var audits int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'oidc_client_denied' AND username = 'bob'").Scan(&audits)
+	if audits != 1 {
+		t.Errorf("expected the denial to be audited, got %d entries", audits)
+	}
+}
+
+func TestIDP_AuthorizeSendsSignedOutUsersToLogin(t *testing.T) {
+	app, _, _ := setupIDPApp(t)
+
+	loc := authorize(t, app, "", authorizeParams())
+	back := loc.Query().Get("redirect")
+	if loc.Path != "/login" || !strings.HasPrefix(back, "/oauth2/authorize?") || !auth.IsSafeRedirect(app, back) {
+		t.Errorf("expected a login redirect that comes back, got %s", loc)
+	}
+
+	params := authorizeParams()
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+	w := httptest.NewRecorder()
+	IDPAuthorizeHandler(app).ServeHTTP(w, newGet("/oauth2/authorize?"+params.Encode()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unregistered redirect URI, got %d", w.Code)
+	}
+}
+
+func TestIDP_WrongClientSecretRejected(t *testing.T) {
+	app, _, _ := setupIDPApp(t)
+	code := authorize(t, app, "alice-session", authorizeParams()).Query().Get("code")
+	if w := exchangeCode(app, "not-the-secret", url.Values{"code": {code}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestIDP_UnavailableWithoutPublicURL(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	w := httptest.NewRecorder()
+	IDPDiscoveryHandler(app).ServeHTTP(w, newGet("/.well-known/openid-configuration"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+
+	app.SystemConfig.PublicURL = testIssuer
+	w = httptest.NewRecorder()
+	IDPDiscoveryHandler(app).ServeHTTP(w, newGet("/.well-known/openid-configuration"))
+	if doc := parseMap(w.Body.Bytes()); doc["issuer"] != testIssuer || doc["jwks_uri"] != testIssuer+"/oauth2/jwks" {
+		t.Errorf("unexpected discovery document: %s", w.Body.String())
+	}
+}
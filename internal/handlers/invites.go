@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+	"dashgate/internal/middleware"
+	"dashgate/internal/server"
+)
+
+const (
+	// defaultInviteHours is how long an invite link stays valid when the
+	// admin does not choose an expiry.
+	defaultInviteHours = 72
+	// maxInviteHours caps invite lifetime at 30 days.
+	maxInviteHours = 720
+)
+
+// AdminInvitesHandler handles GET (list) and POST (create) for invite links.
+func AdminInvitesHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			invites, err := database.ListInvites(app)
+			if err != nil {
+				log.Printf("Error listing invites: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			respondJSON(w, http.StatusOK, invites)
+		case http.MethodPost:
+			createInvite(app, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func createInvite(app *server.App, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email          string   `json:"email"`
+		Groups         []string `json:"groups"`
+		Note           string   `json:"note"`
+		ExpiresInHours int      `json:"expiresInHours"`
+		SendEmail      bool     `json:"sendEmail"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" {
+		addr, err := mail.ParseAddress(req.Email)
+		if err != nil || addr.Address != req.Email {
+			respondError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultInviteHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxInviteHours {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Expiry must be between 1 and %d hours", maxInviteHours))
+		return
+	}
+	if !auth.CanGrantGroups(app, auth.GetUserFromContext(r), req.Groups) {
+		respondError(w, http.StatusForbidden, "Only admins can grant admin or role groups")
+		return
+	}
+	if req.SendEmail && req.Email == "" {
+		respondError(w, http.StatusBadRequest, "An email address is required to send the invite")
+		return
+	}
+	if req.SendEmail && !mailer.Configured(app) {
+		respondError(w, http.StatusBadRequest, "Email is not configured")
+		return
+	}
+
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		log.Printf("Error generating invite token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	adminName := ""
+	if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+		adminName = adminUser.Username
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+	id, err := database.CreateInvite(app, token, req.Email, req.Groups, strings.TrimSpace(req.Note), adminName, expiresAt)
+	if err != nil {
+		log.Printf("Error creating invite: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	path := "/invite/" + url.PathEscape(token)
+	app.SysConfigMu.RLock()
+	link := ""
+	if app.SystemConfig.PublicURL != "" {
+		link = strings.TrimRight(app.SystemConfig.PublicURL, "/") + path
+	}
+	app.SysConfigMu.RUnlock()
+
+	emailed := false
+	if req.SendEmail {
+		if link == "" {
+			respondError(w, http.StatusBadRequest, "A public URL is required to email invites")
+			database.RevokeInvite(app, int(id))
+			return
+		}
+		err := mailer.Send(app, mailer.Message{
+			To:      req.Email,
+			Subject: "You're invited to DashGate",
+			Body: fmt.Sprintf("Hello,\n\n"+
+				"%s has invited you to DashGate.\n"+
+				"To create your account, open this link before %s:\n\n%s\n\n"+
+				"The link can only be used once.\n",
+				displayNameOr(adminName, "An administrator"), expiresAt.Format("2006-01-02 15:04 MST"), link),
+		})
+		if err != nil {
+			log.Printf("Error sending invite email to %s: %v", req.Email, err)
+			respondError(w, http.StatusBadGateway, "Invite created but the email could not be sent: "+err.Error())
+			return
+		}
+		emailed = true
+	}
+
+	detail := fmt.Sprintf("Created invite id=%d", id)
+	if req.Email != "" {
+		detail += " for " + req.Email
+	}
+	if len(req.Groups) > 0 {
+		detail += " with groups " + strings.Join(req.Groups, ", ")
+	}
+	audit.LogAudit(app, adminName, "invite_created", detail, auth.ClientIP(r))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":        id,
+		"token":     token,
+		"path":      path,
+		"url":       link,
+		"expiresAt": expiresAt,
+		"emailed":   emailed,
+	})
+}
+
+// AdminInviteHandler revokes a pending invite (DELETE /api/admin/invites/{id}).
+func AdminInviteHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+		if r.Method != http.MethodDelete {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/invites/"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid invite ID")
+			return
+		}
+
+		n, err := database.RevokeInvite(app, id)
+		if err != nil {
+			log.Printf("Error revoking invite: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if n == 0 {
+			respondError(w, http.StatusNotFound, "Invite not found or already used")
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+		audit.LogAudit(app, adminName, "invite_revoked", fmt.Sprintf("Revoked invite id=%d", id), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+	}
+}
+
+// InvitePageHandler serves the invite acceptance page (GET /invite/{token}).
+func InvitePageHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, "/invite/")
+		email := ""
+		valid := false
+		if app.DB != nil && token != "" {
+			if invite, err := database.GetInviteByToken(app, token); err == nil {
+				valid = true
+				email = invite.Email
+			}
+		}
+
+		app.SysConfigMu.RLock()
+		data := map[string]interface{}{
+			"Token":        token,
+			"Email":        email,
+			"Valid":        valid,
+			"LocalEnabled": app.SystemConfig.LocalAuthEnabled,
+			"CSPNonce":     middleware.GetCSPNonce(r),
+			"Version":      app.Version,
+		}
+		app.SysConfigMu.RUnlock()
+		providers := oidcLoginOptions(app)
+		data["OIDCEnabled"] = len(providers) > 0
+		data["OIDCProviders"] = providers
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if err := app.GetTemplates().ExecuteTemplate(w, "invite.html", data); err != nil {
+			log.Printf("Template error: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal Server Error")
+		}
+	}
+}
+
+// AcceptInviteHandler creates a local account from an invite link and signs
+// the new user in (POST /api/auth/invite).
+func AcceptInviteHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		localEnabled := app.SystemConfig.LocalAuthEnabled
+		app.SysConfigMu.RUnlock()
+		if !localEnabled {
+			respondError(w, http.StatusForbidden, "Local accounts are disabled; sign in with single sign-on instead")
+			return
+		}
+
+		var req struct {
+			Token       string `json:"token"`
+			Username    string `json:"username"`
+			Password    string `json:"password"`
+			DisplayName string `json:"displayName"`
+			Email       string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Token == "" || req.Username == "" || req.Password == "" {
+			respondError(w, http.StatusBadRequest, "Token, username and password required")
+			return
+		}
+
+		const invalidLink = "This invite link is invalid or has expired"
+
+		invite, err := database.GetInviteByToken(app, req.Token)
+		if err == database.ErrInviteInvalid {
+			respondError(w, http.StatusBadRequest, invalidLink)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up invite: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		// Invites sent to an address create an account with that address
+		if invite.Email != "" {
+			if req.Email != "" && !strings.EqualFold(req.Email, invite.Email) {
+				respondError(w, http.StatusForbidden, "This invite is for a different email address")
+				return
+			}
+			req.Email = invite.Email
+		}
+
+		if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		userID, err := database.CreateUserFromInvite(app, invite.ID, req.Username, req.Email, hashedPassword, req.DisplayName)
+		if err == database.ErrInviteInvalid {
+			respondError(w, http.StatusBadRequest, invalidLink)
+			return
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				respondError(w, http.StatusConflict, "Username or email already exists")
+				return
+			}
+			log.Printf("Error creating user from invite: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		audit.LogAudit(app, req.Username, "invite_accepted", fmt.Sprintf("Created account from invite id=%d", invite.ID), auth.ClientIP(r))
+
+		if err := auth.StartSession(app, w, r, int(userID), "local"); err != nil {
+			log.Printf("Error creating session: %v", err)
+			respondError(w, http.StatusInternalServerError, "Account created, but sign-in failed")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ok", "redirect": "/"})
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func createTestInvite(t *testing.T, app *server.App, body map[string]interface{}) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AdminInvitesHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/invites", body), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+		Path  string `json:"path"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Token == "" || resp.Path != "/invite/"+resp.Token {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+	return resp.ID, resp.Token
+}
+
+func acceptInvite(app *server.App, body map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	AcceptInviteHandler(app).ServeHTTP(w, newPost("/api/auth/invite", body))
+	return w
+}
+
+func TestInvites_AcceptCreatesUserWithGroups(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	_, token := createTestInvite(t, app, map[string]interface{}{"groups": []string{"family", "media"}, "note": "for Sam"})
+
+	var stored string
+	app.DB.QueryRow("SELECT token_hash FROM invites").Scan(&stored)
+	if stored != database.HashToken(token) {
+		t.Fatal("expected only the token hash to be stored")
+	}
+
+	w := acceptInvite(app, map[string]string{"token": token, "username": "sam", "password": "a-good-password", "displayName": "Sam"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(w.Result().Cookies()) == 0 {
+		t.Error("expected the new user to be signed in")
+	}
+
+	var groups string
+	app.DB.QueryRow("SELECT groups FROM users WHERE username = 'sam'").Scan(&groups)
+	if groups != `["family","media"]` {
+		t.Errorf("expected invite groups, got %s", groups)
+	}
+
+	// Single use
+	w = acceptInvite(app, map[string]string{"token": token, "username": "sam2", "password": "a-good-password"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected used invite to be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminInvitesHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/invites"), adminUser()))
+	var invites []models.Invite
+	json.Unmarshal(w.Body.Bytes(), &invites)
+	if len(invites) != 1 || invites[0].Status != "used" || invites[0].UsedBy != "sam" {
+		t.Fatalf("expected one used invite, got %+v", invites)
+	}
+}
+
+func TestInvites_EmailBinding(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	_, token := createTestInvite(t, app, map[string]interface{}{"email": "Pat@example.com"})
+
+	w := acceptInvite(app, map[string]string{"token": token, "username": "pat", "password": "a-good-password", "email": "someone@example.com"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected mismatched email to be rejected, got %d", w.Code)
+	}
+
+	w = acceptInvite(app, map[string]string{"token": token, "username": "pat", "password": "a-good-password"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var email string
+	app.DB.QueryRow("SELECT email FROM users WHERE username = 'pat'").Scan(&email)
+	if email != "pat@example.com" {
+		t.Errorf("expected the invite's email on the account, got %q", email)
+	}
+}
+
+func TestInvites_RevokedAndExpiredRejected(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	id, token := createTestInvite(t, app, map[string]interface{}{})
+
+	w := httptest.NewRecorder()
+	AdminInviteHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/invites/"+strconv.Itoa(id)), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := acceptInvite(app, map[string]string{"token": token, "username": "rex", "password": "a-good-password"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected revoked invite to be rejected, got %d", w.Code)
+	}
+
+	// Revoking twice is a 404
+	w = httptest.NewRecorder()
+	AdminInviteHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/invites/"+strconv.Itoa(id)), adminUser()))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	if _, err := database.CreateInvite(app, "old-token", "", nil, "", "admin", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if w := acceptInvite(app, map[string]string{"token": "old-token", "username": "rex", "password": "a-good-password"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected expired invite to be rejected, got %d", w.Code)
+	}
+}
+
+func TestInvites_WeakPasswordKeepsInvite(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	_, token := createTestInvite(t, app, map[string]interface{}{})
+
+	if w := acceptInvite(app, map[string]string{"token": token, "username": "kim", "password": "short"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected policy rejection, got %d", w.Code)
+	}
+	if w := acceptInvite(app, map[string]string{"token": token, "username": "kim", "password": "a-good-password"}); w.Code != http.StatusOK {
+		t.Fatalf("expected invite to survive a rejected password, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInvites_ExpiryBounds(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	w := httptest.NewRecorder()
+	AdminInvitesHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/invites", map[string]interface{}{"expiresInHours": maxInviteHours + 1}), adminUser()))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
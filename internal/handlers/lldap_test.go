@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/lldap"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// fakeLLDAP is a minimal LLDAP server: simple login plus the GraphQL
+// queries and mutations the client sends.
+type fakeLLDAP struct {
+	mu      sync.Mutex
+	users   map[string]string // id -> email
+	groups  map[int]string    // id -> name
+	members map[int][]string  // group id -> user ids
+	nextID  int
+}
+
+func newFakeLLDAP(t *testing.T) (*fakeLLDAP, *httptest.Server) {
+	t.Helper()
+	f := &fakeLLDAP{
+		users:   map[string]string{"admin": "admin@example.com"},
+		groups:  map[int]string{1: "lldap_admin"},
+		members: map[int][]string{1: {"admin"}},
+		nextID:  2,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeLLDAP) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/auth/simple/login" {
+		var req struct{ Username, Password string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Username != "admin" || req.Password != "lldap-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "jwt"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer jwt" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	userID, _ := req.Variables["userId"].(string)
+	groupID := 0
+	if v, ok := req.Variables["groupId"].(float64); ok {
+		groupID = int(v)
+	}
+
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "users { id email"):
+		var users []map[string]interface{}
+		for id, email := range f.users {
+			var groups []map[string]string
+			for gid, ids := range f.members {
+				for _, m := range ids {
+					if m == id {
+						groups = append(groups, map[string]string{"displayName": f.groups[gid]})
+					}
+				}
+			}
+			users = append(users, map[string]interface{}{"id": id, "email": email, "displayName": id, "groups": groups})
+		}
+		data = map[string]interface{}{"users": users}
+	case strings.Contains(req.Query, "groups { id"):
+		var groups []map[string]interface{}
+		for id, name := range f.groups {
+			var users []map[string]string
+			for _, m := range f.members[id] {
+				users = append(users, map[string]string{"id": m})
+			}
+			groups = append(groups, map[string]interface{}{"id": id, "displayName": name, "users": users})
+		}
+		data = map[string]interface{}{"groups": groups}
+	case strings.Contains(req.Query, "createUser"):
+		u := req.Variables["user"].(map[string]interface{})
+		f.users[u["id"].(string)] = u["email"].(string)
+		data = map[string]interface{}{"createUser": map[string]string{"id": u["id"].(string)}}
+	case strings.Contains(req.Query, "createGroup"):
+		f.groups[f.nextID] = req.Variables["name"].(string)
+		data = map[string]interface{}{"createGroup": map[string]int{"id": f.nextID}}
+		f.nextID++
+	case strings.Contains(req.Query, "addUserToGroup"):
+		f.members[groupID] = append(f.members[groupID], userID)
+		data = map[string]interface{}{"addUserToGroup": map[string]bool{"ok": true}}
+	case strings.Contains(req.Query, "deleteUser"):
+		delete(f.users, userID)
+		data = map[string]interface{}{"deleteUser": map[string]bool{"ok": true}}
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"message": "unsupported"}}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// setupLLDAPApp points the app at a fake LLDAP server. The URL is set
+// directly because the config endpoint refuses loopback addresses.
+func setupLLDAPApp(t *testing.T) (*server.App, *fakeLLDAP) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	f, srv := newFakeLLDAP(t)
+	app.HTTPClient = srv.Client()
+	app.SystemConfig.LLDAPEnabled = true
+	app.SystemConfig.LLDAPURL = srv.URL
+	app.SystemConfig.LLDAPAdminUsername = "admin"
+	app.SystemConfig.LLDAPAdminPassword = "lldap-secret"
+	lldap.Configure(app)
+	return app, f
+}
+
+func TestLLDAP_CreateUserGroupAndMembership(t *testing.T) {
+	app, f := setupLLDAPApp(t)
+
+	w := httptest.NewRecorder()
+	AdminLLDAPUsersHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/users", map[string]string{
+		"id": "robin", "email": "robin@example.com", "displayName": "Robin",
+	}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 creating a user, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPGroupsHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/groups", map[string]string{"name": "kids"}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 creating a group, got %d: %s", w.Code, w.Body.String())
+	}
+	groupID := int(parseMap(w.Body.Bytes())["id"].(float64))
+
+	w = httptest.NewRecorder()
+	AdminLLDAPGroupHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/groups/"+strconv.Itoa(groupID)+"/members/robin", nil), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 adding a member, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := f.members[groupID]; len(got) != 1 || got[0] != "robin" {
+		t.Errorf("expected robin in kids, got %v", got)
+	}
+
+	var entries int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action IN ('lldap_user_created', 'lldap_group_created', 'lldap_member_added')").Scan(&entries)
+	if entries != 3 {
+		t.Errorf("expected 3 audit entries, got %d", entries)
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPUsersHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/users", map[string]string{
+		"id": "bad id", "email": "x@example.com",
+	}), adminUser()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid user ID, got %d", w.Code)
+	}
+}
+
+func TestLLDAP_UserManagerCannotGrantLLDAPAdmin(t *testing.T) {
+	app, f := setupLLDAPApp(t)
+	app.SystemConfig.RoleUserManagerGroups = "helpdesk"
+	f.users["robin"] = "robin@example.com"
+	manager := &models.AuthenticatedUser{Username: "helper", Groups: []string{"helpdesk"}}
+
+	w := httptest.NewRecorder()
+	AdminLLDAPGroupHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/groups/1/members/robin", nil), manager))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected adding to lldap_admin to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPUserHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/users/admin"), manager))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected deleting an LLDAP admin to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPUserHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/users/robin"), manager))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected deleting a regular user to work, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLLDAP_ConfigPasswordIsWriteOnlyAndEncrypted(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+	w := httptest.NewRecorder()
+	AdminLLDAPConfigHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/lldap-config", map[string]interface{}{
+		"enabled": true, "url": "http://127.0.0.1:17170", "username": "admin", "password": "lldap-secret",
+	}), adminUser()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a loopback URL to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPConfigHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/lldap-config", map[string]interface{}{
+		"enabled": false, "url": "http://lldap.example.com", "username": "admin", "password": "lldap-secret",
+	}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stored string
+	app.DB.QueryRow("SELECT value FROM system_config WHERE key = 'lldap_admin_password'").Scan(&stored)
+	if stored == "" || strings.Contains(stored, "lldap-secret") {
+		t.Errorf("expected the password to be encrypted at rest, got %q", stored)
+	}
+
+	w = httptest.NewRecorder()
+	AdminLLDAPConfigHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/admin/lldap-config"), adminUser()))
+	if strings.Contains(w.Body.String(), "lldap-secret") || parseMap(w.Body.Bytes())["hasPassword"] != true {
+		t.Errorf("expected the password to be masked, got %s", w.Body.String())
+	}
+
+	app.ConfigEnv = map[string]server.ConfigEnvValue{"lldap_enabled": {Var: "LLDAP_URL", Value: "true"}}
+	w = httptest.NewRecorder()
+	AdminLLDAPConfigHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/lldap-config", map[string]interface{}{"enabled": false}), adminUser()))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 when set by environment variables, got %d", w.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/middleware"
+	"dashgate/internal/server"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// addNetworkPolicy creates a policy through the admin API from a LAN address.
+func addNetworkPolicy(t *testing.T, app *server.App, kind, target, networks string) {
+	t.Helper()
+	req := auth.WithUser(newPost("/api/admin/network-policies", map[string]string{
+		"kind": kind, "target": target, "networks": networks,
+	}), adminUser())
+	req.RemoteAddr = "192.168.1.10:5000"
+	w := httptest.NewRecorder()
+	middleware.ClientIP(app, AdminNetworkPoliciesHandler(app)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// serveWithNetworkPolicy runs req from remoteAddr through the network policy
+// middleware and reports the status.
+func serveWithNetworkPolicy(app *server.App, req *http.Request, remoteAddr string) int {
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	middleware.ClientIP(app, middleware.NetworkPolicy(app, ok)).ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestResolveClientIP_WalksTrustedProxies(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/24")
+	app.TrustedProxyNets = []*net.IPNet{proxies}
+
+	cases := []struct {
+		remote, xff, want string
+	}{
+		{"10.0.0.2:443", "203.0.113.7, 10.0.0.5", "203.0.113.7"},
+		{"10.0.0.2:443", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{"198.51.100.9:443", "10.0.0.5", "198.51.100.9"},
+		{"10.0.0.2:443", "", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		req := newGet("/")
+		req.RemoteAddr = c.remote
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := auth.ResolveClientIP(app, req); got != c.want {
+			t.Errorf("remote %s, XFF %q: expected %s, got %s", c.remote, c.xff, c.want, got)
+		}
+	}
+}
+
+func TestNetworkPolicy_RouteDeniedAndAudited(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	addNetworkPolicy(t, app, "route", "/api/admin", "192.168.0.0/16, tailscale")
+
+	if code := serveWithNetworkPolicy(app, newGet("/api/admin/local-users"), "100.100.1.2:5000"); code != http.StatusOK {
+		t.Errorf("expected Tailscale address to be allowed, got %d", code)
+	}
+	if code := serveWithNetworkPolicy(app, newGet("/api/admin/local-users"), "203.0.113.7:5000"); code != http.StatusForbidden {
+		t.Errorf("expected outside address to be refused, got %d", code)
+	}
+	if code := serveWithNetworkPolicy(app, newGet("/api/admins-only"), "203.0.113.7:5000"); code != http.StatusOK {
+		t.Errorf("expected unrelated route to be allowed, got %d", code)
+	}
+
+	var ip string
+	app.DB.QueryRow("SELECT ip FROM audit_log WHERE action = 'network_denied'").Scan(&ip)
+	if ip != "203.0.113.7" {
+		t.Errorf("expected the denial to be audited with the client IP, got %q", ip)
+	}
+}
+
+func TestNetworkPolicy_RepeatedDenialsAggregated(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	addNetworkPolicy(t, app, "route", "/api/admin", "lan")
+
+	for i := 0; i < 5; i++ {
+		serveWithNetworkPolicy(app, newGet("/api/admin/local-users"), "203.0.113.7:5000")
+	}
+	serveWithNetworkPolicy(app, newGet("/api/admin/local-users"), "198.51.100.4:5000")
+	countDenials := func() int {
+		var n int
+		app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'network_denied'").Scan(&n)
+		return n
+	}
+	if n := countDenials(); n != 2 {
+		t.Fatalf("expected one entry per client, got %d", n)
+	}
+
+	// Once the minute is over, the repeats are audited as one entry
+	middleware.FlushNetworkDenials(app)
+	if n := countDenials(); n != 2 {
+		t.Fatalf("expected nothing to be flushed within the minute, got %d entries", n)
+	}
+	app.NetworkDenialsMu.Lock()
+	for _, c := range app.NetworkDenials {
+		c.Since = c.Since.Add(-time.Minute)
+	}
+	app.NetworkDenialsMu.Unlock()
+	middleware.FlushNetworkDenials(app)
+
+	var detail string
+	app.DB.QueryRow("SELECT detail FROM audit_log WHERE action = 'network_denied' ORDER BY id DESC LIMIT 1").Scan(&detail)
+	if n := countDenials(); n != 3 || !strings.HasPrefix(detail, "4 more requests from 203.0.113.7") {
+		t.Errorf("expected a single summary of 4 repeats, got %d entries, last %q", n, detail)
+	}
+}
+
+func TestNetworkPolicy_GroupRestrictedToLAN(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	guestID := seedUser(t, app, "guest", "pass", "Guest", false)
+	app.DB.Exec(`UPDATE users SET groups = '["guests"]' WHERE id = ?`, guestID)
+	seedSession(t, app, guestID, "guest-session")
+	addNetworkPolicy(t, app, "group", "guests", "lan")
+
+	req := newGet("/api/apps")
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: "guest-session"})
+	if code := serveWithNetworkPolicy(app, req, "192.168.1.50:5000"); code != http.StatusOK {
+		t.Errorf("expected LAN guest to be allowed, got %d", code)
+	}
+
+	req = newGet("/api/apps")
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: "guest-session"})
+	if code := serveWithNetworkPolicy(app, req, "203.0.113.7:5000"); code != http.StatusForbidden {
+		t.Errorf("expected remote guest to be refused, got %d", code)
+	}
+
+	if code := serveWithNetworkPolicy(app, newGet("/api/apps"), "203.0.113.7:5000"); code != http.StatusOK {
+		t.Errorf("expected anonymous request to reach the handler, got %d", code)
+	}
+}
+
+func TestNetworkPolicy_APIKeyAllowedNetworks(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.APIKeyEnabled = true
+	userID := seedUser(t, app, "svc", "pass", "Service", false)
+	keyID := seedAPIKey(t, app, "ci", "dgk_ci01", userID, `["users"]`)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dgk_ci01_full_key"), bcrypt.MinCost)
+	app.DB.Exec("UPDATE api_keys SET key_hash = ?, allowed_networks = '10.1.0.0/16' WHERE id = ?", string(hash), keyID)
+
+	req := newGet("/api/apps")
+	req.Header.Set("X-API-Key", "dgk_ci01_full_key")
+	req.RemoteAddr = "10.1.2.3:5000"
+	if auth.GetAPIKeyUser(app, req) == nil {
+		t.Error("expected the key to authenticate from its allowed network")
+	}
+
+	req = newGet("/api/apps")
+	req.Header.Set("X-API-Key", "dgk_ci01_full_key")
+	if code := serveWithNetworkPolicy(app, req, "203.0.113.7:5000"); code != http.StatusForbidden {
+		t.Errorf("expected key to be refused from outside its networks, got %d", code)
+	}
+	if auth.GetAPIKeyUser(app, req) != nil {
+		t.Error("expected the key not to authenticate from outside its networks")
+	}
+}
+
+func TestAdminNetworkPolicies_RefusesSelfLockout(t *testing.T) {
+	app := setupTestAppWithDB(t)
+
+	req := auth.WithUser(newPost("/api/admin/network-policies", map[string]string{
+		"kind": "route", "target": "/api/admin", "networks": "10.0.0.0/8",
+	}), adminUser())
+	req.RemoteAddr = "192.168.1.10:5000"
+	w := httptest.NewRecorder()
+	AdminNetworkPoliciesHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a policy excluding the admin, got %d", w.Code)
+	}
+
+	req = auth.WithUser(newPost("/api/admin/network-policies", map[string]string{
+		"kind": "group", "target": "guests", "networks": "not-a-network",
+	}), adminUser())
+	w = httptest.NewRecorder()
+	AdminNetworkPoliciesHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid network, got %d", w.Code)
+	}
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/oidc"
+	"dashgate/internal/server"
+)
+
+// fakeOIDCProvider is a minimal OpenID provider for exercising the login flow.
+type fakeOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// idClaims and userInfo are returned for every login
+	idClaims map[string]interface{}
+	userInfo map[string]interface{}
+	// codes maps issued authorization codes to the request that created them
+	codes map[string]url.Values
+	// tamperNonce makes the ID token carry a different nonce
+	tamperNonce bool
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDCProvider{
+		t:        t,
+		key:      key,
+		idClaims: map[string]interface{}{},
+		codes:    map[string]url.Values{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"userinfo_endpoint":                     p.server.URL + "/userinfo",
+			"end_session_endpoint":                  p.server.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(p.userInfo)
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	authReq, ok := p.codes[r.PostForm.Get("code")]
+	if !ok {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	delete(p.codes, r.PostForm.Get("code"))
+
+	// PKCE S256: the challenge must be the hash of the verifier
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if authReq.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != authReq.Get("code_challenge") {
+		http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"aud":   authReq.Get("client_id"),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": authReq.Get("nonce"),
+	}
+	if p.tamperNonce {
+		claims["nonce"] = "something-else"
+	}
+	for k, v := range p.idClaims {
+		claims[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.sign(claims),
+	})
+}
+
+func (p *fakeOIDCProvider) sign(claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"test","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString(mustJSON(claims))
+	sum := sha256.Sum256([]byte(header + "." + payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the provider's login page: it records the authorization
+// request behind the redirect and returns the code to send back.
+func (p *fakeOIDCProvider) authorize(t *testing.T, location string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.server.URL+"/authorize") {
+		t.Fatalf("expected redirect to the provider, got %q", location)
+	}
+	q := u.Query()
+	p.mu.Lock()
+	code = "code-" + q.Get("state")
+	p.codes[code] = q
+	p.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func setupOIDCApp(t *testing.T) (*server.App, *fakeOIDCProvider) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	provider := newFakeOIDCProvider(t)
+	app.SystemConfig.OIDCAuthEnabled = true
+	oidc.InitOIDCProvider(app, provider.server.URL, "dashgate", "secret", "http://dash.example.com/auth/oidc/callback", "", "groups")
+	if app.OIDCProvider == nil {
+		t.Fatal("failed to initialize OIDC provider")
+	}
+	return app, provider
+}
+
+// oidcLogin runs the browser side of a login and returns the callback response.
+func oidcLogin(t *testing.T, app *server.App, provider *fakeOIDCProvider, startPath string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	auth.OIDCAuthHandler(app).ServeHTTP(w, newGet(startPath))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect to provider, got %d: %s", w.Code, w.Body.String())
+	}
+	code, state := provider.authorize(t, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	auth.OIDCCallbackHandler(app).ServeHTTP(w, newGet("/auth/oidc/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state)))
+	return w
+}
+
+func TestOIDC_PKCEAndNonceSentToProvider(t *testing.T) {
+	app, _ := setupOIDCApp(t)
+	w := httptest.NewRecorder()
+	auth.OIDCAuthHandler(app).ServeHTTP(w, newGet("/auth/oidc"))
+	u, _ := url.Parse(w.Header().Get("Location"))
+	q := u.Query()
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("expected an S256 PKCE challenge, got %v", q)
+	}
+	if q.Get("nonce") == "" {
+		t.Error("expected a nonce in the authorization request")
+	}
+}
+
+func TestOIDC_LoginWithNestedGroupsClaim(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	app.SystemConfig.OIDCGroupsClaim = "resource_access.dashgate.roles"
+	provider.idClaims = map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "ada@example.com",
+		"preferred_username": "ada",
+		"resource_access": map[string]interface{}{
+			"dashgate": map[string]interface{}{"roles": []string{"media", "admins"}},
+		},
+	}
+
+	w := oidcLogin(t, app, provider, "/auth/oidc?redirect=/apps")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/apps" {
+		t.Fatalf("expected redirect to /apps, got %d %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+
+	var groups string
+	app.DB.QueryRow("SELECT groups FROM users WHERE username = 'ada'").Scan(&groups)
+	if groups != `["media","admins"]` {
+		t.Errorf("expected groups from the nested claim, got %s", groups)
+	}
+}
+
+func TestOIDC_UserInfoFallbackForGroups(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	provider.idClaims = map[string]interface{}{"sub": "user-2", "preferred_username": "grace"}
+	provider.userInfo = map[string]interface{}{
+		"sub":    "user-2",
+		"email":  "grace@example.com",
+		"groups": []string{"family"},
+	}
+
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Code != http.StatusFound {
+		t.Fatalf("expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var groups, email string
+	app.DB.QueryRow("SELECT groups, email FROM users WHERE username = 'grace'").Scan(&groups, &email)
+	if groups != `["family"]` || email != "grace@example.com" {
+		t.Errorf("expected groups and email from userinfo, got %s %q", groups, email)
+	}
+}
+
+func TestOIDC_UserInfoSubjectMismatchIgnored(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	provider.idClaims = map[string]interface{}{"sub": "user-3", "preferred_username": "linus"}
+	provider.userInfo = map[string]interface{}{"sub": "someone-else", "groups": []string{"admins"}}
+
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Code != http.StatusFound {
+		t.Fatalf("expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var groups string
+	app.DB.QueryRow("SELECT groups FROM users WHERE username = 'linus'").Scan(&groups)
+	if groups != `[]` {
+		t.Errorf("expected userinfo for another subject to be ignored, got %s", groups)
+	}
+}
+
+func TestOIDC_NonceMismatchRejected(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	provider.idClaims = map[string]interface{}{"sub": "user-4", "preferred_username": "mallory", "groups": []string{}}
+	provider.tamperNonce = true
+
+	if w := oidcLogin(t, app, provider, "/auth/oidc"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected nonce mismatch to be rejected, got %d", w.Code)
+	}
+	var count int
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&count)
+	if count != 0 {
+		t.Error("expected no session to be created")
+	}
+}
+
+func TestOIDC_LogoutRedirectsToProvider(t *testing.T) {
+	app, provider := setupOIDCApp(t)
+	app.SystemConfig.OIDCLogoutEnabled = true
+	app.SystemConfig.PublicURL = "https://dash.example.com"
+	provider.idClaims = map[string]interface{}{"sub": "user-5", "preferred_username": "joan", "email": "joan@example.com", "groups": []string{}}
+
+	w := oidcLogin(t, app, provider, "/auth/oidc")
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "test_session" {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	req := newPost("/api/auth/logout", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	LogoutHandler(app).ServeHTTP(w, req)
+
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	u, err := url.Parse(resp["redirect"])
+	if err != nil || !strings.HasPrefix(resp["redirect"], provider.server.URL+"/logout?") {
+		t.Fatalf("expected redirect to the end-session endpoint, got %q", resp["redirect"])
+	}
+	q := u.Query()
+	if q.Get("id_token_hint") == "" || q.Get("client_id") != "dashgate" || q.Get("post_logout_redirect_uri") != "https://dash.example.com/login" {
+		t.Errorf("unexpected logout parameters: %v", q)
+	}
+}
+
+func TestParseOIDCClaims_UnverifiedEmail(t *testing.T) {
+	cases := []struct {
+		verified interface{}
+		want     string
+	}{
+		{nil, "ada@example.com"},
+		{true, "ada@example.com"},
+		{"true", "ada@example.com"},
+		{false, ""},
+		{"false", ""},
+	}
+	for _, tc := range cases {
+		raw := map[string]interface{}{"sub": "1", "email": "ada@example.com"}
+		if tc.verified != nil {
+			raw["email_verified"] = tc.verified
+		}
+		if got := auth.ParseOIDCClaims(raw, "groups").Email; got != tc.want {
+			t.Errorf("email_verified=%v: expected %q, got %q", tc.verified, tc.want, got)
+		}
+	}
+}
+
+func TestParseOIDCClaims_Paths(t *testing.T) {
+	raw := map[string]interface{}{
+		"groups":                     []interface{}{"a"},
+		"realm_access":               map[string]interface{}{"roles": []interface{}{"b", "a"}},
+		"https://example.com/groups": []interface{}{"c"},
+		"single":                     "d",
+	}
+	cases := map[string][]string{
+		"groups":                     {"a"},
+		"realm_access.roles":         {"a", "b"},
+		"https://example.com/groups": {"a", "c"},
+		"single":                     {"a", "d"},
+		"missing.path":               {"a"},
+	}
+	for claim, want := range cases {
+		got := auth.ParseOIDCClaims(raw, claim).Groups
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", claim, want, got)
+		}
+	}
+}
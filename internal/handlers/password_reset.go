@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+	"dashgate/internal/middleware"
+	"dashgate/internal/server"
+)
+
+const (
+	// passwordResetTTL is how long an emailed reset link stays valid.
+	passwordResetTTL = 30 * time.Minute
+	// maxPasswordResetsPerHour caps reset emails per account so the form
+	// cannot be used to flood someone's inbox.
+	maxPasswordResetsPerHour = 3
+)
+
+// passwordResetAvailable reports whether self-service reset is enabled and
+// everything it needs (local auth, SMTP and a public URL) is configured.
+func passwordResetAvailable(app *server.App) bool {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.PasswordResetEnabled && app.SystemConfig.PublicURL != "" && app.SystemConfig.LocalAuthEnabled
+	app.SysConfigMu.RUnlock()
+	return enabled && mailer.Configured(app)
+}
+
+// ForgotPasswordHandler emails a password reset link to a local user
+// (POST /api/auth/forgot-password). The response is the same whether or not
+// the account exists so it cannot be used to discover usernames or emails.
+func ForgotPasswordHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil || !passwordResetAvailable(app) {
+			respondError(w, http.StatusNotFound, "Password reset is not enabled")
+			return
+		}
+
+		var req struct {
+			Login string `json:"login"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		req.Login = strings.TrimSpace(req.Login)
+		if req.Login == "" {
+			respondError(w, http.StatusBadRequest, "Username or email required")
+			return
+		}
+
+		accepted := map[string]string{"status": "ok"}
+
+		user, err := database.GetLocalUserByLogin(app, req.Login)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Error looking up user for password reset: %v", err)
+			}
+			respondJSON(w, http.StatusOK, accepted)
+			return
+		}
+		if user.Email == "" {
+			log.Printf("Password reset requested for %q, who has no email address", user.Username)
+			respondJSON(w, http.StatusOK, accepted)
+			return
+		}
+
+		recent, err := database.CountPasswordResetsSince(app, user.ID, time.Now().Add(-time.Hour))
+		if err != nil {
+			log.Printf("Error counting password resets: %v", err)
+			respondJSON(w, http.StatusOK, accepted)
+			return
+		}
+		if recent >= maxPasswordResetsPerHour {
+			log.Printf("Password reset limit reached for %q", user.Username)
+			respondJSON(w, http.StatusOK, accepted)
+			return
+		}
+
+		token, err := auth.GenerateSessionToken()
+		if err != nil {
+			log.Printf("Error generating reset token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := database.CreatePasswordResetToken(app, user.ID, token, time.Now().Add(passwordResetTTL)); err != nil {
+			log.Printf("Error storing reset token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		link := strings.TrimRight(app.SystemConfig.PublicURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+		app.SysConfigMu.RUnlock()
+
+		msg := mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your DashGate password",
+			Body: fmt.Sprintf("Hello %s,\n\n"+
+				"Someone asked to reset the password for your DashGate account %q.\n"+
+				"To choose a new password, open this link within %d minutes:\n\n%s\n\n"+
+				"If you did not ask for this, you can ignore this email. Your password will not change.\n",
+				displayNameOr(user.DisplayName, user.Username), user.Username, int(passwordResetTTL.Minutes()), link),
+		}
+
+		// Send in the background so response timing does not reveal whether
+		// the account exists
+		go func() {
+			if err := mailer.Send(app, msg); err != nil {
+				log.Printf("Error sending password reset email to %q: %v", user.Username, err)
+			}
+		}()
+
+		audit.LogAudit(app, user.Username, "password_reset_requested", "Password reset link emailed", auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, accepted)
+	}
+}
+
+// ResetPasswordHandler sets a new password using an emailed reset token
+// (POST /api/auth/reset-password).
+func ResetPasswordHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if app.DB == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.Token == "" || req.Password == "" {
+			respondError(w, http.StatusBadRequest, "Token and password required")
+			return
+		}
+
+		const invalidLink = "This reset link is invalid or has expired. Request a new one."
+
+		userID, err := database.GetPasswordResetUser(app, req.Token)
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusBadRequest, invalidLink)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up reset token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		oldHash, err := database.GetPasswordHashByID(app, userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := auth.CheckPasswordHistory(app, userID, req.Password, oldHash); err != nil {
+			if err == auth.ErrPasswordReused {
+				respondError(w, http.StatusBadRequest, err.Error())
+			} else {
+				log.Printf("Error checking password history: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+			}
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		// Consume the token only once the new password is acceptable, so a
+		// rejected password does not burn the link
+		if _, err := database.ConsumePasswordResetToken(app, req.Token); err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Error consuming reset token: %v", err)
+			}
+			respondError(w, http.StatusBadRequest, invalidLink)
+			return
+		}
+
+		if _, err := database.UpdateUserPassword(app, userID, hashedPassword); err != nil {
+			log.Printf("Error updating password: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		auth.RecordPasswordChange(app, userID, oldHash)
+		database.InvalidateUserSessions(app, userID)
+
+		username, _ := database.GetUsernameByID(app, userID)
+		database.ClearLoginAttempts(app, username)
+		audit.LogAudit(app, username, "password_reset_completed", "Password reset with emailed link", auth.ClientIP(r))
+
+		respondJSON(w, http.StatusOK, map[string]string{"status": "password_reset"})
+	}
+}
+
+// ResetPasswordPageHandler serves the forgot/reset password page.
+func ResetPasswordPageHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !passwordResetAvailable(app) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		data := map[string]interface{}{
+			"Token":    r.URL.Query().Get("token"),
+			"CSPNonce": middleware.GetCSPNonce(r),
+			"Version":  app.Version,
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := app.GetTemplates().ExecuteTemplate(w, "reset_password.html", data); err != nil {
+			log.Printf("Template error: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal Server Error")
+		}
+	}
+}
+
+// SMTPTestHandler sends a test email using the saved SMTP settings
+// (POST /api/admin/smtp/test).
+func SMTPTestHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var req struct {
+			To string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+			if req.To == "" {
+				req.To = adminUser.Email
+			}
+		}
+		if req.To == "" {
+			respondError(w, http.StatusBadRequest, "Recipient address required")
+			return
+		}
+
+		err := mailer.Send(app, mailer.Message{
+			To:      req.To,
+			Subject: "DashGate test email",
+			Body:    "This is a test email from DashGate. Your SMTP settings are working.\n",
+		})
+		if err == mailer.ErrNotConfigured {
+			respondError(w, http.StatusBadRequest, "SMTP host and sender address are required")
+			return
+		}
+		if err != nil {
+			log.Printf("SMTP test failed: %v", err)
+			respondError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		audit.LogAudit(app, adminName, "smtp_test", fmt.Sprintf("Sent test email to %s", req.To), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+	}
+}
+
+func displayNameOr(displayName, fallback string) string {
+	if displayName != "" {
+		return displayName
+	}
+	return fallback
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// startSMTPSink runs a minimal SMTP server on localhost and delivers the
+// DATA section of every received message to the returned channel.
+func startSMTPSink(t *testing.T) (host string, port int, messages <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, ch)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return "127.0.0.1", addr.Port, ch
+}
+
+func serveSMTP(conn net.Conn, ch chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			ch <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func setupPasswordResetApp(t *testing.T) (*server.App, <-chan string) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	host, port, messages := startSMTPSink(t)
+	app.SystemConfig.PasswordResetEnabled = true
+	app.SystemConfig.PublicURL = "https://dash.example.com"
+	app.SystemConfig.SMTPHost = host
+	app.SystemConfig.SMTPPort = port
+	app.SystemConfig.SMTPSecurity = "none"
+	app.SystemConfig.SMTPFrom = "DashGate <dashgate@example.com>"
+	return app, messages
+}
+
+func requestReset(t *testing.T, app *server.App, login string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ForgotPasswordHandler(app).ServeHTTP(w, newPost("/api/auth/forgot-password", map[string]string{"login": login}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+var resetLinkPattern = regexp.MustCompile(`https://dash\.example\.com/reset-password\?token=([0-9a-f]+)`)
+
+func waitForResetToken(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		body, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(msg[strings.Index(msg, "\r\n\r\n")+4:])))
+		m := resetLinkPattern.FindStringSubmatch(string(body))
+		if m == nil {
+			t.Fatalf("no reset link in email:\n%s", msg)
+		}
+		return m[1]
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reset email")
+	}
+	return ""
+}
+
+func resetPassword(app *server.App, token, password string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ResetPasswordHandler(app).ServeHTTP(w, newPost("/api/auth/reset-password", map[string]string{"token": token, "password": password}))
+	return w
+}
+
+func TestPasswordReset_EmailLinkResetsPassword(t *testing.T) {
+	app, messages := setupPasswordResetApp(t)
+	userID := seedUser(t, app, "alice", "old-password", "Alice", false)
+	app.DB.Exec("UPDATE users SET email = 'alice@example.com' WHERE id = ?", userID)
+	seedSession(t, app, userID, "alice-session")
+
+	requestReset(t, app, "ALICE@example.com")
+	token := waitForResetToken(t, messages)
+
+	var stored string
+	app.DB.QueryRow("SELECT token_hash FROM password_reset_tokens").Scan(&stored)
+	if stored == token || stored != database.HashToken(token) {
+		t.Fatal("expected only the token hash to be stored")
+	}
+
+	if w := resetPassword(app, token, "brand-new-password"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, newPost("/api/auth/login", map[string]string{"username": "alice", "password": "brand-new-password"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected login with new password, got %d", w.Code)
+	}
+
+	var sessions int
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE token = ?", database.HashToken("alice-session")).Scan(&sessions)
+	if sessions != 0 {
+		t.Error("expected existing sessions to be signed out")
+	}
+
+	// Single use
+	if w := resetPassword(app, token, "another-password"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected reused token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestPasswordReset_WeakPasswordKeepsToken(t *testing.T) {
+	app, messages := setupPasswordResetApp(t)
+	userID := seedUser(t, app, "bob", "old-password", "Bob", false)
+	app.DB.Exec("UPDATE users SET email = 'bob@example.com' WHERE id = ?", userID)
+
+	requestReset(t, app, "bob")
+	token := waitForResetToken(t, messages)
+
+	if w := resetPassword(app, token, "short"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected policy rejection, got %d", w.Code)
+	}
+	if w := resetPassword(app, token, "long-enough-password"); w.Code != http.StatusOK {
+		t.Fatalf("expected token to survive a rejected password, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPasswordReset_UnknownUserLooksTheSame(t *testing.T) {
+	app, messages := setupPasswordResetApp(t)
+	requestReset(t, app, "nobody@example.com")
+
+	select {
+	case <-messages:
+		t.Fatal("expected no email for an unknown account")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestPasswordReset_RateLimitedPerUser(t *testing.T) {
+	app, _ := setupPasswordResetApp(t)
+	userID := seedUser(t, app, "carol", "old-password", "Carol", false)
+	app.DB.Exec("UPDATE users SET email = 'carol@example.com' WHERE id = ?", userID)
+
+	for i := 0; i < maxPasswordResetsPerHour+2; i++ {
+		requestReset(t, app, "carol")
+	}
+
+	var count int
+	app.DB.QueryRow("SELECT COUNT(*) FROM password_reset_tokens WHERE user_id = ?", userID).Scan(&count)
+	if count != maxPasswordResetsPerHour {
+		t.Fatalf("expected %d tokens, got %d", maxPasswordResetsPerHour, count)
+	}
+}
+
+func TestPasswordReset_ExpiredToken(t *testing.T) {
+	app, _ := setupPasswordResetApp(t)
+	userID := seedUser(t, app, "dave", "old-password", "Dave", false)
+	if err := database.CreatePasswordResetToken(app, userID, "expired-token", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := resetPassword(app, "expired-token", "brand-new-password"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected expired token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestPasswordReset_DisabledReturnsNotFound(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	w := httptest.NewRecorder()
+	ForgotPasswordHandler(app).ServeHTTP(w, newPost("/api/auth/forgot-password", map[string]string{"login": "anyone"}))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestSMTPTestHandler_SendsToSink(t *testing.T) {
+	app, messages := setupPasswordResetApp(t)
+	w := httptest.NewRecorder()
+	SMTPTestHandler(app).ServeHTTP(w, newPost("/api/admin/smtp/test", map[string]string{"to": "admin@example.com"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-messages:
+		if !strings.Contains(msg, "To: <admin@example.com>") || !strings.Contains(msg, "Subject: DashGate test email") {
+			t.Fatalf("unexpected message:\n%s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for test email")
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// setupPreviewApp returns an app with a signed-in admin, a kids-only app and
+// admin-only configured and discovered apps.
+func setupPreviewApp(t *testing.T) (*server.App, *http.Cookie) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	app.Config.Categories = []models.Category{{
+		Name: "Media",
+		Apps: []models.App{
+			{Name: "Cartoons", URL: "http://cartoons.local", Groups: []string{"kids"}},
+			{Name: "Grafana", URL: "http://grafana.local", Groups: []string{"admins"}},
+		},
+	}}
+	app.DockerDiscovery = server.NewDiscoveryManager()
+	app.TraefikDiscovery = server.NewDiscoveryManager()
+	app.NginxDiscovery = server.NewDiscoveryManager()
+	app.NPMDiscovery = server.NewDiscoveryManager()
+	app.CaddyDiscovery = server.NewDiscoveryManager()
+	app.UnraidDiscovery = server.NewDiscoveryManager()
+	app.DockerDiscovery.Enabled = true
+	app.DockerDiscovery.SetApps([]models.App{{Name: "Portainer", URL: "http://portainer.local"}})
+	app.DiscoveredOverrides = map[string]*models.DiscoveredAppOverride{
+		"http://portainer.local": {URL: "http://portainer.local", Groups: []string{"admins"}},
+	}
+	adminID := seedUser(t, app, "admin", "letmein", "Big Admin", true)
+	seedSession(t, app, adminID, "preview-admin-session")
+	return app, &http.Cookie{Name: "test_session", Value: "preview-admin-session"}
+}
+
+// startPreview starts a preview through the admin API and returns its cookie.
+func startPreview(t *testing.T, app *server.App, body map[string]interface{}) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AdminPreviewHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/preview", body), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.PreviewCookieName {
+			return c
+		}
+	}
+	t.Fatal("expected a preview cookie")
+	return nil
+}
+
+func healthAppNames(t *testing.T, app *server.App, cookies ...*http.Cookie) []string {
+	t.Helper()
+	req := newGet("/api/health")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	APIHealthHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var categories []models.Category
+	json.Unmarshal(w.Body.Bytes(), &categories)
+	var names []string
+	for _, cat := range categories {
+		for _, a := range cat.Apps {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+func TestPreview_GroupsNarrowHealthResults(t *testing.T) {
+	app, session := setupPreviewApp(t)
+
+	if names := healthAppNames(t, app, session); len(names) != 3 {
+		t.Fatalf("expected the admin to see every app, got %v", names)
+	}
+
+	preview := startPreview(t, app, map[string]interface{}{"groups": []string{"kids"}})
+	if names := healthAppNames(t, app, session, preview); len(names) != 1 || names[0] != "Cartoons" {
+		t.Errorf("expected only the kids app while previewing, got %v", names)
+	}
+
+	var entries int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'preview_started' AND detail LIKE '%groups kids%'").Scan(&entries)
+	if entries != 1 {
+		t.Errorf("expected one preview_started audit entry, got %d", entries)
+	}
+}
+
+func TestPreview_AsUserUsesTheirGroups(t *testing.T) {
+	app, session := setupPreviewApp(t)
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('robin', '', '["kids"]')`)
+
+	preview := startPreview(t, app, map[string]interface{}{"username": "robin"})
+	if names := healthAppNames(t, app, session, preview); len(names) != 1 || names[0] != "Cartoons" {
+		t.Errorf("expected robin's view, got %v", names)
+	}
+
+	w := httptest.NewRecorder()
+	AdminPreviewHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/preview", map[string]string{"username": "nobody"}), adminUser()))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown user, got %d", w.Code)
+	}
+}
+
+func TestPreview_AsUserIncludesGrantedGroups(t *testing.T) {
+	app, session := setupPreviewApp(t)
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups, granted_groups) VALUES ('sam', 'OIDC_USER', '[]', '["kids"]')`)
+	if _, err := database.GrantGroup(app, "sam", "admins", "admin", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	preview := startPreview(t, app, map[string]interface{}{"username": "sam"})
+	if names := healthAppNames(t, app, session, preview); len(names) != 3 {
+		t.Errorf("expected invite and temporary groups in sam's view, got %v", names)
+	}
+}
+
+func TestPreview_IgnoredForNonAdmins(t *testing.T) {
+	app, _ := setupPreviewApp(t)
+	userID := seedUser(t, app, "kid", "pass", "Kid", false)
+	app.DB.Exec(`UPDATE users SET groups = '["kids"]' WHERE id = ?`, userID)
+	seedSession(t, app, userID, "preview-kid-session")
+	session := &http.Cookie{Name: "test_session", Value: "preview-kid-session"}
+
+	// A hand-made cookie cannot widen a regular user's view
+	preview := startPreview(t, app, map[string]interface{}{"groups": []string{"admins"}})
+	if names := healthAppNames(t, app, session, preview); len(names) != 1 || names[0] != "Cartoons" {
+		t.Errorf("expected the preview cookie to be ignored, got %v", names)
+	}
+}
+
+func TestPreview_ReadOnly(t *testing.T) {
+	app, session := setupPreviewApp(t)
+	preview := startPreview(t, app, map[string]interface{}{"groups": []string{"kids"}})
+
+	reached := false
+	handler := middleware.PreviewReadOnly(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	req := newPost("/api/user/preferences", map[string]string{"theme": "dark"})
+	req.AddCookie(session)
+	req.AddCookie(preview)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || reached {
+		t.Fatalf("expected writes to be blocked during a preview, got %d", w.Code)
+	}
+
+	// Exiting the preview stays possible
+	req = newDelete("/api/admin/preview")
+	req.AddCookie(session)
+	req.AddCookie(preview)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !reached {
+		t.Error("expected the preview endpoint to stay writable")
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// seedRoleUser signs in a user in the given groups and returns their session cookie.
+func seedRoleUser(t *testing.T, app *server.App, username string, groups string) *http.Cookie {
+	t.Helper()
+	userID := seedUser(t, app, username, "irrelevant-pass", username, false)
+	app.DB.Exec("UPDATE users SET groups = ? WHERE id = ?", groups, userID)
+	seedSession(t, app, userID, username+"-session")
+	return &http.Cookie{Name: "test_session", Value: username + "-session"}
+}
+
+func TestRoles_AppEditorCannotTouchSystemConfig(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.RoleAppEditorGroups = "teens"
+	teen := seedRoleUser(t, app, "teen", `["teens"]`)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	cases := []struct {
+		role auth.Role
+		want int
+	}{
+		{auth.RoleAppEditor, http.StatusOK},
+		{auth.RoleSystemAdmin, http.StatusForbidden},
+		{auth.RoleUserManager, http.StatusForbidden},
+		{auth.RoleAuditor, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := newGet("/api/admin/anything")
+		req.AddCookie(teen)
+		w := httptest.NewRecorder()
+		auth.RequireRole(app, tc.role, ok).ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.role, tc.want, w.Code)
+		}
+	}
+
+	// The admin check lists the roles so the UI can show the right panels
+	req := newGet("/api/admin/check")
+	req.AddCookie(teen)
+	w := httptest.NewRecorder()
+	auth.RequireAnyRole(app, AdminCheckHandler(app)).ServeHTTP(w, req)
+	var resp struct {
+		IsAdmin bool        `json:"isAdmin"`
+		Roles   []auth.Role `json:"roles"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.IsAdmin || len(resp.Roles) != 1 || resp.Roles[0] != auth.RoleAppEditor {
+		t.Errorf("unexpected admin check: %d %+v", w.Code, resp)
+	}
+}
+
+func TestRoles_AdminsHoldEveryRole(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	roles := auth.UserRoles(app, &models.AuthenticatedUser{Username: "root", Groups: []string{"admins"}, IsAdmin: true})
+	if len(roles) != len(auth.AllRoles) {
+		t.Errorf("expected admins to hold every role, got %v", roles)
+	}
+	if roles := auth.UserRoles(app, &models.AuthenticatedUser{Username: "kid", Groups: []string{"kids"}}); len(roles) != 0 {
+		t.Errorf("expected no roles for a regular user, got %v", roles)
+	}
+}
+
+func TestRoles_UserManagerCannotEscalate(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.RoleUserManagerGroups = "helpdesk"
+	app.SystemConfig.RoleSystemAdminGroups = "ops"
+	adminID := seedUser(t, app, "root", "letmein", "Root", true)
+	memberID := seedUser(t, app, "member", "letmein", "Member", false)
+	manager := &models.AuthenticatedUser{Username: "helper", Groups: []string{"helpdesk"}}
+
+	for _, groups := range [][]string{{"admins"}, {"ops"}, {"helpdesk"}} {
+		w := httptest.NewRecorder()
+		LocalUsersHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/local-users", map[string]interface{}{
+			"username": "sneaky", "password": "Sneaky-Pass-123", "groups": groups,
+		}), manager))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected granting %v to be refused, got %d", groups, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		AdminInvitesHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/invites", map[string]interface{}{"groups": groups}), manager))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected inviting into %v to be refused, got %d", groups, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/admin/local-users/"+strconv.Itoa(adminID)+"/password", map[string]string{"password": "Taken-Over-123"}), manager))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected resetting an admin's password to be refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/local-users/"+strconv.Itoa(memberID), map[string]interface{}{
+		"displayName": "Member", "groups": []string{"family"},
+	}), manager))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected managing a regular user to work, got %d: %s", w.Code, w.Body.String())
+	}
+}
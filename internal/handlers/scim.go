@@ -0,0 +1,1126 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// SCIM 2.0 (RFC 7643/7644) provisioning of local users and managed groups.
+// Identity providers authenticate with a bearer token generated in the admin
+// panel and are trusted like a system admin.
+
+const (
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimResTypeSchema  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	// scimMaxResults caps the page size of list responses.
+	scimMaxResults = 200
+	// scimAuditActor is recorded as the user in audit entries.
+	scimAuditActor = "scim"
+)
+
+// scimFilterPattern matches the single-expression filters identity providers
+// send, e.g. userName eq "alice" or displayName sw "fam".
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+(eq|ne|co|sw|ew|pr)\s*(?:"((?:[^"\\]|\\.)*)")?\s*$`)
+
+// scimMemberFilterPattern matches member paths like members[value eq "12"].
+var scimMemberFilterPattern = regexp.MustCompile(`(?i)^members\[value eq "([^"]*)"\]$`)
+
+// scimGroupNameInvalid matches characters not allowed in managed group names.
+var scimGroupNameInvalid = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+func respondSCIM(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func respondSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	respondSCIM(w, status, body)
+}
+
+// scimAuthorized checks the bearer token against the stored hash.
+func scimAuthorized(app *server.App, r *http.Request) (enabled, ok bool) {
+	app.SysConfigMu.RLock()
+	enabled = app.SystemConfig.SCIMEnabled
+	tokenHash := app.SystemConfig.SCIMTokenHash
+	app.SysConfigMu.RUnlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !enabled || tokenHash == "" || token == "" || token == r.Header.Get("Authorization") {
+		return enabled, false
+	}
+	return true, subtle.ConstantTimeCompare([]byte(database.HashToken(token)), []byte(tokenHash)) == 1
+}
+
+// scimLocation returns the absolute URL of a resource when a public URL is
+// configured, or its path otherwise.
+func scimLocation(app *server.App, path string) string {
+	app.SysConfigMu.RLock()
+	publicURL := app.SystemConfig.PublicURL
+	app.SysConfigMu.RUnlock()
+	return strings.TrimRight(publicURL, "/") + "/scim/v2" + path
+}
+
+// SCIMHandler serves /scim/v2/Users, /scim/v2/Groups and the discovery
+// endpoints.
+func SCIMHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enabled, ok := scimAuthorized(app, r)
+		if !enabled {
+			respondSCIMError(w, http.StatusForbidden, "", "SCIM provisioning is disabled")
+			return
+		}
+		if !ok {
+			respondSCIMError(w, http.StatusUnauthorized, "", "Invalid or missing bearer token")
+			return
+		}
+
+		resource, id, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/scim/v2"), "/"), "/")
+		switch resource {
+		case "Users":
+			if id == "" {
+				scimUsersCollection(app, w, r)
+			} else {
+				scimUserResource(app, w, r, id)
+			}
+		case "Groups":
+			if id == "" {
+				scimGroupsCollection(app, w, r)
+			} else {
+				scimGroupResource(app, w, r, id)
+			}
+		case "ServiceProviderConfig":
+			respondSCIM(w, http.StatusOK, scimServiceProviderConfig())
+		case "ResourceTypes":
+			respondSCIM(w, http.StatusOK, scimResourceTypes())
+		default:
+			respondSCIMError(w, http.StatusNotFound, "", "Resource not found")
+		}
+	}
+}
+
+func scimServiceProviderConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":        []string{scimSPConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": map[string]bool{"supported": true},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Token generated under Authentication > SCIM Provisioning",
+		}},
+	}
+}
+
+func scimResourceTypes() map[string]interface{} {
+	types := []map[string]interface{}{
+		{"schemas": []string{scimResTypeSchema}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimUserSchema},
+		{"schemas": []string{scimResTypeSchema}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimGroupSchema},
+	}
+	return scimList(toInterfaces(types), 1, len(types))
+}
+
+func toInterfaces(items []map[string]interface{}) []interface{} {
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		out[i] = item
+	}
+	return out
+}
+
+// scimList wraps one page of resources in a ListResponse.
+func scimList(page []interface{}, startIndex, total int) map[string]interface{} {
+	if page == nil {
+		page = []interface{}{}
+	}
+	return map[string]interface{}{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	}
+}
+
+// scimPage applies startIndex (1-based) and count to a filtered result set.
+func scimPage(r *http.Request, items []interface{}) map[string]interface{} {
+	start, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 0 || count > scimMaxResults {
+		count = scimMaxResults
+	}
+	from := start - 1
+	if from > len(items) {
+		from = len(items)
+	}
+	to := from + count
+	if to > len(items) {
+		to = len(items)
+	}
+	return scimList(items[from:to], start, len(items))
+}
+
+// scimFilter is a parsed single-expression filter.
+type scimFilter struct {
+	attr, op, value string
+}
+
+func parseSCIMFilter(filter string) (*scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	m := scimFilterPattern.FindStringSubmatch(filter)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported filter %q", filter)
+	}
+	op := strings.ToLower(m[2])
+	value := strings.ReplaceAll(strings.ReplaceAll(m[3], `\"`, `"`), `\\`, `\`)
+	if op != "pr" && m[3] == "" && !strings.Contains(filter, `""`) {
+		return nil, fmt.Errorf("filter %q needs a quoted value", filter)
+	}
+	return &scimFilter{attr: strings.ToLower(m[1]), op: op, value: value}, nil
+}
+
+// matches compares the filter against the attribute values of a resource.
+// String comparisons ignore case, as the attributes DashGate exposes are
+// not case-exact.
+func (f *scimFilter) matches(values map[string][]string) bool {
+	if f == nil {
+		return true
+	}
+	attrValues := values[f.attr]
+	if f.op == "pr" {
+		for _, v := range attrValues {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	want := strings.ToLower(f.value)
+	for _, v := range attrValues {
+		v = strings.ToLower(v)
+		switch f.op {
+		case "eq":
+			if v == want {
+				return true
+			}
+		case "ne":
+			if v != want {
+				return true
+			}
+		case "co":
+			if strings.Contains(v, want) {
+				return true
+			}
+		case "sw":
+			if strings.HasPrefix(v, want) {
+				return true
+			}
+		case "ew":
+			if strings.HasSuffix(v, want) {
+				return true
+			}
+		}
+	}
+	return f.op == "ne" && len(attrValues) == 0
+}
+
+func scimMeta(app *server.App, resourceType, path string, created, updated time.Time) map[string]string {
+	return map[string]string{
+		"resourceType": resourceType,
+		"created":      created.UTC().Format(time.RFC3339),
+		"lastModified": updated.UTC().Format(time.RFC3339),
+		"location":     scimLocation(app, path),
+	}
+}
+
+// --- Users ---
+
+func scimUserJSON(app *server.App, u *database.DirectoryUser) map[string]interface{} {
+	id := strconv.Itoa(u.ID)
+	res := map[string]interface{}{
+		"schemas":     []string{scimUserSchema},
+		"id":          id,
+		"userName":    u.Username,
+		"displayName": u.DisplayName,
+		"name":        map[string]string{"formatted": u.DisplayName},
+		"active":      !u.Disabled,
+		"meta":        scimMeta(app, "User", "/Users/"+id, u.CreatedAt, u.UpdatedAt),
+	}
+	if u.ExternalID != "" {
+		res["externalId"] = u.ExternalID
+	}
+	if u.Email != "" {
+		res["emails"] = []map[string]interface{}{{"value": u.Email, "type": "work", "primary": true}}
+	}
+	groups := make([]map[string]string, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		groups = append(groups, map[string]string{"value": g, "display": g, "$ref": scimLocation(app, "/Groups/"+g)})
+	}
+	res["groups"] = groups
+	return res
+}
+
+func scimUserFilterValues(u *database.DirectoryUser) map[string][]string {
+	return map[string][]string{
+		"id":             {strconv.Itoa(u.ID)},
+		"username":       {u.Username},
+		"externalid":     {u.ExternalID},
+		"displayname":    {u.DisplayName},
+		"name.formatted": {u.DisplayName},
+		"emails":         {u.Email},
+		"emails.value":   {u.Email},
+		"groups":         u.Groups,
+		"groups.value":   u.Groups,
+		"active":         {strconv.FormatBool(!u.Disabled)},
+	}
+}
+
+// scimUserInput is the body of a user POST or PUT.
+type scimUserInput struct {
+	UserName    string `json:"userName"`
+	ExternalID  string `json:"externalId"`
+	DisplayName string `json:"displayName"`
+	Name        struct {
+		Formatted  string `json:"formatted"`
+		GivenName  string `json:"givenName"`
+		FamilyName string `json:"familyName"`
+	} `json:"name"`
+	Emails   []scimEmail `json:"emails"`
+	Active   *bool       `json:"active"`
+	Password string      `json:"password"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"`
+}
+
+// primaryEmail returns the primary address, or the first one.
+func primaryEmail(emails []scimEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+	return ""
+}
+
+// apply replaces the user's attributes with those in the input.
+func (in *scimUserInput) apply(u *database.DirectoryUser) {
+	u.Username = strings.TrimSpace(in.UserName)
+	u.ExternalID = in.ExternalID
+	u.Email = primaryEmail(in.Emails)
+	u.DisplayName = in.DisplayName
+	if u.DisplayName == "" {
+		u.DisplayName = in.Name.Formatted
+	}
+	if u.DisplayName == "" {
+		u.DisplayName = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+	}
+	u.Disabled = in.Active != nil && !*in.Active
+}
+
+// respondSCIMWriteError maps database errors from user and group writes.
+func respondSCIMWriteError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		respondSCIMError(w, http.StatusConflict, "uniqueness", "A resource with this name or email already exists")
+		return
+	}
+	log.Printf("SCIM write failed: %v", err)
+	respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+}
+
+// scimHashPassword checks a provisioned password against the policy.
+func scimHashPassword(app *server.App, w http.ResponseWriter, password string) (string, bool) {
+	if err := auth.CheckPasswordPolicy(app, password); err != nil {
+		respondSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return "", false
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+		return "", false
+	}
+	return hash, true
+}
+
+func scimUsersCollection(app *server.App, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+		if err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		users, err := database.ListDirectoryUsers(app)
+		if err != nil {
+			log.Printf("SCIM: failed to list users: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		var matched []interface{}
+		for i := range users {
+			if filter.matches(scimUserFilterValues(&users[i])) {
+				matched = append(matched, scimUserJSON(app, &users[i]))
+			}
+		}
+		respondSCIM(w, http.StatusOK, scimPage(r, matched))
+
+	case http.MethodPost:
+		var in scimUserInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		var u database.DirectoryUser
+		in.apply(&u)
+		if u.Username == "" {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+			return
+		}
+		passwordHash := ""
+		if in.Password != "" {
+			var ok bool
+			if passwordHash, ok = scimHashPassword(app, w, in.Password); !ok {
+				return
+			}
+		}
+		id, err := database.CreateDirectoryUser(app, u, passwordHash)
+		if err != nil {
+			respondSCIMWriteError(w, err)
+			return
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_user_created", fmt.Sprintf("Provisioned user %q (id=%d)", u.Username, id), auth.ClientIP(r))
+
+		created, err := database.GetDirectoryUser(app, int(id))
+		if err != nil {
+			log.Printf("SCIM: failed to reload user: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		w.Header().Set("Location", scimLocation(app, "/Users/"+strconv.FormatInt(id, 10)))
+		respondSCIM(w, http.StatusCreated, scimUserJSON(app, created))
+
+	default:
+		respondSCIMError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+func scimUserResource(app *server.App, w http.ResponseWriter, r *http.Request, rawID string) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		respondSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	u, err := database.GetDirectoryUser(app, id)
+	if err == sql.ErrNoRows {
+		respondSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("SCIM: failed to load user: %v", err)
+		respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+		return
+	}
+	wasDisabled := u.Disabled
+
+	if r.Method != http.MethodGet {
+		managed, err := scimManagesUser(app, u)
+		if err != nil {
+			log.Printf("SCIM: failed to load user: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		if !managed {
+			respondSCIMError(w, http.StatusForbidden, "", "This user is not managed by provisioning")
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondSCIM(w, http.StatusOK, scimUserJSON(app, u))
+		return
+
+	case http.MethodPut:
+		var in scimUserInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		in.apply(u)
+		if u.Username == "" {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+			return
+		}
+		if !scimSaveUser(app, w, r, u, wasDisabled, in.Password) {
+			return
+		}
+
+	case http.MethodPatch:
+		var patch scimPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		password := ""
+		for _, op := range patch.Operations {
+			if err := applySCIMUserOp(u, op, &password); err != nil {
+				respondSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+		if u.Username == "" {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+			return
+		}
+		if !scimSaveUser(app, w, r, u, wasDisabled, password) {
+			return
+		}
+
+	case http.MethodDelete:
+		if _, err := database.DeleteUser(app, id); err != nil {
+			log.Printf("SCIM: failed to delete user: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_user_deleted", fmt.Sprintf("Deprovisioned user %q (id=%d)", u.Username, id), auth.ClientIP(r))
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		respondSCIMError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+
+	updated, err := database.GetDirectoryUser(app, id)
+	if err != nil {
+		log.Printf("SCIM: failed to reload user: %v", err)
+		respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+		return
+	}
+	respondSCIM(w, http.StatusOK, scimUserJSON(app, updated))
+}
+
+// scimManagesUser reports whether provisioning clients may change or delete
+// a user: accounts they provisioned, and local accounts that are not admins.
+// Admins and accounts created by LDAP or OIDC sign-ins are left alone.
+func scimManagesUser(app *server.App, u *database.DirectoryUser) (bool, error) {
+	row, err := database.GetUserByID(app, u.ID)
+	if err != nil {
+		return false, err
+	}
+	switch row.PasswordHash {
+	case database.ProvisionedPasswordHash:
+		return true, nil
+	case "LDAP_USER", "OIDC_USER":
+		return false, nil
+	}
+	return !auth.CheckIsAdmin(app, u.Groups), nil
+}
+
+// scimSaveUser stores a replaced or patched user and, if given, their new
+// password.
+func scimSaveUser(app *server.App, w http.ResponseWriter, r *http.Request, u *database.DirectoryUser, wasDisabled bool, password string) bool {
+	passwordHash := ""
+	if password != "" {
+		var ok bool
+		if passwordHash, ok = scimHashPassword(app, w, password); !ok {
+			return false
+		}
+	}
+
+	if err := database.UpdateDirectoryUser(app, *u); err != nil {
+		respondSCIMWriteError(w, err)
+		return false
+	}
+	if passwordHash != "" {
+		if _, err := database.UpdateUserPassword(app, u.ID, passwordHash); err != nil {
+			log.Printf("SCIM: failed to set password: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return false
+		}
+	}
+
+	action, detail := "scim_user_updated", fmt.Sprintf("Updated user %q (id=%d)", u.Username, u.ID)
+	switch {
+	case u.Disabled && !wasDisabled:
+		action, detail = "scim_user_deactivated", fmt.Sprintf("Deactivated user %q (id=%d)", u.Username, u.ID)
+	case !u.Disabled && wasDisabled:
+		action, detail = "scim_user_reactivated", fmt.Sprintf("Reactivated user %q (id=%d)", u.Username, u.ID)
+	}
+	audit.LogAudit(app, scimAuditActor, action, detail, auth.ClientIP(r))
+	return true
+}
+
+// scimPatch is a PatchOp request body.
+type scimPatch struct {
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+type scimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimString decodes a string value, tolerating a one-element list.
+func scimString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var list []struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) > 0 {
+		return list[0].Value, nil
+	}
+	return "", fmt.Errorf("expected a string value")
+}
+
+// scimBool decodes a boolean, also accepting "True"/"False" strings as some
+// providers send them.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, fmt.Errorf("expected a boolean value")
+}
+
+// applySCIMUserOp applies one PATCH operation to a user. Attributes DashGate
+// does not store are ignored so providers can send their full mapping.
+func applySCIMUserOp(u *database.DirectoryUser, op scimPatchOp, password *string) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return fmt.Errorf("remove requires a path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("expected an object value")
+		}
+		// Apply in a fixed order so results do not depend on map iteration
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if strings.EqualFold(k, "name") {
+				var name struct {
+					Formatted string `json:"formatted"`
+				}
+				if json.Unmarshal(attrs[k], &name) == nil && name.Formatted != "" {
+					u.DisplayName = name.Formatted
+				}
+				continue
+			}
+			if err := setSCIMUserAttr(u, strings.ToLower(k), attrs[k], password); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path := strings.ToLower(op.Path)
+	if kind == "remove" {
+		switch {
+		case path == "externalid":
+			u.ExternalID = ""
+		case path == "displayname" || path == "name.formatted":
+			u.DisplayName = ""
+		case strings.HasPrefix(path, "emails"):
+			u.Email = ""
+		}
+		return nil
+	}
+	return setSCIMUserAttr(u, path, op.Value, password)
+}
+
+func setSCIMUserAttr(u *database.DirectoryUser, attr string, raw json.RawMessage, password *string) error {
+	var err error
+	switch {
+	case attr == "active":
+		var active bool
+		active, err = scimBool(raw)
+		u.Disabled = !active
+	case attr == "username":
+		u.Username, err = scimString(raw)
+		u.Username = strings.TrimSpace(u.Username)
+	case attr == "displayname" || attr == "name.formatted":
+		u.DisplayName, err = scimString(raw)
+	case attr == "externalid":
+		u.ExternalID, err = scimString(raw)
+	case attr == "emails":
+		var emails []scimEmail
+		if err = json.Unmarshal(raw, &emails); err == nil {
+			u.Email = primaryEmail(emails)
+		}
+	case strings.HasPrefix(attr, "emails[") || attr == "emails.value":
+		u.Email, err = scimString(raw)
+		u.Email = strings.TrimSpace(u.Email)
+	case attr == "password":
+		*password, err = scimString(raw)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", attr, err)
+	}
+	return nil
+}
+
+// --- Groups ---
+
+// scimGroupJSON renders a managed group and its members.
+func scimGroupJSON(app *server.App, g database.ManagedGroup, users []database.DirectoryUser) map[string]interface{} {
+	members := []map[string]string{}
+	for _, u := range users {
+		for _, name := range u.Groups {
+			if name == g.Name {
+				id := strconv.Itoa(u.ID)
+				members = append(members, map[string]string{"value": id, "display": u.Username, "$ref": scimLocation(app, "/Users/"+id)})
+				break
+			}
+		}
+	}
+	return map[string]interface{}{
+		"schemas":     []string{scimGroupSchema},
+		"id":          g.Name,
+		"displayName": g.DisplayName,
+		"members":     members,
+		"meta": map[string]string{
+			"resourceType": "Group",
+			"location":     scimLocation(app, "/Groups/"+g.Name),
+		},
+	}
+}
+
+func scimGroupFilterValues(g database.ManagedGroup) map[string][]string {
+	return map[string][]string{
+		"id":          {g.Name},
+		"displayname": {g.DisplayName},
+	}
+}
+
+// scimGroupName derives a managed group name from a SCIM display name.
+func scimGroupName(displayName string) string {
+	name := strings.ToLower(strings.TrimSpace(displayName))
+	name = strings.ReplaceAll(name, " ", "-")
+	return strings.Trim(scimGroupNameInvalid.ReplaceAllString(name, ""), "-")
+}
+
+// scimMemberIDs decodes a list of {"value": "<user id>"} members and checks
+// that the users exist.
+func scimMemberIDs(app *server.App, raw json.RawMessage) ([]int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var members []struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &members); err != nil {
+		var single struct {
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil, fmt.Errorf("expected a list of members")
+		}
+		members = append(members, single)
+	}
+	ids := make([]int, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("unknown member %q", m.Value)
+		}
+		if _, err := database.GetDirectoryUser(app, id); err != nil {
+			return nil, fmt.Errorf("unknown member %q", m.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setSCIMMembers adds or removes the users in ids to or from the group.
+// Users provisioning does not manage (see scimManagesUser) are skipped.
+func setSCIMMembers(app *server.App, group string, ids []int, member bool) error {
+	for _, id := range ids {
+		u, err := database.GetDirectoryUser(app, id)
+		if err != nil {
+			return err
+		}
+		managed, err := scimManagesUser(app, u)
+		if err != nil {
+			return err
+		}
+		if !managed {
+			continue
+		}
+		if err := database.SetUserGroupMembership(app, id, group, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceSCIMMembers makes ids the exact member list of the group, as far as
+// provisioning manages the users involved.
+func replaceSCIMMembers(app *server.App, group string, ids []int) error {
+	keep := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	users, err := database.ListDirectoryUsers(app)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		for _, g := range u.Groups {
+			if g == group && !keep[u.ID] {
+				if err := setSCIMMembers(app, group, []int{u.ID}, false); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return setSCIMMembers(app, group, ids, true)
+}
+
+func scimGroupsCollection(app *server.App, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+		if err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		groups, err := database.ListManagedGroups(app)
+		if err != nil {
+			log.Printf("SCIM: failed to list groups: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		users, err := database.ListDirectoryUsers(app)
+		if err != nil {
+			log.Printf("SCIM: failed to list users: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		var matched []interface{}
+		for _, g := range groups {
+			if filter.matches(scimGroupFilterValues(g)) {
+				matched = append(matched, scimGroupJSON(app, g, users))
+			}
+		}
+		respondSCIM(w, http.StatusOK, scimPage(r, matched))
+
+	case http.MethodPost:
+		var in struct {
+			DisplayName string          `json:"displayName"`
+			Members     json.RawMessage `json:"members"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		name := scimGroupName(in.DisplayName)
+		if name == "" {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "displayName must contain letters or digits")
+			return
+		}
+		ids, err := scimMemberIDs(app, in.Members)
+		if err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		if err := database.CreateManagedGroup(app, name, strings.TrimSpace(in.DisplayName)); err != nil {
+			respondSCIMWriteError(w, err)
+			return
+		}
+		if err := setSCIMMembers(app, name, ids, true); err != nil {
+			respondSCIMWriteError(w, err)
+			return
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_group_created", fmt.Sprintf("Provisioned group %q with %d members", name, len(ids)), auth.ClientIP(r))
+		w.Header().Set("Location", scimLocation(app, "/Groups/"+name))
+		scimRespondGroup(app, w, name, http.StatusCreated)
+
+	default:
+		respondSCIMError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+func scimRespondGroup(app *server.App, w http.ResponseWriter, name string, status int) {
+	g, err := database.GetManagedGroup(app, name)
+	if err == nil {
+		var users []database.DirectoryUser
+		if users, err = database.ListDirectoryUsers(app); err == nil {
+			respondSCIM(w, status, scimGroupJSON(app, *g, users))
+			return
+		}
+	}
+	log.Printf("SCIM: failed to reload group: %v", err)
+	respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+}
+
+func scimGroupResource(app *server.App, w http.ResponseWriter, r *http.Request, name string) {
+	g, err := database.GetManagedGroup(app, name)
+	if err == sql.ErrNoRows {
+		respondSCIMError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	if err != nil {
+		log.Printf("SCIM: failed to load group: %v", err)
+		respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scimRespondGroup(app, w, name, http.StatusOK)
+
+	case http.MethodPut:
+		var in struct {
+			DisplayName string          `json:"displayName"`
+			Members     json.RawMessage `json:"members"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		ids, err := scimMemberIDs(app, in.Members)
+		if err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		if in.DisplayName != "" && in.DisplayName != g.DisplayName {
+			if err := database.RenameManagedGroup(app, name, in.DisplayName); err != nil {
+				respondSCIMWriteError(w, err)
+				return
+			}
+		}
+		if err := replaceSCIMMembers(app, name, ids); err != nil {
+			respondSCIMWriteError(w, err)
+			return
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_group_updated", fmt.Sprintf("Replaced group %q with %d members", name, len(ids)), auth.ClientIP(r))
+		scimRespondGroup(app, w, name, http.StatusOK)
+
+	case http.MethodPatch:
+		var patch scimPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+		for _, op := range patch.Operations {
+			if err := applySCIMGroupOp(app, g, op); err != nil {
+				respondSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_group_updated", fmt.Sprintf("Patched group %q (%d operations)", name, len(patch.Operations)), auth.ClientIP(r))
+		scimRespondGroup(app, w, name, http.StatusOK)
+
+	case http.MethodDelete:
+		err := replaceSCIMMembers(app, name, nil)
+		if err == nil {
+			err = database.DeleteManagedGroup(app, name)
+		}
+		if err != nil {
+			log.Printf("SCIM: failed to delete group: %v", err)
+			respondSCIMError(w, http.StatusInternalServerError, "", "Internal server error")
+			return
+		}
+		audit.LogAudit(app, scimAuditActor, "scim_group_deleted", fmt.Sprintf("Deprovisioned group %q", name), auth.ClientIP(r))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		respondSCIMError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+// applySCIMGroupOp applies one PATCH operation to a group's display name or
+// members.
+func applySCIMGroupOp(app *server.App, g *database.ManagedGroup, op scimPatchOp) error {
+	kind := strings.ToLower(op.Op)
+	path := strings.ToLower(op.Path)
+
+	if m := scimMemberFilterPattern.FindStringSubmatch(op.Path); m != nil {
+		if kind != "remove" {
+			return fmt.Errorf("unsupported operation %q on %s", op.Op, op.Path)
+		}
+		ids, err := scimMemberIDs(app, json.RawMessage(fmt.Sprintf(`[{"value":%q}]`, m[1])))
+		if err != nil {
+			return err
+		}
+		return setSCIMMembers(app, g.Name, ids, false)
+	}
+
+	switch {
+	case path == "" && (kind == "add" || kind == "replace"):
+		var attrs struct {
+			DisplayName string          `json:"displayName"`
+			Members     json.RawMessage `json:"members"`
+		}
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("expected an object value")
+		}
+		if attrs.DisplayName != "" {
+			if err := database.RenameManagedGroup(app, g.Name, attrs.DisplayName); err != nil {
+				return err
+			}
+		}
+		if attrs.Members != nil {
+			return applySCIMGroupOp(app, g, scimPatchOp{Op: op.Op, Path: "members", Value: attrs.Members})
+		}
+		return nil
+
+	case path == "displayname" && (kind == "add" || kind == "replace"):
+		name, err := scimString(op.Value)
+		if err != nil {
+			return err
+		}
+		return database.RenameManagedGroup(app, g.Name, name)
+
+	case path == "members":
+		ids, err := scimMemberIDs(app, op.Value)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case "add":
+			return setSCIMMembers(app, g.Name, ids, true)
+		case "replace":
+			return replaceSCIMMembers(app, g.Name, ids)
+		case "remove":
+			// Without a value, remove every member
+			if len(op.Value) == 0 || string(op.Value) == "null" {
+				return replaceSCIMMembers(app, g.Name, nil)
+			}
+			return setSCIMMembers(app, g.Name, ids, false)
+		}
+	}
+	return fmt.Errorf("unsupported operation %q on %q", op.Op, op.Path)
+}
+
+// AdminSCIMHandler gets (GET) and updates (PUT) the SCIM settings. A PUT with
+// "regenerateToken" returns a new bearer token; it is shown only once.
+func AdminSCIMHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.SysConfigMu.RLock()
+			resp := map[string]interface{}{
+				"enabled":  app.SystemConfig.SCIMEnabled,
+				"hasToken": app.SystemConfig.SCIMTokenHash != "",
+			}
+			app.SysConfigMu.RUnlock()
+			resp["baseUrl"] = scimLocation(app, "")
+			respondJSON(w, http.StatusOK, resp)
+
+		case http.MethodPut:
+			var req struct {
+				Enabled         bool `json:"enabled"`
+				RegenerateToken bool `json:"regenerateToken"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+
+			token := ""
+			if req.RegenerateToken {
+				var err error
+				if token, err = auth.GenerateSessionToken(); err != nil {
+					log.Printf("Failed to generate SCIM token: %v", err)
+					respondError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+			}
+
+			app.SysConfigMu.Lock()
+			app.SystemConfig.SCIMEnabled = req.Enabled
+			if token != "" {
+				app.SystemConfig.SCIMTokenHash = database.HashToken(token)
+			}
+			app.SysConfigMu.Unlock()
+
+			if err := database.SaveSystemConfig(app); err != nil {
+				log.Printf("Failed to save SCIM config: %v", err)
+				respondError(w, http.StatusInternalServerError, "Failed to save configuration")
+				return
+			}
+
+			adminName := ""
+			if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+				adminName = adminUser.Username
+			}
+			detail := fmt.Sprintf("Updated SCIM settings (enabled=%v)", req.Enabled)
+			if token != "" {
+				detail += ", generated a new token"
+			}
+			audit.LogAudit(app, adminName, "scim_config_updated", detail, auth.ClientIP(r))
+
+			resp := map[string]string{"status": "ok"}
+			if token != "" {
+				resp["token"] = token
+			}
+			respondJSON(w, http.StatusOK, resp)
+
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
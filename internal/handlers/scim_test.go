@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// setupSCIMApp enables SCIM through the admin API and returns the token.
+func setupSCIMApp(t *testing.T) (*server.App, string) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	w := httptest.NewRecorder()
+	AdminSCIMHandler(app).ServeHTTP(w, auth.WithUser(newPut("/api/admin/scim", map[string]bool{
+		"enabled": true, "regenerateToken": true,
+	}), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 enabling SCIM, got %d: %s", w.Code, w.Body.String())
+	}
+	token, _ := parseMap(w.Body.Bytes())["token"].(string)
+	if token == "" || app.SystemConfig.SCIMTokenHash == token {
+		t.Fatalf("expected a token that is stored only as a hash")
+	}
+	return app, token
+}
+
+// scimDo sends a SCIM request and decodes the response body.
+func scimDo(t *testing.T, app *server.App, token, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, jsonBody(body))
+	req.Header.Set("Content-Type", "application/scim+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	SCIMHandler(app).ServeHTTP(w, req)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestSCIM_RequiresToken(t *testing.T) {
+	app, token := setupSCIMApp(t)
+
+	if code, _ := scimDo(t, app, "", http.MethodGet, "/scim/v2/Users", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", code)
+	}
+	if code, _ := scimDo(t, app, "wrong-token", http.MethodGet, "/scim/v2/Users", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", code)
+	}
+
+	app.SystemConfig.SCIMEnabled = false
+	if code, _ := scimDo(t, app, token, http.MethodGet, "/scim/v2/Users", nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 while disabled, got %d", code)
+	}
+}
+
+func TestSCIM_UserLifecycle(t *testing.T) {
+	app, token := setupSCIMApp(t)
+
+	code, user := scimDo(t, app, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{
+		"schemas":    []string{scimUserSchema},
+		"userName":   "robin",
+		"externalId": "00u123",
+		"name":       map[string]string{"givenName": "Robin", "familyName": "Hood"},
+		"emails":     []map[string]interface{}{{"value": "robin@example.com", "primary": true}},
+		"active":     true,
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %v", code, user)
+	}
+	id := user["id"].(string)
+	if user["displayName"] != "Robin Hood" || user["active"] != true {
+		t.Errorf("unexpected user: %v", user)
+	}
+
+	code, list := scimDo(t, app, token, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22ROBIN%22`, nil)
+	if code != http.StatusOK || list["totalResults"] != float64(1) {
+		t.Fatalf("expected the filter to find robin, got %d: %v", code, list)
+	}
+	if code, list = scimDo(t, app, token, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22nobody%22`, nil); list["totalResults"] != float64(0) {
+		t.Errorf("expected no results, got %v", list)
+	}
+	if code, _ = scimDo(t, app, token, http.MethodGet, `/scim/v2/Users?filter=userName+gt+1`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unsupported filter, got %d", code)
+	}
+
+	// Deactivating ends sessions and blocks sign-in
+	userID, _ := strconv.Atoi(id)
+	seedSession(t, app, userID, "robin-session")
+	code, user = scimDo(t, app, token, http.MethodPatch, "/scim/v2/Users/"+id, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "Replace", "path": "active", "value": "False"}},
+	})
+	if code != http.StatusOK || user["active"] != false {
+		t.Fatalf("expected the user to be deactivated, got %d: %v", code, user)
+	}
+	if _, err := database.GetUserBySession(app, "robin-session"); err == nil {
+		t.Error("expected the session of a deactivated user to stop working")
+	}
+	if err := auth.CheckAdmission(app, auth.AdmissionCandidate{Source: "oidc", Username: "robin"}); err == nil {
+		t.Error("expected a deactivated user to be refused at sign-in")
+	}
+
+	if code, _ = scimDo(t, app, token, http.MethodDelete, "/scim/v2/Users/"+id, nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code, _ = scimDo(t, app, token, http.MethodGet, "/scim/v2/Users/"+id, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", code)
+	}
+
+	var entries int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE username = 'scim' AND action IN ('scim_user_created', 'scim_user_deactivated', 'scim_user_deleted')").Scan(&entries)
+	if entries != 3 {
+		t.Errorf("expected 3 audit entries, got %d", entries)
+	}
+}
+
+func TestSCIM_OnlyManagesProvisionedAndLocalUsers(t *testing.T) {
+	app, token := setupSCIMApp(t)
+	adminID := seedUser(t, app, "boss", "letmein", "Boss", true)
+	localID := seedUser(t, app, "temp", "letmein", "Temp", false)
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('dirk', 'LDAP_USER', '[]'), ('olga', 'OIDC_USER', '[]')`)
+	ldapID, _ := database.GetUserIDByUsername(app, "dirk")
+	oidcID, _ := database.GetUserIDByUsername(app, "olga")
+
+	deactivate := map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": false}},
+	}
+	for _, id := range []int{adminID, ldapID, oidcID} {
+		path := "/scim/v2/Users/" + strconv.Itoa(id)
+		if code, _ := scimDo(t, app, token, http.MethodGet, path, nil); code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, code)
+		}
+		if code, _ := scimDo(t, app, token, http.MethodPatch, path, deactivate); code != http.StatusForbidden {
+			t.Errorf("PATCH %s: expected 403, got %d", path, code)
+		}
+		if code, _ := scimDo(t, app, token, http.MethodPut, path, map[string]interface{}{"userName": "taken-over"}); code != http.StatusForbidden {
+			t.Errorf("PUT %s: expected 403, got %d", path, code)
+		}
+		if code, _ := scimDo(t, app, token, http.MethodDelete, path, nil); code != http.StatusForbidden {
+			t.Errorf("DELETE %s: expected 403, got %d", path, code)
+		}
+	}
+	if database.IsUserDisabled(app, "boss") {
+		t.Error("expected the admin to stay active")
+	}
+
+	if code, _ := scimDo(t, app, token, http.MethodPatch, "/scim/v2/Users/"+strconv.Itoa(localID), deactivate); code != http.StatusOK {
+		t.Errorf("expected a local non-admin account to be managed, got %d", code)
+	}
+}
+
+func TestSCIM_GroupsLeaveUnmanagedMembersAlone(t *testing.T) {
+	app, token := setupSCIMApp(t)
+	adminID := seedUser(t, app, "boss", "letmein", "Boss", true)
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('dirk', 'LDAP_USER', '["admins"]')`)
+	ldapID, _ := database.GetUserIDByUsername(app, "dirk")
+	if code, _ := scimDo(t, app, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{"displayName": "admins"}); code != http.StatusCreated {
+		t.Fatalf("expected the group to be created, got %d", code)
+	}
+
+	path := "/scim/v2/Groups/admins"
+	for _, id := range []int{adminID, ldapID} {
+		scimDo(t, app, token, http.MethodPatch, path, map[string]interface{}{
+			"Operations": []map[string]interface{}{{"op": "remove", "path": `members[value eq "` + strconv.Itoa(id) + `"]`}},
+		})
+		scimDo(t, app, token, http.MethodPut, path, map[string]interface{}{"displayName": "admins", "members": []map[string]string{}})
+		if groups, _ := database.GetUserGroupsByID(app, id); len(groups) != 1 || groups[0] != "admins" {
+			t.Errorf("expected user %d to stay in admins, got %v", id, groups)
+		}
+	}
+
+	scimDo(t, app, token, http.MethodDelete, path, nil)
+	if !auth.CheckIsAdmin(app, mustUserGroups(t, app, adminID)) {
+		t.Error("expected deleting the group to leave the admin an admin")
+	}
+
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('olga', 'OIDC_USER', '[]')`)
+	oidcID, _ := database.GetUserIDByUsername(app, "olga")
+	scimDo(t, app, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{
+		"displayName": "media",
+		"members":     []map[string]string{{"value": strconv.Itoa(oidcID)}},
+	})
+	if groups := mustUserGroups(t, app, oidcID); len(groups) != 0 {
+		t.Errorf("expected the OIDC account's groups to be left alone, got %v", groups)
+	}
+}
+
+func mustUserGroups(t *testing.T, app *server.App, id int) []string {
+	t.Helper()
+	groups, err := database.GetUserGroupsByID(app, id)
+	if err != nil {
+		t.Fatalf("failed to load groups: %v", err)
+	}
+	return groups
+}
+
+func TestSCIM_RenameKeepsUserData(t *testing.T) {
+	app, token := setupSCIMApp(t)
+	code, user := scimDo(t, app, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "jsmith"})
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %v", code, user)
+	}
+	id := user["id"].(string)
+	userID, _ := strconv.Atoi(id)
+	if _, err := database.GrantGroup(app, "jsmith", "media", "admin", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateAccessRequest(app, "jsmith", "Plex", []string{"media"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SavePreferences(app, userID, "jsmith", `{"theme":"dark"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	code, user = scimDo(t, app, token, http.MethodPatch, "/scim/v2/Users/"+id, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "userName", "value": "john.smith"}},
+	})
+	if code != http.StatusOK || user["userName"] != "john.smith" {
+		t.Fatalf("expected the rename to succeed, got %d: %v", code, user)
+	}
+
+	for _, table := range []string{"group_grants", "access_requests", "user_preferences"} {
+		var old, renamed int
+		app.DB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE username = 'jsmith'").Scan(&old)
+		app.DB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE username = 'john.smith'").Scan(&renamed)
+		if old != 0 || renamed != 1 {
+			t.Errorf("%s: expected the row to follow the rename, got %d old and %d renamed", table, old, renamed)
+		}
+	}
+}
+
+func TestSCIM_GroupMembership(t *testing.T) {
+	app, token := setupSCIMApp(t)
+	_, alice := scimDo(t, app, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "alice"})
+	_, bob := scimDo(t, app, token, http.MethodPost, "/scim/v2/Users", map[string]interface{}{"userName": "bob"})
+	aliceID, bobID := alice["id"].(string), bob["id"].(string)
+
+	code, group := scimDo(t, app, token, http.MethodPost, "/scim/v2/Groups", map[string]interface{}{
+		"displayName": "Family Members",
+		"members":     []map[string]string{{"value": aliceID}},
+	})
+	if code != http.StatusCreated || group["id"] != "family-members" {
+		t.Fatalf("expected the group to be created, got %d: %v", code, group)
+	}
+
+	code, group = scimDo(t, app, token, http.MethodPatch, "/scim/v2/Groups/family-members", map[string]interface{}{
+		"Operations": []map[string]interface{}{
+			{"op": "add", "path": "members", "value": []map[string]string{{"value": bobID}}},
+			{"op": "remove", "path": `members[value eq "` + aliceID + `"]`},
+		},
+	})
+	if members := group["members"].([]interface{}); code != http.StatusOK || len(members) != 1 {
+		t.Fatalf("expected only bob to remain, got %d: %v", code, group)
+	}
+
+	// Memberships survive an identity provider sign-in
+	granted, _ := database.GetGrantedGroups(app, "bob")
+	if len(granted) != 1 || granted[0] != "family-members" {
+		t.Errorf("expected the group to be recorded as granted, got %v", granted)
+	}
+
+	code, list := scimDo(t, app, token, http.MethodGet, `/scim/v2/Groups?filter=displayName+eq+%22Family+Members%22`, nil)
+	if code != http.StatusOK || list["totalResults"] != float64(1) {
+		t.Errorf("expected the displayName filter to match, got %v", list)
+	}
+
+	if code, _ = scimDo(t, app, token, http.MethodDelete, "/scim/v2/Groups/family-members", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	bobUserID, _ := strconv.Atoi(bobID)
+	groups, _ := database.GetUserGroupsByID(app, bobUserID)
+	if len(groups) != 0 {
+		t.Errorf("expected deleting the group to remove it from members, got %v", groups)
+	}
+}
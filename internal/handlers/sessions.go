@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// UserSessionsHandler lists the signed-in user's sessions (GET
+// /api/user/sessions) and revokes one of them (DELETE /api/user/sessions/{id}).
+func UserSessionsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.UserFromContext(r.Context())
+		if user == nil {
+			respondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Proxy and API key users have no DashGate sessions, and the username
+		// a proxy asserts may belong to an unrelated local account
+		if !auth.HasSession(user) {
+			respondError(w, http.StatusForbidden, "Sessions are only available when signed in to DashGate directly")
+			return
+		}
+
+		userID, err := database.GetUserIDByUsername(app, user.Username)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error looking up user: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/sessions"), "/")
+
+		switch {
+		case r.Method == http.MethodGet && idPart == "":
+			if userID == 0 {
+				respondJSON(w, http.StatusOK, []models.UserSession{})
+				return
+			}
+			listSessions(app, w, r, userID)
+
+		case r.Method == http.MethodDelete && idPart != "":
+			sessionID, err := strconv.Atoi(idPart)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid session ID")
+				return
+			}
+			if userID == 0 {
+				respondError(w, http.StatusNotFound, "Session not found")
+				return
+			}
+			if !revokeSession(app, w, userID, sessionID) {
+				return
+			}
+			audit.LogAudit(app, user.Username, "session_revoked", fmt.Sprintf("Revoked own session id=%d", sessionID), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// adminUserSessions handles /api/admin/local-users/{id}/sessions[/{sessionID}]:
+// GET lists the user's sessions, DELETE without a session ID signs the user
+// out everywhere, and DELETE with one revokes that session.
+func adminUserSessions(app *server.App, w http.ResponseWriter, r *http.Request, userID int, rest []string) {
+	if len(rest) == 1 && rest[0] == "" {
+		rest = nil
+	}
+
+	adminName := ""
+	if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+		adminName = adminUser.Username
+	}
+
+	username, err := database.GetUsernameByID(app, userID)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(rest) == 0:
+		listSessions(app, w, r, userID)
+
+	case r.Method == http.MethodDelete && len(rest) == 0:
+		if err := database.InvalidateUserSessions(app, userID); err != nil {
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		audit.LogAudit(app, adminName, "sessions_revoked", fmt.Sprintf("Signed out %q (id=%d) everywhere", username, userID), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+
+	case r.Method == http.MethodDelete && len(rest) == 1:
+		sessionID, err := strconv.Atoi(rest[0])
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid session ID")
+			return
+		}
+		if !revokeSession(app, w, userID, sessionID) {
+			return
+		}
+		audit.LogAudit(app, adminName, "session_revoked", fmt.Sprintf("Revoked session id=%d of %q (id=%d)", sessionID, username, userID), auth.ClientIP(r))
+		respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listSessions(app *server.App, w http.ResponseWriter, r *http.Request, userID int) {
+	currentToken := ""
+	if cookie, err := r.Cookie(app.AuthConfig.CookieName); err == nil {
+		currentToken = cookie.Value
+	}
+
+	sessions, err := database.ListUserSessions(app, userID, currentToken)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// revokeSession deletes one of userID's sessions, writing an error response
+// and returning false if it could not.
+func revokeSession(app *server.App, w http.ResponseWriter, userID, sessionID int) bool {
+	rowsAffected, err := database.DeleteUserSession(app, userID, sessionID)
+	if err != nil {
+		log.Printf("Error deleting session: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if rowsAffected == 0 {
+		respondError(w, http.StatusNotFound, "Session not found")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func loginAs(t *testing.T, app *server.App, username, password, userAgent string) *http.Cookie {
+	t.Helper()
+	req := newPost("/api/auth/login", map[string]string{"username": username, "password": password})
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	LoginHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "test_session" {
+			return c
+		}
+	}
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+func listMySessions(t *testing.T, app *server.App, username string, cookie *http.Cookie) []models.UserSession {
+	t.Helper()
+	req := newGet("/api/user/sessions")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	req = auth.WithUser(req, &models.AuthenticatedUser{Username: username, Source: "local"})
+	w := httptest.NewRecorder()
+	UserSessionsHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var sessions []models.UserSession
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	return sessions
+}
+
+func TestLogin_KeepsOtherSessions(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedUser(t, app, "alice", "letmein", "Alice", false)
+
+	loginAs(t, app, "alice", "letmein", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+	phone := loginAs(t, app, "alice", "letmein", "Mozilla/5.0 (iPhone) Safari/604.1")
+
+	sessions := listMySessions(t, app, "alice", phone)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	var current *models.UserSession
+	for i := range sessions {
+		if sessions[i].Current {
+			current = &sessions[i]
+		}
+	}
+	if current == nil {
+		t.Fatal("expected one session to be flagged current")
+	}
+	if current.UserAgent != "Mozilla/5.0 (iPhone) Safari/604.1" {
+		t.Errorf("unexpected user agent %q", current.UserAgent)
+	}
+	if current.AuthSource != "local" {
+		t.Errorf("expected auth source local, got %q", current.AuthSource)
+	}
+	if current.IP != "192.0.2.1" {
+		t.Errorf("expected IP 192.0.2.1, got %q", current.IP)
+	}
+	if current.LastSeenAt == nil {
+		t.Error("expected lastSeenAt to be set")
+	}
+}
+
+func TestLogin_SessionCapSignsOutOldest(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.MaxSessions = 2
+	seedUser(t, app, "bob", "letmein", "Bob", false)
+
+	first := loginAs(t, app, "bob", "letmein", "first")
+	loginAs(t, app, "bob", "letmein", "second")
+	third := loginAs(t, app, "bob", "letmein", "third")
+
+	sessions := listMySessions(t, app, "bob", third)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions after cap, got %d", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.UserAgent == "first" {
+			t.Error("expected the oldest session to be signed out")
+		}
+	}
+
+	req := newGet("/api/auth/me")
+	req.AddCookie(first)
+	w := httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected pruned session to be rejected, got %d", w.Code)
+	}
+}
+
+func TestUserSessions_RevokeOwn(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedUser(t, app, "carol", "letmein", "Carol", false)
+	laptop := loginAs(t, app, "carol", "letmein", "laptop")
+	loginAs(t, app, "carol", "letmein", "tablet")
+
+	var tabletID int
+	for _, s := range listMySessions(t, app, "carol", laptop) {
+		if s.UserAgent == "tablet" {
+			tabletID = s.ID
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/sessions/"+strconv.Itoa(tabletID), nil)
+	req = auth.WithUser(req, &models.AuthenticatedUser{Username: "carol", Source: "local"})
+	w := httptest.NewRecorder()
+	UserSessionsHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if sessions := listMySessions(t, app, "carol", laptop); len(sessions) != 1 || sessions[0].UserAgent != "laptop" {
+		t.Fatalf("expected only the laptop session to remain, got %+v", sessions)
+	}
+}
+
+func TestUserSessions_CannotRevokeOthers(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedUser(t, app, "dave", "letmein", "Dave", false)
+	seedUser(t, app, "erin", "letmein", "Erin", false)
+	erin := loginAs(t, app, "erin", "letmein", "erin-browser")
+	erinSessions := listMySessions(t, app, "erin", erin)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/sessions/"+strconv.Itoa(erinSessions[0].ID), nil)
+	req = auth.WithUser(req, &models.AuthenticatedUser{Username: "dave", Source: "local"})
+	w := httptest.NewRecorder()
+	UserSessionsHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if len(listMySessions(t, app, "erin", erin)) != 1 {
+		t.Fatal("expected erin's session to survive")
+	}
+}
+
+func TestUserSessions_ProxyAndAPIKeyForbidden(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	userID := seedUser(t, app, "grace", "letmein", "Grace", false)
+	loginAs(t, app, "grace", "letmein", "laptop")
+
+	for _, source := range []string{"authentik", "apikey"} {
+		for _, req := range []*http.Request{
+			newGet("/api/user/sessions"),
+			httptest.NewRequest(http.MethodDelete, "/api/user/sessions/1", nil),
+		} {
+			req = auth.WithUser(req, &models.AuthenticatedUser{Username: "grace", Source: source})
+			w := httptest.NewRecorder()
+			UserSessionsHandler(app).ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s via %s: expected 403, got %d", req.Method, req.URL.Path, source, w.Code)
+			}
+		}
+	}
+	if sessions, _ := database.ListUserSessions(app, userID, ""); len(sessions) != 1 {
+		t.Errorf("expected grace's session to survive, got %d", len(sessions))
+	}
+}
+
+func TestAdminUserSessions_ListAndSignOutEverywhere(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	userID := seedUser(t, app, "frank", "letmein", "Frank", false)
+	loginAs(t, app, "frank", "letmein", "one")
+	loginAs(t, app, "frank", "letmein", "two")
+	path := "/api/admin/local-users/" + strconv.Itoa(userID) + "/sessions"
+
+	req := auth.WithUser(newGet(path), adminUser())
+	w := httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var sessions []models.UserSession
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	// Revoke a single session
+	req = auth.WithUser(newDelete(path+"/"+strconv.Itoa(sessions[0].ID)), adminUser())
+	w = httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Sign out everywhere
+	req = auth.WithUser(newDelete(path), adminUser())
+	w = httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var count int
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&count)
+	if count != 0 {
+		t.Fatalf("expected no sessions left, got %d", count)
+	}
+
+	var action string
+	app.DB.QueryRow("SELECT action FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&action)
+	if action != "sessions_revoked" {
+		t.Errorf("expected sessions_revoked audit entry, got %q", action)
+	}
+}
+
+func TestAdminUserSessions_UnknownUser(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	req := auth.WithUser(newGet("/api/admin/local-users/999/sessions"), adminUser())
+	w := httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestLogin_StoresOnlyTokenHash(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	seedUser(t, app, "gina", "letmein", "Gina", false)
+	cookie := loginAs(t, app, "gina", "letmein", "browser")
+
+	var stored string
+	if err := app.DB.QueryRow("SELECT token FROM sessions").Scan(&stored); err != nil {
+		t.Fatalf("failed to read session: %v", err)
+	}
+	if stored == cookie.Value {
+		t.Fatal("session token stored in plain text")
+	}
+	if stored != database.HashToken(cookie.Value) {
+		t.Fatalf("expected SHA-256 of the cookie token, got %q", stored)
+	}
+
+	// The raw stored value must not work as a cookie
+	req := newGet("/api/auth/me")
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: stored})
+	w := httptest.NewRecorder()
+	AuthMeHandler(app).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected stored hash to be rejected as a token, got %d", w.Code)
+	}
+}
+
+func TestOIDCState_StoredHashed(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	if err := database.CreateOIDCState(app, "state-value", database.OIDCLogin{RedirectURL: "/after", CodeVerifier: "verifier", Nonce: "nonce"}); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+
+	var stored string
+	app.DB.QueryRow("SELECT state FROM oidc_states").Scan(&stored)
+	if stored == "state-value" {
+		t.Fatal("OIDC state stored in plain text")
+	}
+
+	login, err := database.GetOIDCState(app, "state-value")
+	if err != nil || login.RedirectURL != "/after" || login.CodeVerifier != "verifier" || login.Nonce != "nonce" {
+		t.Fatalf("expected lookup by raw state to succeed, got %+v, %v", login, err)
+	}
+}
+
+func TestLoadSystemConfig_DefaultSessionCap(t *testing.T) {
+	app := setupTestAppWithDB(t)
+	// A config saved before the session cap existed
+	app.DB.Exec("INSERT INTO system_config (key, value) VALUES ('setup_completed', 'true')")
+	app.SystemConfig.MaxSessions = 0
+	if err := database.LoadSystemConfig(app); err != nil {
+		t.Fatalf("LoadSystemConfig failed: %v", err)
+	}
+	if app.SystemConfig.MaxSessions != 10 {
+		t.Errorf("expected the session cap to default to 10, got %d", app.SystemConfig.MaxSessions)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"dashgate/internal/auth"
 	"dashgate/internal/database"
 	"dashgate/internal/middleware"
 	"dashgate/internal/server"
@@ -107,8 +108,8 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 				return
 			}
 
-			if len(req.Password) < 8 {
-				respondError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+			if err := auth.CheckPasswordPolicy(app, req.Password); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
 				return
 			}
 
@@ -135,6 +136,7 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 		} else {
 			app.SystemConfig.SessionDays = 7
 		}
+		app.SystemConfig.MaxSessions = 10
 
 		// Set provider flags
 		app.SystemConfig.ProxyAuthEnabled = req.ProxyAuthEnabled
@@ -152,23 +154,12 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 			app.SystemConfig.LDAPBindPassword = req.LDAPBindPassword
 			app.SystemConfig.LDAPBaseDN = req.LDAPBaseDN
 			app.SystemConfig.LDAPUserFilter = req.LDAPUserFilter
-			if app.SystemConfig.LDAPUserFilter == "" {
-				app.SystemConfig.LDAPUserFilter = "(uid=%s)"
-			}
 			app.SystemConfig.LDAPUserAttr = req.LDAPUserAttr
-			if app.SystemConfig.LDAPUserAttr == "" {
-				app.SystemConfig.LDAPUserAttr = "uid"
-			}
 			app.SystemConfig.LDAPEmailAttr = req.LDAPEmailAttr
-			if app.SystemConfig.LDAPEmailAttr == "" {
-				app.SystemConfig.LDAPEmailAttr = "mail"
-			}
 			app.SystemConfig.LDAPDisplayAttr = req.LDAPDisplayAttr
-			if app.SystemConfig.LDAPDisplayAttr == "" {
-				app.SystemConfig.LDAPDisplayAttr = "cn"
-			}
 			app.SystemConfig.LDAPStartTLS = req.LDAPStartTLS
 			app.SystemConfig.LDAPSkipVerify = req.LDAPSkipVerify
+			database.SetLDAPDefaults(&app.SystemConfig)
 		}
 
 		// Set OIDC display name (always saved, even if OIDC is not enabled,
@@ -182,13 +173,8 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 			app.SystemConfig.OIDCClientSecret = req.OIDCClientSecret
 			app.SystemConfig.OIDCRedirectURL = req.OIDCRedirectURL
 			app.SystemConfig.OIDCScopes = req.OIDCScopes
-			if app.SystemConfig.OIDCScopes == "" {
-				app.SystemConfig.OIDCScopes = "openid profile email groups"
-			}
 			app.SystemConfig.OIDCGroupsClaim = req.OIDCGroupsClaim
-			if app.SystemConfig.OIDCGroupsClaim == "" {
-				app.SystemConfig.OIDCGroupsClaim = "groups"
-			}
+			database.SetOIDCDefaults(&app.SystemConfig)
 		}
 		app.SysConfigMu.Unlock()
 
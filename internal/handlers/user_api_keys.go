@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/netpolicy"
+	"dashgate/internal/server"
+)
+
+// maxPersonalAPIKeys caps how many keys one user can hold.
+const maxPersonalAPIKeys = 10
+
+// UserAPIKeysHandler manages the signed-in user's personal API keys: GET
+// /api/user/api-keys lists them with the groups a key may carry, POST creates
+// one, DELETE /api/user/api-keys/{id} revokes one and POST
+// /api/user/api-keys/{id}/rotate replaces its secret.
+func UserAPIKeysHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.UserFromContext(r.Context())
+		if user == nil {
+			respondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		// A leaked key must not be able to mint more keys
+		if user.Source == "apikey" {
+			respondError(w, http.StatusForbidden, "API keys cannot be managed with an API key")
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		enabled := app.SystemConfig.APIKeyEnabled
+		app.SysConfigMu.RUnlock()
+		if !enabled {
+			respondError(w, http.StatusNotFound, "API keys are disabled")
+			return
+		}
+
+		// Proxy users have no DashGate account to own keys
+		row, err := database.GetUserByUsername(app, user.Username)
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "No DashGate account to own API keys")
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up user: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		var groups []string
+		json.Unmarshal([]byte(row.GroupsJSON), &groups)
+
+		rest := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/api-keys"), "/"), "/")
+		keyID := 0
+		if rest[0] != "" {
+			if keyID, err = strconv.Atoi(rest[0]); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid key ID")
+				return
+			}
+		}
+
+		switch {
+		case r.Method == http.MethodGet && keyID == 0:
+			keys, err := database.ListPersonalAPIKeys(app, row.ID)
+			if err != nil {
+				log.Printf("Error listing personal API keys: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if groups == nil {
+				groups = []string{}
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"keys":    keys,
+				"groups":  groups,
+				"maxKeys": maxPersonalAPIKeys,
+			})
+
+		case r.Method == http.MethodPost && keyID == 0:
+			createPersonalAPIKey(app, w, r, row, groups)
+
+		case r.Method == http.MethodDelete && keyID != 0 && len(rest) == 1:
+			err := database.DeletePersonalAPIKey(app, row.ID, keyID)
+			if err == database.ErrAPIKeyNotFound {
+				respondError(w, http.StatusNotFound, "Key not found")
+				return
+			}
+			if err != nil {
+				log.Printf("Error deleting personal API key: %v", err)
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.LogAudit(app, row.Username, "api_key_deleted", fmt.Sprintf("Deleted personal API key id=%d", keyID), auth.ClientIP(r))
+			respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+
+		case r.Method == http.MethodPost && keyID != 0 && len(rest) == 2 && rest[1] == "rotate":
+			rotatePersonalAPIKey(app, w, r, row, keyID)
+
+		default:
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func createPersonalAPIKey(app *server.App, w http.ResponseWriter, r *http.Request, row *database.UserRow, ownerGroups []string) {
+	var req struct {
+		Name            string   `json:"name"`
+		Groups          []string `json:"groups"`    // nil = all of the owner's groups
+		ExpiresIn       int      `json:"expiresIn"` // days, 0 = never
+		AllowedNetworks string   `json:"allowedNetworks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		respondError(w, http.StatusBadRequest, "Name is required (up to 64 characters)")
+		return
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > 3650 {
+		respondError(w, http.StatusBadRequest, "Expiry must be between 0 and 3650 days")
+		return
+	}
+	req.AllowedNetworks = strings.TrimSpace(req.AllowedNetworks)
+	if _, err := netpolicy.Parse(req.AllowedNetworks); err != nil {
+		respondError(w, http.StatusBadRequest, "Allowed networks: "+err.Error())
+		return
+	}
+
+	// A key can carry at most the groups its owner holds right now
+	if req.Groups == nil {
+		req.Groups = ownerGroups
+	}
+	held := make(map[string]bool, len(ownerGroups))
+	for _, g := range ownerGroups {
+		held[g] = true
+	}
+	for _, g := range req.Groups {
+		if !held[g] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("You are not a member of group %q", g))
+			return
+		}
+	}
+
+	count, err := database.CountPersonalAPIKeys(app, row.ID)
+	if err != nil {
+		log.Printf("Error counting personal API keys: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if count >= maxPersonalAPIKeys {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("You can have at most %d API keys", maxPersonalAPIKeys))
+		return
+	}
+
+	apiKey, keyPrefix, keyHash, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate key")
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresIn) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	id, err := database.CreatePersonalAPIKey(app, row.ID, row.Username, req.Name, keyHash, keyPrefix, database.MarshalListJSON(req.Groups), req.AllowedNetworks, expiresAt)
+	if err != nil {
+		log.Printf("Error creating personal API key: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create key")
+		return
+	}
+
+	audit.LogAudit(app, row.Username, "api_key_created", fmt.Sprintf("Created personal API key %q (id=%d, prefix=%s)", req.Name, id, keyPrefix), auth.ClientIP(r))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":        id,
+		"name":      req.Name,
+		"key":       apiKey, // Only returned once!
+		"prefix":    keyPrefix,
+		"expiresAt": expiresAt,
+	})
+}
+
+func rotatePersonalAPIKey(app *server.App, w http.ResponseWriter, r *http.Request, row *database.UserRow, keyID int) {
+	apiKey, keyPrefix, keyHash, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate key")
+		return
+	}
+
+	expiresAt, err := database.RotatePersonalAPIKey(app, row.ID, keyID, keyHash, keyPrefix)
+	if err == database.ErrAPIKeyNotFound {
+		respondError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating personal API key: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	audit.LogAudit(app, row.Username, "api_key_rotated", fmt.Sprintf("Rotated personal API key id=%d (new prefix=%s)", keyID, keyPrefix), auth.ClientIP(r))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":        keyID,
+		"key":       apiKey, // Only returned once!
+		"prefix":    keyPrefix,
+		"expiresAt": expiresAt,
+	})
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// setupUserAPIKeyApp returns an app with API keys enabled and a local user
+// "alice" in the family and media groups.
+func setupUserAPIKeyApp(t *testing.T) (*server.App, int) {
+	t.Helper()
+	app := setupTestAppWithDB(t)
+	app.SystemConfig.APIKeyEnabled = true
+	aliceID := seedUser(t, app, "alice", "pass", "Alice", false)
+	app.DB.Exec(`UPDATE users SET groups = '["family","media"]' WHERE id = ?`, aliceID)
+	return app, aliceID
+}
+
+func alice() *models.AuthenticatedUser {
+	return &models.AuthenticatedUser{Username: "alice", Groups: []string{"family", "media"}, Source: "local"}
+}
+
+// createPersonalKey creates a key for alice and returns the response.
+func createPersonalKey(t *testing.T, app *server.App, body map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	UserAPIKeysHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/api-keys", body), alice()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	return parseMap(w.Body.Bytes())
+}
+
+func keyRequest(key string) *http.Request {
+	req := newGet("/api/apps")
+	req.Header.Set("Authorization", "Bearer "+key)
+	return req
+}
+
+func TestUserAPIKeys_CreateInheritsOwnerGroups(t *testing.T) {
+	app, _ := setupUserAPIKeyApp(t)
+	resp := createPersonalKey(t, app, map[string]interface{}{"name": "Phone widget", "expiresIn": 90})
+
+	user := auth.GetAPIKeyUser(app, keyRequest(resp["key"].(string)))
+	if user == nil {
+		t.Fatal("expected the new key to authenticate")
+	}
+	if user.Username != "alice" || len(user.Groups) != 2 {
+		t.Errorf("expected alice with both groups, got %s %v", user.Username, user.Groups)
+	}
+
+	w := httptest.NewRecorder()
+	UserAPIKeysHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/api-keys", map[string]interface{}{
+		"name": "Sneaky", "groups": []string{"admins"},
+	}), alice()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a group alice does not hold, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	UserAPIKeysHandler(app).ServeHTTP(w, auth.WithUser(newGet("/api/user/api-keys"), alice()))
+	var list struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Keys) != 1 || !list.Keys[0].Personal || list.Keys[0].ExpiresAt == nil {
+		t.Errorf("expected one expiring personal key, got %+v", list.Keys)
+	}
+}
+
+func TestUserAPIKeys_RevokedWhenOwnerLosesGroup(t *testing.T) {
+	app, aliceID := setupUserAPIKeyApp(t)
+	resp := createPersonalKey(t, app, map[string]interface{}{"name": "Home Assistant", "groups": []string{"media"}})
+	key := resp["key"].(string)
+
+	app.DB.Exec(`UPDATE users SET groups = '["family"]' WHERE id = ?`, aliceID)
+	if auth.GetAPIKeyUser(app, keyRequest(key)) != nil {
+		t.Fatal("expected the key to stop working once alice left media")
+	}
+
+	var keys, audits int
+	app.DB.QueryRow("SELECT COUNT(*) FROM api_keys").Scan(&keys)
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'api_key_revoked'").Scan(&audits)
+	if keys != 0 || audits != 1 {
+		t.Errorf("expected the key to be deleted and audited, got %d keys and %d audit entries", keys, audits)
+	}
+}
+
+func TestUserAPIKeys_SweepRevokesKeysOfDeactivatedOwners(t *testing.T) {
+	app, aliceID := setupUserAPIKeyApp(t)
+	createPersonalKey(t, app, map[string]interface{}{"name": "Widget"})
+	bobID := seedUser(t, app, "bob", "pass", "Bob", false)
+	seedAPIKey(t, app, "admin-made", "dgk_bob1", bobID, `["whatever"]`)
+
+	app.DB.Exec("UPDATE users SET disabled = 1 WHERE id = ?", aliceID)
+	auth.MaintainPersonalAPIKeys(app)
+
+	var names []string
+	rows, _ := app.DB.Query("SELECT name FROM api_keys")
+	for rows.Next() {
+		var n string
+		rows.Scan(&n)
+		names = append(names, n)
+	}
+	rows.Close()
+	if len(names) != 1 || names[0] != "admin-made" {
+		t.Errorf("expected only the admin-created key to remain, got %v", names)
+	}
+}
+
+func TestUserAPIKeys_RotateKeepsLifetime(t *testing.T) {
+	app, _ := setupUserAPIKeyApp(t)
+	resp := createPersonalKey(t, app, map[string]interface{}{"name": "Widget", "expiresIn": 30})
+	oldKey := resp["key"].(string)
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	// Pretend the key was created 20 days ago
+	app.DB.Exec("UPDATE api_keys SET created_at = ?, expires_at = ?", time.Now().Add(-20*24*time.Hour), time.Now().Add(10*24*time.Hour))
+
+	w := httptest.NewRecorder()
+	UserAPIKeysHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/api-keys/"+id+"/rotate", nil), alice()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	rotated := parseMap(w.Body.Bytes())
+
+	if auth.GetAPIKeyUser(app, keyRequest(oldKey)) != nil {
+		t.Error("expected the old secret to stop working")
+	}
+	if auth.GetAPIKeyUser(app, keyRequest(rotated["key"].(string))) == nil {
+		t.Error("expected the new secret to work")
+	}
+	expiresAt, _ := time.Parse(time.RFC3339Nano, rotated["expiresAt"].(string))
+	if d := time.Until(expiresAt); d < 29*24*time.Hour || d > 31*24*time.Hour {
+		t.Errorf("expected a fresh 30 day lifetime, got %v", d)
+	}
+}
+
+func TestUserAPIKeys_NotManageableWithAPIKey(t *testing.T) {
+	app, _ := setupUserAPIKeyApp(t)
+	keyUser := alice()
+	keyUser.Source = "apikey"
+
+	w := httptest.NewRecorder()
+	UserAPIKeysHandler(app).ServeHTTP(w, auth.WithUser(newPost("/api/user/api-keys", map[string]interface{}{"name": "Another"}), keyUser))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestUserAPIKeys_DeletedWithOwner(t *testing.T) {
+	app, aliceID := setupUserAPIKeyApp(t)
+	resp := createPersonalKey(t, app, map[string]interface{}{"name": "Widget"})
+
+	w := httptest.NewRecorder()
+	LocalUserHandler(app).ServeHTTP(w, auth.WithUser(newDelete("/api/admin/local-users/"+strconv.Itoa(aliceID)), adminUser()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if auth.GetAPIKeyUser(app, keyRequest(resp["key"].(string))) != nil {
+		t.Error("expected the key to be gone with its owner")
+	}
+}
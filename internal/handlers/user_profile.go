@@ -53,7 +53,7 @@ func userProfileGet(app *server.App, w http.ResponseWriter, r *http.Request, use
 	if user.Source == "local" {
 		row, err := database.GetUserByUsername(app, user.Username)
 		if err == nil {
-			hasPassword = row.PasswordHash != "" && row.PasswordHash != "LDAP_USER" && row.PasswordHash != "OIDC_USER"
+			hasPassword = hasLocalPassword(row.PasswordHash)
 		}
 	}
 
@@ -128,8 +128,8 @@ func userPasswordChange(app *server.App, w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	if len(req.NewPassword) < 8 {
-		respondError(w, http.StatusBadRequest, "New password must be at least 8 characters")
+	if err := auth.CheckPasswordPolicy(app, req.NewPassword); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -145,6 +145,16 @@ func userPasswordChange(app *server.App, w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if err := auth.CheckPasswordHistory(app, row.ID, req.NewPassword, row.PasswordHash); err != nil {
+		if err == auth.ErrPasswordReused {
+			respondError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error checking password history: %v", err)
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
@@ -159,6 +169,7 @@ func userPasswordChange(app *server.App, w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	auth.RecordPasswordChange(app, row.ID, row.PasswordHash)
 	database.InvalidateUserSessions(app, row.ID)
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "password_changed"})
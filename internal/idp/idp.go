@@ -0,0 +1,183 @@
+// Package idp issues and verifies the tokens of DashGate's built-in OpenID
+// provider, which lets downstream apps sign users in through DashGate.
+package idp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// TokenLifetime is how long ID and access tokens are valid.
+const TokenLifetime = time.Hour
+
+// ErrInvalidToken is returned for access tokens that are malformed, expired,
+// not signed by DashGate or not access tokens.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// UserClaims are the identity claims placed in ID tokens and returned from
+// the userinfo endpoint, filtered by the granted scopes.
+type UserClaims struct {
+	Subject           string   `json:"sub"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+}
+
+// AccessClaims are the claims of a verified access token.
+type AccessClaims struct {
+	jwt.Claims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	TokenUse string `json:"token_use"`
+}
+
+// SigningKey returns the provider's signing key, loading it from the
+// database or creating it on first use.
+func SigningKey(app *server.App) (*server.IDPKey, error) {
+	app.IDPKeyMu.Lock()
+	defer app.IDPKeyMu.Unlock()
+	if app.IDPKey != nil {
+		return app.IDPKey, nil
+	}
+
+	kid, keyPEM, err := database.GetIDPSigningKey(app)
+	if err == sql.ErrNoRows {
+		return createSigningKey(app)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("stored signing key is not PEM encoded")
+	}
+	private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	app.IDPKey = &server.IDPKey{ID: kid, Private: private}
+	return app.IDPKey, nil
+}
+
+func createSigningKey(app *server.App) (*server.IDPKey, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	kid := hex.EncodeToString(idBytes)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if err := database.SaveIDPSigningKey(app, kid, string(keyPEM)); err != nil {
+		return nil, err
+	}
+	app.IDPKey = &server.IDPKey{ID: kid, Private: private}
+	return app.IDPKey, nil
+}
+
+// JWKS returns the public half of the signing key as a JSON Web Key Set.
+func JWKS(app *server.App) (*jose.JSONWebKeySet, error) {
+	key, err := SigningKey(app)
+	if err != nil {
+		return nil, err
+	}
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &key.Private.PublicKey,
+		KeyID:     key.ID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}}, nil
+}
+
+func signer(app *server.App) (jose.Signer, error) {
+	key, err := SigningKey(app)
+	if err != nil {
+		return nil, err
+	}
+	return jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key.Private, KeyID: key.ID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+}
+
+// SignIDToken returns an ID token for clientID about user.
+func SignIDToken(app *server.App, issuer, clientID string, user UserClaims, nonce string) (string, error) {
+	sig, err := signer(app)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	extra := map[string]interface{}{"auth_time": now.Unix()}
+	if nonce != "" {
+		extra["nonce"] = nonce
+	}
+	return jwt.Signed(sig).Claims(jwt.Claims{
+		Issuer:   issuer,
+		Subject:  user.Subject,
+		Audience: jwt.Audience{clientID},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(TokenLifetime)),
+	}).Claims(user).Claims(extra).CompactSerialize()
+}
+
+// SignAccessToken returns an access token that lets clientID read subject's
+// userinfo with the given scopes.
+func SignAccessToken(app *server.App, issuer, clientID, subject, scope string) (string, error) {
+	sig, err := signer(app)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return jwt.Signed(sig).Claims(AccessClaims{
+		Claims: jwt.Claims{
+			Issuer:   issuer,
+			Subject:  subject,
+			Audience: jwt.Audience{clientID},
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(TokenLifetime)),
+		},
+		ClientID: clientID,
+		Scope:    scope,
+		TokenUse: "access",
+	}).CompactSerialize()
+}
+
+// VerifyAccessToken checks an access token's signature, issuer and expiry.
+// ID tokens are rejected, so they cannot be replayed as bearer tokens.
+func VerifyAccessToken(app *server.App, issuer, token string) (*AccessClaims, error) {
+	key, err := SigningKey(app)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims AccessClaims
+	if err := parsed.Claims(&key.Private.PublicKey, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.TokenUse != "access" {
+		return nil, ErrInvalidToken
+	}
+	if err := claims.Validate(jwt.Expected{Issuer: issuer, Time: time.Now()}); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
@@ -3,11 +3,11 @@ package lldap
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -15,39 +15,125 @@ import (
 	"dashgate/internal/server"
 )
 
-// InitLLDAP reads LLDAP environment variables and initializes the LLDAP client
-// configuration on app.LLDAPConfig. If the required variables are missing or
-// the initial token refresh fails, LLDAP is left unconfigured.
+// ErrNotConfigured is returned when LLDAP management is not set up.
+var ErrNotConfigured = errors.New("LLDAP is not configured")
+
+// maxAttempts is how often a request is tried before giving up, and
+// retryDelay the pause before the first retry, doubled after each attempt.
+const maxAttempts = 3
+
+var retryDelay = 500 * time.Millisecond
+
+// InitLLDAP configures the LLDAP client at startup. The LLDAP_URL,
+// LLDAP_ADMIN_USERNAME and LLDAP_ADMIN_PASSWORD environment variables (or
+// their DASHGATE_LLDAP_* forms) are applied to the system config beforehand.
 func InitLLDAP(app *server.App) {
-	url := os.Getenv("LLDAP_URL")
-	username := os.Getenv("LLDAP_ADMIN_USERNAME")
-	password := os.Getenv("LLDAP_ADMIN_PASSWORD")
+	if Configure(app) == nil {
+		log.Println("LLDAP not configured")
+	}
+}
 
-	if url == "" || username == "" || password == "" {
-		log.Println("LLDAP not configured (missing LLDAP_URL, LLDAP_ADMIN_USERNAME, or LLDAP_ADMIN_PASSWORD)")
-		return
+// Configure (re)builds the LLDAP client from the system config and connects
+// in the background, retrying on failure. It returns nil if LLDAP is disabled
+// or incomplete.
+func Configure(app *server.App) *server.LLDAPConfigRef {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.LLDAPEnabled
+	url := strings.TrimSuffix(app.SystemConfig.LLDAPURL, "/")
+	username := app.SystemConfig.LLDAPAdminUsername
+	password := app.SystemConfig.LLDAPAdminPassword
+	app.SysConfigMu.RUnlock()
+
+	var l *server.LLDAPConfigRef
+	if enabled && url != "" && username != "" && password != "" {
+		l = &server.LLDAPConfigRef{URL: url, Username: username, Password: password}
 	}
 
-	app.LLDAPConfig = &server.LLDAPConfigRef{
-		URL:      strings.TrimSuffix(url, "/"),
-		Username: username,
-		Password: password,
+	app.LLDAPMu.Lock()
+	app.LLDAPConfig = l
+	app.LLDAPMu.Unlock()
+
+	if l != nil {
+		go func() {
+			if err := connect(app, l); err != nil {
+				log.Printf("Warning: LLDAP connection to %s failed, will retry on next use: %v", url, err)
+				return
+			}
+			log.Printf("LLDAP connected successfully to %s", url)
+		}()
 	}
+	return l
+}
+
+// Configured reports whether LLDAP management is set up.
+func Configured(app *server.App) bool {
+	return current(app) != nil
+}
 
-	if err := RefreshToken(app); err != nil {
-		log.Printf("Warning: LLDAP connection failed: %v", err)
-		app.LLDAPConfig = nil
-		return
+// Status describes the LLDAP connection for the admin UI.
+func Status(app *server.App) (configured, connected bool, lastError string) {
+	l := current(app)
+	if l == nil {
+		return false, false, ""
 	}
+	l.TokenMu.RLock()
+	defer l.TokenMu.RUnlock()
+	return true, l.Token != "", l.LastError
+}
 
-	log.Printf("LLDAP connected successfully to %s", url)
+// Test logs in to LLDAP with the given settings without changing the active
+// configuration.
+func Test(app *server.App, url, username, password string) error {
+	l := &server.LLDAPConfigRef{URL: strings.TrimSuffix(url, "/"), Username: username, Password: password}
+	return refreshToken(app, l)
+}
+
+func current(app *server.App) *server.LLDAPConfigRef {
+	app.LLDAPMu.RLock()
+	defer app.LLDAPMu.RUnlock()
+	return app.LLDAPConfig
+}
+
+// connect logs in, retrying with backoff on failure.
+func connect(app *server.App, l *server.LLDAPConfigRef) error {
+	var err error
+	delay := retryDelay
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = refreshToken(app, l); err == nil {
+			return nil
+		}
+		if attempt < maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
 }
 
 // RefreshToken authenticates against the LLDAP simple login endpoint and
 // stores the JWT token in app.LLDAPConfig.
 func RefreshToken(app *server.App) error {
-	l := app.LLDAPConfig
+	l := current(app)
+	if l == nil {
+		return ErrNotConfigured
+	}
+	return refreshToken(app, l)
+}
+
+func refreshToken(app *server.App, l *server.LLDAPConfigRef) error {
+	err := login(app, l)
+
+	l.TokenMu.Lock()
+	if err != nil {
+		l.LastError = err.Error()
+	} else {
+		l.LastError = ""
+	}
+	l.TokenMu.Unlock()
+	return err
+}
 
+func login(app *server.App, l *server.LLDAPConfigRef) error {
 	loginPayload := map[string]string{
 		"username": l.Username,
 		"password": l.Password,
@@ -81,20 +167,17 @@ func RefreshToken(app *server.App) error {
 	return nil
 }
 
-// GetToken returns the cached LLDAP JWT token, refreshing it if expired.
-// Uses a write lock for the entire check-and-refresh to prevent TOCTOU races.
-func GetToken(app *server.App) (string, error) {
-	l := app.LLDAPConfig
-
-	l.TokenMu.Lock()
+// getToken returns the cached LLDAP JWT token, refreshing it if expired.
+func getToken(app *server.App, l *server.LLDAPConfigRef) (string, error) {
+	l.TokenMu.RLock()
 	if l.Token != "" && time.Now().Before(l.Expiry) {
 		token := l.Token
-		l.TokenMu.Unlock()
+		l.TokenMu.RUnlock()
 		return token, nil
 	}
-	l.TokenMu.Unlock()
+	l.TokenMu.RUnlock()
 
-	if err := RefreshToken(app); err != nil {
+	if err := refreshToken(app, l); err != nil {
 		return "", err
 	}
 
@@ -103,14 +186,53 @@ func GetToken(app *server.App) (string, error) {
 	return l.Token, nil
 }
 
-// GraphQL sends a GraphQL query to the LLDAP API and returns the raw response body.
+// GetToken returns the cached LLDAP JWT token, refreshing it if expired.
+func GetToken(app *server.App) (string, error) {
+	l := current(app)
+	if l == nil {
+		return "", ErrNotConfigured
+	}
+	return getToken(app, l)
+}
+
+// errRetry marks a failure worth retrying: the connection failed, the server
+// had an error, or the token was rejected.
+type errRetry struct{ err error }
+
+func (e errRetry) Error() string { return e.err.Error() }
+
+// GraphQL sends a GraphQL query to the LLDAP API and returns the raw response
+// body. Connection failures, server errors and expired tokens are retried
+// with backoff.
 func GraphQL(app *server.App, query string, variables map[string]interface{}) ([]byte, error) {
-	token, err := GetToken(app)
-	if err != nil {
-		return nil, err
+	l := current(app)
+	if l == nil {
+		return nil, ErrNotConfigured
 	}
 
-	l := app.LLDAPConfig
+	var err error
+	delay := retryDelay
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var respBody []byte
+		respBody, err = graphQL(app, l, query, variables)
+		var retry errRetry
+		if !errors.As(err, &retry) {
+			return respBody, err
+		}
+		err = retry.err
+		if attempt < maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return nil, err
+}
+
+func graphQL(app *server.App, l *server.LLDAPConfigRef, query string, variables map[string]interface{}) ([]byte, error) {
+	token, err := getToken(app, l)
+	if err != nil {
+		return nil, errRetry{err}
+	}
 
 	payload := map[string]interface{}{
 		"query":     query,
@@ -128,58 +250,80 @@ func GraphQL(app *server.App, query string, variables map[string]interface{}) ([
 
 	resp, err := app.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, errRetry{err}
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024)) // 10MB limit
 	if err != nil {
-		return nil, err
+		return nil, errRetry{err}
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Token revoked or LLDAP restarted with a new secret: log in again
+		l.TokenMu.Lock()
+		l.Token = ""
+		l.TokenMu.Unlock()
+		return nil, errRetry{fmt.Errorf("GraphQL request was not authorized")}
+	}
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("GraphQL request failed with status %d: %s", resp.StatusCode, string(respBody))
-		return nil, fmt.Errorf("GraphQL request failed with status %d", resp.StatusCode)
+		err := fmt.Errorf("GraphQL request failed with status %d", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			return nil, errRetry{err}
+		}
+		return nil, err
 	}
 
 	return respBody, nil
 }
 
-// ListUsers queries all users from LLDAP via GraphQL and returns them as models.LLDAPUser slices.
-func ListUsers(app *server.App) ([]models.LLDAPUser, error) {
-	query := `query { users { id email displayName groups { displayName } } }`
-
-	respBody, err := GraphQL(app, query, nil)
+// run sends a GraphQL query or mutation and decodes its data into out, which
+// may be nil.
+func run(app *server.App, query string, variables map[string]interface{}, out interface{}) error {
+	respBody, err := GraphQL(app, query, variables)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	var result struct {
-		Data struct {
-			Users []struct {
-				ID          string `json:"id"`
-				Email       string `json:"email"`
-				DisplayName string `json:"displayName"`
-				Groups      []struct {
-					DisplayName string `json:"displayName"`
-				} `json:"groups"`
-			} `json:"users"`
-		} `json:"data"`
+		Data   json.RawMessage `json:"data"`
 		Errors []struct {
 			Message string `json:"message"`
 		} `json:"errors"`
 	}
-
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, err
+		return err
 	}
-
 	if len(result.Errors) > 0 {
-		return nil, fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
+		return fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
+	}
+	if out == nil {
+		return nil
 	}
+	return json.Unmarshal(result.Data, out)
+}
 
-	users := make([]models.LLDAPUser, len(result.Data.Users))
-	for i, u := range result.Data.Users {
+// ListUsers queries all users from LLDAP via GraphQL and returns them as models.LLDAPUser slices.
+func ListUsers(app *server.App) ([]models.LLDAPUser, error) {
+	query := `query { users { id email displayName groups { displayName } } }`
+
+	var data struct {
+		Users []struct {
+			ID          string `json:"id"`
+			Email       string `json:"email"`
+			DisplayName string `json:"displayName"`
+			Groups      []struct {
+				DisplayName string `json:"displayName"`
+			} `json:"groups"`
+		} `json:"users"`
+	}
+	if err := run(app, query, nil, &data); err != nil {
+		return nil, err
+	}
+
+	users := make([]models.LLDAPUser, len(data.Users))
+	for i, u := range data.Users {
 		groups := make([]string, len(u.Groups))
 		for j, g := range u.Groups {
 			groups[j] = g.DisplayName
@@ -199,36 +343,21 @@ func ListUsers(app *server.App) ([]models.LLDAPUser, error) {
 func ListGroups(app *server.App) ([]models.LLDAPGroup, error) {
 	query := `query { groups { id displayName users { id } } }`
 
-	respBody, err := GraphQL(app, query, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var result struct {
-		Data struct {
-			Groups []struct {
-				ID          int    `json:"id"`
-				DisplayName string `json:"displayName"`
-				Users       []struct {
-					ID string `json:"id"`
-				} `json:"users"`
-			} `json:"groups"`
-		} `json:"data"`
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors"`
+	var data struct {
+		Groups []struct {
+			ID          int    `json:"id"`
+			DisplayName string `json:"displayName"`
+			Users       []struct {
+				ID string `json:"id"`
+			} `json:"users"`
+		} `json:"groups"`
 	}
-
-	if err := json.Unmarshal(respBody, &result); err != nil {
+	if err := run(app, query, nil, &data); err != nil {
 		return nil, err
 	}
 
-	if len(result.Errors) > 0 {
-		return nil, fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
-	}
-
-	groups := make([]models.LLDAPGroup, len(result.Data.Groups))
-	for i, g := range result.Data.Groups {
+	groups := make([]models.LLDAPGroup, len(data.Groups))
+	for i, g := range data.Groups {
 		users := make([]string, len(g.Users))
 		for j, u := range g.Users {
 			users[j] = u.ID
@@ -242,3 +371,54 @@ func ListGroups(app *server.App) ([]models.LLDAPGroup, error) {
 
 	return groups, nil
 }
+
+// CreateUser creates a user. LLDAP users are created without a password;
+// set one with SetPassword.
+func CreateUser(app *server.App, u models.LLDAPUser) error {
+	query := `mutation($user: CreateUserInput!) { createUser(user: $user) { id } }`
+	return run(app, query, map[string]interface{}{
+		"user": map[string]string{
+			"id":          u.ID,
+			"email":       u.Email,
+			"displayName": u.DisplayName,
+		},
+	}, nil)
+}
+
+// DeleteUser deletes a user.
+func DeleteUser(app *server.App, userID string) error {
+	query := `mutation($userId: String!) { deleteUser(userId: $userId) { ok } }`
+	return run(app, query, map[string]interface{}{"userId": userID}, nil)
+}
+
+// CreateGroup creates a group and returns its ID.
+func CreateGroup(app *server.App, name string) (int, error) {
+	query := `mutation($name: String!) { createGroup(name: $name) { id } }`
+	var data struct {
+		CreateGroup struct {
+			ID int `json:"id"`
+		} `json:"createGroup"`
+	}
+	if err := run(app, query, map[string]interface{}{"name": name}, &data); err != nil {
+		return 0, err
+	}
+	return data.CreateGroup.ID, nil
+}
+
+// DeleteGroup deletes a group.
+func DeleteGroup(app *server.App, groupID int) error {
+	query := `mutation($groupId: Int!) { deleteGroup(groupId: $groupId) { ok } }`
+	return run(app, query, map[string]interface{}{"groupId": groupID}, nil)
+}
+
+// AddUserToGroup adds a user to a group.
+func AddUserToGroup(app *server.App, userID string, groupID int) error {
+	query := `mutation($userId: String!, $groupId: Int!) { addUserToGroup(userId: $userId, groupId: $groupId) { ok } }`
+	return run(app, query, map[string]interface{}{"userId": userID, "groupId": groupID}, nil)
+}
+
+// RemoveUserFromGroup removes a user from a group.
+func RemoveUserFromGroup(app *server.App, userID string, groupID int) error {
+	query := `mutation($userId: String!, $groupId: Int!) { removeUserFromGroup(userId: $userId, groupId: $groupId) { ok } }`
+	return run(app, query, map[string]interface{}{"userId": userID, "groupId": groupID}, nil)
+}
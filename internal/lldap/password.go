@@ -0,0 +1,68 @@
+package lldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"dashgate/internal/server"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrPasswordResetUnavailable is returned when passwords cannot be set
+// because LDAP sign-in is not configured.
+var ErrPasswordResetUnavailable = errors.New("setting LLDAP passwords requires the LDAP server settings")
+
+// SetPassword sets a user's password with the LDAP password modify
+// operation. LLDAP's GraphQL API cannot set passwords, so this uses the LDAP
+// settings from LDAP sign-in; the bind user must be an LLDAP admin or
+// password manager.
+func SetPassword(app *server.App, userID, password string) error {
+	cfg := app.LDAPAuth
+	if cfg == nil || cfg.Server == "" || cfg.BindDN == "" {
+		return ErrPasswordResetUnavailable
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	l, err := ldap.DialURL(cfg.Server, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return fmt.Errorf("failed to connect to LDAP: %w", err)
+	}
+	defer l.Close()
+
+	l.SetTimeout(10 * time.Second)
+
+	if cfg.StartTLS {
+		if err := l.StartTLS(&tls.Config{InsecureSkipVerify: cfg.SkipVerify}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if err := l.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return fmt.Errorf("service account bind failed: %w", err)
+	}
+
+	userFilter := strings.Replace(cfg.UserFilter, "%s", ldap.EscapeFilter(userID), -1)
+	sr, err := l.Search(ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
+		userFilter,
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return fmt.Errorf("user search failed: %w", err)
+	}
+	if len(sr.Entries) != 1 {
+		return fmt.Errorf("user not found")
+	}
+
+	if _, err := l.PasswordModify(ldap.NewPasswordModifyRequest(sr.Entries[0].DN, "", password)); err != nil {
+		return fmt.Errorf("password change failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Package mailer sends plain-text notification emails through the SMTP server
+// configured in SystemConfig.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// Security modes for the SMTP connection.
+const (
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+	SecurityNone     = "none"
+)
+
+const dialTimeout = 15 * time.Second
+const sendTimeout = 30 * time.Second
+
+// ErrNotConfigured is returned when no SMTP server has been set up.
+var ErrNotConfigured = errors.New("email is not configured")
+
+// Settings describes how to reach the SMTP server.
+type Settings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Security string
+}
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SettingsFromApp returns the SMTP settings from the current system config.
+func SettingsFromApp(app *server.App) Settings {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	return Settings{
+		Host:     app.SystemConfig.SMTPHost,
+		Port:     app.SystemConfig.SMTPPort,
+		Username: app.SystemConfig.SMTPUsername,
+		Password: app.SystemConfig.SMTPPassword,
+		From:     app.SystemConfig.SMTPFrom,
+		Security: app.SystemConfig.SMTPSecurity,
+	}
+}
+
+// Configured reports whether enough SMTP settings are present to send mail.
+func (s Settings) Configured() bool {
+	return s.Host != "" && s.From != ""
+}
+
+// Configured reports whether the app has an SMTP server set up.
+func Configured(app *server.App) bool {
+	return SettingsFromApp(app).Configured()
+}
+
+// IsValidSecurity reports whether mode is a supported connection security
+// mode. The empty string selects the default (STARTTLS).
+func IsValidSecurity(mode string) bool {
+	switch mode {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+		return true
+	}
+	return false
+}
+
+// Send delivers msg using the app's SMTP settings.
+func Send(app *server.App, msg Message) error {
+	return SendWith(SettingsFromApp(app), msg)
+}
+
+// SendWith delivers msg using the given settings.
+func SendWith(s Settings, msg Message) error {
+	if !s.Configured() {
+		return ErrNotConfigured
+	}
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("invalid subject")
+	}
+
+	data, err := buildMessage(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	port := s.Port
+	if port == 0 {
+		port = defaultPort(s.Security)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	if s.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer c.Close()
+
+	if s.Security == "" || s.Security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO rejected: %w", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA rejected: %w", err)
+	}
+	if _, err := wc.Write(data); err != nil {
+		wc.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return c.Quit()
+}
+
+func defaultPort(security string) int {
+	switch security {
+	case SecurityTLS:
+		return 465
+	case SecurityNone:
+		return 25
+	default:
+		return 587
+	}
+}
+
+func buildMessage(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	domain := "dashgate.local"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(idBytes), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
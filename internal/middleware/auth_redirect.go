@@ -21,6 +21,9 @@ func AutoLoginRedirect(app *server.App, next http.Handler) http.Handler {
 			"/login",
 			"/logout",
 			"/setup",
+			"/reset-password",
+			"/invite/",
+			"/display/",
 			"/health",
 			"/api/health",
 			"/api/auth/",
@@ -29,6 +32,9 @@ func AutoLoginRedirect(app *server.App, next http.Handler) http.Handler {
 			"/sw.js",
 			"/offline",
 			"/auth/oidc",
+			"/scim/",
+			"/oauth2/",
+			"/.well-known/",
 		}
 
 		for _, path := range publicPaths {
@@ -39,6 +45,11 @@ func AutoLoginRedirect(app *server.App, next http.Handler) http.Handler {
 		}
 
 		user := auth.GetAuthenticatedUser(app, r)
+		if user == nil && r.URL.Path == "/" && auth.GuestUser(app) != nil {
+			// Guests see the dashboard with public apps only
+			next.ServeHTTP(w, r)
+			return
+		}
 		if user == nil {
 			isAPIRequest := strings.Contains(r.Header.Get("Accept"), "application/json") ||
 				strings.HasPrefix(r.URL.Path, "/api/")
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"dashgate/internal/audit"
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// NetworkDeniedMessage is returned to requests refused by a network policy.
+const NetworkDeniedMessage = "Access from your network is not allowed"
+
+// networkDenialInterval is how often repeated denials of one client by the
+// same policy are audited.
+const networkDenialInterval = time.Minute
+
+// ClientIP resolves the client address through trusted proxies once per
+// request, for auth.ClientIP and everything after it.
+func ClientIP(app *server.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, auth.WithClientIP(r, auth.ResolveClientIP(app, r)))
+	})
+}
+
+// NetworkPolicy enforces the route, API key and group network policies
+// before any handler or auth check runs. Group policies need the user, so
+// requests are only authenticated here when one is configured. Denials are
+// audited, repeats at most once a minute (see auditNetworkDenial).
+func NetworkPolicy(app *server.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := auth.ClientIP(r)
+		ip := net.ParseIP(clientIP)
+
+		if d := auth.RouteNetworkDenial(app, r.URL.Path, ip); d != nil {
+			denyNetwork(app, w, r, "", clientIP, d)
+			return
+		}
+		if d := auth.APIKeyNetworkDenial(app, r, ip); d != nil {
+			denyNetwork(app, w, r, "", clientIP, d)
+			return
+		}
+		if auth.HasGroupNetworkPolicies(app) {
+			if user := auth.GetAuthenticatedUser(app, r); user != nil {
+				if d := auth.GroupNetworkDenial(app, user.Groups, ip); d != nil {
+					denyNetwork(app, w, r, user.Username, clientIP, d)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func denyNetwork(app *server.App, w http.ResponseWriter, r *http.Request, username, clientIP string, d *auth.NetworkDenial) {
+	auditNetworkDenial(app, username, clientIP, d,
+		fmt.Sprintf("%s %s from %s refused by %s policy %q", r.Method, r.URL.Path, clientIP, d.Kind, d.Target))
+
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/scim/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": NetworkDeniedMessage})
+		return
+	}
+	http.Error(w, NetworkDeniedMessage, http.StatusForbidden)
+}
+
+// auditNetworkDenial audits the first denial of a client by a policy and
+// only counts the repeats for the next minute, so a client hammering a
+// protected route cannot flood the audit log. The count is audited once the
+// minute is over.
+func auditNetworkDenial(app *server.App, username, clientIP string, d *auth.NetworkDenial, detail string) {
+	key := clientIP + " " + d.Kind + " " + d.Target
+	now := time.Now()
+
+	app.NetworkDenialsMu.Lock()
+	if app.NetworkDenials == nil {
+		app.NetworkDenials = make(map[string]*server.NetworkDenialCount)
+	}
+	prev := app.NetworkDenials[key]
+	if prev != nil && now.Sub(prev.Since) < networkDenialInterval {
+		prev.Repeats++
+		app.NetworkDenialsMu.Unlock()
+		return
+	}
+	app.NetworkDenials[key] = &server.NetworkDenialCount{
+		IP: clientIP, Kind: d.Kind, Target: d.Target, Username: username, Since: now,
+	}
+	app.NetworkDenialsMu.Unlock()
+
+	if prev != nil && prev.Repeats > 0 {
+		auditRepeatedDenials(app, prev)
+	}
+	audit.LogAudit(app, username, "network_denied", detail, clientIP)
+}
+
+// FlushNetworkDenials audits the repeats counted in minutes that are over
+// and forgets them.
+func FlushNetworkDenials(app *server.App) {
+	now := time.Now()
+	var done []*server.NetworkDenialCount
+	app.NetworkDenialsMu.Lock()
+	for key, c := range app.NetworkDenials {
+		if now.Sub(c.Since) >= networkDenialInterval {
+			delete(app.NetworkDenials, key)
+			if c.Repeats > 0 {
+				done = append(done, c)
+			}
+		}
+	}
+	app.NetworkDenialsMu.Unlock()
+
+	for _, c := range done {
+		auditRepeatedDenials(app, c)
+	}
+}
+
+func auditRepeatedDenials(app *server.App, c *server.NetworkDenialCount) {
+	audit.LogAudit(app, c.Username, "network_denied",
+		fmt.Sprintf("%d more requests from %s refused by %s policy %q since %s", c.Repeats, c.IP, c.Kind, c.Target, c.Since.UTC().Format(time.RFC3339)), c.IP)
+}
+
+// StartNetworkDenialFlushLoop starts a background goroutine that audits
+// counted network policy denials every minute. The goroutine stops when the
+// context is cancelled.
+func StartNetworkDenialFlushLoop(app *server.App, ctx context.Context) {
+	ticker := time.NewTicker(networkDenialInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				FlushNetworkDenials(app)
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// previewWritablePaths stay usable during a preview so the admin can leave it.
+var previewWritablePaths = map[string]bool{
+	"/api/admin/preview": true,
+	"/api/auth/logout":   true,
+	"/logout":            true,
+}
+
+// PreviewReadOnly rejects state-changing requests while an admin is previewing
+// the dashboard as another user or set of groups.
+func PreviewReadOnly(app *server.App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if previewWritablePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie(auth.PreviewCookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if auth.GetPreview(app, r, auth.GetAuthenticatedUser(app, r)) != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Read-only preview: exit the preview to make changes",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -7,11 +7,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"dashgate/internal/auth"
 )
 
 type contextKey string
@@ -94,6 +95,13 @@ func CSRFProtection(next http.Handler) http.Handler {
 			return
 		}
 
+		// The OpenID token endpoint is called server-to-server by clients
+		// that authenticate with their own secret, never with cookies.
+		if r.URL.Path == "/oauth2/token" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// --- Ensure the CSRF cookie is present on every response ---
 		existingToken := ""
 		if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
@@ -299,14 +307,8 @@ func MaxBodySize(maxBytes int64, next http.Handler) http.Handler {
 }
 
 func extractIP(r *http.Request) string {
-	// Use RemoteAddr as the authoritative source.
-	// X-Forwarded-For is not trusted because any client can spoof it,
-	// allowing rate limit bypass. In a reverse proxy setup, the proxy's
-	// IP will be rate-limited, which is acceptable since the proxy
-	// should handle upstream rate limiting.
-	ip := r.RemoteAddr
-	if host, _, err := net.SplitHostPort(ip); err == nil {
-		ip = host
-	}
-	return ip
+	// X-Forwarded-For is only honoured for hops added by configured trusted
+	// proxies (see auth.ResolveClientIP), so clients cannot spoof it to
+	// bypass the limit. Without trusted proxies this is RemoteAddr.
+	return auth.ClientIP(r)
 }
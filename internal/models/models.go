@@ -33,9 +33,11 @@ type TemplateData struct {
 	User       string
 	Categories []Category
 	Version    string
+	Preview    string // who an admin is previewing the dashboard as, if anyone
+	Guest      bool   // the visitor is not signed in and sees public apps only
 }
 
-// LLDAPUser represents a user from the LLDAP directory (read-only).
+// LLDAPUser represents a user in the LLDAP directory.
 type LLDAPUser struct {
 	ID          string   `json:"id"`
 	Email       string   `json:"email"`
@@ -43,7 +45,7 @@ type LLDAPUser struct {
 	Groups      []string `json:"groups,omitempty"`
 }
 
-// LLDAPGroup represents a group from the LLDAP directory (read-only).
+// LLDAPGroup represents a group in the LLDAP directory.
 type LLDAPGroup struct {
 	ID          int      `json:"id"`
 	DisplayName string   `json:"displayName"`
@@ -100,18 +102,151 @@ type AuthConfig struct {
 	SessionDuration int    // days, default 7
 	CookieName      string // default "dashgate_session"
 	CookieSecure    bool   // default true
+	CookieDomain    string // optional, e.g. ".example.com" for forward auth across subdomains
 }
 
 // LocalUser represents a user stored in the local SQLite database.
 type LocalUser struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email,omitempty"`
-	PasswordHash string    `json:"-"`
-	DisplayName  string    `json:"displayName"`
-	Groups       []string  `json:"groups"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email,omitempty"`
+	PasswordHash string     `json:"-"`
+	DisplayName  string     `json:"displayName"`
+	Groups       []string   `json:"groups"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
+	// Disabled is set for accounts deactivated by SCIM provisioning.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// UserSession describes one signed-in device for the session management views.
+type UserSession struct {
+	ID         int        `json:"id"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	AuthSource string     `json:"authSource"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+// Identity is an external sign-in (an OIDC subject or an LDAP account)
+// linked to a DashGate user. Provider is "ldap", "oidc" or "oidc:{id}".
+type Identity struct {
+	ID          int        `json:"id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// NetworkPolicy restricts a route prefix (Kind "route") or the members of
+// a group (Kind "group") to the listed networks.
+type NetworkPolicy struct {
+	ID          int       `json:"id"`
+	Kind        string    `json:"kind"`
+	Target      string    `json:"target"`
+	Networks    string    `json:"networks"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// IDPClient is an app that signs users in through DashGate's own OpenID
+// provider. Only users in one of AllowedGroups may sign in to it; an empty
+// list allows everyone.
+type IDPClient struct {
+	ClientID      string    `json:"clientID"`
+	Name          string    `json:"name"`
+	RedirectURIs  []string  `json:"redirectURIs"`
+	AllowedGroups []string  `json:"allowedGroups"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// OIDCProviderConfig is an additional OpenID Connect provider offered on the
+// login page next to the primary one configured in SystemConfig. GroupMapping
+// holds one "provider-group = dashgate-group, ..." rule per line.
+type OIDCProviderConfig struct {
+	ID              string `json:"id"`
+	DisplayName     string `json:"displayName"`
+	Issuer          string `json:"issuer"`
+	ClientID        string `json:"clientID"`
+	ClientSecret    string `json:"-"`
+	HasClientSecret bool   `json:"hasClientSecret"`
+	RedirectURL     string `json:"redirectURL"`
+	Scopes          string `json:"scopes"`
+	GroupsClaim     string `json:"groupsClaim"`
+	GroupMapping    string `json:"groupMapping"`
+	Enabled         bool   `json:"enabled"`
+	SortOrder       int    `json:"sortOrder"`
+}
+
+// Invite is a single-use onboarding link with preassigned groups. Status is
+// one of "pending", "used", "revoked" or "expired".
+type Invite struct {
+	ID        int        `json:"id"`
+	Email     string     `json:"email,omitempty"` // if set, only this address may accept
+	Groups    []string   `json:"groups"`
+	Note      string     `json:"note,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	UsedBy    string     `json:"usedBy,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	Status    string     `json:"status"`
+}
+
+// AccessRequest is a user's request for access to an app they cannot see.
+// Groups lists the groups that would give them access.
+type AccessRequest struct {
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	App       string     `json:"app"`
+	Groups    []string   `json:"groups"`
+	Reason    string     `json:"reason,omitempty"`
+	Status    string     `json:"status"` // pending, approved or denied
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// GroupGrant adds a group to a user until it expires, on top of the groups
+// from their account or identity provider.
+type GroupGrant struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Group     string    `json:"group"`
+	GrantedBy string    `json:"grantedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// DisplayToken is a read-only link that shows a dashboard for a fixed set
+// of groups on a wall display or TV, without signing in.
+type DisplayToken struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	TokenPrefix     string     `json:"tokenPrefix"`
+	Groups          []string   `json:"groups"`
+	AllowedNetworks string     `json:"allowedNetworks"`
+	CreatedBy       string     `json:"createdBy"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+}
+
+// EncryptionStatus describes the key that encrypts sensitive values and how
+// many stored values still need another key. Failed counts values a rotation
+// could not decrypt.
+type EncryptionStatus struct {
+	KeyID     string   `json:"keyId"`
+	Source    string   `json:"source"` // env, file or database
+	OldKeyIDs []string `json:"oldKeyIds"`
+	Values    int      `json:"values"`
+	Pending   int      `json:"pending"`
+	Failed    int      `json:"failed,omitempty"`
 }
 
 // AuthenticatedUser is the unified user struct used throughout the app.
@@ -120,7 +255,7 @@ type AuthenticatedUser struct {
 	DisplayName string   `json:"displayName"`
 	Email       string   `json:"email,omitempty"`
 	Groups      []string `json:"groups"`
-	Source      string   `json:"source"` // "proxy", "local", "ldap", "oidc", "apikey"
+	Source      string   `json:"source"` // proxy profile name, "local", "ldap", "oidc", "apikey"
 	IsAdmin     bool     `json:"isAdmin"`
 }
 
@@ -128,11 +263,58 @@ type AuthenticatedUser struct {
 type SystemConfig struct {
 	// General settings
 	SessionDays    int    `json:"sessionDays"`
+	MaxSessions    int    `json:"maxSessions"` // concurrent sessions per user, 0 = unlimited
 	CookieSecure   bool   `json:"cookieSecure"`
+	CookieDomain   string `json:"cookieDomain"`
 	SetupCompleted bool   `json:"setupCompleted"`
 	AdminGroup     string `json:"adminGroup"`
 	TrustedProxies string `json:"trustedProxies"`
 
+	// Admin roles: comma-separated groups granted each role. Members of
+	// AdminGroup hold every role.
+	RoleAppEditorGroups        string `json:"roleAppEditorGroups"`
+	RoleDiscoveryManagerGroups string `json:"roleDiscoveryManagerGroups"`
+	RoleUserManagerGroups      string `json:"roleUserManagerGroups"`
+	RoleSystemAdminGroups      string `json:"roleSystemAdminGroups"`
+	RoleAuditorGroups          string `json:"roleAuditorGroups"`
+
+	// Audit log
+	AuditRetentionDays int `json:"auditRetentionDays"` // 0 = keep forever
+
+	// Password policy and account lockout
+	PasswordMinLength     int    `json:"passwordMinLength"`
+	PasswordCheckBreached bool   `json:"passwordCheckBreached"`
+	PasswordBreachedList  string `json:"passwordBreachedList"` // optional file of extra breached passwords or SHA-1 hashes
+	PasswordHistory       int    `json:"passwordHistory"`      // previous passwords that cannot be reused, 0 = off
+	LockoutThreshold      int    `json:"lockoutThreshold"`     // failed logins before lockout, 0 = off
+	LockoutMinutes        int    `json:"lockoutMinutes"`
+
+	// Admission rules for OIDC and LDAP sign-ins. Lists are separated by
+	// commas or newlines.
+	AdmissionEmailDomains       string `json:"admissionEmailDomains"`
+	AdmissionRequiredGroups     string `json:"admissionRequiredGroups"` // any one of these groups is required
+	AdmissionAllowList          string `json:"admissionAllowList"`      // usernames or emails always admitted
+	AdmissionDenyList           string `json:"admissionDenyList"`       // usernames or emails never admitted
+	AdmissionPreprovisionedOnly bool   `json:"admissionPreprovisionedOnly"`
+
+	// Let users request access to apps they cannot see
+	AccessRequestsEnabled bool `json:"accessRequestsEnabled"`
+
+	// Guest mode: visitors who are not signed in see apps shared with the
+	// "anonymous" group and every app in GuestCategories (comma-separated).
+	GuestModeEnabled bool   `json:"guestModeEnabled"`
+	GuestCategories  string `json:"guestCategories"`
+
+	// Email (SMTP) and self-service password reset
+	PublicURL            string `json:"publicUrl"` // external base URL used in links sent by email
+	SMTPHost             string `json:"smtpHost"`
+	SMTPPort             int    `json:"smtpPort"`
+	SMTPUsername         string `json:"smtpUsername"`
+	SMTPPassword         string `json:"-"`
+	SMTPFrom             string `json:"smtpFrom"`
+	SMTPSecurity         string `json:"smtpSecurity"` // starttls (default), tls or none
+	PasswordResetEnabled bool   `json:"passwordResetEnabled"`
+
 	// Auth providers enabled
 	ProxyAuthEnabled bool `json:"proxyAuthEnabled"`
 	LocalAuthEnabled bool `json:"localAuthEnabled"`
@@ -140,6 +322,18 @@ type SystemConfig struct {
 	OIDCAuthEnabled  bool `json:"oidcAuthEnabled"`
 	APIKeyEnabled    bool `json:"apiKeyEnabled"`
 
+	// Proxy auth header profile (authelia, authentik, oauth2-proxy, cloudflare,
+	// tailscale, custom). Custom header names override the profile defaults.
+	ProxyAuthProfile     string `json:"proxyAuthProfile"`
+	ProxyUserHeader      string `json:"proxyUserHeader"`
+	ProxyGroupsHeader    string `json:"proxyGroupsHeader"`
+	ProxyNameHeader      string `json:"proxyNameHeader"`
+	ProxyEmailHeader     string `json:"proxyEmailHeader"`
+	ProxyGroupsSeparator string `json:"proxyGroupsSeparator"`
+	ProxyJWKS            string `json:"proxyJwks"` // JWKS URL or file path for signed assertions
+	ProxyJWTIssuer       string `json:"proxyJwtIssuer"`
+	ProxyJWTAudience     string `json:"proxyJwtAudience"`
+
 	// LDAP settings
 	LDAPServer       string `json:"ldapServer"`
 	LDAPBindDN       string `json:"ldapBindDN"`
@@ -154,14 +348,26 @@ type SystemConfig struct {
 	LDAPStartTLS     bool   `json:"ldapStartTLS"`
 	LDAPSkipVerify   bool   `json:"ldapSkipVerify"`
 
+	// LLDAP management (GraphQL API)
+	LLDAPEnabled       bool   `json:"lldapEnabled"`
+	LLDAPURL           string `json:"lldapUrl"`
+	LLDAPAdminUsername string `json:"lldapAdminUsername"`
+	LLDAPAdminPassword string `json:"-"`
+
+	// SCIM provisioning. Only the SHA-256 of the bearer token is stored.
+	SCIMEnabled   bool   `json:"scimEnabled"`
+	SCIMTokenHash string `json:"-"`
+
 	// OIDC settings
-	OIDCDisplayName  string `json:"oidcDisplayName"`
-	OIDCIssuer       string `json:"oidcIssuer"`
-	OIDCClientID     string `json:"oidcClientID"`
-	OIDCClientSecret string `json:"-"`
-	OIDCRedirectURL  string `json:"oidcRedirectURL"`
-	OIDCScopes       string `json:"oidcScopes"`
-	OIDCGroupsClaim  string `json:"oidcGroupsClaim"`
+	OIDCDisplayName   string `json:"oidcDisplayName"`
+	OIDCIssuer        string `json:"oidcIssuer"`
+	OIDCClientID      string `json:"oidcClientID"`
+	OIDCClientSecret  string `json:"-"`
+	OIDCRedirectURL   string `json:"oidcRedirectURL"`
+	OIDCScopes        string `json:"oidcScopes"`
+	OIDCGroupsClaim   string `json:"oidcGroupsClaim"`
+	OIDCLogoutEnabled bool   `json:"oidcLogoutEnabled"`
+	OIDCGroupMapping  string `json:"oidcGroupMapping"`
 
 	// Discovery settings
 	DockerDiscoveryEnabled  bool   `json:"dockerDiscoveryEnabled"`
@@ -224,6 +430,12 @@ type APIKey struct {
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
 	CreatedAt   time.Time  `json:"createdAt"`
+	// AllowedNetworks restricts where the key can be used from (CIDRs,
+	// addresses or aliases such as "lan"); empty allows any network
+	AllowedNetworks string `json:"allowedNetworks,omitempty"`
+	// Personal keys are created by Username for themselves and never carry
+	// groups the owner does not hold
+	Personal bool `json:"personal"`
 }
 
 // DockerContainer represents a Docker container from the API.
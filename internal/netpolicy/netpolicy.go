@@ -0,0 +1,66 @@
+// Package netpolicy parses the network lists used by access policies.
+package netpolicy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Aliases are named ranges that can be used in place of CIDRs.
+var Aliases = map[string][]string{
+	"lan": {
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "127.0.0.0/8",
+		"fc00::/7", "fe80::/10", "::1/128",
+	},
+	"loopback":  {"127.0.0.0/8", "::1/128"},
+	"tailscale": {"100.64.0.0/10", "fd7a:115c:a1e0::/48"},
+}
+
+// Parse reads a comma-, space- or newline-separated list of CIDRs, single
+// IP addresses and aliases. An empty list parses to no networks.
+func Parse(spec string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		if alias, ok := Aliases[strings.ToLower(entry)]; ok {
+			for _, cidr := range alias {
+				_, n, _ := net.ParseCIDR(cidr)
+				nets = append(nets, n)
+			}
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, n, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", entry)
+			}
+			nets = append(nets, n)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// Contains reports whether ip is in any of the networks.
+func Contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 )
 
+const discoveryTimeout = 30 * time.Second
+
 func InitOIDCProvider(app *server.App, issuer, clientID, clientSecret, redirectURL, scopes, groupsClaim string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
 	defer cancel()
 
 	provider, err := oidc.NewProvider(ctx, issuer)
@@ -22,18 +26,7 @@ func InitOIDCProvider(app *server.App, issuer, clientID, clientSecret, redirectU
 		return
 	}
 
-	scopeList := []string{oidc.ScopeOpenID, "profile", "email"}
-	if scopes != "" {
-		scopeList = strings.Split(scopes, " ")
-	}
-
-	oauthConfig := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Endpoint:     provider.Endpoint(),
-		Scopes:       scopeList,
-	}
+	oauthConfig := newOAuth2Config(provider, clientID, clientSecret, redirectURL, scopes)
 
 	if groupsClaim == "" {
 		groupsClaim = "groups"
@@ -47,3 +40,85 @@ func InitOIDCProvider(app *server.App, issuer, clientID, clientSecret, redirectU
 
 	log.Printf("OIDC auth configured: %s", issuer)
 }
+
+// NewClient discovers an additional provider's endpoints and returns it ready
+// for logins.
+func NewClient(ctx context.Context, cfg models.OIDCProviderConfig) (*server.OIDCClient, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	return &server.OIDCClient{
+		ID:           cfg.ID,
+		DisplayName:  cfg.DisplayName,
+		Provider:     provider,
+		OAuth2:       newOAuth2Config(provider, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.Scopes),
+		GroupsClaim:  groupsClaim,
+		GroupMapping: cfg.GroupMapping,
+	}, nil
+}
+
+// InitOIDCProviders initializes the enabled additional providers in parallel
+// and replaces app.OIDCProviders with those that could be reached. It returns
+// the discovery error for each provider that failed.
+func InitOIDCProviders(app *server.App, configs []models.OIDCProviderConfig) map[string]error {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+
+	clients := make([]*server.OIDCClient, len(configs))
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		if !cfg.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cfg models.OIDCProviderConfig) {
+			defer wg.Done()
+			client, err := NewClient(ctx, cfg)
+			if err != nil {
+				log.Printf("Failed to initialize OIDC provider %q: %v", cfg.ID, err)
+				mu.Lock()
+				errs[cfg.ID] = err
+				mu.Unlock()
+				return
+			}
+			clients[i] = client
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	ready := make([]*server.OIDCClient, 0, len(clients))
+	for _, c := range clients {
+		if c != nil {
+			ready = append(ready, c)
+			log.Printf("OIDC provider configured: %s", c.ID)
+		}
+	}
+
+	app.SysConfigMu.Lock()
+	app.OIDCProviders = ready
+	app.SysConfigMu.Unlock()
+	return errs
+}
+
+func newOAuth2Config(provider *oidc.Provider, clientID, clientSecret, redirectURL, scopes string) *oauth2.Config {
+	scopeList := []string{oidc.ScopeOpenID, "profile", "email"}
+	if scopes != "" {
+		scopeList = strings.Fields(scopes)
+	}
+
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopeList,
+	}
+}
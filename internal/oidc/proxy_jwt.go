@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v3"
+)
+
+// NewProxyJWTVerifier builds a verifier for JWT assertions forwarded by an
+// authenticating proxy (e.g. Cloudflare Access). The jwks argument is either
+// an http(s) URL, fetched lazily and cached, or a path to a local JWKS file.
+// The audience (e.g. the Access application's AUD tag) is required, since
+// without it assertions for any application of the same team would be
+// accepted. An empty issuer disables the issuer check.
+func NewProxyJWTVerifier(client *http.Client, jwks, issuer, audience string) (*oidc.IDTokenVerifier, error) {
+	if audience == "" {
+		return nil, fmt.Errorf("an audience is required to verify proxy assertions")
+	}
+
+	var keySet oidc.KeySet
+	if strings.HasPrefix(jwks, "https://") || strings.HasPrefix(jwks, "http://") {
+		ctx := oidc.ClientContext(context.Background(), client)
+		keySet = oidc.NewRemoteKeySet(ctx, jwks)
+	} else {
+		keys, err := loadJWKSFile(jwks)
+		if err != nil {
+			return nil, err
+		}
+		keySet = &oidc.StaticKeySet{PublicKeys: keys}
+	}
+
+	return oidc.NewVerifier(issuer, keySet, &oidc.Config{
+		ClientID:        audience,
+		SkipIssuerCheck: issuer == "",
+	}), nil
+}
+
+// loadJWKSFile reads a JSON Web Key Set from disk and returns its public keys.
+func loadJWKSFile(path string) ([]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	var keys []crypto.PublicKey
+	for _, k := range set.Keys {
+		if !k.Valid() {
+			continue
+		}
+		keys = append(keys, k.Public().Key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS file %s contains no usable keys", path)
+	}
+	return keys, nil
+}
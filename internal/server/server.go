@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/rsa"
 	"crypto/tls"
 	"database/sql"
 	"html/template"
@@ -31,12 +32,27 @@ type App struct {
 	SysConfigMu      sync.RWMutex
 	TrustedProxyNets []*net.IPNet
 	TrustedProxyIPs  []net.IP
+	// NetworkPolicies are the parsed route and group network policies
+	NetworkPolicies []NetworkPolicy
+	// NetworkDenials counts recent denials per client and policy, keyed by
+	// "ip kind target", so repeats are audited once a minute
+	NetworkDenials   map[string]*NetworkDenialCount
+	NetworkDenialsMu sync.Mutex
 
 	// Auth
 	AuthConfig   models.AuthConfig
 	LDAPAuth     *models.LDAPAuthConfig
 	OIDCProvider *oidc.Provider
 	OAuth2Config *oauth2.Config
+	// OIDCProviders are the additional OIDC providers, in login page order
+	OIDCProviders []*OIDCClient
+
+	// Verifier for signed proxy assertions (e.g. Cloudflare Access JWTs)
+	ProxyJWTVerifier *oidc.IDTokenVerifier
+
+	// Signing key of the built-in OpenID provider, loaded on first use
+	IDPKey   *IDPKey
+	IDPKeyMu sync.Mutex
 
 	// Health
 	HealthCache map[string]string
@@ -47,8 +63,10 @@ type App struct {
 	MappingsMu   sync.RWMutex
 	MappingsPath string
 
-	// LLDAP client config
+	// LLDAP client config, replaced when the settings change. Nil when
+	// LLDAP is not configured.
 	LLDAPConfig *LLDAPConfigRef
+	LLDAPMu     sync.RWMutex
 
 	// Discovery managers
 	DockerDiscovery  *DiscoveryManager
@@ -59,13 +77,9 @@ type App struct {
 	UnraidDiscovery  *DiscoveryManager
 	DiscoveryMu      sync.RWMutex
 
-	// Discovery env override flags
-	DockerDiscoveryEnvOverride  bool
-	TraefikDiscoveryEnvOverride bool
-	NginxDiscoveryEnvOverride   bool
-	NPMDiscoveryEnvOverride     bool
-	CaddyDiscoveryEnvOverride   bool
-	UnraidDiscoveryEnvOverride  bool
+	// System config values set from the environment, keyed by
+	// system_config key. Filled once at startup and read-only afterwards.
+	ConfigEnv map[string]ConfigEnvValue
 
 	// Discovered app overrides cache
 	DiscoveredOverrides   map[string]*models.DiscoveredAppOverride
@@ -91,21 +105,61 @@ type App struct {
 	NPMTokenMu     sync.RWMutex
 	NPMTokenExpiry time.Time
 
-	// Encryption key for sensitive config values (AES-256, 32 bytes)
-	EncryptionKey []byte
+	// Encryption key for sensitive config values (AES-256, 32 bytes).
+	// OldEncryptionKeys still decrypt values written before a key rotation.
+	EncryptionKey       []byte
+	OldEncryptionKeys   [][]byte
+	EncryptionKeySource string // env, file or database
+	EncryptionMu        sync.RWMutex
+
+	// AuditKey keys the audit log's hash chain. It is set at startup.
+	AuditKey []byte
 
 	// Version string set at startup
 	Version string
 }
 
+// ConfigEnvValue is a system config value locked by an environment variable.
+type ConfigEnvValue struct {
+	Var   string // Variable that set it, e.g. DASHGATE_SESSION_DAYS
+	Value string
+}
+
+// OIDCClient is an initialized OIDC provider. The primary provider has an
+// empty ID.
+type OIDCClient struct {
+	ID           string
+	DisplayName  string
+	Provider     *oidc.Provider
+	OAuth2       *oauth2.Config
+	GroupsClaim  string
+	GroupMapping string
+}
+
+// IDPKey is the RSA key the built-in OpenID provider signs tokens with.
+type IDPKey struct {
+	ID      string
+	Private *rsa.PrivateKey
+}
+
+// NetworkPolicy is a parsed network policy. Kind is "route" (Target is a
+// path prefix) or "group" (Target is a group name).
+type NetworkPolicy struct {
+	ID       int
+	Kind     string
+	Target   string
+	Networks []*net.IPNet
+}
+
 // LLDAPConfigRef holds LLDAP connection details.
 type LLDAPConfigRef struct {
-	URL      string
-	Username string
-	Password string
-	Token    string
-	TokenMu  sync.RWMutex
-	Expiry   time.Time
+	URL       string
+	Username  string
+	Password  string
+	Token     string
+	TokenMu   sync.RWMutex
+	Expiry    time.Time
+	LastError string // last connection error, cleared on success
 }
 
 // DiscoveryManager tracks a single discovery source.
@@ -184,3 +238,20 @@ func (a *App) GetTemplates() *template.Template {
 	}
 	return a.Templates
 }
+
+// ConfigEnvVar returns the environment variable that sets a system config
+// key, or "" if the key can be changed from the admin UI.
+func (a *App) ConfigEnvVar(key string) string {
+	return a.ConfigEnv[key].Var
+}
+
+// NetworkDenialCount tracks the denials of one client by one network policy
+// since the last one that was audited.
+type NetworkDenialCount struct {
+	IP       string
+	Kind     string
+	Target   string
+	Username string
+	Since    time.Time
+	Repeats  int
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"dashgate/internal/auth"
+	"dashgate/internal/bootstrap"
 	"dashgate/internal/config"
 	"dashgate/internal/database"
 	"dashgate/internal/discovery"
@@ -96,6 +97,11 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Unattended setup from SETUP_FILE / SETUP_* (no-op when unset)
+	if err := bootstrap.Run(app); err != nil {
+		log.Fatalf("Unattended setup failed:\n%v", err)
+	}
+
 	// Template directory (default: /app/templates for Docker, override with TEMPLATES_PATH)
 	app.TemplateDir = "/app/templates"
 	if dir := os.Getenv("TEMPLATES_PATH"); dir != "" {
@@ -126,6 +132,9 @@ func main() {
 	// Start background services
 	health.StartHealthChecker(app, bgCtx)
 	database.StartSessionCleanupLoop(app, bgCtx)
+	auth.StartAPIKeyMaintenanceLoop(app, bgCtx)
+	auth.StartGroupGrantExpiryLoop(app, bgCtx)
+	middleware.StartNetworkDenialFlushLoop(app, bgCtx)
 	lldap.InitLLDAP(app)
 	discovery.InitDockerDiscovery(app)
 	discovery.InitTraefikDiscovery(app)
@@ -216,6 +225,13 @@ func main() {
 	mux.HandleFunc("/api/auth/logout", handlers.LogoutHandler(app))
 	mux.HandleFunc("/api/auth/me", handlers.AuthMeHandler(app))
 	mux.HandleFunc("/api/auth/config", handlers.AuthConfigHandler(app))
+	mux.HandleFunc("/api/auth/verify", handlers.ForwardAuthHandler(app))
+	mux.HandleFunc("/api/auth/forgot-password", handlers.ForgotPasswordHandler(app))
+	mux.HandleFunc("/api/auth/reset-password", handlers.ResetPasswordHandler(app))
+	mux.HandleFunc("/reset-password", handlers.ResetPasswordPageHandler(app))
+	mux.HandleFunc("/api/auth/invite", handlers.AcceptInviteHandler(app))
+	mux.HandleFunc("/invite/", handlers.InvitePageHandler(app))
+	mux.HandleFunc("/display/", handlers.DisplayHandler(app))
 
 	// User preferences
 	mux.HandleFunc("/api/user/preferences", handlers.UserPreferencesHandler(app))
@@ -223,79 +239,134 @@ func main() {
 	// User self-service (profile, password)
 	mux.HandleFunc("/api/user/profile", auth.RequireAuth(app, handlers.UserProfileHandler(app)))
 	mux.HandleFunc("/api/user/password", auth.RequireAuth(app, handlers.UserPasswordHandler(app)))
+	mux.HandleFunc("/api/user/sessions", auth.RequireAuth(app, handlers.UserSessionsHandler(app)))
+	mux.HandleFunc("/api/user/sessions/", auth.RequireAuth(app, handlers.UserSessionsHandler(app)))
+	mux.HandleFunc("/api/user/identities", auth.RequireAuth(app, handlers.UserIdentitiesHandler(app)))
+	mux.HandleFunc("/api/user/identities/", auth.RequireAuth(app, handlers.UserIdentitiesHandler(app)))
+	mux.HandleFunc("/api/user/api-keys", auth.RequireAuth(app, handlers.UserAPIKeysHandler(app)))
+	mux.HandleFunc("/api/user/api-keys/", auth.RequireAuth(app, handlers.UserAPIKeysHandler(app)))
+	mux.HandleFunc("/api/user/access-requests", auth.RequireAuth(app, handlers.UserAccessRequestsHandler(app)))
 
 	// OIDC routes
 	mux.HandleFunc("/auth/oidc", auth.OIDCAuthHandler(app))
 	mux.HandleFunc("/auth/oidc/callback", auth.OIDCCallbackHandler(app))
+	mux.HandleFunc("/auth/oidc/", auth.OIDCProviderHandler(app))
+
+	// Built-in OpenID provider for downstream apps
+	mux.HandleFunc("/.well-known/openid-configuration", handlers.IDPDiscoveryHandler(app))
+	mux.HandleFunc("/oauth2/jwks", handlers.IDPJWKSHandler(app))
+	mux.HandleFunc("/oauth2/authorize", handlers.IDPAuthorizeHandler(app))
+	mux.HandleFunc("/oauth2/token", handlers.IDPTokenHandler(app))
+	mux.HandleFunc("/oauth2/userinfo", handlers.IDPUserInfoHandler(app))
 
 	// API key management
-	mux.HandleFunc("/api/admin/api-keys", auth.RequireAdmin(app, handlers.APIKeysHandler(app)))
+	mux.HandleFunc("/api/admin/api-keys", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.APIKeysHandler(app)))
 
 	// System config
-	mux.HandleFunc("/api/admin/system-config", auth.RequireAdmin(app, handlers.SystemConfigHandler(app)))
+	mux.HandleFunc("/api/admin/system-config", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.SystemConfigHandler(app)))
+	mux.HandleFunc("/api/admin/smtp/test", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.SMTPTestHandler(app)))
 
 	// Audit log
-	mux.HandleFunc("/api/admin/audit-log", auth.RequireAdmin(app, handlers.AuditLogHandler(app)))
+	mux.HandleFunc("/api/admin/audit-log", auth.RequireRole(app, auth.RoleAuditor, handlers.AuditLogHandler(app)))
+	mux.HandleFunc("/api/admin/audit-log/export", auth.RequireRole(app, auth.RoleAuditor, handlers.AuditLogExportHandler(app)))
+	mux.HandleFunc("/api/admin/audit-log/verify", auth.RequireRole(app, auth.RoleAuditor, handlers.AuditLogVerifyHandler(app)))
 
 	// Admin API routes
-	mux.HandleFunc("/api/admin/check", auth.RequireAdmin(app, handlers.AdminCheckHandler(app)))
-	mux.HandleFunc("/api/admin/users", auth.RequireAdmin(app, handlers.AdminLLDAPUsersHandler(app)))
-	mux.HandleFunc("/api/admin/groups", auth.RequireAdmin(app, handlers.AdminLLDAPGroupsHandler(app)))
-	mux.HandleFunc("/api/admin/apps", auth.RequireAdmin(app, handlers.AdminAppsHandler(app)))
-	mux.HandleFunc("/api/admin/apps/mapping", auth.RequireAdmin(app, handlers.AdminAppMappingHandler(app)))
+	mux.HandleFunc("/api/admin/check", auth.RequireAnyRole(app, handlers.AdminCheckHandler(app)))
+	mux.HandleFunc("/api/admin/users", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminLLDAPUsersHandler(app)))
+	mux.HandleFunc("/api/admin/groups", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminLLDAPGroupsHandler(app)))
+	mux.HandleFunc("/api/admin/users/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminLLDAPUserHandler(app)))
+	mux.HandleFunc("/api/admin/groups/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminLLDAPGroupHandler(app)))
+	mux.HandleFunc("/api/admin/lldap-config", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminLLDAPConfigHandler(app)))
+	mux.HandleFunc("/api/admin/scim", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminSCIMHandler(app)))
+
+	// SCIM provisioning (bearer token, see AdminSCIMHandler)
+	mux.HandleFunc("/scim/v2/", handlers.SCIMHandler(app))
+	mux.HandleFunc("/api/admin/apps", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminAppsHandler(app)))
+	mux.HandleFunc("/api/admin/apps/mapping", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminAppMappingHandler(app)))
 
 	// Local user management
-	mux.HandleFunc("/api/admin/local-users", auth.RequireAdmin(app, handlers.LocalUsersHandler(app)))
-	mux.HandleFunc("/api/admin/local-users/", auth.RequireAdmin(app, handlers.LocalUserHandler(app)))
+	mux.HandleFunc("/api/admin/local-users", auth.RequireRole(app, auth.RoleUserManager, handlers.LocalUsersHandler(app)))
+	mux.HandleFunc("/api/admin/local-users/", auth.RequireRole(app, auth.RoleUserManager, handlers.LocalUserHandler(app)))
+
+	// Invitation links
+	mux.HandleFunc("/api/admin/invites", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminInvitesHandler(app)))
+	mux.HandleFunc("/api/admin/invites/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminInviteHandler(app)))
+
+	// Access requests and temporary group grants
+	mux.HandleFunc("/api/admin/access-requests", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminAccessRequestsHandler(app)))
+	mux.HandleFunc("/api/admin/access-requests/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminAccessRequestsHandler(app)))
+	mux.HandleFunc("/api/admin/group-grants", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminGroupGrantsHandler(app)))
+	mux.HandleFunc("/api/admin/group-grants/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminGroupGrantsHandler(app)))
+	mux.HandleFunc("/api/admin/oidc-providers", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminOIDCProvidersHandler(app)))
+	mux.HandleFunc("/api/admin/oidc-providers/", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminOIDCProviderHandler(app)))
+	mux.HandleFunc("/api/admin/oidc-clients", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminOIDCClientsHandler(app)))
+	mux.HandleFunc("/api/admin/oidc-clients/", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminOIDCClientHandler(app)))
+	mux.HandleFunc("/api/admin/network-policies", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminNetworkPoliciesHandler(app)))
+	mux.HandleFunc("/api/admin/network-policies/", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminNetworkPolicyHandler(app)))
+
+	// Display tokens for wall dashboards and TVs
+	mux.HandleFunc("/api/admin/display-tokens", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminDisplayTokensHandler(app)))
+	mux.HandleFunc("/api/admin/display-tokens/", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminDisplayTokenHandler(app)))
+
+	// Encryption key status and rotation
+	mux.HandleFunc("/api/admin/encryption", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminEncryptionHandler(app)))
+	mux.HandleFunc("/api/admin/encryption/rotate", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.AdminEncryptionRotateHandler(app)))
 
 	// Managed groups
-	mux.HandleFunc("/api/admin/managed-groups", auth.RequireAdmin(app, handlers.AdminManagedGroupsHandler(app)))
-	mux.HandleFunc("/api/admin/managed-groups/", auth.RequireAdmin(app, handlers.AdminManagedGroupHandler(app)))
+	mux.HandleFunc("/api/admin/managed-groups", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminManagedGroupsHandler(app)))
+	mux.HandleFunc("/api/admin/managed-groups/", auth.RequireRole(app, auth.RoleUserManager, handlers.AdminManagedGroupHandler(app)))
 
 	// App configuration CRUD
-	mux.HandleFunc("/api/admin/config/apps", auth.RequireAdmin(app, handlers.AdminConfigAppsHandler(app)))
-	mux.HandleFunc("/api/admin/config/categories", auth.RequireAdmin(app, handlers.AdminCategoriesHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons", auth.RequireAdmin(app, handlers.AdminIconsHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/upload", auth.RequireAdmin(app, handlers.AdminIconUploadHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/dashboard-icons", auth.RequireAdmin(app, handlers.AdminDashboardIconsHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/download", auth.RequireAdmin(app, handlers.AdminIconDownloadHandler(app)))
+	mux.HandleFunc("/api/admin/config/apps", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminConfigAppsHandler(app)))
+	mux.HandleFunc("/api/admin/config/categories", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminCategoriesHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminIconsHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/upload", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminIconUploadHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/dashboard-icons", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminDashboardIconsHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/download", auth.RequireRole(app, auth.RoleAppEditor, handlers.AdminIconDownloadHandler(app)))
 
 	// Dependencies API
 	mux.HandleFunc("/api/dependencies", handlers.DependenciesHandler(app))
 
 	// Discovered apps
 	mux.HandleFunc("/api/discovered-apps", handlers.DiscoveredAppsHandler(app))
-	mux.HandleFunc("/api/admin/discovered-apps", auth.RequireAdmin(app, handlers.AdminDiscoveredAppsHandler(app)))
-	mux.HandleFunc("/api/admin/discovered-apps/bulk", auth.RequireAdmin(app, handlers.BulkDiscoveredAppsHandler(app)))
+	mux.HandleFunc("/api/admin/discovered-apps", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.AdminDiscoveredAppsHandler(app)))
+	mux.HandleFunc("/api/admin/discovered-apps/bulk", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.BulkDiscoveredAppsHandler(app)))
 
 	// Discovery management
-	mux.HandleFunc("/api/admin/docker-discovery", auth.RequireAdmin(app, handlers.DockerDiscoveryHandler(app)))
-	mux.HandleFunc("/api/admin/traefik-discovery", auth.RequireAdmin(app, handlers.TraefikDiscoveryHandler(app)))
-	mux.HandleFunc("/api/admin/nginx-discovery", auth.RequireAdmin(app, handlers.NginxDiscoveryHandler(app)))
-	mux.HandleFunc("/api/admin/npm-discovery", auth.RequireAdmin(app, handlers.NPMDiscoveryHandler(app)))
-	mux.HandleFunc("/api/admin/caddy-discovery", auth.RequireAdmin(app, handlers.CaddyDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/docker-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.DockerDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/traefik-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.TraefikDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/nginx-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.NginxDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/npm-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.NPMDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/caddy-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.CaddyDiscoveryHandler(app)))
 
 	// Discovery test endpoints
-	mux.HandleFunc("/api/admin/traefik-discovery/test", auth.RequireAdmin(app, handlers.TraefikTestHandler(app)))
-	mux.HandleFunc("/api/admin/npm-discovery/test", auth.RequireAdmin(app, handlers.NPMTestHandler(app)))
-	mux.HandleFunc("/api/admin/caddy-discovery/test", auth.RequireAdmin(app, handlers.CaddyTestHandler(app)))
-	mux.HandleFunc("/api/admin/unraid-discovery", auth.RequireAdmin(app, handlers.UnraidDiscoveryHandler(app)))
-	mux.HandleFunc("/api/admin/unraid-discovery/test", auth.RequireAdmin(app, handlers.UnraidTestHandler(app)))
+	mux.HandleFunc("/api/admin/traefik-discovery/test", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.TraefikTestHandler(app)))
+	mux.HandleFunc("/api/admin/npm-discovery/test", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.NPMTestHandler(app)))
+	mux.HandleFunc("/api/admin/caddy-discovery/test", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.CaddyTestHandler(app)))
+	mux.HandleFunc("/api/admin/unraid-discovery", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.UnraidDiscoveryHandler(app)))
+	mux.HandleFunc("/api/admin/unraid-discovery/test", auth.RequireRole(app, auth.RoleDiscoveryManager, handlers.UnraidTestHandler(app)))
 
 	// Backup/Restore
-	mux.HandleFunc("/api/admin/backup", auth.RequireAdmin(app, handlers.BackupHandler(app)))
-	mux.HandleFunc("/api/admin/restore", auth.RequireAdmin(app, handlers.RestoreHandler(app)))
+	mux.HandleFunc("/api/admin/backup", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.BackupHandler(app)))
+	mux.HandleFunc("/api/admin/restore", auth.RequireRole(app, auth.RoleSystemAdmin, handlers.RestoreHandler(app)))
 
 	// Import
-	mux.HandleFunc("/api/admin/import/preview", auth.RequireAdmin(app, handlers.ImportPreviewHandler(app)))
-	mux.HandleFunc("/api/admin/import/apply", auth.RequireAdmin(app, handlers.ImportApplyHandler(app)))
+	mux.HandleFunc("/api/admin/import/preview", auth.RequireRole(app, auth.RoleAppEditor, handlers.ImportPreviewHandler(app)))
+	mux.HandleFunc("/api/admin/import/apply", auth.RequireRole(app, auth.RoleAppEditor, handlers.ImportApplyHandler(app)))
+
+	// View-as preview
+	mux.HandleFunc("/api/admin/preview", auth.RequireAdmin(app, handlers.AdminPreviewHandler(app)))
 
-	// Apply middleware chain: auto-login redirect → body size limit → rate limiting → CSRF → security headers
-	bodySizeLimited := middleware.MaxBodySize(1<<20, mux)
-	rateLimited := loginLimiter.LimitPath([]string{"/api/auth/login", "/login"}, bodySizeLimited)
+	// Apply middleware chain: auto-login redirect → body size limit → rate limiting → CSRF → security headers → preview read-only
+	previewReadOnly := middleware.PreviewReadOnly(app, mux)
+	bodySizeLimited := middleware.MaxBodySize(1<<20, previewReadOnly)
+	rateLimited := loginLimiter.LimitPath([]string{"/api/auth/login", "/login", "/api/auth/forgot-password", "/api/auth/reset-password", "/api/auth/invite"}, bodySizeLimited)
 	csrfProtected := middleware.CSRFProtection(rateLimited)
 	securityHeaders := middleware.SecurityHeaders(csrfProtected)
-	handler := middleware.AutoLoginRedirect(app, securityHeaders)
+	autoLogin := middleware.AutoLoginRedirect(app, securityHeaders)
+	networkPolicy := middleware.NetworkPolicy(app, autoLogin)
+	handler := middleware.ClientIP(app, networkPolicy)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -66,6 +66,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -122,6 +123,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -209,6 +211,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -265,6 +268,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -355,6 +359,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -442,6 +447,7 @@
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
+                        envOverride.querySelector('span').textContent = `Controlled by ${status.envVar} environment variable. UI changes won't take effect until the env var is removed.`;
                     }
 
                     // Update hint
@@ -1,6 +1,6 @@
 // admin-users.js - LLDAP/local users and groups management
 
-// Read-only User List
+// LLDAP User List
 function renderUsersList() {
   const container = document.getElementById("usersList");
   const searchTerm =
@@ -43,6 +43,20 @@ function renderUsersList() {
                             : ""
                         }
                     </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="openPasswordResetModal('${escapeHtml(user.id).replace(/'/g, "\\'")}', '${escapeHtml(user.id).replace(/'/g, "\\'")}', 'lldap')" title="Reset Password">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
+                                <path d="M7 11V7a5 5 0 0110 0v4"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="confirmDeleteLLDAPUser('${escapeHtml(user.id).replace(/'/g, "\\'")}')" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
                 </div>
             `,
     )
@@ -53,7 +67,7 @@ function filterUsers() {
   renderUsersList();
 }
 
-// Read-only Group List
+// LLDAP Group List
 function renderGroupsList() {
   const container = document.getElementById("groupsList");
 
@@ -62,9 +76,16 @@ function renderGroupsList() {
     return;
   }
 
+  const quote = (v) => escapeHtml(String(v)).replace(/'/g, "\\'");
+
   container.innerHTML = adminState.groups
-    .map(
-      (group) => `
+    .map((group) => {
+      const members = group.users || [];
+      const memberIds = new Set(members.map((u) => u.id));
+      const candidates = (adminState.users || []).filter(
+        (u) => !memberIds.has(u.id),
+      );
+      return `
                 <div class="admin-item">
                     <div class="admin-item-icon">
                         <svg width="20" height="20" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
@@ -75,14 +96,190 @@ function renderGroupsList() {
                     </div>
                     <div class="admin-item-info">
                         <div class="admin-item-name">${escapeHtml(group.displayName)}</div>
-                        <div class="admin-item-meta">${group.users ? group.users.length : 0} members</div>
+                        <div class="admin-item-meta">${members.length} members</div>
+                        <div class="admin-item-groups">
+                            ${members
+                              .map(
+                                (u) =>
+                                  `<span class="admin-group-badge">${escapeHtml(u.id)} <a href="#" onclick="removeLLDAPMember(${group.id}, '${quote(u.id)}'); return false;" title="Remove from group">&times;</a></span>`,
+                              )
+                              .join("")}
+                            ${
+                              candidates.length > 0
+                                ? `<select class="admin-search-input" style="width: auto; padding: 2px 6px; font-size: 11px" onchange="addLLDAPMember(${group.id}, this.value)">
+                                <option value="">+ Add member</option>
+                                ${candidates.map((u) => `<option value="${escapeHtml(u.id)}">${escapeHtml(u.id)}</option>`).join("")}
+                            </select>`
+                                : ""
+                            }
+                        </div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="confirmDeleteLLDAPGroup(${group.id}, '${quote(group.displayName)}')" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
                     </div>
                 </div>
-            `,
-    )
+            `;
+    })
     .join("");
 }
 
+async function reloadLLDAPData() {
+  try {
+    const [usersResp, groupsResp] = await Promise.all([
+      fetch("/api/admin/users", { credentials: "include" }),
+      fetch("/api/admin/groups", { credentials: "include" }),
+    ]);
+    if (usersResp.ok) adminState.users = (await usersResp.json()) || [];
+    if (groupsResp.ok) adminState.groups = (await groupsResp.json()) || [];
+  } catch (e) {
+    console.error("Failed to reload LLDAP data:", e);
+  }
+  renderUsersList();
+  renderGroupsList();
+}
+
+function openLLDAPUserModal() {
+  [
+    "lldapUserID",
+    "lldapUserEmail",
+    "lldapUserDisplayName",
+    "lldapUserPassword",
+  ].forEach((id) => (document.getElementById(id).value = ""));
+  document.getElementById("lldapUserModal").classList.add("open");
+}
+
+function closeLLDAPUserModal() {
+  document.getElementById("lldapUserModal").classList.remove("open");
+  document.getElementById("lldapUserPassword").value = "";
+}
+
+async function saveLLDAPUser() {
+  const payload = {
+    id: document.getElementById("lldapUserID").value.trim(),
+    email: document.getElementById("lldapUserEmail").value.trim(),
+    displayName: document.getElementById("lldapUserDisplayName").value.trim(),
+    password: document.getElementById("lldapUserPassword").value,
+  };
+  if (!payload.id || !payload.email) {
+    showToast("User ID and email are required");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/users", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(payload),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    showToast(result.warning || `User "${payload.id}" created`);
+    closeLLDAPUserModal();
+    await reloadLLDAPData();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteLLDAPUser(userId) {
+  if (adminState.currentUser && adminState.currentUser.username === userId) {
+    showToast("Cannot delete yourself");
+    return;
+  }
+
+  document.getElementById("confirmDeleteMessage").textContent =
+    `Delete LLDAP user "${userId}"? They will no longer be able to sign in.`;
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(
+        `/api/admin/users/${encodeURIComponent(userId)}`,
+        { method: "DELETE", credentials: "include" },
+      );
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("User deleted");
+      closeConfirmDelete();
+      await reloadLLDAPData();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+async function addLLDAPGroup() {
+  const input = document.getElementById("newLLDAPGroupInput");
+  const name = input.value.trim();
+  if (!name) {
+    showToast("Enter a group name");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/groups", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ name }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    input.value = "";
+    showToast(`Group "${name}" created`);
+    await reloadLLDAPData();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteLLDAPGroup(groupId, name) {
+  document.getElementById("confirmDeleteMessage").textContent =
+    `Delete LLDAP group "${name}"? Its members lose any access it grants.`;
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(`/api/admin/groups/${groupId}`, {
+        method: "DELETE",
+        credentials: "include",
+      });
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("Group deleted");
+      closeConfirmDelete();
+      await reloadLLDAPData();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+async function setLLDAPMember(groupId, userId, add) {
+  if (!userId) return;
+  try {
+    const resp = await fetch(
+      `/api/admin/groups/${groupId}/members/${encodeURIComponent(userId)}`,
+      { method: add ? "PUT" : "DELETE", credentials: "include" },
+    );
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast(add ? `Added "${userId}"` : `Removed "${userId}"`);
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+  await reloadLLDAPData();
+}
+
+function addLLDAPMember(groupId, userId) {
+  return setLLDAPMember(groupId, userId, true);
+}
+
+function removeLLDAPMember(groupId, userId) {
+  return setLLDAPMember(groupId, userId, false);
+}
+
 // Local User Management
 function renderLocalUsersList() {
   const container = document.getElementById("localUsersList");
@@ -110,7 +307,7 @@ function renderLocalUsersList() {
                 <div class="admin-item">
                     <div class="admin-item-avatar">${escapeHtml((user.displayName || user.username)[0].toUpperCase())}</div>
                     <div class="admin-item-info">
-                        <div class="admin-item-name">${escapeHtml(user.displayName || user.username)}</div>
+                        <div class="admin-item-name">${escapeHtml(user.displayName || user.username)}${user.lockedUntil ? ` <span class="admin-readonly-badge" style="font-size:10px;" title="Locked until ${escapeHtml(new Date(user.lockedUntil).toLocaleString())}">locked</span>` : ""}${user.disabled ? ' <span class="admin-readonly-badge" style="font-size:10px;" title="Deactivated by SCIM provisioning">deactivated</span>' : ""}</div>
                         <div class="admin-item-meta">${escapeHtml(user.username)}${user.email ? " \u2022 " + escapeHtml(user.email) : ""}</div>
                         ${
                           user.groups && user.groups.length > 0
@@ -130,12 +327,39 @@ function renderLocalUsersList() {
                         }
                     </div>
                     <div class="admin-item-actions">
+                        ${
+                          user.lockedUntil
+                            ? `<button class="admin-action-btn" onclick="unlockLocalUser(${user.id})" title="Unlock">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
+                                <path d="M7 11V7a5 5 0 019.9-1"/>
+                            </svg>
+                        </button>`
+                            : ""
+                        }
+                        ${
+                          adminState.fullAdmin
+                            ? `<button class="admin-action-btn" onclick="startPreview({ username: '${escapeHtml(user.username).replace(/'/g, "\\'")}' })" title="Preview as this user">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M1 12s4-8 11-8 11 8 11 8-4 8-11 8-11-8-11-8z"/>
+                                <circle cx="12" cy="12" r="3"/>
+                            </svg>
+                        </button>`
+                            : ""
+                        }
                         <button class="admin-action-btn" onclick="openPasswordResetModal(${user.id}, '${escapeHtml(user.username).replace(/'/g, "\\'")}')" title="Reset Password">
                             <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
                                 <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
                                 <path d="M7 11V7a5 5 0 0110 0v4"/>
                             </svg>
                         </button>
+                        <button class="admin-action-btn" onclick="openUserSessionsModal(${user.id}, '${escapeHtml(user.username).replace(/'/g, "\\'")}')" title="Sessions">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <rect x="2" y="3" width="20" height="14" rx="2" ry="2"/>
+                                <line x1="8" y1="21" x2="16" y2="21"/>
+                                <line x1="12" y1="17" x2="12" y2="21"/>
+                            </svg>
+                        </button>
                         <button class="admin-action-btn" onclick="openEditLocalUserModal(${user.id})" title="Edit">
                             <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
                                 <path d="M11 4H4a2 2 0 00-2 2v14a2 2 0 002 2h14a2 2 0 002-2v-7"/>
@@ -292,6 +516,16 @@ function renderLocalGroupsList() {
                         <div class="admin-item-meta">${counts[group] || 0} user${counts[group] !== 1 ? "s" : ""}</div>
                     </div>
                     ${badge}
+                    ${
+                      adminState.fullAdmin
+                        ? `<button class="admin-action-btn" onclick="startPreview({ groups: ['${escapeHtml(group).replace(/'/g, "\\'")}'] })" title="Preview as this group">
+                        <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                            <path d="M1 12s4-8 11-8 11 8 11 8-4 8-11 8-11-8-11-8z"/>
+                            <circle cx="12" cy="12" r="3"/>
+                        </svg>
+                    </button>`
+                        : ""
+                    }
                     ${deleteBtn}
                 </div>`;
     })
@@ -477,7 +711,8 @@ function confirmDeleteLocalUser(userId, username) {
   document.getElementById("confirmDeleteModal").classList.add("open");
 }
 
-function openPasswordResetModal(userId, username) {
+function openPasswordResetModal(userId, username, source) {
+  adminState.passwordResetSource = source || "local";
   document.getElementById("passwordResetUserId").value = userId;
   document.getElementById("passwordResetUsername").textContent = username;
   document.getElementById("newPasswordInput").value = "";
@@ -504,20 +739,19 @@ async function resetPassword() {
     return;
   }
 
-  if (newPassword.length < 8) {
-    showToast("Password must be at least 8 characters");
-    return;
-  }
-
   try {
-    const resp = await fetch(`/api/admin/local-users/${userId}/password`, {
+    const url =
+      adminState.passwordResetSource === "lldap"
+        ? `/api/admin/users/${encodeURIComponent(userId)}/password`
+        : `/api/admin/local-users/${userId}/password`;
+    const resp = await fetch(url, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
       credentials: "include",
       body: JSON.stringify({ password: newPassword }),
     });
 
-    if (!resp.ok) throw new Error(await resp.text());
+    if (!resp.ok) throw new Error((await resp.json()).error);
 
     showToast("Password reset successfully");
     closePasswordResetModal();
@@ -525,3 +759,428 @@ async function resetPassword() {
     showToast("Error: " + e.message);
   }
 }
+
+async function unlockLocalUser(userId) {
+  try {
+    const resp = await fetch(`/api/admin/local-users/${userId}/unlock`, {
+      method: "POST",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+
+    showToast("Account unlocked");
+    await reloadLocalUsers();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// View-as preview
+async function startPreview(target) {
+  try {
+    const resp = await fetch("/api/admin/preview", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(target),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    window.location.href = "/";
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// Session management
+async function openUserSessionsModal(userId, username) {
+  document.getElementById("userSessionsUserId").value = userId;
+  document.getElementById("userSessionsUsername").textContent = username;
+  document.getElementById("userSessionsList").innerHTML = "";
+  document.getElementById("userSessionsModal").classList.add("open");
+  await loadUserSessions();
+}
+
+function closeUserSessionsModal() {
+  document.getElementById("userSessionsModal").classList.remove("open");
+}
+
+async function loadUserSessions() {
+  const userId = document.getElementById("userSessionsUserId").value;
+  const container = document.getElementById("userSessionsList");
+  try {
+    const resp = await fetch(`/api/admin/local-users/${userId}/sessions`, {
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    container.innerHTML = renderSessionItems(
+      await resp.json(),
+      "revokeUserSession",
+    );
+  } catch (e) {
+    container.innerHTML = `<div class="admin-empty">${escapeHtml(e.message)}</div>`;
+  }
+}
+
+async function revokeUserSession(sessionId) {
+  const userId = document.getElementById("userSessionsUserId").value;
+  try {
+    const resp = await fetch(
+      `/api/admin/local-users/${userId}/sessions/${sessionId}`,
+      { method: "DELETE", credentials: "include" },
+    );
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Session signed out");
+    await loadUserSessions();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function signOutUserEverywhere() {
+  const userId = document.getElementById("userSessionsUserId").value;
+  const username = document.getElementById("userSessionsUsername").textContent;
+  if (!confirm(`Sign "${username}" out of all devices?`)) return;
+  try {
+    const resp = await fetch(`/api/admin/local-users/${userId}/sessions`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("User signed out everywhere");
+    await loadUserSessions();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// Invitation links
+async function loadInvites() {
+  if (!adminState.isAdmin) return;
+  try {
+    const resp = await fetch("/api/admin/invites", { credentials: "include" });
+    if (resp.ok) {
+      adminState.invites = (await resp.json()) || [];
+      renderInvitesList();
+    }
+  } catch (e) {
+    console.error("Failed to load invites:", e);
+  }
+}
+
+function renderInvitesList() {
+  const container = document.getElementById("invitesList");
+  if (!container) return;
+
+  const invites = adminState.invites || [];
+  if (invites.length === 0) {
+    container.innerHTML =
+      '<div class="admin-empty">No invites yet. Click "New Invite" to create one.</div>';
+    return;
+  }
+
+  const statusText = (inv) => {
+    switch (inv.status) {
+      case "used":
+        return `used by ${escapeHtml(inv.usedBy)}`;
+      case "revoked":
+        return "revoked";
+      case "expired":
+        return "expired";
+      default:
+        return `expires ${escapeHtml(new Date(inv.expiresAt).toLocaleString())}`;
+    }
+  };
+
+  container.innerHTML = invites
+    .map(
+      (inv) => `
+                <div class="admin-item">
+                    <div class="admin-item-icon">
+                        <svg width="20" height="20" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                            <path d="M4 4h16c1.1 0 2 .9 2 2v12c0 1.1-.9 2-2 2H4c-1.1 0-2-.9-2-2V6c0-1.1.9-2 2-2z"/>
+                            <polyline points="22,6 12,13 2,6"/>
+                        </svg>
+                    </div>
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(inv.email || "Anyone with the link")}${inv.status !== "pending" ? ` <span class="admin-readonly-badge" style="font-size:10px;">${escapeHtml(inv.status)}</span>` : ""}</div>
+                        <div class="admin-item-meta">${statusText(inv)}${inv.createdBy ? " • by " + escapeHtml(inv.createdBy) : ""}${inv.note ? " • " + escapeHtml(inv.note) : ""}</div>
+                        ${
+                          inv.groups && inv.groups.length > 0
+                            ? `<div class="admin-item-groups">${inv.groups.map((g) => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join("")}</div>`
+                            : ""
+                        }
+                    </div>
+                    <div class="admin-item-actions">
+                        ${
+                          inv.status === "pending"
+                            ? `<button class="admin-action-btn danger" onclick="revokeInvite(${inv.id})" title="Revoke">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <circle cx="12" cy="12" r="10"/>
+                                <line x1="4.93" y1="4.93" x2="19.07" y2="19.07"/>
+                            </svg>
+                        </button>`
+                            : ""
+                        }
+                    </div>
+                </div>
+            `,
+    )
+    .join("");
+}
+
+async function loadAccessRequests() {
+  try {
+    const resp = await fetch("/api/admin/access-requests", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      const data = await resp.json();
+      adminState.accessRequests = data.requests || [];
+      adminState.groupGrants = data.grants || [];
+      renderAccessRequests();
+    }
+  } catch (e) {
+    console.error("Failed to load access requests:", e);
+  }
+}
+
+function renderAccessRequests() {
+  const requests = document.getElementById("accessRequestsList");
+  const grants = document.getElementById("groupGrantsList");
+  if (!requests || !grants) return;
+
+  requests.innerHTML = adminState.accessRequests.length
+    ? adminState.accessRequests
+        .map(
+          (r) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(r.username)} \u2192 ${escapeHtml(r.app)}</div>
+                        <div class="admin-item-meta">${escapeHtml(new Date(r.createdAt).toLocaleString())}${r.reason ? " \u2022 " + escapeHtml(r.reason) : ""}</div>
+                        <div class="admin-item-groups">${r.groups.map((g) => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join("")}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="approveAccessRequest(${r.id})" title="Approve">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="20 6 9 17 4 12"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="denyAccessRequest(${r.id})" title="Deny">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+        )
+        .join("")
+    : '<div class="admin-empty">No pending requests</div>';
+
+  grants.innerHTML = adminState.groupGrants.length
+    ? adminState.groupGrants
+        .map(
+          (g) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(g.username)} <span class="admin-group-badge">${escapeHtml(g.group)}</span></div>
+                        <div class="admin-item-meta">until ${escapeHtml(new Date(g.expiresAt).toLocaleString())}${g.grantedBy ? " \u2022 by " + escapeHtml(g.grantedBy) : ""}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="revokeGroupGrant(${g.id})" title="Revoke">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <circle cx="12" cy="12" r="10"/>
+                                <line x1="4.93" y1="4.93" x2="19.07" y2="19.07"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+        )
+        .join("")
+    : '<div class="admin-empty">No temporary groups</div>';
+}
+
+// promptGrantDays asks how long a grant should last and returns the number
+// of days, or null if cancelled.
+function promptGrantDays() {
+  const input = prompt("Grant for how many days? (1-365)", "7");
+  if (input === null) return null;
+  const days = parseInt(input, 10);
+  if (!days || days < 1 || days > 365) {
+    showToast("Enter a number of days between 1 and 365");
+    return null;
+  }
+  return days;
+}
+
+async function approveAccessRequest(requestId) {
+  const req = adminState.accessRequests.find((r) => r.id === requestId);
+  if (!req) return;
+  let group = req.groups[0] || "";
+  if (req.groups.length > 1) {
+    group = prompt(
+      `Which group should ${req.username} get? (${req.groups.join(", ")})`,
+      group,
+    );
+    if (group === null) return;
+  }
+  const days = promptGrantDays();
+  if (days === null) return;
+  try {
+    const resp = await fetch(`/api/admin/access-requests/${requestId}/approve`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ group: group.trim(), days }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast(`Granted ${group} to ${req.username} for ${days} days`);
+    await loadAccessRequests();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function denyAccessRequest(requestId) {
+  if (!confirm("Deny this request?")) return;
+  try {
+    const resp = await fetch(`/api/admin/access-requests/${requestId}/deny`, {
+      method: "POST",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Request denied");
+    await loadAccessRequests();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function grantGroupDirectly() {
+  const username = prompt("Username");
+  if (!username || !username.trim()) return;
+  const group = prompt("Group");
+  if (!group || !group.trim()) return;
+  const days = promptGrantDays();
+  if (days === null) return;
+  try {
+    const resp = await fetch("/api/admin/group-grants", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({
+        username: username.trim(),
+        group: group.trim(),
+        days,
+      }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Group granted");
+    await loadAccessRequests();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function revokeGroupGrant(grantId) {
+  if (!confirm("Revoke this temporary group now?")) return;
+  try {
+    const resp = await fetch(`/api/admin/group-grants/${grantId}`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Grant revoked");
+    await loadAccessRequests();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function openCreateInviteModal() {
+  document.getElementById("inviteEmail").value = "";
+  document.getElementById("inviteSendEmail").checked = false;
+  document.getElementById("inviteExpiresHours").value = "72";
+  document.getElementById("inviteNote").value = "";
+  document.getElementById("inviteGroups").innerHTML = getLocalGroups()
+    .map(
+      (group) => `
+                <label class="admin-group-checkbox">
+                    <input type="checkbox" value="${escapeHtml(group)}">
+                    <span class="admin-group-checkbox-label">${escapeHtml(group)}</span>
+                </label>
+            `,
+    )
+    .join("");
+  document.getElementById("inviteFormFields").style.display = "block";
+  document.getElementById("inviteResult").style.display = "none";
+  document.getElementById("inviteSubmitBtn").style.display = "";
+  document.getElementById("inviteCopyBtn").style.display = "none";
+  document.getElementById("inviteModal").classList.add("open");
+}
+
+function closeInviteModal() {
+  document.getElementById("inviteModal").classList.remove("open");
+  document.getElementById("inviteLink").value = "";
+}
+
+async function createInvite() {
+  const email = document.getElementById("inviteEmail").value.trim();
+  const sendEmail = document.getElementById("inviteSendEmail").checked;
+  const expiresInHours =
+    parseInt(document.getElementById("inviteExpiresHours").value, 10) || 0;
+  const note = document.getElementById("inviteNote").value.trim();
+  const groups = Array.from(
+    document.querySelectorAll('#inviteGroups input[type="checkbox"]:checked'),
+  ).map((cb) => cb.value);
+
+  if (sendEmail && !email) {
+    showToast("Enter an email address to send the invite");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/invites", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ email, groups, note, expiresInHours, sendEmail }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    const data = await resp.json();
+
+    document.getElementById("inviteLink").value =
+      data.url || window.location.origin + data.path;
+    document.getElementById("inviteFormFields").style.display = "none";
+    document.getElementById("inviteResult").style.display = "block";
+    document.getElementById("inviteSubmitBtn").style.display = "none";
+    document.getElementById("inviteCopyBtn").style.display = "";
+    showToast(data.emailed ? "Invite emailed" : "Invite created");
+    await loadInvites();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function copyInviteLink() {
+  const link = document.getElementById("inviteLink").value;
+  navigator.clipboard.writeText(link).then(() => {
+    showToast("Invite link copied to clipboard");
+  });
+}
+
+async function revokeInvite(inviteId) {
+  try {
+    const resp = await fetch(`/api/admin/invites/${inviteId}`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+
+    showToast("Invite revoked");
+    await loadInvites();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
@@ -3,6 +3,8 @@
 // Admin Functions
 let adminState = {
   isAdmin: false,
+  fullAdmin: false,
+  roles: [],
   lldapEnabled: false,
   localAuthEnabled: false,
   authMode: "authelia",
@@ -23,36 +25,60 @@ let adminState = {
   filteredDiscoveredApps: [],
 };
 
+function hasAdminRole(role) {
+  return adminState.roles.includes(role);
+}
+
+// Hide admin sections the user has no role for. Elements list the roles
+// that can see them in data-admin-roles.
+function applyAdminRoles() {
+  document.querySelectorAll("[data-admin-roles]").forEach((el) => {
+    const allowed = el.dataset.adminRoles.split(" ").some(hasAdminRole);
+    el.style.display = allowed ? "" : "none";
+  });
+  const active = document.querySelector(".admin-subtab.active");
+  if (active && active.style.display === "none") {
+    const first = Array.from(document.querySelectorAll(".admin-subtab")).find(
+      (t) => t.style.display !== "none",
+    );
+    if (first) first.click();
+  }
+}
+
 async function loadAdminData() {
   if (!adminState.isAdmin) return;
 
   try {
     // Load system config first
-    await loadSystemConfig();
+    if (hasAdminRole("system_admin")) {
+      await loadSystemConfig();
+    }
 
     // Load apps configuration
-    const [appsResp, categoriesResp, iconsResp] = await Promise.all([
-      fetch("/api/admin/config/apps", { credentials: "include" }),
-      fetch("/api/admin/config/categories", { credentials: "include" }),
-      fetch("/api/admin/config/icons", { credentials: "include" }),
-    ]);
+    if (hasAdminRole("app_editor")) {
+      const [appsResp, categoriesResp, iconsResp] = await Promise.all([
+        fetch("/api/admin/config/apps", { credentials: "include" }),
+        fetch("/api/admin/config/categories", { credentials: "include" }),
+        fetch("/api/admin/config/icons", { credentials: "include" }),
+      ]);
 
-    if (appsResp.ok) {
-      adminState.apps = await appsResp.json();
-      renderAppsList();
-    }
+      if (appsResp.ok) {
+        adminState.apps = await appsResp.json();
+        renderAppsList();
+      }
 
-    if (categoriesResp.ok) {
-      adminState.categories = await categoriesResp.json();
-      renderCategoriesList();
-    }
+      if (categoriesResp.ok) {
+        adminState.categories = await categoriesResp.json();
+        renderCategoriesList();
+      }
 
-    if (iconsResp.ok) {
-      adminState.icons = await iconsResp.json();
+      if (iconsResp.ok) {
+        adminState.icons = await iconsResp.json();
+      }
     }
 
     // Load LLDAP data if enabled
-    if (adminState.lldapEnabled) {
+    if (adminState.lldapEnabled && hasAdminRole("user_manager")) {
       document.getElementById("lldapUsersSection").style.display = "";
       document.getElementById("lldapDivider").style.display = "";
       document.getElementById("lldapGroupsSection").style.display = "";
@@ -74,7 +100,7 @@ async function loadAdminData() {
     }
 
     // Load local users if local auth is enabled
-    if (adminState.localAuthEnabled) {
+    if (adminState.localAuthEnabled && hasAdminRole("user_manager")) {
       const localUsersResp = await fetch("/api/admin/local-users", {
         credentials: "include",
       });
@@ -98,6 +124,11 @@ async function loadAdminData() {
       renderLocalGroupsList();
     }
 
+    if (hasAdminRole("user_manager")) {
+      loadInvites();
+      loadAccessRequests();
+    }
+
     // Build unified groups list from all sources (LLDAP, local users,
     // app configs, discovered apps, custom localStorage groups)
     const allGroupNames = new Set();
@@ -135,26 +166,28 @@ async function loadAdminData() {
       .sort()
       .map((name) => ({ displayName: name }));
 
-    // Load Docker discovery status
-    await loadDockerDiscoveryStatus();
+    if (hasAdminRole("discovery_manager")) {
+      // Load Docker discovery status
+      await loadDockerDiscoveryStatus();
 
-    // Load Traefik discovery status
-    await loadTraefikDiscoveryStatus();
+      // Load Traefik discovery status
+      await loadTraefikDiscoveryStatus();
 
-    // Load Nginx discovery status
-    await loadNginxDiscoveryStatus();
+      // Load Nginx discovery status
+      await loadNginxDiscoveryStatus();
 
-    // Load NPM discovery status
-    await loadNPMDiscoveryStatus();
+      // Load NPM discovery status
+      await loadNPMDiscoveryStatus();
 
-    // Load Caddy discovery status
-    await loadCaddyDiscoveryStatus();
+      // Load Caddy discovery status
+      await loadCaddyDiscoveryStatus();
 
-    // Load Unraid discovery status
-    await loadUnraidDiscoveryStatus();
+      // Load Unraid discovery status
+      await loadUnraidDiscoveryStatus();
 
-    // Load discovered apps for management
-    await loadDiscoveredAppsData();
+      // Load discovered apps for management
+      await loadDiscoveredAppsData();
+    }
   } catch (e) {
     console.error("Failed to load admin data:", e);
   }
@@ -244,18 +277,75 @@ async function loadSystemConfig() {
       // General settings
       document.getElementById("systemSessionDays").value =
         config.sessionDays || 7;
+      document.getElementById("systemMaxSessions").value =
+        config.maxSessions ?? 0;
       document.getElementById("systemCookieSecure").checked =
         config.cookieSecure !== false;
+      document.getElementById("systemCookieDomain").value =
+        config.cookieDomain || "";
 
       // Security settings
       document.getElementById("systemAdminGroup").value =
         config.adminGroup || "admin";
+      document.getElementById("systemRoleAppEditorGroups").value =
+        config.roleAppEditorGroups || "";
+      document.getElementById("systemRoleDiscoveryManagerGroups").value =
+        config.roleDiscoveryManagerGroups || "";
+      document.getElementById("systemRoleUserManagerGroups").value =
+        config.roleUserManagerGroups || "";
+      document.getElementById("systemRoleSystemAdminGroups").value =
+        config.roleSystemAdminGroups || "";
+      document.getElementById("systemRoleAuditorGroups").value =
+        config.roleAuditorGroups || "";
+      document.getElementById("systemAuditRetentionDays").value =
+        config.auditRetentionDays ?? 0;
+      document.getElementById("systemPasswordMinLength").value =
+        config.passwordMinLength || 8;
+      document.getElementById("systemPasswordCheckBreached").checked =
+        config.passwordCheckBreached !== false;
+      document.getElementById("systemPasswordBreachedList").value =
+        config.passwordBreachedList || "";
+      document.getElementById("systemPasswordHistory").value =
+        config.passwordHistory ?? 0;
+      document.getElementById("systemLockoutThreshold").value =
+        config.lockoutThreshold ?? 5;
+      document.getElementById("systemLockoutMinutes").value =
+        config.lockoutMinutes || 15;
+
+      // Email
+      document.getElementById("systemPasswordResetEnabled").checked =
+        config.passwordResetEnabled || false;
+      document.getElementById("systemPublicURL").value = config.publicUrl || "";
+      document.getElementById("smtpHost").value = config.smtpHost || "";
+      document.getElementById("smtpPort").value = config.smtpPort || "";
+      document.getElementById("smtpSecurity").value =
+        config.smtpSecurity || "starttls";
+      document.getElementById("smtpUsername").value = config.smtpUsername || "";
+      document.getElementById("smtpPassword").value = "";
+      document.getElementById("smtpFrom").value = config.smtpFrom || "";
 
       // Auth providers
       document.getElementById("systemProxyAuth").checked =
         config.proxyAuthEnabled || false;
       document.getElementById("systemTrustedProxies").value =
         config.trustedProxies || "";
+      document.getElementById("proxyAuthProfile").value =
+        config.proxyAuthProfile || "authelia";
+      document.getElementById("proxyUserHeader").value =
+        config.proxyUserHeader || "";
+      document.getElementById("proxyGroupsHeader").value =
+        config.proxyGroupsHeader || "";
+      document.getElementById("proxyNameHeader").value =
+        config.proxyNameHeader || "";
+      document.getElementById("proxyEmailHeader").value =
+        config.proxyEmailHeader || "";
+      document.getElementById("proxyGroupsSeparator").value =
+        config.proxyGroupsSeparator || "";
+      document.getElementById("proxyJwks").value = config.proxyJwks || "";
+      document.getElementById("proxyJwtIssuer").value =
+        config.proxyJwtIssuer || "";
+      document.getElementById("proxyJwtAudience").value =
+        config.proxyJwtAudience || "";
       document.getElementById("systemLocalAuth").checked =
         config.localAuthEnabled || false;
       document.getElementById("systemLDAPAuth").checked =
@@ -297,14 +387,36 @@ async function loadSystemConfig() {
         config.oidcScopes || "openid profile email groups";
       document.getElementById("oidcGroupsClaim").value =
         config.oidcGroupsClaim || "groups";
+      document.getElementById("oidcLogoutEnabled").checked =
+        config.oidcLogoutEnabled || false;
+      document.getElementById("oidcGroupMapping").value =
+        config.oidcGroupMapping || "";
+      document.getElementById("admissionEmailDomains").value =
+        config.admissionEmailDomains || "";
+      document.getElementById("admissionRequiredGroups").value =
+        config.admissionRequiredGroups || "";
+      document.getElementById("admissionAllowList").value =
+        config.admissionAllowList || "";
+      document.getElementById("admissionDenyList").value =
+        config.admissionDenyList || "";
+      document.getElementById("admissionPreprovisionedOnly").checked =
+        config.admissionPreprovisionedOnly || false;
+      document.getElementById("systemAccessRequestsEnabled").checked =
+        config.accessRequestsEnabled || false;
+      document.getElementById("systemGuestModeEnabled").checked =
+        config.guestModeEnabled || false;
+      document.getElementById("systemGuestCategories").value =
+        config.guestCategories || "";
 
       // Update UI visibility
       toggleTrustedProxiesSection();
+      toggleProxyProfileFields();
       updateProxyAuthWarning();
       toggleLDAPSection();
       toggleOIDCSection();
       toggleAPIKeySection();
       toggleLocalAuthSection();
+      applyConfigEnvLocks(config.envLocked || {});
 
       systemConfigDirty = false;
       updateSaveButtonState();
@@ -313,12 +425,43 @@ async function loadSystemConfig() {
       if (config.apiKeyEnabled) {
         loadAPIKeys();
       }
+      if (config.oidcAuthEnabled) {
+        loadOIDCProviders();
+      }
+      loadLLDAPConfig();
+      loadSCIMConfig();
+      loadNetworkPolicies();
+      loadDisplayTokens();
+      loadEncryptionStatus();
+      loadOIDCClients();
     }
   } catch (e) {
     console.error("Failed to load system config:", e);
   }
 }
 
+// Settings set from DASHGATE_* (or legacy) environment variables cannot be
+// changed here, so disable them and name the variable.
+function applyConfigEnvLocks(locked) {
+  document.querySelectorAll("[data-config-key]").forEach((el) => {
+    const envVar = locked[el.dataset.configKey];
+    if (!envVar || el.dataset.envVar) return;
+    el.disabled = true;
+    el.dataset.envVar = envVar;
+    el.title = `Set by the ${envVar} environment variable`;
+
+    const row = el.closest(".settings-row, .admin-form-group");
+    const label = row && row.querySelector(".settings-label, label");
+    if (label) {
+      const badge = document.createElement("span");
+      badge.className = "env-locked-badge";
+      badge.textContent = envVar;
+      badge.title = "Set by an environment variable";
+      label.appendChild(badge);
+    }
+  });
+}
+
 function markSystemConfigDirty() {
   systemConfigDirty = true;
   updateSaveButtonState();
@@ -347,6 +490,23 @@ function toggleTrustedProxiesSection() {
   updateProxyAuthWarning();
 }
 
+function toggleProxyProfileFields() {
+  const profile = document.getElementById("proxyAuthProfile").value;
+  document.getElementById("proxyCustomHeaders").style.display =
+    profile === "custom" ? "block" : "none";
+  document.getElementById("proxyJWTFields").style.display =
+    profile === "cloudflare" ? "block" : "none";
+}
+
+// Custom header overrides only apply to the "custom" profile; other profiles
+// use their built-in header names.
+function customProxyHeader(id) {
+  if (document.getElementById("proxyAuthProfile").value !== "custom") {
+    return "";
+  }
+  return document.getElementById(id).value.trim();
+}
+
 function updateProxyAuthWarning() {
   const warning = document.getElementById("proxyAuthWarning");
   if (!warning) return;
@@ -417,6 +577,17 @@ async function saveSystemSettings() {
     }
   }
 
+  // Validate proxy assertion settings
+  const proxyAuthProfile = document.getElementById("proxyAuthProfile").value;
+  if (
+    proxyAuthEnabled &&
+    proxyAuthProfile === "cloudflare" &&
+    !document.getElementById("proxyJwks").value.trim()
+  ) {
+    showToast("Cloudflare Access requires a JWKS URL or file path");
+    return;
+  }
+
   // Validate LDAP settings if enabled
   if (ldapAuthEnabled) {
     const ldapServer = document.getElementById("ldapServer").value.trim();
@@ -444,13 +615,67 @@ async function saveSystemSettings() {
   const payload = {
     sessionDays:
       parseInt(document.getElementById("systemSessionDays").value) || 7,
+    maxSessions:
+      parseInt(document.getElementById("systemMaxSessions").value) || 0,
     cookieSecure: document.getElementById("systemCookieSecure").checked,
+    cookieDomain: document.getElementById("systemCookieDomain").value.trim(),
     adminGroup:
       document.getElementById("systemAdminGroup").value.trim() || "admin",
+    roleAppEditorGroups: document
+      .getElementById("systemRoleAppEditorGroups")
+      .value.trim(),
+    roleDiscoveryManagerGroups: document
+      .getElementById("systemRoleDiscoveryManagerGroups")
+      .value.trim(),
+    roleUserManagerGroups: document
+      .getElementById("systemRoleUserManagerGroups")
+      .value.trim(),
+    roleSystemAdminGroups: document
+      .getElementById("systemRoleSystemAdminGroups")
+      .value.trim(),
+    roleAuditorGroups: document
+      .getElementById("systemRoleAuditorGroups")
+      .value.trim(),
+    auditRetentionDays:
+      parseInt(document.getElementById("systemAuditRetentionDays").value) ||
+      0,
+    passwordMinLength:
+      parseInt(document.getElementById("systemPasswordMinLength").value) || 8,
+    passwordCheckBreached: document.getElementById(
+      "systemPasswordCheckBreached",
+    ).checked,
+    passwordBreachedList: document
+      .getElementById("systemPasswordBreachedList")
+      .value.trim(),
+    passwordHistory:
+      parseInt(document.getElementById("systemPasswordHistory").value) || 0,
+    lockoutThreshold:
+      parseInt(document.getElementById("systemLockoutThreshold").value) || 0,
+    lockoutMinutes:
+      parseInt(document.getElementById("systemLockoutMinutes").value) || 15,
+    passwordResetEnabled: document.getElementById(
+      "systemPasswordResetEnabled",
+    ).checked,
+    publicUrl: document.getElementById("systemPublicURL").value.trim(),
+    smtpHost: document.getElementById("smtpHost").value.trim(),
+    smtpPort: parseInt(document.getElementById("smtpPort").value) || 0,
+    smtpSecurity: document.getElementById("smtpSecurity").value,
+    smtpUsername: document.getElementById("smtpUsername").value.trim(),
+    smtpPassword: document.getElementById("smtpPassword").value,
+    smtpFrom: document.getElementById("smtpFrom").value.trim(),
     proxyAuthEnabled,
     trustedProxies: document
       .getElementById("systemTrustedProxies")
       .value.trim(),
+    proxyAuthProfile,
+    proxyUserHeader: customProxyHeader("proxyUserHeader"),
+    proxyGroupsHeader: customProxyHeader("proxyGroupsHeader"),
+    proxyNameHeader: customProxyHeader("proxyNameHeader"),
+    proxyEmailHeader: customProxyHeader("proxyEmailHeader"),
+    proxyGroupsSeparator: customProxyHeader("proxyGroupsSeparator"),
+    proxyJwks: document.getElementById("proxyJwks").value.trim(),
+    proxyJwtIssuer: document.getElementById("proxyJwtIssuer").value.trim(),
+    proxyJwtAudience: document.getElementById("proxyJwtAudience").value.trim(),
     localAuthEnabled,
     ldapAuthEnabled,
     oidcAuthEnabled,
@@ -485,6 +710,27 @@ async function saveSystemSettings() {
       "openid profile email groups",
     oidcGroupsClaim:
       document.getElementById("oidcGroupsClaim").value.trim() || "groups",
+    oidcLogoutEnabled: document.getElementById("oidcLogoutEnabled").checked,
+    oidcGroupMapping: document.getElementById("oidcGroupMapping").value,
+    admissionEmailDomains: document
+      .getElementById("admissionEmailDomains")
+      .value.trim(),
+    admissionRequiredGroups: document
+      .getElementById("admissionRequiredGroups")
+      .value.trim(),
+    admissionAllowList: document.getElementById("admissionAllowList").value,
+    admissionDenyList: document.getElementById("admissionDenyList").value,
+    admissionPreprovisionedOnly: document.getElementById(
+      "admissionPreprovisionedOnly",
+    ).checked,
+    accessRequestsEnabled: document.getElementById(
+      "systemAccessRequestsEnabled",
+    ).checked,
+    guestModeEnabled: document.getElementById("systemGuestModeEnabled")
+      .checked,
+    guestCategories: document
+      .getElementById("systemGuestCategories")
+      .value.trim(),
   };
 
   try {
@@ -500,6 +746,7 @@ async function saveSystemSettings() {
     // Clear password fields after save
     document.getElementById("ldapBindPassword").value = "";
     document.getElementById("oidcClientSecret").value = "";
+    document.getElementById("smtpPassword").value = "";
 
     systemConfigDirty = false;
     updateSaveButtonState();
@@ -522,6 +769,39 @@ async function saveSystemSettings() {
   }
 }
 
+// Sends a test email with the saved SMTP settings to the signed-in admin
+async function sendTestEmail() {
+  const result = document.getElementById("smtpTestResult");
+  if (systemConfigDirty) {
+    result.textContent = "Save settings first";
+    result.style.color = "var(--orange)";
+    return;
+  }
+  const to = prompt("Send a test email to:", "");
+  if (to === null) return;
+  result.textContent = "Sending...";
+  result.style.color = "var(--text-secondary)";
+  try {
+    const resp = await fetch("/api/admin/smtp/test", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ to: to.trim() }),
+    });
+    const data = await resp.json();
+    if (resp.ok) {
+      result.textContent = "Test email sent";
+      result.style.color = "var(--green)";
+    } else {
+      result.textContent = data.error || "Failed to send";
+      result.style.color = "var(--red)";
+    }
+  } catch (e) {
+    result.textContent = "Test failed: " + e.message;
+    result.style.color = "var(--red)";
+  }
+}
+
 // API Key Management
 async function loadAPIKeys() {
   try {
@@ -548,11 +828,12 @@ function renderAPIKeysList() {
       (key) => `
                 <div class="api-key-item">
                     <div class="api-key-info">
-                        <div class="api-key-name">${escapeHtml(key.name)}</div>
+                        <div class="api-key-name">${escapeHtml(key.name)}${key.personal ? ' <span class="admin-readonly-badge" style="font-size:10px;">personal</span>' : ""}</div>
                         <div class="api-key-meta">
                             <span class="api-key-prefix">${escapeHtml(key.keyPrefix)}...</span>
                             User: ${escapeHtml(key.username)} |
                             ${key.expiresAt ? `Expires: ${new Date(key.expiresAt).toLocaleDateString()}` : "Never expires"}
+                            ${key.allowedNetworks ? ` | From: ${escapeHtml(key.allowedNetworks)}` : ""}
                         </div>
                     </div>
                     <div class="admin-item-actions">
@@ -577,6 +858,7 @@ function openCreateAPIKeyModal() {
   document.getElementById("apiKeyUsername").value = "";
   document.getElementById("apiKeyGroups").value = "";
   document.getElementById("apiKeyExpiry").value = "365";
+  document.getElementById("apiKeyAllowedNetworks").value = "";
   document.getElementById("apiKeyModal").classList.add("open");
 }
 
@@ -589,6 +871,9 @@ async function createAPIKey() {
   const username = document.getElementById("apiKeyUsername").value.trim();
   const groupsStr = document.getElementById("apiKeyGroups").value.trim();
   const expiryDays = parseInt(document.getElementById("apiKeyExpiry").value);
+  const allowedNetworks = document
+    .getElementById("apiKeyAllowedNetworks")
+    .value.trim();
 
   if (!name || !username) {
     showToast("Name and username are required");
@@ -607,7 +892,13 @@ async function createAPIKey() {
       method: "POST",
       headers: { "Content-Type": "application/json" },
       credentials: "include",
-      body: JSON.stringify({ name, username, groups, expiryDays }),
+      body: JSON.stringify({
+        name,
+        username,
+        groups,
+        expiryDays,
+        allowedNetworks,
+      }),
     });
 
     if (!resp.ok) throw new Error(await resp.text());
@@ -654,6 +945,720 @@ function confirmDeleteAPIKey(id, name) {
   document.getElementById("confirmDeleteModal").classList.add("open");
 }
 
+// Additional OIDC providers
+async function loadOIDCProviders() {
+  try {
+    const resp = await fetch("/api/admin/oidc-providers", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      adminState.oidcProviders = (await resp.json()) || [];
+      renderOIDCProvidersList();
+    }
+  } catch (e) {
+    console.error("Failed to load OIDC providers:", e);
+  }
+}
+
+function renderOIDCProvidersList() {
+  const container = document.getElementById("oidcProvidersList");
+  if (!container) return;
+
+  const providers = adminState.oidcProviders || [];
+  if (providers.length === 0) {
+    container.innerHTML =
+      '<div class="admin-empty">No additional providers.</div>';
+    return;
+  }
+
+  const status = (p) => {
+    if (!p.enabled) return "disabled";
+    return p.active ? "" : "unreachable";
+  };
+
+  container.innerHTML = providers
+    .map(
+      (p) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(p.displayName)}${status(p) ? ` <span class="admin-readonly-badge" style="font-size:10px;">${status(p)}</span>` : ""}</div>
+                        <div class="admin-item-meta">${escapeHtml(p.id)} • ${escapeHtml(p.issuer)}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="openOIDCProviderModal('${escapeHtml(p.id)}')" title="Edit">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M11 4H4a2 2 0 00-2 2v14a2 2 0 002 2h14a2 2 0 002-2v-7"/>
+                                <path d="M18.5 2.5a2.121 2.121 0 013 3L12 15l-4 1 1-4 9.5-9.5z"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="confirmDeleteOIDCProvider('${escapeHtml(p.id)}')" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+    )
+    .join("");
+}
+
+function openOIDCProviderModal(id) {
+  const p = (adminState.oidcProviders || []).find((x) => x.id === id) || {
+    enabled: true,
+    sortOrder: 0,
+  };
+  adminState.editingOIDCProvider = id || null;
+
+  document.getElementById("oidcProviderModalTitle").textContent = id
+    ? "Edit OIDC Provider"
+    : "Add OIDC Provider";
+  document.getElementById("oidcProviderID").value = p.id || "";
+  document.getElementById("oidcProviderID").disabled = !!id;
+  document.getElementById("oidcProviderDisplayName").value =
+    p.displayName || "";
+  document.getElementById("oidcProviderIssuer").value = p.issuer || "";
+  document.getElementById("oidcProviderClientID").value = p.clientID || "";
+  document.getElementById("oidcProviderClientSecret").value = "";
+  document.getElementById("oidcProviderRedirectURL").value =
+    p.redirectURL || "";
+  document.getElementById("oidcProviderScopes").value = p.scopes || "";
+  document.getElementById("oidcProviderGroupsClaim").value =
+    p.groupsClaim || "";
+  document.getElementById("oidcProviderGroupMapping").value =
+    p.groupMapping || "";
+  document.getElementById("oidcProviderSortOrder").value = p.sortOrder || 0;
+  document.getElementById("oidcProviderEnabled").checked = p.enabled;
+  document.getElementById("oidcProviderModal").classList.add("open");
+}
+
+function closeOIDCProviderModal() {
+  document.getElementById("oidcProviderModal").classList.remove("open");
+  document.getElementById("oidcProviderClientSecret").value = "";
+}
+
+async function saveOIDCProvider() {
+  const editing = adminState.editingOIDCProvider;
+  const payload = {
+    id: document.getElementById("oidcProviderID").value.trim(),
+    displayName: document
+      .getElementById("oidcProviderDisplayName")
+      .value.trim(),
+    issuer: document.getElementById("oidcProviderIssuer").value.trim(),
+    clientID: document.getElementById("oidcProviderClientID").value.trim(),
+    clientSecret: document.getElementById("oidcProviderClientSecret").value,
+    redirectURL: document
+      .getElementById("oidcProviderRedirectURL")
+      .value.trim(),
+    scopes: document.getElementById("oidcProviderScopes").value.trim(),
+    groupsClaim: document
+      .getElementById("oidcProviderGroupsClaim")
+      .value.trim(),
+    groupMapping: document.getElementById("oidcProviderGroupMapping").value,
+    sortOrder:
+      parseInt(document.getElementById("oidcProviderSortOrder").value) || 0,
+    enabled: document.getElementById("oidcProviderEnabled").checked,
+  };
+
+  if (
+    !payload.id ||
+    !payload.displayName ||
+    !payload.issuer ||
+    !payload.clientID
+  ) {
+    showToast("ID, display name, issuer and client ID are required");
+    return;
+  }
+
+  try {
+    const resp = await fetch(
+      editing
+        ? `/api/admin/oidc-providers/${encodeURIComponent(editing)}`
+        : "/api/admin/oidc-providers",
+      {
+        method: editing ? "PUT" : "POST",
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify(payload),
+      },
+    );
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    showToast(result.warning || "Provider saved");
+    closeOIDCProviderModal();
+    loadOIDCProviders();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteOIDCProvider(id) {
+  document.getElementById("confirmDeleteMessage").textContent =
+    `Delete OIDC provider "${id}"? Users can no longer sign in with it.`;
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(
+        `/api/admin/oidc-providers/${encodeURIComponent(id)}`,
+        { method: "DELETE", credentials: "include" },
+      );
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("Provider deleted");
+      closeConfirmDelete();
+      loadOIDCProviders();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+// Network policies
+async function loadNetworkPolicies() {
+  try {
+    const resp = await fetch("/api/admin/network-policies", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      const data = await resp.json();
+      adminState.networkPolicies = data.policies || [];
+      document.getElementById("networkPolicyYourIP").textContent =
+        data.yourIP || "";
+      renderNetworkPoliciesList();
+    }
+  } catch (e) {
+    console.error("Failed to load network policies:", e);
+  }
+}
+
+function renderNetworkPoliciesList() {
+  const container = document.getElementById("networkPoliciesList");
+  if (!container) return;
+
+  const policies = adminState.networkPolicies || [];
+  if (policies.length === 0) {
+    container.innerHTML =
+      '<div class="admin-empty">No policies. Every network is allowed.</div>';
+    return;
+  }
+
+  container.innerHTML = policies
+    .map(
+      (p) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${p.kind === "group" ? "Group " : ""}${escapeHtml(p.target)}</div>
+                        <div class="admin-item-meta">${escapeHtml(p.networks)}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="confirmDeleteNetworkPolicy(${p.id})" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+    )
+    .join("");
+}
+
+async function addNetworkPolicy() {
+  const payload = {
+    kind: document.getElementById("networkPolicyKind").value,
+    target: document.getElementById("networkPolicyTarget").value.trim(),
+    networks: document.getElementById("networkPolicyNetworks").value.trim(),
+  };
+  if (!payload.target || !payload.networks) {
+    showToast("Route or group and networks are required");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/network-policies", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(payload),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    showToast("Policy added");
+    document.getElementById("networkPolicyTarget").value = "";
+    document.getElementById("networkPolicyNetworks").value = "";
+    loadNetworkPolicies();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteNetworkPolicy(id) {
+  document.getElementById("confirmDeleteMessage").textContent =
+    "Delete this network policy? Its route or group will be reachable from any network.";
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(`/api/admin/network-policies/${id}`, {
+        method: "DELETE",
+        credentials: "include",
+      });
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("Policy deleted");
+      closeConfirmDelete();
+      loadNetworkPolicies();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+// Display tokens
+async function loadDisplayTokens() {
+  try {
+    const resp = await fetch("/api/admin/display-tokens", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      adminState.displayTokens = (await resp.json()) || [];
+      renderDisplayTokensList();
+    }
+  } catch (e) {
+    console.error("Failed to load display tokens:", e);
+  }
+}
+
+function renderDisplayTokensList() {
+  const container = document.getElementById("displayTokensList");
+  if (!container) return;
+
+  const tokens = adminState.displayTokens || [];
+  if (tokens.length === 0) {
+    container.innerHTML = '<div class="admin-empty">No display links</div>';
+    return;
+  }
+
+  container.innerHTML = tokens
+    .map(
+      (t) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(t.name)}</div>
+                        <div class="admin-item-meta">${escapeHtml(t.tokenPrefix)}... \u2022 ${escapeHtml(t.allowedNetworks || "any network")} \u2022 last used ${escapeHtml(t.lastUsedAt ? new Date(t.lastUsedAt).toLocaleString() : "never")}</div>
+                        <div class="admin-item-groups">${t.groups.map((g) => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join("")}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="confirmDeleteDisplayToken(${t.id})" title="Revoke">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+    )
+    .join("");
+}
+
+async function addDisplayToken() {
+  const payload = {
+    name: document.getElementById("displayTokenName").value.trim(),
+    groups: splitList(document.getElementById("displayTokenGroups").value),
+    allowedNetworks: document
+      .getElementById("displayTokenNetworks")
+      .value.trim(),
+  };
+  if (!payload.name || !payload.groups.length) {
+    showToast("Name and at least one group are required");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/display-tokens", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(payload),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    document.getElementById("displayTokenLink").value =
+      result.url || window.location.origin + result.path;
+    document.getElementById("displayTokenLinkGroup").style.display = "";
+    document.getElementById("displayTokenName").value = "";
+    document.getElementById("displayTokenGroups").value = "";
+    document.getElementById("displayTokenNetworks").value = "";
+    loadDisplayTokens();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteDisplayToken(id) {
+  document.getElementById("confirmDeleteMessage").textContent =
+    "Revoke this display link? Screens using it stop showing apps.";
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(`/api/admin/display-tokens/${id}`, {
+        method: "DELETE",
+        credentials: "include",
+      });
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("Display link revoked");
+      closeConfirmDelete();
+      loadDisplayTokens();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+// Encryption key status and rotation
+async function loadEncryptionStatus() {
+  try {
+    const resp = await fetch("/api/admin/encryption", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      renderEncryptionStatus(await resp.json());
+    }
+  } catch (e) {
+    console.error("Failed to load encryption status:", e);
+  }
+}
+
+function renderEncryptionStatus(status) {
+  const container = document.getElementById("encryptionStatus");
+  if (!container) return;
+
+  if (!status.keyId) {
+    container.innerHTML =
+      '<div class="admin-empty">Encryption is not configured</div>';
+    return;
+  }
+  const source = {
+    env: "ENCRYPTION_KEY",
+    file: "ENCRYPTION_KEY_FILE",
+    database: "generated, stored in the database",
+  }[status.source];
+  const oldKeys = status.oldKeyIds.length
+    ? ` \u2022 old keys ${escapeHtml(status.oldKeyIds.join(", "))}`
+    : "";
+  container.innerHTML = `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">Key ${escapeHtml(status.keyId)}</div>
+                        <div class="admin-item-meta">${escapeHtml(source || status.source)} \u2022 ${status.values} encrypted values, ${status.pending} on older keys${oldKeys}</div>
+                    </div>
+                </div>
+            `;
+}
+
+async function rotateEncryptionKey() {
+  if (
+    !confirm(
+      "Re-encrypt all stored secrets with a new key? Back up the database first.",
+    )
+  )
+    return;
+
+  try {
+    const resp = await fetch("/api/admin/encryption/rotate", {
+      method: "POST",
+      credentials: "include",
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    renderEncryptionStatus(result);
+    if (result.failed) {
+      showToast(
+        `${result.failed} values could not be decrypted; old keys are kept`,
+      );
+    } else {
+      showToast(`Encryption key is now ${result.keyId}`);
+    }
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// OpenID provider clients
+async function loadOIDCClients() {
+  try {
+    const resp = await fetch("/api/admin/oidc-clients", {
+      credentials: "include",
+    });
+    if (resp.ok) {
+      const data = await resp.json();
+      adminState.oidcClients = data.clients || [];
+      document.getElementById("oidcClientsIssuer").textContent =
+        data.issuer || "set a public URL to enable";
+      renderOIDCClientsList();
+    }
+  } catch (e) {
+    console.error("Failed to load OIDC clients:", e);
+  }
+}
+
+function renderOIDCClientsList() {
+  const container = document.getElementById("oidcClientsList");
+  if (!container) return;
+
+  const clients = adminState.oidcClients || [];
+  if (clients.length === 0) {
+    container.innerHTML = '<div class="admin-empty">No clients.</div>';
+    return;
+  }
+
+  container.innerHTML = clients
+    .map(
+      (c) => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(c.name)} <code>${escapeHtml(c.clientID)}</code></div>
+                        <div class="admin-item-meta">${c.redirectURIs.map(escapeHtml).join(", ")} &middot; ${c.allowedGroups.length ? escapeHtml(c.allowedGroups.join(", ")) : "everyone"}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="rotateOIDCClientSecret('${escapeHtml(c.clientID)}')" title="New secret">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="23 4 23 10 17 10"/>
+                                <path d="M20.49 15a9 9 0 11-2.12-9.36L23 10"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="confirmDeleteOIDCClient('${escapeHtml(c.clientID)}')" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `,
+    )
+    .join("");
+}
+
+function showOIDCClientSecret(secret) {
+  document.getElementById("oidcClientSecret").value = secret;
+  document.getElementById("oidcClientSecretGroup").style.display = "";
+}
+
+function splitList(value) {
+  return value
+    .split(",")
+    .map((s) => s.trim())
+    .filter(Boolean);
+}
+
+async function addOIDCClient() {
+  const payload = {
+    clientID: document.getElementById("oidcClientID").value.trim(),
+    name: document.getElementById("oidcClientName").value.trim(),
+    redirectURIs: splitList(
+      document.getElementById("oidcClientRedirectURIs").value,
+    ),
+    allowedGroups: splitList(document.getElementById("oidcClientGroups").value),
+  };
+  if (!payload.clientID || !payload.name || !payload.redirectURIs.length) {
+    showToast("Client ID, name and a redirect URI are required");
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/oidc-clients", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(payload),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    showOIDCClientSecret(result.clientSecret);
+    showToast("Client added");
+    for (const id of [
+      "oidcClientID",
+      "oidcClientName",
+      "oidcClientRedirectURIs",
+      "oidcClientGroups",
+    ]) {
+      document.getElementById(id).value = "";
+    }
+    loadOIDCClients();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function rotateOIDCClientSecret(clientID) {
+  if (
+    !confirm(
+      "Replace the secret of this client? The app cannot sign users in until it is updated.",
+    )
+  )
+    return;
+  try {
+    const resp = await fetch(
+      `/api/admin/oidc-clients/${encodeURIComponent(clientID)}/secret`,
+      { method: "POST", credentials: "include" },
+    );
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+    showOIDCClientSecret(result.clientSecret);
+    showToast("New secret generated");
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+function confirmDeleteOIDCClient(clientID) {
+  document.getElementById("confirmDeleteMessage").textContent =
+    "Delete this client? Its users will no longer be able to sign in to it with DashGate.";
+  adminState.deleteCallback = async () => {
+    try {
+      const resp = await fetch(
+        `/api/admin/oidc-clients/${encodeURIComponent(clientID)}`,
+        { method: "DELETE", credentials: "include" },
+      );
+      if (!resp.ok) throw new Error((await resp.json()).error);
+      showToast("Client deleted");
+      closeConfirmDelete();
+      loadOIDCClients();
+    } catch (e) {
+      showToast("Error: " + e.message);
+    }
+  };
+  document.getElementById("confirmDeleteModal").classList.add("open");
+}
+
+// LLDAP connection
+async function loadLLDAPConfig() {
+  try {
+    const resp = await fetch("/api/admin/lldap-config", {
+      credentials: "include",
+    });
+    if (!resp.ok) return;
+    const cfg = await resp.json();
+
+    document.getElementById("lldapEnabled").checked = cfg.enabled;
+    document.getElementById("lldapURL").value = cfg.url || "";
+    document.getElementById("lldapAdminUsername").value = cfg.username || "";
+    document.getElementById("lldapAdminPassword").value = "";
+    document.getElementById("lldapAdminPassword").placeholder = cfg.hasPassword
+      ? "Leave blank to keep the current password"
+      : "Password";
+
+    [
+      "lldapEnabled",
+      "lldapURL",
+      "lldapAdminUsername",
+      "lldapAdminPassword",
+      "lldapSaveBtn",
+    ].forEach((id) => {
+      const el = document.getElementById(id);
+      el.disabled = cfg.envOverride || !!el.dataset.envVar;
+    });
+    document.getElementById("lldapEnvNotice").style.display = cfg.envOverride
+      ? ""
+      : "none";
+
+    const status = document.getElementById("lldapConfigStatus");
+    if (cfg.configured) {
+      status.textContent = cfg.connected ? "connected" : "unreachable";
+      status.title = cfg.lastError || "";
+      status.style.display = "";
+    } else {
+      status.style.display = "none";
+    }
+  } catch (e) {
+    console.error("Failed to load LLDAP config:", e);
+  }
+}
+
+async function saveLLDAPConfig() {
+  const payload = {
+    enabled: document.getElementById("lldapEnabled").checked,
+    url: document.getElementById("lldapURL").value.trim(),
+    username: document.getElementById("lldapAdminUsername").value.trim(),
+    password: document.getElementById("lldapAdminPassword").value,
+  };
+
+  try {
+    const resp = await fetch("/api/admin/lldap-config", {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(payload),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    showToast(result.warning || "LLDAP settings saved");
+    loadLLDAPConfig();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// SCIM provisioning
+async function loadSCIMConfig() {
+  try {
+    const resp = await fetch("/api/admin/scim", { credentials: "include" });
+    if (!resp.ok) return;
+    const cfg = await resp.json();
+    document.getElementById("scimEnabled").checked = cfg.enabled;
+    document.getElementById("scimBaseURL").textContent =
+      "Base URL: " + cfg.baseUrl;
+    document.getElementById("scimTokenBtnLabel").textContent = cfg.hasToken
+      ? "Regenerate Token"
+      : "Generate Token";
+  } catch (e) {
+    console.error("Failed to load SCIM config:", e);
+  }
+}
+
+async function saveSCIMConfig(regenerateToken) {
+  if (
+    regenerateToken &&
+    document.getElementById("scimTokenBtnLabel").textContent ===
+      "Regenerate Token" &&
+    !confirm(
+      "Replace the SCIM token? Your identity provider will stop syncing until it is updated.",
+    )
+  ) {
+    return;
+  }
+
+  try {
+    const resp = await fetch("/api/admin/scim", {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({
+        enabled: document.getElementById("scimEnabled").checked,
+        regenerateToken,
+      }),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+
+    if (result.token) {
+      document.getElementById("scimToken").value = result.token;
+      document.getElementById("scimTokenGroup").style.display = "";
+    }
+    showToast("SCIM settings saved");
+    loadSCIMConfig();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
 // Backup/Restore
 async function downloadBackup() {
   try {
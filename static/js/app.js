@@ -543,7 +543,11 @@ async function checkAdminStatus() {
     const resp = await fetch("/api/admin/check", { credentials: "include" });
     if (resp.ok) {
       const data = await resp.json();
-      adminState.isAdmin = data.isAdmin;
+      // isAdmin opens the admin panel; roles decide which parts are shown
+      adminState.fullAdmin = data.isAdmin;
+      adminState.roles = data.roles || [];
+      adminState.isAdmin = adminState.roles.length > 0;
+      applyAdminRoles();
       adminState.lldapEnabled = data.lldapEnabled;
       adminState.localAuthEnabled = data.localAuthEnabled;
       adminState.authMode = data.authMode || "authelia";
@@ -599,16 +603,33 @@ function addLogoutButton() {
 
 async function logout() {
   try {
-    await fetch("/api/auth/logout", { method: "POST", credentials: "include" });
+    const resp = await fetch("/api/auth/logout", {
+      method: "POST",
+      credentials: "include",
+    });
+    const data = await resp.json().catch(() => ({}));
     if ("serviceWorker" in navigator && navigator.serviceWorker.controller) {
       navigator.serviceWorker.controller.postMessage({ type: "CLEAR_CACHES" });
     }
-    window.location.href = "/login";
+    window.location.href = data.redirect || "/login";
   } catch (e) {
     showToast("Logout failed");
   }
 }
 
+async function exitPreview() {
+  try {
+    const resp = await fetch("/api/admin/preview", {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    window.location.href = "/";
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
 // PWA Service Worker Registration
 if ("serviceWorker" in navigator) {
   window.addEventListener("load", () => {
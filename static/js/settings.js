@@ -39,6 +39,8 @@ function closeSettings() {
 }
 
 function initSettingsModal() {
+  showIdentityLinkResult();
+
   // Tab switching
   document.querySelectorAll(".settings-tab").forEach((tab) => {
     tab.addEventListener("click", () => {
@@ -487,6 +489,362 @@ async function loadProfile() {
   } else {
     passwordSection.style.display = "none";
   }
+
+  loadMySessions();
+  loadMyIdentities();
+  loadMyAPIKeys();
+  loadMyAccessRequests();
+}
+
+// Your Devices
+async function loadMySessions() {
+  const container = document.getElementById("profileSessionsList");
+  try {
+    const resp = await fetch("/api/user/sessions", { credentials: "include" });
+    if (resp.status === 403) {
+      container.innerHTML =
+        '<div class="admin-empty">Your sign-in is managed by your proxy</div>';
+      return;
+    }
+    if (!resp.ok) throw new Error("Failed to load sessions");
+    container.innerHTML = renderSessionItems(
+      await resp.json(),
+      "revokeMySession",
+    );
+  } catch (e) {
+    container.innerHTML =
+      '<div class="admin-empty">Failed to load sessions</div>';
+  }
+}
+
+async function revokeMySession(sessionId) {
+  try {
+    const resp = await fetch(`/api/user/sessions/${sessionId}`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Session signed out");
+    loadMySessions();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// API Keys
+async function loadMyAPIKeys() {
+  const section = document.getElementById("profileAPIKeysSection");
+  const container = document.getElementById("profileAPIKeysList");
+  document.getElementById("profileAPIKeyNew").style.display = "none";
+  try {
+    const resp = await fetch("/api/user/api-keys", { credentials: "include" });
+    if (resp.status === 404 || resp.status === 403) {
+      section.style.display = "none";
+      return;
+    }
+    if (!resp.ok) throw new Error("Failed to load API keys");
+    const data = await resp.json();
+    section.style.display = "";
+
+    const soon = Date.now() + 7 * 24 * 60 * 60 * 1000;
+    container.innerHTML = data.keys.length
+      ? data.keys
+          .map((k) => {
+            const expires = k.expiresAt ? new Date(k.expiresAt) : null;
+            const expiry = expires
+              ? `expires ${expires.toLocaleDateString()}`
+              : "never expires";
+            return `
+      <div class="admin-item">
+        <div class="admin-item-info">
+          <div class="admin-item-name">${escapeHtml(k.name)}${expires && expires.getTime() < soon ? ' <span class="admin-readonly-badge" style="font-size:10px;">expires soon</span>' : ""}</div>
+          <div class="admin-item-meta">${escapeHtml(k.keyPrefix)}... \u2022 ${escapeHtml((k.groups || []).join(", ") || "no groups")} \u2022 ${expiry} \u2022 last used ${escapeHtml(k.lastUsedAt ? new Date(k.lastUsedAt).toLocaleString() : "never")}</div>
+        </div>
+        <div class="admin-item-actions">
+          <button class="admin-action-btn" onclick="rotateMyAPIKey(${k.id})" title="Rotate">
+            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+              <path d="M23 4v6h-6"/><path d="M20.49 15a9 9 0 11-2.12-9.36L23 10"/>
+            </svg>
+          </button>
+          <button class="admin-action-btn danger" onclick="deleteMyAPIKey(${k.id})" title="Revoke">
+            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+              <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
+            </svg>
+          </button>
+        </div>
+      </div>`;
+          })
+          .join("")
+      : '<div class="admin-empty">No API keys</div>';
+  } catch (e) {
+    container.innerHTML = '<div class="admin-empty">Failed to load API keys</div>';
+  }
+}
+
+function showMyNewAPIKey(key) {
+  document.getElementById("profileAPIKeyValue").value = key;
+  document.getElementById("profileAPIKeyNew").style.display = "";
+}
+
+async function createMyAPIKey() {
+  const nameInput = document.getElementById("profileAPIKeyName");
+  const groupsStr = document.getElementById("profileAPIKeyGroups").value.trim();
+  const body = {
+    name: nameInput.value.trim(),
+    expiresIn: parseInt(document.getElementById("profileAPIKeyExpiry").value),
+    allowedNetworks: document
+      .getElementById("profileAPIKeyNetworks")
+      .value.trim(),
+  };
+  if (groupsStr) {
+    body.groups = groupsStr
+      .split(",")
+      .map((g) => g.trim())
+      .filter((g) => g);
+  }
+  if (!body.name) {
+    showToast("Name is required");
+    return;
+  }
+  try {
+    const resp = await fetch("/api/user/api-keys", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(body),
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+    nameInput.value = "";
+    await loadMyAPIKeys();
+    showMyNewAPIKey(result.key);
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function rotateMyAPIKey(keyId) {
+  if (!confirm("Replace this key? Apps using the current key stop working."))
+    return;
+  try {
+    const resp = await fetch(`/api/user/api-keys/${keyId}/rotate`, {
+      method: "POST",
+      credentials: "include",
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error);
+    await loadMyAPIKeys();
+    showMyNewAPIKey(result.key);
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function deleteMyAPIKey(keyId) {
+  if (!confirm("Revoke this API key?")) return;
+  try {
+    const resp = await fetch(`/api/user/api-keys/${keyId}`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("API key revoked");
+    loadMyAPIKeys();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// Access Requests
+async function loadMyAccessRequests() {
+  const section = document.getElementById("profileAccessRequestsSection");
+  try {
+    const resp = await fetch("/api/user/access-requests", {
+      credentials: "include",
+    });
+    if (resp.status === 404 || resp.status === 403) {
+      section.style.display = "none";
+      return;
+    }
+    if (!resp.ok) throw new Error("Failed to load access requests");
+    const data = await resp.json();
+    section.style.display = "";
+
+    document.getElementById("profileAccessGrantsList").innerHTML = data.grants
+      .map(
+        (g) => `
+      <div class="admin-item">
+        <div class="admin-item-info">
+          <div class="admin-item-name"><span class="admin-group-badge">${escapeHtml(g.group)}</span></div>
+          <div class="admin-item-meta">until ${escapeHtml(new Date(g.expiresAt).toLocaleString())}</div>
+        </div>
+      </div>`,
+      )
+      .join("");
+    document.getElementById("profileAccessRequestsList").innerHTML =
+      data.requests
+        .slice(0, 5)
+        .map(
+          (r) => `
+      <div class="admin-item">
+        <div class="admin-item-info">
+          <div class="admin-item-name">${escapeHtml(r.app)} <span class="admin-readonly-badge" style="font-size:10px;">${escapeHtml(r.status)}</span></div>
+          <div class="admin-item-meta">requested ${escapeHtml(new Date(r.createdAt).toLocaleString())}${r.reason ? " \u2022 " + escapeHtml(r.reason) : ""}</div>
+        </div>
+      </div>`,
+        )
+        .join("");
+
+    const select = document.getElementById("profileAccessRequestApp");
+    select.innerHTML = data.apps.length
+      ? data.apps
+          .map(
+            (a) =>
+              `<option value="${escapeHtml(a.name)}">${escapeHtml(a.name)}</option>`,
+          )
+          .join("")
+      : '<option value="">No apps to request</option>';
+  } catch (e) {
+    section.style.display = "none";
+  }
+}
+
+async function requestAppAccess() {
+  const app = document.getElementById("profileAccessRequestApp").value;
+  const reasonInput = document.getElementById("profileAccessRequestReason");
+  if (!app) {
+    showToast("There are no apps to request");
+    return;
+  }
+  try {
+    const resp = await fetch("/api/user/access-requests", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ app, reason: reasonInput.value.trim() }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    reasonInput.value = "";
+    showToast("Access requested");
+    loadMyAccessRequests();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// Sign-in Methods
+async function loadMyIdentities() {
+  const container = document.getElementById("profileIdentitiesList");
+  const links = document.getElementById("profileIdentityLinks");
+  document.getElementById("profileLDAPLinkForm").style.display = "none";
+  try {
+    const resp = await fetch("/api/user/identities", {
+      credentials: "include",
+    });
+    if (resp.status === 404) {
+      document.getElementById("profileIdentitiesSection").style.display =
+        "none";
+      return;
+    }
+    if (!resp.ok) throw new Error("Failed to load sign-in methods");
+    const data = await resp.json();
+    document.getElementById("profileIdentitiesSection").style.display = "";
+
+    const names = {};
+    data.providers.forEach((p) => (names[p.provider] = p.displayName));
+    container.innerHTML = data.identities.length
+      ? data.identities
+          .map(
+            (i) => `
+      <div class="admin-item">
+        <div class="admin-item-info">
+          <div class="admin-item-name">${escapeHtml(names[i.provider] || i.provider)}</div>
+          <div class="admin-item-meta">${escapeHtml(i.email || i.subject)} \u2022 last used ${escapeHtml(i.lastLoginAt ? new Date(i.lastLoginAt).toLocaleString() : "never")}</div>
+        </div>
+        <div class="admin-item-actions">
+          <button class="admin-action-btn danger" onclick="unlinkMyIdentity(${i.id})" title="Unlink">
+            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+              <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
+            </svg>
+          </button>
+        </div>
+      </div>`,
+          )
+          .join("")
+      : '<div class="admin-empty">No linked sign-in methods</div>';
+
+    const linked = new Set(data.identities.map((i) => i.provider));
+    links.innerHTML = data.providers
+      .filter((p) => !linked.has(p.provider))
+      .map((p) =>
+        p.linkURL
+          ? `<a class="settings-btn" href="${escapeHtml(p.linkURL)}">Link ${escapeHtml(p.displayName)}</a>`
+          : `<button class="settings-btn" onclick="showLDAPLinkForm()">Link ${escapeHtml(p.displayName)}</button>`,
+      )
+      .join(" ");
+  } catch (e) {
+    container.innerHTML =
+      '<div class="admin-empty">Failed to load sign-in methods</div>';
+  }
+}
+
+function showLDAPLinkForm() {
+  document.getElementById("profileLDAPLinkForm").style.display = "";
+  document.getElementById("profileLDAPUsername").focus();
+}
+
+async function linkLDAPIdentity() {
+  const username = document.getElementById("profileLDAPUsername").value.trim();
+  const passwordInput = document.getElementById("profileLDAPPassword");
+  try {
+    const resp = await fetch("/api/user/identities/ldap", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ username, password: passwordInput.value }),
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    passwordInput.value = "";
+    showToast("LDAP account linked");
+    loadMyIdentities();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+async function unlinkMyIdentity(identityId) {
+  if (!confirm("Unlink this sign-in method from your account?")) return;
+  try {
+    const resp = await fetch(`/api/user/identities/${identityId}`, {
+      method: "DELETE",
+      credentials: "include",
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error);
+    showToast("Sign-in method unlinked");
+    loadMyIdentities();
+  } catch (e) {
+    showToast("Error: " + e.message);
+  }
+}
+
+// Report the outcome of linking an identity provider, which returns here
+// with ?identity=linked or ?identity=conflict
+function showIdentityLinkResult() {
+  const params = new URLSearchParams(window.location.search);
+  const result = params.get("identity");
+  if (!result) return;
+  if (result === "linked") {
+    showToast("Sign-in method linked");
+  } else if (result === "conflict") {
+    showToast("That account is already linked to another user");
+  }
+  params.delete("identity");
+  const query = params.toString();
+  history.replaceState(
+    null,
+    "",
+    window.location.pathname + (query ? "?" + query : ""),
+  );
 }
 
 async function saveProfile() {
@@ -527,8 +885,8 @@ async function changePassword() {
     showToast("Enter your current password");
     return;
   }
-  if (!newPassword || newPassword.length < 8) {
-    showToast("New password must be at least 8 characters");
+  if (!newPassword) {
+    showToast("Enter a new password");
     return;
   }
   if (newPassword !== confirmPassword) {
@@ -560,8 +918,16 @@ async function changePassword() {
 // Logout function
 async function logoutUser() {
   try {
-    await fetch("/api/auth/logout", { method: "POST", credentials: "include" });
-    window.location.reload();
+    const resp = await fetch("/api/auth/logout", {
+      method: "POST",
+      credentials: "include",
+    });
+    const data = await resp.json().catch(() => ({}));
+    if (data.redirect) {
+      window.location.href = data.redirect;
+    } else {
+      window.location.reload();
+    }
   } catch (e) {
     showToast("Logout failed");
   }
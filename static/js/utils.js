@@ -51,6 +51,44 @@
             setTimeout(() => toast.classList.remove('show'), 2500);
         }
 
+        // Summarize a User-Agent string as "Browser on OS" for session lists
+        function describeUserAgent(ua) {
+            if (!ua) return 'Unknown device';
+            const browsers = [['Edg/', 'Edge'], ['OPR/', 'Opera'], ['Firefox/', 'Firefox'], ['Chrome/', 'Chrome'], ['Safari/', 'Safari'], ['curl/', 'curl']];
+            const systems = [['Windows', 'Windows'], ['Android', 'Android'], ['iPhone', 'iOS'], ['iPad', 'iPadOS'], ['Mac OS X', 'macOS'], ['Linux', 'Linux']];
+            const browser = (browsers.find(([needle]) => ua.includes(needle)) || [null, 'Unknown browser'])[1];
+            const os = (systems.find(([needle]) => ua.includes(needle)) || [null, ''])[1];
+            return os ? `${browser} on ${os}` : browser;
+        }
+
+        // Render sessions returned by the session APIs; onRevoke is the name of a
+        // global function called with the session ID
+        function renderSessionItems(sessions, onRevoke) {
+            if (!sessions || sessions.length === 0) {
+                return '<div class="admin-empty">No active sessions</div>';
+            }
+            return sessions.map(s => {
+                const lastSeen = s.lastSeenAt ? new Date(s.lastSeenAt).toLocaleString() : 'never';
+                return `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name" title="${escapeHtml(s.userAgent)}">${escapeHtml(describeUserAgent(s.userAgent))}${s.current ? ' <span class="admin-group-badge">This device</span>' : ''}</div>
+                        <div class="admin-item-meta">${escapeHtml(s.ip || 'unknown IP')} \u2022 ${escapeHtml(s.authSource || 'unknown')} \u2022 last seen ${escapeHtml(lastSeen)}</div>
+                        <div class="admin-item-meta">Signed in ${escapeHtml(new Date(s.createdAt).toLocaleString())}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="${onRevoke}(${s.id})" title="Sign out this session">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M9 21H5a2 2 0 01-2-2V5a2 2 0 012-2h4"/>
+                                <polyline points="16 17 21 12 16 7"/>
+                                <line x1="21" y1="12" x2="9" y2="12"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>`;
+            }).join('');
+        }
+
         function scrollToTop() {
             window.scrollTo({ top: 0, behavior: 'smooth' });
         }